@@ -1,9 +1,13 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/AndrewDonelson/go-basic-blockchain/sdk"
 )
@@ -11,10 +15,14 @@ import (
 func main() {
 	// Parse command-line flags
 	err := sdk.Args.Parse()
+	if command := sdk.Args.Command(); len(command) > 0 {
+		os.Exit(runCommand(command))
+	}
 	if err == sdk.ErrNoArgs {
 		fmt.Println("No arguments provided. Using default configuration.")
 		// You might want to print some brief usage information here
 		fmt.Println("Use -h or --help for usage information.")
+		fmt.Printf("The node wallet passphrase is read from the %s environment variable.\n", sdk.NodeWalletPassphraseEnv)
 	} else if err != nil {
 		fmt.Printf("Error parsing arguments: %v\n", err)
 		os.Exit(1)
@@ -25,22 +33,106 @@ func main() {
 
 	// Apply command-line flags to node options
 	nodeOpts.IsSeed = sdk.Args.GetBool("seed")
-	nodeOpts.SeedAddress = sdk.Args.GetString("seed-address")
+	nodeOpts.SeedAddresses = sdk.ParseSeedAddresses(sdk.Args.GetString("seed-address"))
 
 	// Create the node
-	err = sdk.NewNode(nodeOpts)
+	node, err := sdk.NewNode(nodeOpts)
 	if err != nil {
 		log.Fatalf("Failed to create node: %v", err)
-		os.Exit(1)
 	}
 
-	// Get the node instance and run it
-	node := sdk.GetNode()
-	if node == nil {
-		fmt.Println("Failed to get node instance")
-		os.Exit(1)
-	}
+	// Flush state and stop services when interrupted
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		err := node.Cleanup()
+		if err != nil {
+			log.Printf("Error during shutdown: %v", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}()
 
 	fmt.Println("Starting node...")
 	node.Run()
 }
+
+// runCommand runs a command given after the flags instead of starting the node, and returns the exit code.
+func runCommand(command []string) int {
+	switch command[0] {
+	case "verify-block":
+		if len(command) < 2 || len(command) > 3 {
+			fmt.Println("Usage: verify-block <file> [previous-hash]")
+			return 2
+		}
+
+		previousHash := ""
+		if len(command) == 3 {
+			previousHash = command[2]
+		}
+
+		err := sdk.VerifyBlockFile(command[1], previousHash)
+		if err != nil {
+			fmt.Printf("Block %s is invalid: %v\n", command[1], err)
+			return 1
+		}
+		fmt.Printf("Block %s is valid\n", command[1])
+		return 0
+	case "verify-balance":
+		if len(command) != 2 {
+			fmt.Println("Usage: verify-balance <address>")
+			return 2
+		}
+		return verifyBalance(command[1])
+	default:
+		fmt.Printf("Unknown command: %s\n", command[0])
+		fmt.Println("Use -h or --help for usage information.")
+		return 2
+	}
+}
+
+// verifyBalance checks the balance held in the wallet saved for address against the chain, and returns the exit
+// code. The wallet's passphrase is read from stdin.
+func verifyBalance(address string) int {
+	cfg := sdk.NewConfig()
+	sdk.SetAddressPrefix(cfg.AddressPrefix)
+	err := sdk.NewLocalStorage(cfg.DataPath)
+	if err != nil {
+		fmt.Printf("Failed to open the data path: %v\n", err)
+		return 1
+	}
+
+	// Look the wallet up before the chain, so that a chain is not created for a wallet that doesn't exist
+	wallet, err := sdk.GetWalletByAddress(address)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	fmt.Print("Wallet passphrase: ")
+	passphrase, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && passphrase == "" {
+		fmt.Printf("Failed to read the passphrase: %v\n", err)
+		return 1
+	}
+	err = wallet.Unlock(strings.TrimSpace(passphrase))
+	if err != nil {
+		fmt.Printf("Failed to unlock wallet %s: %v\n", address, err)
+		return 1
+	}
+
+	bc := sdk.NewBlockchain(cfg)
+	if bc == nil {
+		fmt.Println("Failed to load the blockchain")
+		return 1
+	}
+
+	ok, err := wallet.VerifyBalanceProof(bc)
+	if !ok {
+		fmt.Printf("Balance of wallet %s has drifted: %v\n", address, err)
+		return 1
+	}
+	fmt.Printf("Balance of wallet %s matches the chain: %f\n", address, wallet.GetBalance())
+	return 0
+}
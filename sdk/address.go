@@ -30,11 +30,23 @@
 // Usage of this file's components is essential for proper address management
 // throughout the blockchain application, ensuring consistency and security in
 // address handling and representation
+//
+// Wallet addresses are the SHA-256 hash of the public key, encoded Base58Check style: the configured
+// address prefix followed by the Base58 encoding of the hash and a 4 byte checksum. The checksum covers
+// the prefix, so a typo or an address from another chain fails ValidateAddress. Legacy addresses, the
+// plain hex encoding of the hash, are still accepted and can be converted with MigrateAddress.
 package sdk
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
 )
 
 // Address represents a blockchain address.
@@ -76,3 +88,179 @@ func (a *Address) GetAddressHash() string {
 	hash := sha256.Sum256([]byte(a.PrependedAddress))
 	return hex.EncodeToString(hash[:])
 }
+
+// Address format errors
+var (
+	ErrAddressPrefix   = errors.New("address has the wrong prefix")
+	ErrAddressChecksum = errors.New("address checksum mismatch")
+)
+
+// addressHashLength is the length in bytes of the public key hash held in an address.
+const addressHashLength = 32
+
+// addressChecksumLength is the length in bytes of the checksum appended to the hash.
+const addressChecksumLength = 4
+
+// base58Alphabet is the Bitcoin Base58 alphabet, which leaves out characters that are easily confused.
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var (
+	currentAddressPrefix = addressPrefix
+	addressPrefixMutex   sync.RWMutex
+)
+
+// SetAddressPrefix sets the prefix used for new addresses and required by ValidateAddress. It is set from
+// Config.AddressPrefix when the blockchain is created.
+func SetAddressPrefix(prefix string) {
+	addressPrefixMutex.Lock()
+	defer addressPrefixMutex.Unlock()
+	currentAddressPrefix = prefix
+}
+
+// AddressPrefix returns the prefix used for new addresses.
+func AddressPrefix() string {
+	addressPrefixMutex.RLock()
+	defer addressPrefixMutex.RUnlock()
+	return currentAddressPrefix
+}
+
+// validAddressPrefix returns true if the prefix only contains ASCII letters and digits, as addresses are
+// also used as wallet file names.
+func validAddressPrefix(prefix string) bool {
+	for _, c := range prefix {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// EncodeAddress encodes a public key hash as an address with the current prefix and a checksum.
+func EncodeAddress(hash []byte) string {
+	prefix := AddressPrefix()
+	payload := append(append([]byte{}, hash...), addressChecksum(prefix, hash)...)
+	return prefix + base58Encode(payload)
+}
+
+// DecodeAddress returns the public key hash held in an address. Legacy hex addresses are decoded as is,
+// otherwise the prefix and checksum are verified.
+func DecodeAddress(address string) ([]byte, error) {
+	if isLegacyAddress(address) {
+		return hex.DecodeString(address)
+	}
+
+	prefix := AddressPrefix()
+	if !strings.HasPrefix(address, prefix) {
+		return nil, fmt.Errorf("%w: expected %q", ErrAddressPrefix, prefix)
+	}
+
+	payload, err := base58Decode(strings.TrimPrefix(address, prefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode address: %v", err)
+	}
+
+	if len(payload) != addressHashLength+addressChecksumLength {
+		return nil, fmt.Errorf("expected address length: %d, got: %d", addressHashLength+addressChecksumLength, len(payload))
+	}
+
+	hash := payload[:addressHashLength]
+	if !bytes.Equal(payload[addressHashLength:], addressChecksum(prefix, hash)) {
+		return nil, ErrAddressChecksum
+	}
+
+	return hash, nil
+}
+
+// publicKeyHash returns the hash an address encodes for the PEM encoded public key, the SHA-256 of its PKIX
+// encoding.
+func publicKeyHash(publicPEM string) ([]byte, error) {
+	block, _ := pem.Decode([]byte(publicPEM))
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block containing public key")
+	}
+	key, err := parsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing public key: %v", err)
+	}
+	der, err := marshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(der)
+	return hash[:], nil
+}
+
+// MigrateAddress converts a legacy hex address to the current address format. Addresses that are already
+// in the current format are returned unchanged.
+func MigrateAddress(address string) (string, error) {
+	hash, err := DecodeAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return EncodeAddress(hash), nil
+}
+
+// isLegacyAddress returns true if the address is the plain hex encoding of a public key hash, the format
+// used before addresses carried a prefix and checksum.
+func isLegacyAddress(address string) bool {
+	if len(address) != hex.EncodedLen(addressHashLength) {
+		return false
+	}
+	_, err := hex.DecodeString(address)
+	return err == nil
+}
+
+// addressChecksum returns the first bytes of the double SHA-256 of the prefix and hash.
+func addressChecksum(prefix string, hash []byte) []byte {
+	first := sha256.Sum256(append([]byte(prefix), hash...))
+	second := sha256.Sum256(first[:])
+	return second[:addressChecksumLength]
+}
+
+// base58Encode encodes data in Base58, keeping leading zero bytes as leading '1' characters.
+func base58Encode(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+
+	var encoded []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		encoded = append(encoded, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, base58Alphabet[0])
+	}
+
+	// Digits were produced least significant first
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
+
+// base58Decode decodes a Base58 string produced by base58Encode.
+func base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+
+	for _, c := range s {
+		digit := strings.IndexRune(base58Alphabet, c)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+
+	decoded := n.Bytes()
+	leading := 0
+	for leading < len(s) && s[leading] == base58Alphabet[0] {
+		leading++
+	}
+	return append(make([]byte, leading), decoded...), nil
+}
@@ -55,3 +55,61 @@ func TestGetAddressHash(t *testing.T) {
 
 	assert.Equal(t, expectedHashString, hash)
 }
+
+func TestEncodeAddressRoundTrip(t *testing.T) {
+	hash := sha256.Sum256([]byte("public key"))
+
+	address := EncodeAddress(hash[:])
+	assert.True(t, len(address) > len(AddressPrefix()))
+	assert.Equal(t, AddressPrefix(), address[:len(AddressPrefix())])
+	assert.NoError(t, ValidateAddress(address))
+
+	decoded, err := DecodeAddress(address)
+	assert.NoError(t, err)
+	assert.Equal(t, hash[:], decoded)
+}
+
+func TestValidateAddressWrongChecksum(t *testing.T) {
+	hash := sha256.Sum256([]byte("public key"))
+	address := EncodeAddress(hash[:])
+
+	// Change the last character, as a typo would
+	last := address[len(address)-1]
+	typo := byte('2')
+	if last == typo {
+		typo = '3'
+	}
+	address = address[:len(address)-1] + string(typo)
+
+	assert.ErrorIs(t, ValidateAddress(address), ErrAddressChecksum)
+}
+
+func TestValidateAddressWrongPrefix(t *testing.T) {
+	hash := sha256.Sum256([]byte("public key"))
+	address := EncodeAddress(hash[:])
+
+	SetAddressPrefix("OTHER")
+	defer SetAddressPrefix(addressPrefix)
+
+	assert.ErrorIs(t, ValidateAddress(address), ErrAddressPrefix)
+
+	// The same hash under the new prefix has a different checksum, so swapping the prefix is not enough
+	swapped := "OTHER" + address[len(addressPrefix):]
+	assert.ErrorIs(t, ValidateAddress(swapped), ErrAddressChecksum)
+}
+
+func TestMigrateAddress(t *testing.T) {
+	assert.NoError(t, ValidateAddress(testAddr), "legacy hex addresses remain valid")
+
+	migrated, err := MigrateAddress(testAddr)
+	assert.NoError(t, err)
+	assert.NoError(t, ValidateAddress(migrated))
+
+	hash, err := DecodeAddress(migrated)
+	assert.NoError(t, err)
+	assert.Equal(t, testAddr, hex.EncodeToString(hash))
+
+	again, err := MigrateAddress(migrated)
+	assert.NoError(t, err)
+	assert.Equal(t, migrated, again)
+}
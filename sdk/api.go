@@ -3,13 +3,20 @@
 package sdk
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io/ioutil"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -39,31 +46,59 @@ type ErrorResponse struct {
 //     Produces:
 //     - application/json
 //
+// Any JSON response is indented when the request has ?pretty=true.
+//
 // Endpoints:
 //     	GET		/														# Home
 //     	GET		/version												# Version
 //     	GET		/info													# General Chain/Project Info
+//     	GET		/info/config/schema										# Config fields with their types, defaults and validation rules
 //     	GET		/health													# Health
+//     	GET		/metrics												# Request counts and latencies per endpoint, in the Prometheus text format
+//     	GET		/node													# This node's ID, P2P address, version, seed status and peer count
+//     	GET		/explorer/blocks/{index}								# HTML page of a block header and its transactions
+//     	POST	/rpc													# Batch of RPC style calls (getBlock, getTransaction, getBalance, ...)
 //     	POST	/consensus/p2p											# P2P Broadcast Message to 1/3, then 2/3, then all nodes
-//     	POST	/consensus/tx											# Incomming TX from another node that needs to be validated and returned
-//     	POST	/consensus/block										# Incomming Block from another node that needs to be validated and returned
+//     	POST	/consensus/register										# Register a peer over HTTP, returns the node list to bootstrap from
+//     	POST	/consensus/tx											# Incomming TX from another node that needs to be validated and returned (Idempotency-Key for safe retries)
+//     	POST	/consensus/block										# Incomming Block from another node that needs to be validated and added to the chain
 //     	GET		/blockchain												# Blockchain state
-//     	GET		/blockchain/blocks										# Browse all blocks (with pagination)
+//     	GET		/blockchain/tip											# Summary of the latest block for light clients
+//     	GET		/blockchain/health/detailed								# Confirmation times, mempool wait and block fullness of recently mined blocks
+//     	POST	/blockchain/validate									# Validate the chain and report the result
+//     	GET		/blockchain/richlist?limit=N							# Top addresses by balance
+//     	POST	/blockchain/balances									# Balances of a JSON array of addresses, as a map of address to balance
+//     	GET		/blockchain/fees/estimate?fee=F							# Estimated wait before a transaction paying F is mined
+//     	GET		/blockchain/next-block/preview							# The block that would be mined next from the mempool, without mining it
+//     	GET		/blockchain/protocols									# Registered transaction protocols with their required fields and fee rules
+//     	GET		/blockchain/blocks										# Browse all blocks (with pagination, or ?cursor= for stable iteration)
+//     	GET		/blockchain/blocks/stream?from=N&to=M					# Stream a range of blocks as newline delimited JSON
+//     	GET		/blockchain/blocks/waitfor?after=N&timeout=S			# Long-poll for the block after index N
+//     	GET		/blockchain/blocks/at?timestamp=T						# The block that was the tip at time T (RFC 3339)
 //     	GET		/blockchain/blocks/{index}								# View a block
+//     	GET		/blockchain/blocks/{index}/header						# Header, index and hash of a block without its transactions
+//     	GET		/blockchain/blocks/{index}/protocols					# Number of transactions in a block for each protocol
+//     	GET		/blockchain/blocks/{index}/raw							# The block in the binary codec, with its hash in X-Block-Hash
 //     	GET		/blockchain/blocks/{index}/transactions					# Browse all transactions in a block (with pagination)
 //     	GET		/blockchain/blocks/{index}/transactions/{id}			# View a transaction in a block
 //		GET		/blockchain/blocks/{index}/transactions/{protocol}		# Browse all transactions in a block by protocol
-//	 	GET		/blockchain/wallets										# Browse all wallets (with pagination)
+//	 	GET		/blockchain/wallets										# Browse all wallets (with pagination, ?tag= to filter by tag)
 //	 	GET		/blockchain/wallets/new									# Create a new wallet
 //	 	GET		/blockchain/wallets/{id}								# View a wallet
 //	 	POST	/blockchain/wallets/{id}								# Update a wallet (Name, tags, etc, Owser Only)
 //	 	GET		/blockchain/wallets/{id}/balance						# View a wallet balance
+//	 	GET		/blockchain/wallets/{id}/qr								# QR code of a wallet address (PNG, or ?format=svg)
+//	 	POST	/blockchain/wallets/{id}/export							# Encrypted keystore of a wallet, for its owner (passphrase in the body, local only)
+//	 	GET		/blockchain/wallets/{id}/statement						# Every credit and debit for a wallet with the running balance
 //	 	GET		/blockchain/wallets/{id}/transactions					# Browse all transactions for a wallet (with pagination)
 //	 	GET		/blockchain/wallets/{id}/transactions/{id}				# View a transaction for a wallet
 //	 	GET		/blockchain/wallets/{id}/transactions/{protocol}		# Browse all transactions for a wallet by protocol
-//	 	GET		/blockchain/transactions								# Browse all transactions (with pagination)
+//	 	GET		/blockchain/transactions								# Browse all transactions (with pagination or ?cursor=, ?from=&to= for a time range, ?protocol= to filter)
 //	 	GET		/blockchain/transactions/{id}							# View a transaction
+//	 	GET		/blockchain/transactions/{id}/receipt					# Status, block and confirmations of a transaction
+//	 	POST	/blockchain/transactions/{id}/pin						# Include a pending transaction in the next block whatever its fee
 //	 	GET		/blockchain/transactions/{protocol}						# Browse all transactions by protocol
+//	 	GET		/ws/wallets/{id}										# WebSocket of statement lines as transactions for a wallet are confirmed
 //
 // This API is a Goroutine that is started by the main() function in main.go if the global constant `EnableAPI` is enabled.
 // The API is a struct object and all endpoint methods are defined as methods on the API struct and prepended with 'handle'.
@@ -74,7 +109,11 @@ type API struct {
 	bc      *Blockchain
 	router  *mux.Router
 	log     *logging.Logger
+	metrics *RequestMetrics
+	server  *http.Server
 	running bool
+
+	idempotency *idempotencyCache // Responses replayed to retried submissions with the same Idempotency-Key
 }
 
 var publicPaths = []string{
@@ -82,18 +121,28 @@ var publicPaths = []string{
 	"/version",
 	"/info",
 	"/health",
+	"/metrics",
+	"/node",
 	"/account/register",
 	"/account/login",
 	"/account/verify",
 }
 
+// publicPathPrefixes are path prefixes that do not require an API key, used for the HTML explorer pages.
+var publicPathPrefixes = []string{
+	"/explorer/",
+}
+
 // NewAPI creates a new instance of the blockchain API.
 func NewAPI(bc *Blockchain) *API {
 	// Initialize the Gorilla Mux router
 	api := &API{
-		bc:     bc,
-		log:    logging.MustGetLogger("api"),
-		router: mux.NewRouter(),
+		bc:      bc,
+		log:     logging.MustGetLogger("api"),
+		router:  mux.NewRouter(),
+		metrics: NewRequestMetrics(),
+
+		idempotency: newIdempotencyCache(idempotencyKeyTTLInSec * time.Second),
 	}
 
 	log.Printf("Initializing API...\n")
@@ -122,36 +171,36 @@ func isPublicPath(path string) bool {
 			return true
 		}
 	}
+	for _, prefix := range publicPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
 	return false
 }
 
-func authenticateNode(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		PrettyPrint(r)
-		// Perform authentication logic here
-		// Check if the node is registered and has valid credentials
-		// If authentication fails, return an error or redirect to an error page
-
-		// Example: Assume authentication fails for demonstration
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-	})
-}
-
-// Logging middleware logs the request and response details
-func loggingMiddleware(next http.Handler) http.Handler {
+// Logging middleware gives each request an ID, returned in the X-Request-ID header, logs the request and response
+// details, and records them in the API's request metrics
+func (api *API) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		// Get the user's remote IP address
 		ip := GetUserIP(r)
 
+		// Identify the request, so its log lines can be matched with the response the client received
+		r = withRequestID(r)
+		w.Header().Set(RequestIDHeader, RequestID(r))
+
 		// Log the request details
-		cacheReqStr := fmt.Sprintf("[%s] Request: %s %s %s", time.Now().Format(logDateTimeFormat), ip, r.Method, r.URL.Path)
+		cacheReqStr := fmt.Sprintf("[%s] Request %s: %s %s %s", time.Now().Format(logDateTimeFormat), RequestID(r), ip, r.Method, r.URL.Path)
 
-		// Create a response writer wrapper to capture the response status code
-		ww := &responseWriterWrapper{ResponseWriter: w}
+		// Create a response writer wrapper to capture the response status code, 200 unless the handler sets one
+		ww := &responseWriterWrapper{ResponseWriter: w, statusCode: http.StatusOK}
 
 		// Call the next handler
+		start := time.Now()
 		next.ServeHTTP(ww, r)
+		api.metrics.Observe(r.Method, routeTemplate(r), ww.statusCode, time.Since(start))
 
 		// Log the response details
 		//api.logger.Printf("%s -> Response: %d %d bytes", cacheReqStr, ww.statusCode, ww.bytesWritten)
@@ -159,6 +208,20 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// routeTemplate returns the template of the route that matched the request, such as /blockchain/blocks/{index}.
+// Requests matched without a path, such as those refused by a read-only API, are grouped as "other".
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "other"
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "other"
+	}
+	return template
+}
+
 // responseWriterWrapper is a wrapper around http.ResponseWriter to capture the response status code.
 type responseWriterWrapper struct {
 	http.ResponseWriter
@@ -177,6 +240,16 @@ func (ww *responseWriterWrapper) Write(data []byte) (int, error) {
 	return n, err
 }
 
+// Hijack lets WebSocket handlers take over the connection through the wrapper.
+func (ww *responseWriterWrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := ww.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	ww.statusCode = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
 // IsRunning returns true if the API is running
 func (api *API) IsRunning() bool {
 	return api.running
@@ -189,9 +262,6 @@ func (api *API) Start() {
 		return
 	}
 
-	// Create a logging middleware
-	api.router.Use(loggingMiddleware)
-
 	// API key middleware
 	apiKeyMiddleware, err := ApiKeyMiddleware(defaulAPIKeytConfig, api.log)
 	if err != nil {
@@ -201,8 +271,26 @@ func (api *API) Start() {
 
 	// Start the HTTP server
 	log.Printf("API listening on %s\n", apiHostname)
+	api.server = &http.Server{Addr: apiHostname, Handler: api.router}
 	api.running = true
-	log.Fatal(http.ListenAndServe(apiHostname, api.router))
+	err = api.server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// Stop gracefully shuts down the API server, allowing in-flight requests to complete.
+func (api *API) Stop() error {
+	if !api.IsRunning() || api.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	api.running = false
+	log.Println("API shutting down")
+	return api.server.Shutdown(ctx)
 }
 
 func (api *API) GetConfig() *Config {
@@ -211,10 +299,31 @@ func (api *API) GetConfig() *Config {
 
 // registerRoutes registers the API routes.
 func (api *API) registerRoutes() {
+	// Log every request and record it in the request metrics
+	api.router.Use(api.loggingMiddleware)
+
+	// Indent JSON responses for requests with ?pretty=true, including the envelope
+	api.router.Use(prettyMiddleware)
+
+	// Wrap JSON responses in an envelope with the request ID when configured to
+	if api.bc != nil && api.bc.GetConfig() != nil && api.bc.GetConfig().APIResponseEnvelope {
+		api.router.Use(api.envelopeMiddleware)
+	}
+
+	// A read-only API only serves queries. Every other request is refused before it can reach a handler.
+	readOnly := api.bc != nil && api.bc.GetConfig() != nil && api.bc.GetConfig().APIReadOnly
+	if readOnly {
+		api.router.MatcherFunc(isWriteRequest).HandlerFunc(handleReadOnly)
+	}
+
 	api.router.HandleFunc("/", api.handleHome).Methods("GET") // same as /info but HTML only
 	api.router.HandleFunc("/version", api.handleVersion).Methods("GET")
 	api.router.HandleFunc("/info", api.handleInfo).Methods("GET") // Same as / but JSON only
+	api.router.HandleFunc("/info/config/schema", api.handleConfigSchema).Methods("GET")
 	api.router.HandleFunc("/health", api.handleHealth).Methods("GET")
+	api.router.HandleFunc("/metrics", api.handleMetrics).Methods("GET")
+	api.router.HandleFunc("/node", api.handleNode).Methods("GET")
+	api.router.HandleFunc("/explorer/blocks/{index}", api.handleExplorerBlock).Methods("GET") // HTML only
 
 	// Register Public Account Endpoints
 	api.router.HandleFunc("/account/register", api.handleAccountRegister).Methods("GET")
@@ -232,36 +341,78 @@ func (api *API) registerRoutes() {
 
 	// Register the blockchain endpoints
 	api.router.HandleFunc("/blockchain", api.handleBlockchain).Methods("GET")
+	api.router.HandleFunc("/blockchain/tip", api.handleChainTip).Methods("GET")
+	api.router.HandleFunc("/blockchain/health/detailed", api.handleDetailedHealth).Methods("GET")
+	api.router.HandleFunc("/blockchain/richlist", api.handleRichList).Methods("GET")
+	api.router.HandleFunc("/blockchain/fees/estimate", api.handleFeeEstimate).Methods("GET")
+	api.router.HandleFunc("/blockchain/next-block/preview", api.handleNextBlockPreview).Methods("GET")
+	api.router.HandleFunc("/blockchain/protocols", api.handleProtocols).Methods("GET")
 	api.router.HandleFunc("/blockchain/blocks", api.handleBrowseBlocks).Methods("GET")
+	api.router.HandleFunc("/blockchain/blocks/stream", api.handleStreamBlocks).Methods("GET")
+	api.router.HandleFunc("/blockchain/blocks/waitfor", api.handleWaitForBlock).Methods("GET")
+	api.router.HandleFunc("/blockchain/blocks/at", api.handleBlockAtTime).Methods("GET")
 	api.router.HandleFunc("/blockchain/blocks/{index}", api.handleViewBlock).Methods("GET")
+	api.router.HandleFunc("/blockchain/blocks/{index}/header", api.handleBlockHeader).Methods("GET")
+	api.router.HandleFunc("/blockchain/blocks/{index}/protocols", api.handleBlockProtocols).Methods("GET")
+	api.router.HandleFunc("/blockchain/blocks/{index}/raw", api.handleRawBlock).Methods("GET")
 	api.router.HandleFunc("/blockchain/blocks/{index}/transactions", api.handleBrowseTransactionsInBlock).Methods("GET")
 	api.router.HandleFunc("/blockchain/blocks/{index}/transactions/{id}", api.handleViewTransactionInBlock).Methods("GET")
 	api.router.HandleFunc("/blockchain/blocks/{index}/transactions/{protocol}", api.handleBrowseTransactionsByProtocolInBlock).Methods("GET")
 	api.router.HandleFunc("/blockchain/wallets", api.handleBrowseWallets).Methods("GET")
 	api.router.HandleFunc("/blockchain/wallets/new", api.handleCreateWallet).Methods("GET")
 	api.router.HandleFunc("/blockchain/wallets/{id}", api.handleViewWallet).Methods("GET")
-	api.router.HandleFunc("/blockchain/wallets/{id}", api.handleUpdateWallet).Methods("POST")
 	api.router.HandleFunc("/blockchain/wallets/{id}/balance", api.handleViewWalletBalance).Methods("GET")
+	api.router.HandleFunc("/blockchain/wallets/{id}/qr", api.handleWalletQRCode).Methods("GET")
+	api.router.HandleFunc("/blockchain/wallets/{id}/statement", api.handleWalletStatement).Methods("GET")
 	api.router.HandleFunc("/blockchain/wallets/{id}/transactions", api.handleBrowseTransactionsForWallet).Methods("GET")
 	api.router.HandleFunc("/blockchain/wallets/{id}/transactions/{id}", api.handleViewTransactionForWallet).Methods("GET")
 	api.router.HandleFunc("/blockchain/wallets/{id}/transactions/{protocol}", api.handleBrowseTransactionsByProtocolForWallet).Methods("GET")
 	api.router.HandleFunc("/blockchain/transactions", api.handleBrowseTransactions).Methods("GET")
 	api.router.HandleFunc("/blockchain/transactions/{id}", api.handleViewTransaction).Methods("GET")
+	api.router.HandleFunc("/blockchain/transactions/{id}/receipt", api.handleTransactionReceipt).Methods("GET")
 	api.router.HandleFunc("/blockchain/transactions/{protocol}", api.handleBrowseTransactionsByProtocol).Methods("GET")
 
+	// Register the WebSocket endpoints
+	api.router.HandleFunc("/ws/wallets/{id}", api.handleWalletEvents).Methods("GET")
+
+	// Everything else changes state, so is not available on a read-only API
+	if readOnly {
+		return
+	}
+
+	// Register the blockchain endpoints that change state
+	api.router.HandleFunc("/rpc", api.handleRPC).Methods("POST")
+	api.router.HandleFunc("/blockchain/validate", api.handleValidateChain).Methods("POST")
+	api.router.HandleFunc("/blockchain/balances", api.handleBalances).Methods("POST")
+	api.router.HandleFunc("/blockchain/wallets/{id}", api.handleUpdateWallet).Methods("POST")
+	api.router.HandleFunc("/blockchain/wallets/{id}/export", api.handleExportWallet).Methods("POST")
+	api.router.HandleFunc("/blockchain/transactions/{id}/pin", api.handlePinTransaction).Methods("POST")
+
 	// Create a subrouter for the consensus endpoints
-	// This is only available to other regsitered/authorized nodes
+	// This is only available to registered peers that sign their requests, or peers with the node token, see authenticateNode
 	consensusRouter := mux.NewRouter().PathPrefix("/consensus").Subrouter()
 	consensusRouter.Use(authenticateNode)
 
 	consensusRouter.HandleFunc("/p2p", api.handleConsensusP2P).Methods("POST")
-	consensusRouter.HandleFunc("/tx", api.handleConsensusTx).Methods("POST")
+	consensusRouter.HandleFunc("/register", api.handleConsensusRegister).Methods("POST")
+	consensusRouter.HandleFunc("/tx", api.idempotent(api.handleConsensusTx)).Methods("POST") // Retries with an Idempotency-Key are answered once
 	consensusRouter.HandleFunc("/block", api.handleConsensusBlock).Methods("POST")
 
 	// Add the consensusRouter to the main router
 	api.router.PathPrefix("/consensus").Handler(consensusRouter)
 }
 
+// isWriteRequest matches requests with a method that may change state.
+func isWriteRequest(r *http.Request, _ *mux.RouteMatch) bool {
+	return r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+}
+
+// handleReadOnly refuses requests that may change state when the API is read-only.
+func handleReadOnly(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", "GET, HEAD")
+	http.Error(w, "API is read-only", http.StatusMethodNotAllowed)
+}
+
 // handleHome handles the home endpoint.
 func (api *API) handleHome(w http.ResponseWriter, r *http.Request) {
 	info := BlockchainInfo{
@@ -332,6 +483,126 @@ func (api *API) handleHome(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// explorerTransaction is a row in the transaction table of the explorer block page.
+type explorerTransaction struct {
+	ID       string
+	Protocol string
+	Fee      float64
+	Status   TransactionStatus
+}
+
+// handleExplorerBlock handles the explorer/blocks/{index} endpoint, rendering a block header and its transactions as HTML.
+func (api *API) handleExplorerBlock(w http.ResponseWriter, r *http.Request) {
+	// Get the block index from the request URL path parameters
+	vars := mux.Vars(r)
+	index, err := strconv.ParseInt(vars["index"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid block index", http.StatusBadRequest)
+		return
+	}
+
+	block := api.bc.GetBlockByIndex(index)
+	if block == nil {
+		http.Error(w, "Block not found", http.StatusNotFound)
+		return
+	}
+
+	page := struct {
+		Index        string
+		Hash         string
+		PreviousHash string
+		Timestamp    time.Time
+		Difficulty   uint32
+		Nonce        uint32
+		Transactions []explorerTransaction
+	}{
+		Index:        block.Index.String(),
+		Hash:         block.Hash,
+		PreviousHash: block.Header.PreviousHash,
+		Timestamp:    block.Header.Timestamp,
+		Difficulty:   block.Header.Difficulty,
+		Nonce:        block.Header.Nonce,
+	}
+	for _, tx := range block.Transactions {
+		page.Transactions = append(page.Transactions, explorerTransaction{
+			ID:       tx.GetID(),
+			Protocol: tx.GetProtocol(),
+			Fee:      tx.GetFee(),
+			Status:   tx.GetStatus(),
+		})
+	}
+
+	// Define the HTML template
+	const blockTemplate = `
+		<!DOCTYPE html>
+		<html>
+		<head>
+			<title>Block {{.Index}}</title>
+			<link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css">
+		</head>
+		<body>
+			<div class="container">
+				<h1>Block {{.Index}}</h1>
+				<table class="table">
+					<tr>
+						<th>Hash</th>
+						<td>{{.Hash}}</td>
+					</tr>
+					<tr>
+						<th>Previous Hash</th>
+						<td>{{.PreviousHash}}</td>
+					</tr>
+					<tr>
+						<th>Timestamp</th>
+						<td>{{.Timestamp}}</td>
+					</tr>
+					<tr>
+						<th>Difficulty</th>
+						<td>{{.Difficulty}}</td>
+					</tr>
+					<tr>
+						<th>Nonce</th>
+						<td>{{.Nonce}}</td>
+					</tr>
+				</table>
+				<h2>Transactions</h2>
+				<table class="table">
+					<tr>
+						<th>ID</th>
+						<th>Protocol</th>
+						<th>Fee</th>
+						<th>Status</th>
+					</tr>
+					{{range .Transactions}}
+					<tr>
+						<td><a href="/blockchain/transactions/{{.ID}}">{{.ID}}</a></td>
+						<td>{{.Protocol}}</td>
+						<td>{{.Fee}}</td>
+						<td>{{.Status}}</td>
+					</tr>
+					{{end}}
+				</table>
+			</div>
+			<script src="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/js/bootstrap.bundle.min.js"></script>
+		</body>
+		</html>
+	`
+
+	// Parse the HTML template
+	tmpl, err := template.New("block").Parse(blockTemplate)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Render the HTML template with the data
+	err = tmpl.Execute(w, page)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
 // handleVersion handles the version endpoint.
 func (api *API) handleVersion(w http.ResponseWriter, r *http.Request) {
 	info := BlockchainInfo{
@@ -379,12 +650,63 @@ func (api *API) handleInfo(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
+// handleConfigSchema handles the /info/config/schema endpoint, describing every configuration field with its type,
+// default and validation rules, so a settings UI can render and check a form. Secret defaults are left out.
+func (api *API) handleConfigSchema(w http.ResponseWriter, r *http.Request) {
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the schema to JSON
+	data, err := json.Marshal(ConfigSchema())
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
 // handleHealth handles the health endpoint.
 func (api *API) handleHealth(w http.ResponseWriter, r *http.Request) {
 	// Return "Not Yet Implemented"
 	w.Write([]byte("Not Yet Implemented"))
 }
 
+// handleMetrics handles the metrics endpoint, returning the request metrics in the Prometheus text format.
+func (api *API) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	// Set response headers
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	// Write the metrics
+	w.WriteHeader(http.StatusOK)
+	api.metrics.WriteTo(w)
+}
+
+// handleNode handles the node endpoint, returning the details that identify this node.
+func (api *API) handleNode(w http.ResponseWriter, r *http.Request) {
+	n := GetNode()
+	if n == nil {
+		http.Error(w, "Node not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the node details to JSON
+	data, err := json.Marshal(n.Details())
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
 // handleConsensusP2P handles the consensus/P2P endpoint. This is used to recieve and process a Broadcast a Message to 1/3. Upon validation it is then
 // broadcast to 2/3 of all nodes. Finally upon validation it is Broadcast to all nodes
 // 1. get the post data and unmarshal it into a P2PTransaction
@@ -411,16 +733,115 @@ func (api *API) handleConsensusP2P(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 }
 
-// handleConsensusTx handles the consensus/tx endpoint.
+// handleConsensusRegister handles the consensus/register endpoint, for peers that can only reach this node over
+// HTTP. The peer posts its NodeInfo and is registered as it would be by the P2P handshake. The response is the
+// node list, as sent for GET_NODES, so the new peer can bootstrap from it.
+func (api *API) handleConsensusRegister(w http.ResponseWriter, r *http.Request) {
+	n := GetNode()
+	if n == nil || n.P2P == nil {
+		http.Error(w, "Node not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	var info NodeInfo
+	err := json.NewDecoder(r.Body).Decode(&info)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Registering again is allowed, so a peer can fetch the node list after a restart
+	if !n.P2P.IsRegistered(info.ID) {
+		err = n.P2P.RegisterPeer(info)
+		if errors.Is(err, ErrTooManyPeers) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the node list to JSON
+	data, err := json.Marshal(n.P2P.NodeList())
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleConsensusTx handles the consensus/tx endpoint. Peers post transactions they have accepted, encoded as a
+// PersistedTransaction, which are queued here and gossiped onwards to this node's peers.
 func (api *API) handleConsensusTx(w http.ResponseWriter, r *http.Request) {
-	// Return "Not Yet Implemented"
-	w.Write([]byte("Not Yet Implemented"))
+	var persisted PersistedTransaction
+	err := json.NewDecoder(r.Body).Decode(&persisted)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := persisted.Transaction()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Only transactions signed by their sender are accepted from peers
+	err = api.bc.VerifySignature(tx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = api.bc.AddTransaction(tx)
+	if errors.Is(err, ErrDuplicateTransaction) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Return a 202 response to indicate the transaction was accepted into the mempool
+	w.WriteHeader(http.StatusAccepted)
 }
 
-// handleConsensusBlock handles the consensus/block endpoint.
+// handleConsensusBlock handles the consensus/block endpoint, adding a block mined by another node to the chain.
+// The block may be in either wire format. A block that is already in the chain is refused with 409 Conflict.
 func (api *API) handleConsensusBlock(w http.ResponseWriter, r *http.Request) {
-	// Return "Not Yet Implemented"
-	w.Write([]byte("Not Yet Implemented"))
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxP2PMessageSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	block, err := DecodeBlock(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = api.bc.AddBlock(block)
+	if errors.Is(err, ErrDuplicateBlock) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Return a 201 response to indicate the block was added to the chain
+	w.WriteHeader(http.StatusCreated)
 }
 
 // handleBlockchain handles the blockchain endpoint.
@@ -428,11 +849,13 @@ func (api *API) handleBlockchain(w http.ResponseWriter, r *http.Request) {
 
 	// Create a response struct
 	response := struct {
-		NumBlocks              int `json:"num_blocks"`
-		NumTransactionsInQueue int `json:"num_transactions_in_queue"`
+		NumBlocks              int    `json:"num_blocks"`
+		NumTransactionsInQueue int    `json:"num_transactions_in_queue"`
+		TotalWork              string `json:"total_work"`
 	}{
 		NumBlocks:              len(api.bc.Blocks),
 		NumTransactionsInQueue: len(api.bc.TransactionQueue),
+		TotalWork:              api.bc.TotalWork().String(),
 	}
 
 	// Set response headers
@@ -450,38 +873,40 @@ func (api *API) handleBlockchain(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-// handleBrowseBlocks handles the /blockchain/blocks endpoint.
-func (api *API) handleBrowseBlocks(w http.ResponseWriter, r *http.Request) {
+// FeeEstimate is the response of the /blockchain/fees/estimate endpoint.
+type FeeEstimate struct {
+	Fee                 float64 `json:"fee"`
+	MinFee              float64 `json:"min_fee"`
+	MempoolSize         int     `json:"mempool_size"`
+	EstimatedWaitInSecs float64 `json:"estimated_wait_secs"`
+}
 
-	// Parse the query parameters
-	queryParams := r.URL.Query()
-	page, err := strconv.Atoi(queryParams.Get("page"))
-	if err != nil {
-		page = 1
-	}
-	limit, err := strconv.Atoi(queryParams.Get("limit"))
-	if err != nil {
-		limit = 10
+// handleFeeEstimate handles the /blockchain/fees/estimate endpoint, estimating how long a transaction paying the fee
+// would wait to be mined. The fee defaults to the configured transaction fee.
+func (api *API) handleFeeEstimate(w http.ResponseWriter, r *http.Request) {
+	cfg := api.bc.GetConfig()
+	fee := cfg.TransactionFee
+	if value := r.URL.Query().Get("fee"); value != "" {
+		var err error
+		fee, err = strconv.ParseFloat(value, 64)
+		if err != nil || fee < 0 || math.IsNaN(fee) || math.IsInf(fee, 0) {
+			http.Error(w, "Invalid fee", http.StatusBadRequest)
+			return
+		}
 	}
 
-	// Calculate the start and end indices for pagination
-	startIndex := (page - 1) * limit
-	endIndex := startIndex + limit
-	if startIndex >= len(api.bc.Blocks) {
-		startIndex = len(api.bc.Blocks) - 1
+	response := FeeEstimate{
+		Fee:                 fee,
+		MinFee:              cfg.MinTransactionFee,
+		MempoolSize:         api.bc.GetMempoolSize(),
+		EstimatedWaitInSecs: api.bc.EstimateConfirmationTime(fee).Seconds(),
 	}
-	if endIndex >= len(api.bc.Blocks) {
-		endIndex = len(api.bc.Blocks)
-	}
-
-	// Get the requested blocks based on the pagination
-	requestedBlocks := api.bc.Blocks[startIndex:endIndex]
 
 	// Set response headers
 	w.Header().Set("Content-Type", "application/json")
 
-	// Marshal the requested blocks to JSON
-	data, err := json.Marshal(requestedBlocks)
+	// Marshal the estimate to JSON
+	data, err := json.Marshal(response)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -492,31 +917,491 @@ func (api *API) handleBrowseBlocks(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-// handleViewBlock handles the /blockchain/blocks/{index} endpoint.
-func (api *API) handleViewBlock(w http.ResponseWriter, r *http.Request) {
-	// Get the block index from the request URL path parameters
-	vars := mux.Vars(r)
-	indexStr := vars["index"]
-	index, err := strconv.Atoi(indexStr)
+// handleProtocols handles the /blockchain/protocols endpoint, describing every registered transaction protocol with
+// its required fields and fee rules.
+func (api *API) handleProtocols(w http.ResponseWriter, r *http.Request) {
+	var cfg *Config
+	if api.bc != nil {
+		cfg = api.bc.GetConfig()
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the protocol descriptions to JSON
+	data, err := json.Marshal(DescribeProtocols(cfg))
 	if err != nil {
-		http.Error(w, "Invalid block index", http.StatusBadRequest)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// Check if the requested block index is valid
-	if index < 0 || index >= len(api.bc.Blocks) {
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// RichListEntry is an address and its balance, as returned by the /blockchain/richlist endpoint.
+type RichListEntry struct {
+	Address string  `json:"address"`
+	Balance float64 `json:"balance"`
+}
+
+// handleRichList handles the /blockchain/richlist endpoint, returning the addresses with the highest balances.
+// Addresses with equal balances are ordered by address so the list is stable.
+func (api *API) handleRichList(w http.ResponseWriter, r *http.Request) {
+	limit := richListLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	balances := api.bc.GetAllBalances()
+	richList := make([]RichListEntry, 0, len(balances))
+	for address, balance := range balances {
+		richList = append(richList, RichListEntry{Address: address, Balance: balance})
+	}
+	sort.Slice(richList, func(i, j int) bool {
+		if richList[i].Balance != richList[j].Balance {
+			return richList[i].Balance > richList[j].Balance
+		}
+		return richList[i].Address < richList[j].Address
+	})
+	if len(richList) > limit {
+		richList = richList[:limit]
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the rich list to JSON
+	data, err := json.Marshal(richList)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleNextBlockPreview handles the /blockchain/next-block/preview endpoint, returning the block that would be
+// mined next from the mempool. The block is not mined, so its nonce and hash are not final.
+func (api *API) handleNextBlockPreview(w http.ResponseWriter, r *http.Request) {
+	block := api.bc.PreviewNextBlock()
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the block to JSON
+	data, err := json.Marshal(block)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleDetailedHealth handles the /blockchain/health/detailed endpoint, returning the confirmation, mempool wait
+// and block fullness statistics of the blocks recently mined by this node.
+func (api *API) handleDetailedHealth(w http.ResponseWriter, r *http.Request) {
+	stats := api.bc.GetConfirmationStats()
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the statistics to JSON
+	data, err := json.Marshal(stats)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleBalances handles the /blockchain/balances endpoint, returning the balance of each address in the request
+// body so a wallet tracking many addresses needs only one call.
+func (api *API) handleBalances(w http.ResponseWriter, r *http.Request) {
+	var addresses []string
+	if err := json.NewDecoder(r.Body).Decode(&addresses); err != nil {
+		http.Error(w, "Request body must be a JSON array of addresses", http.StatusBadRequest)
+		return
+	}
+
+	if len(addresses) == 0 {
+		http.Error(w, "No addresses in request", http.StatusBadRequest)
+		return
+	}
+
+	if len(addresses) > maxBalanceQueryAddresses {
+		http.Error(w, fmt.Sprintf("Request exceeds the maximum of %d addresses", maxBalanceQueryAddresses), http.StatusBadRequest)
+		return
+	}
+
+	balances := api.bc.GetBalances(addresses)
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the balances to JSON
+	data, err := json.Marshal(balances)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleBrowseBlocks handles the /blockchain/blocks endpoint.
+// With ?cursor= the blocks after the cursor are returned in a CursorPage instead of a page by number.
+func (api *API) handleBrowseBlocks(w http.ResponseWriter, r *http.Request) {
+
+	// Parse the query parameters
+	queryParams := r.URL.Query()
+	page, err := strconv.Atoi(queryParams.Get("page"))
+	if err != nil {
+		page = 1
+	}
+	limit, err := strconv.Atoi(queryParams.Get("limit"))
+	if err != nil {
+		limit = 10
+	}
+
+	if queryParams.Has("cursor") {
+		cursor, err := decodeCursor(queryParams.Get("cursor"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if limit < 1 {
+			limit = 10
+		}
+		blocks, next := api.bc.blocksAfter(cursor, limit)
+		writeCursorPage(w, blocks, next)
+		return
+	}
+
+	// Calculate the start and end indices for pagination
+	startIndex := (page - 1) * limit
+	endIndex := startIndex + limit
+	if startIndex >= len(api.bc.Blocks) {
+		startIndex = len(api.bc.Blocks) - 1
+	}
+	if endIndex >= len(api.bc.Blocks) {
+		endIndex = len(api.bc.Blocks)
+	}
+
+	// Get the requested blocks based on the pagination
+	requestedBlocks := api.bc.Blocks[startIndex:endIndex]
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the requested blocks to JSON
+	data, err := json.Marshal(requestedBlocks)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleChainTip handles the /blockchain/tip endpoint, returning a summary of the latest block.
+func (api *API) handleChainTip(w http.ResponseWriter, r *http.Request) {
+	tip := api.bc.GetChainTip()
+	if tip == nil {
+		http.Error(w, "No blocks found", http.StatusNotFound)
+		return
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the tip to JSON
+	data, err := json.Marshal(tip)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleValidateChain handles the /blockchain/validate endpoint, validating a snapshot of the chain.
+func (api *API) handleValidateChain(w http.ResponseWriter, r *http.Request) {
+	report := api.bc.ValidateChainReport()
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the report to JSON
+	data, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handlePinTransaction handles the /blockchain/transactions/{id}/pin endpoint, making a pending transaction go into
+// the next block whatever its fee.
+func (api *API) handlePinTransaction(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	err := api.bc.PinTransaction(id)
+	if errors.Is(err, ErrNotPending) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return a 204 response to indicate the transaction was pinned
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleViewBlock handles the /blockchain/blocks/{index} endpoint.
+func (api *API) handleViewBlock(w http.ResponseWriter, r *http.Request) {
+	// Get the block index from the request URL path parameters
+	vars := mux.Vars(r)
+	indexStr := vars["index"]
+	index, err := strconv.Atoi(indexStr)
+	if err != nil {
+		http.Error(w, "Invalid block index", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the requested block index is valid
+	if index < 0 || index >= len(api.bc.Blocks) {
+		http.Error(w, "Block not found", http.StatusNotFound)
+		return
+	}
+
+	// Get the requested block
+	block := api.bc.Blocks[index]
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the block to JSON
+	data, err := json.Marshal(block)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleStreamBlocks handles the blockchain/blocks/stream endpoint, used by clients syncing over HTTP. The blocks from
+// index "from" to "to", inclusive, are written as newline delimited JSON and flushed as they are written. "to" defaults
+// to the latest block, and at most maxBlockStreamRange blocks are returned per request.
+func (api *API) handleStreamBlocks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from, err := strconv.ParseInt(query.Get("from"), 10, 64)
+	if err != nil || from < 0 {
+		http.Error(w, "Invalid from block index", http.StatusBadRequest)
+		return
+	}
+
+	blocks := api.bc.snapshotBlocks()
+	to := int64(len(blocks)) - 1
+	if query.Get("to") != "" {
+		to, err = strconv.ParseInt(query.Get("to"), 10, 64)
+		if err != nil || to < from {
+			http.Error(w, "Invalid to block index", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if to-from+1 > maxBlockStreamRange {
+		http.Error(w, fmt.Sprintf("Range exceeds the maximum of %d blocks", maxBlockStreamRange), http.StatusBadRequest)
+		return
+	}
+
+	if from >= int64(len(blocks)) {
+		http.Error(w, "Block not found", http.StatusNotFound)
+		return
+	}
+	if to >= int64(len(blocks)) {
+		to = int64(len(blocks)) - 1
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	// Write each block as a line of JSON, flushing so the client can start ingesting straight away
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	for _, block := range blocks[from : to+1] {
+		err = encoder.Encode(block)
+		if err != nil {
+			log.Printf("Error streaming block %s: %v\n", block.Index.String(), err)
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// handleWaitForBlock handles the /blockchain/blocks/waitfor endpoint, a long-poll for clients that can't use
+// WebSockets. It returns the block following index "after" as soon as it exists. If no block arrives within
+// "timeout" seconds, blockWaitTimeoutInSec by default, it responds with 204 No Content and the client should
+// poll again.
+func (api *API) handleWaitForBlock(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	after, err := strconv.ParseInt(query.Get("after"), 10, 64)
+	if err != nil || after < 0 {
+		http.Error(w, "Invalid after block index", http.StatusBadRequest)
+		return
+	}
+
+	timeout := blockWaitTimeoutInSec
+	if query.Get("timeout") != "" {
+		timeout, err = strconv.Atoi(query.Get("timeout"))
+		if err != nil || timeout < 1 || timeout > maxBlockWaitTimeoutInSec {
+			http.Error(w, fmt.Sprintf("Invalid timeout, expected 1 to %d seconds", maxBlockWaitTimeoutInSec), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	block, err := api.bc.WaitForBlock(ctx, after)
+	if err != nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the block to JSON
+	data, err := json.Marshal(block)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleBlockAtTime handles the /blockchain/blocks/at endpoint, returning the block that was the tip of the chain
+// at the time given by "timestamp" in RFC 3339 format.
+func (api *API) handleBlockAtTime(w http.ResponseWriter, r *http.Request) {
+	timestamp, err := time.Parse(time.RFC3339, r.URL.Query().Get("timestamp"))
+	if err != nil {
+		http.Error(w, "Invalid timestamp, expected RFC 3339", http.StatusBadRequest)
+		return
+	}
+
+	block := api.bc.GetBlockAtTime(timestamp)
+	if block == nil {
+		http.Error(w, "No block at or before the timestamp", http.StatusNotFound)
+		return
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the block to JSON
+	data, err := json.Marshal(block)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleBlockProtocols handles the /blockchain/blocks/{index}/protocols endpoint, returning the number of
+// transactions in the block for each protocol.
+func (api *API) handleBlockProtocols(w http.ResponseWriter, r *http.Request) {
+	// Get the block index from the request URL path parameters
+	vars := mux.Vars(r)
+	index, err := strconv.ParseInt(vars["index"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid block index", http.StatusBadRequest)
+		return
+	}
+
+	block := api.bc.GetBlockByIndex(index)
+	if block == nil {
 		http.Error(w, "Block not found", http.StatusNotFound)
 		return
 	}
 
-	// Get the requested block
-	block := api.bc.Blocks[index]
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the counts to JSON
+	data, err := json.Marshal(block.ProtocolCounts())
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleBlockHeader handles the /blockchain/blocks/{index}/header endpoint, for light clients that sync headers and
+// only request the blocks they need.
+func (api *API) handleBlockHeader(w http.ResponseWriter, r *http.Request) {
+	// Get the block index from the request URL path parameters
+	vars := mux.Vars(r)
+	index, err := strconv.ParseInt(vars["index"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid block index", http.StatusBadRequest)
+		return
+	}
+
+	block := api.bc.GetBlockByIndex(index)
+	if block == nil {
+		http.Error(w, "Block not found", http.StatusNotFound)
+		return
+	}
 
 	// Set response headers
 	w.Header().Set("Content-Type", "application/json")
 
-	// Marshal the block to JSON
-	data, err := json.Marshal(block)
+	// Marshal the header to JSON
+	data, err := json.Marshal(block.HeaderSummary())
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -527,6 +1412,40 @@ func (api *API) handleViewBlock(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
+// handleRawBlock handles the /blockchain/blocks/{index}/raw endpoint, for tools that verify blocks independently. The
+// block is returned exactly as encoded by EncodeBinary, and its hash is sent in the X-Block-Hash header.
+func (api *API) handleRawBlock(w http.ResponseWriter, r *http.Request) {
+	// Get the block index from the request URL path parameters
+	vars := mux.Vars(r)
+	index, err := strconv.ParseInt(vars["index"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid block index", http.StatusBadRequest)
+		return
+	}
+
+	block := api.bc.GetBlockByIndex(index)
+	if block == nil {
+		http.Error(w, "Block not found", http.StatusNotFound)
+		return
+	}
+
+	// Encode the block
+	data, err := block.EncodeBinary()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("X-Block-Hash", block.Hash)
+
+	// Write the binary response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
 // handleBrowseTransactionsInBlock handles the /blockchain/blocks/{index}/transactions endpoint.
 func (api *API) handleBrowseTransactionsInBlock(w http.ResponseWriter, r *http.Request) {
 	// Get the block index from the path parameters
@@ -551,7 +1470,7 @@ func (api *API) handleBrowseTransactionsInBlock(w http.ResponseWriter, r *http.R
 	w.Header().Set("Content-Type", "application/json")
 
 	// Marshal the transactions to JSON
-	data, err := json.Marshal(transactions)
+	data, err := json.Marshal(NewTransactionViews(transactions))
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -627,8 +1546,58 @@ func (api *API) handleBrowseTransactionsByProtocolInBlock(w http.ResponseWriter,
 
 // handleBrowseWallets handles the /blockchain/wallets endpoint.
 func (api *API) handleBrowseWallets(w http.ResponseWriter, r *http.Request) {
-	// Return "Not Yet Implemented"
-	w.Write([]byte("Not Yet Implemented"))
+	wallets, err := LocalWallets()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Only include wallets with the requested tag, if any. Wallets saved before tags were kept unencrypted have no
+	// tags to match until they are unlocked once, which migrates their tags.
+	tag := r.URL.Query().Get("tag")
+
+	response := []WalletSummary{}
+	for _, wallet := range wallets {
+		if tag != "" && !wallet.HasTag(tag) {
+			continue
+		}
+		response = append(response, NewWalletSummary(wallet))
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the wallets to JSON
+	data, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// WalletSummary is the public view of a wallet returned by the API, the encrypted vault is never returned.
+type WalletSummary struct {
+	ID        string   `json:"id"`
+	Address   string   `json:"address"`
+	Encrypted bool     `json:"encrypted"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+// NewWalletSummary returns the public view of the wallet.
+func NewWalletSummary(wallet *Wallet) WalletSummary {
+	summary := WalletSummary{
+		Address:   wallet.GetAddress(),
+		Encrypted: wallet.Encrypted,
+		Tags:      wallet.GetTags(),
+	}
+	if wallet.ID != nil {
+		summary.ID = wallet.ID.String()
+	}
+	return summary
 }
 
 // handleCreateWallet handles the /blockchain/wallets/new endpoint.
@@ -638,9 +1607,207 @@ func (api *API) handleCreateWallet(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleViewWallet handles the /blockchain/wallets/{id} endpoint.
+// The {id} may be either the wallet address (64 hex characters) or the wallet PUID.
 func (api *API) handleViewWallet(w http.ResponseWriter, r *http.Request) {
-	// Return "Not Yet Implemented"
-	w.Write([]byte("Not Yet Implemented"))
+	id := mux.Vars(r)["id"]
+
+	wallet, err := GetWallet(id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Wallet not found: %s (expected a 64 character hex address or a PUID in the form userID:organizationID:appID:assetID)", id), http.StatusNotFound)
+		return
+	}
+
+	// Create a response struct, the encrypted vault is never returned
+	response := NewWalletSummary(wallet)
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the response struct to JSON
+	data, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleWalletQRCode handles the /blockchain/wallets/{id}/qr endpoint, returning a QR code of the wallet
+// address as a PNG, or as an SVG with ?format=svg.
+func (api *API) handleWalletQRCode(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	wallet, err := GetWallet(id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Wallet not found: %s", id), http.StatusNotFound)
+		return
+	}
+
+	var data []byte
+	var contentType string
+	switch format := r.URL.Query().Get("format"); format {
+	case "", QRFormatPNG:
+		data, err = AddressQRCodePNG(wallet.GetAddress())
+		contentType = "image/png"
+	case QRFormatSVG:
+		data, err = AddressQRCodeSVG(wallet.GetAddress())
+		contentType = "image/svg+xml"
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported format: %s (expected png or svg)", format), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", contentType)
+
+	// Write the image response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleExportWallet handles the /blockchain/wallets/{id}/export endpoint, returning the wallet's encrypted keystore
+// for its owner to back up. The owner proves ownership by giving the wallet's passphrase in a WalletExportRequest
+// body, the keystore is only returned if it unlocks the wallet. The keystore is returned still encrypted.
+//
+// Exports are only served to clients on this host, and a wallet is locked out of exports for a while after
+// maxExportFailures failed attempts. Every refusal gets the same response, so it does not tell whether the wallet
+// exists or the passphrase was wrong.
+func (api *API) handleExportWallet(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	refuse := func() {
+		http.Error(w, "Wallet export refused", http.StatusForbidden)
+	}
+
+	if !isLoopbackRequest(r) {
+		refuse()
+		return
+	}
+
+	// Failed attempts are counted per wallet, whether it is named by its address or its PUID
+	wallet, walletErr := GetWallet(id)
+	key := id
+	if walletErr == nil {
+		key = wallet.GetAddress()
+	}
+
+	now := time.Now()
+	if !exportAttempts.allowed(key, now) {
+		refuse()
+		return
+	}
+
+	var req WalletExportRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxExportRequestSize)).Decode(&req)
+	if err != nil || req.Passphrase == "" || walletErr != nil {
+		exportAttempts.fail(key, now)
+		refuse()
+		return
+	}
+
+	// Export before unlocking, so only the encrypted vault is returned
+	data, err := wallet.Export()
+	if err != nil || wallet.Unlock(req.Passphrase) != nil {
+		exportAttempts.fail(key, now)
+		refuse()
+		return
+	}
+	exportAttempts.reset(key)
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", wallet.GetAddress()+".json"))
+
+	// Write the keystore response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// isLoopbackRequest returns true if the request was made from this host. Only the connection's address is
+// trusted, not the X-Forwarded-For header a client can set.
+func isLoopbackRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handleWalletStatement handles the /blockchain/wallets/{id}/statement endpoint. The id can be the address or
+// PUID of a wallet stored on this node, or any address on the chain.
+func (api *API) handleWalletStatement(w http.ResponseWriter, r *http.Request) {
+	address := mux.Vars(r)["id"]
+	if wallet, err := GetWallet(address); err == nil {
+		address = wallet.GetAddress()
+	}
+
+	statement := api.bc.GetStatement(address)
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the statement to JSON
+	data, err := json.Marshal(statement)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleWalletEvents handles the /ws/wallets/{id} WebSocket endpoint. Each time a transaction affecting the wallet
+// is confirmed its statement line is sent as a JSON text message. The id is resolved like handleWalletStatement.
+func (api *API) handleWalletEvents(w http.ResponseWriter, r *http.Request) {
+	address := mux.Vars(r)["id"]
+	if wallet, err := GetWallet(address); err == nil {
+		address = wallet.GetAddress()
+	}
+
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		if !errors.Is(err, ErrNotWebSocket) {
+			log.Printf("[%s] Error upgrading WebSocket for %s: %v\n", time.Now().Format(logDateTimeFormat), address, err)
+		}
+		return
+	}
+	defer conn.Close()
+
+	sub := api.bc.SubscribeAddress(address)
+	defer api.bc.UnsubscribeAddress(sub)
+
+	// The client only sends control frames, stop when it closes the connection
+	closed := make(chan struct{})
+	go func() {
+		conn.ReadControl()
+		close(closed)
+	}()
+
+	for {
+		select {
+		case line := <-sub:
+			data, err := json.Marshal(line)
+			if err != nil {
+				log.Printf("[%s] Error marshaling statement line: %v\n", time.Now().Format(logDateTimeFormat), err)
+				continue
+			}
+			err = conn.WriteText(data)
+			if err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
 }
 
 // handleUpdateWallet handles the /blockchain/wallets/{id} endpoint.
@@ -674,15 +1841,147 @@ func (api *API) handleBrowseTransactionsByProtocolForWallet(w http.ResponseWrite
 }
 
 // handleBrowseTransactions handles the /blockchain/transactions endpoint.
+// The transactions can be limited to blocks mined in a time range with ?from= and ?to=, given in RFC 3339 format.
+// With ?cursor= the transactions after the cursor are returned in a CursorPage instead of a page by number.
 func (api *API) handleBrowseTransactions(w http.ResponseWriter, r *http.Request) {
-	// Return "Not Yet Implemented"
-	w.Write([]byte("Not Yet Implemented"))
+
+	// Parse the query parameters
+	queryParams := r.URL.Query()
+	from := time.Time{}
+	to := time.Now()
+	var err error
+	if value := queryParams.Get("from"); value != "" {
+		from, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid from time, expected RFC 3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := queryParams.Get("to"); value != "" {
+		to, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid to time, expected RFC 3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Before(from) {
+		http.Error(w, "The to time is before the from time", http.StatusBadRequest)
+		return
+	}
+	protocol := queryParams.Get("protocol")
+	if protocol != "" && isValidProtocol(protocol) != nil {
+		http.Error(w, fmt.Sprintf("Unknown protocol: %s", protocol), http.StatusBadRequest)
+		return
+	}
+
+	page, err := strconv.Atoi(queryParams.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(queryParams.Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+
+	if queryParams.Has("cursor") {
+		cursor, err := decodeCursor(queryParams.Get("cursor"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		txs, next := api.bc.transactionsAfter(cursor, limit, func(block *Block, tx Transaction) bool {
+			if block.Header.Timestamp.Before(from) || block.Header.Timestamp.After(to) {
+				return false
+			}
+			return protocol == "" || strings.EqualFold(tx.GetProtocol(), protocol)
+		})
+		writeCursorPage(w, NewTransactionViews(txs), next)
+		return
+	}
+
+	// Get the requested transactions based on the pagination
+	txs := api.bc.GetTransactionsByTimeRange(from, to)
+	if protocol != "" {
+		filtered := []Transaction{}
+		for _, tx := range txs {
+			if strings.EqualFold(tx.GetProtocol(), protocol) {
+				filtered = append(filtered, tx)
+			}
+		}
+		txs = filtered
+	}
+	startIndex := (page - 1) * limit
+	endIndex := startIndex + limit
+	if startIndex > len(txs) {
+		startIndex = len(txs)
+	}
+	if endIndex > len(txs) {
+		endIndex = len(txs)
+	}
+	requestedTxs := txs[startIndex:endIndex]
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the requested transactions to JSON
+	data, err := json.Marshal(NewTransactionViews(requestedTxs))
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
 }
 
 // handleViewTransaction handles the /blockchain/transactions/{id} endpoint.
 func (api *API) handleViewTransaction(w http.ResponseWriter, r *http.Request) {
-	// Return "Not Yet Implemented"
-	w.Write([]byte("Not Yet Implemented"))
+	id := mux.Vars(r)["id"]
+
+	tx := api.bc.GetTransactionByID(id)
+	if tx == nil {
+		http.Error(w, fmt.Sprintf("Transaction not found: %s", id), http.StatusNotFound)
+		return
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the transaction to JSON
+	data, err := json.Marshal(NewTransactionView(tx))
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleTransactionReceipt handles the /blockchain/transactions/{id}/receipt endpoint.
+func (api *API) handleTransactionReceipt(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	receipt := api.bc.GetTransactionReceipt(vars["id"])
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the receipt to JSON
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	if receipt.Status == ReceiptStatusNotFound {
+		w.WriteHeader(http.StatusNotFound)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.Write(data)
 }
 
 // handleBrowseTransactionsByProtocol handles the /blockchain/transactions/{protocol} endpoint.
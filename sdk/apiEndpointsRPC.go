@@ -0,0 +1,181 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/apiEndpointsRPC.go - Batched RPC style requests
+package sdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// maxRPCBatchSize is the largest number of calls accepted in a single batch.
+const maxRPCBatchSize = 100
+
+// RPCRequest is a single call in a batch sent to the /rpc endpoint.
+type RPCRequest struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// RPCResponse is the result of a single call. Exactly one of Result or Error is set.
+type RPCResponse struct {
+	Method string      `json:"method"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// rpcParams holds every parameter used by the RPC methods, each method reads the ones it needs.
+type rpcParams struct {
+	Index   *int64 `json:"index"`
+	Hash    string `json:"hash"`
+	ID      string `json:"id"`
+	Address string `json:"address"`
+}
+
+// rpcMethod handles a single RPC call.
+type rpcMethod func(bc *Blockchain, params *rpcParams) (interface{}, error)
+
+// rpcMethods maps the RPC method names to the blockchain getters that serve them.
+var rpcMethods = map[string]rpcMethod{
+	"getBlock":              rpcGetBlock,
+	"getBlockCount":         rpcGetBlockCount,
+	"getChainTip":           rpcGetChainTip,
+	"getTransaction":        rpcGetTransaction,
+	"getTransactionReceipt": rpcGetTransactionReceipt,
+	"getBalance":            rpcGetBalance,
+}
+
+// handleRPC handles the /rpc endpoint.
+// api.router.HandleFunc("/rpc", api.handleRPC).Methods("POST")
+// Shell: curl -X POST -d '[{"method":"getBlock","params":{"index":1}},{"method":"getBalance","params":{"address":"ADDRESS"}}]' "http://localhost:8080/rpc"
+//
+// The body is a JSON array of calls which are run in order. The response is a JSON array holding the result of
+// each call at the same position, a failing call reports its error without affecting the others.
+func (api *API) handleRPC(w http.ResponseWriter, r *http.Request) {
+	var calls []RPCRequest
+	err := json.NewDecoder(r.Body).Decode(&calls)
+	if err != nil {
+		RespondError(w, http.StatusBadRequest, "Request body must be a JSON array of calls")
+		return
+	}
+
+	if len(calls) == 0 {
+		RespondError(w, http.StatusBadRequest, "No calls in batch")
+		return
+	}
+
+	if len(calls) > maxRPCBatchSize {
+		RespondError(w, http.StatusBadRequest, fmt.Sprintf("Batch exceeds the maximum of %d calls", maxRPCBatchSize))
+		return
+	}
+
+	responses := make([]RPCResponse, 0, len(calls))
+	for _, call := range calls {
+		responses = append(responses, api.dispatchRPC(call))
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the responses to JSON
+	data, err := json.Marshal(responses)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// dispatchRPC runs a single call.
+func (api *API) dispatchRPC(call RPCRequest) RPCResponse {
+	response := RPCResponse{Method: call.Method}
+
+	method, ok := rpcMethods[call.Method]
+	if !ok {
+		response.Error = fmt.Sprintf("unknown method: %s", call.Method)
+		return response
+	}
+
+	params := &rpcParams{}
+	if len(call.Params) > 0 {
+		err := json.Unmarshal(call.Params, params)
+		if err != nil {
+			response.Error = fmt.Sprintf("invalid params: %v", err)
+			return response
+		}
+	}
+
+	result, err := method(api.bc, params)
+	if err != nil {
+		response.Error = err.Error()
+		return response
+	}
+
+	response.Result = result
+	return response
+}
+
+// rpcGetBlock returns the block with the given index or hash.
+func rpcGetBlock(bc *Blockchain, params *rpcParams) (interface{}, error) {
+	var block *Block
+	switch {
+	case params.Index != nil:
+		block = bc.GetBlockByIndex(*params.Index)
+	case params.Hash != "":
+		block = bc.GetBlockByHash(params.Hash)
+	default:
+		return nil, errors.New("index or hash is required")
+	}
+
+	if block == nil {
+		return nil, errors.New("block not found")
+	}
+	return block, nil
+}
+
+// rpcGetBlockCount returns the number of blocks in the chain.
+func rpcGetBlockCount(bc *Blockchain, params *rpcParams) (interface{}, error) {
+	return bc.GetBlockCount(), nil
+}
+
+// rpcGetChainTip returns a summary of the latest block.
+func rpcGetChainTip(bc *Blockchain, params *rpcParams) (interface{}, error) {
+	tip := bc.GetChainTip()
+	if tip == nil {
+		return nil, errors.New("no blocks found")
+	}
+	return tip, nil
+}
+
+// rpcGetTransaction returns the queued or mined transaction with the given ID.
+func rpcGetTransaction(bc *Blockchain, params *rpcParams) (interface{}, error) {
+	if params.ID == "" {
+		return nil, errors.New("id is required")
+	}
+
+	tx := bc.GetTransactionByID(params.ID)
+	if tx == nil {
+		return nil, errors.New("transaction not found")
+	}
+	return NewTransactionView(tx), nil
+}
+
+// rpcGetTransactionReceipt returns the receipt for the transaction with the given ID.
+func rpcGetTransactionReceipt(bc *Blockchain, params *rpcParams) (interface{}, error) {
+	if params.ID == "" {
+		return nil, errors.New("id is required")
+	}
+	return bc.GetTransactionReceipt(params.ID), nil
+}
+
+// rpcGetBalance returns the balance of the wallet with the given address.
+func rpcGetBalance(bc *Blockchain, params *rpcParams) (interface{}, error) {
+	if params.Address == "" {
+		return nil, errors.New("address is required")
+	}
+	return bc.GetBalance(params.Address), nil
+}
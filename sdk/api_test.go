@@ -0,0 +1,1429 @@
+package sdk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/makiuchi-d/gozxing"
+	qrcodereader "github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveTestRequest sends a request through the API router and returns the recorded response.
+func serveTestRequest(api *API, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	rec := httptest.NewRecorder()
+	api.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandleViewWalletByAddressAndID(t *testing.T) {
+	useTestStorage(t)
+
+	wallet := &Wallet{
+		ID:        NewPUID(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(4)),
+		Address:   testAddr,
+		Encrypted: true,
+	}
+	require.NoError(t, localStorage.Set("wallet", wallet))
+
+	api := NewAPI(nil)
+
+	for _, id := range []string{wallet.Address, wallet.ID.String()} {
+		rec := serveTestRequest(api, http.MethodGet, "/blockchain/wallets/"+id)
+		require.Equal(t, http.StatusOK, rec.Code, id)
+
+		var response struct {
+			ID      string `json:"id"`
+			Address string `json:"address"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, wallet.ID.String(), response.ID)
+		assert.Equal(t, wallet.Address, response.Address)
+	}
+
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/wallets/unknown")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "64 character hex address")
+}
+
+func TestHandleNode(t *testing.T) {
+	cfg := &Config{}
+	cfg.setDefaultValues()
+
+	previous := node
+	node = &Node{ID: "test-node", Config: cfg, P2P: NewP2P()}
+	t.Cleanup(func() { node = previous })
+
+	require.NoError(t, node.P2P.RegisterNode(node))
+	require.NoError(t, node.P2P.RegisterNode(&Node{ID: "peer", Config: &Config{P2PHostName: "10.0.0.2:8101"}}))
+
+	rec := serveTestRequest(NewAPI(nil), http.MethodGet, "/node")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var details NodeDetails
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &details))
+	assert.NotEmpty(t, details.ID)
+	assert.Equal(t, node.ID, details.ID)
+	assert.Equal(t, cfg.P2PHostName, details.P2PAddress)
+	assert.Equal(t, BlockchainVersion, details.Version)
+	assert.False(t, details.IsSeed)
+	assert.Equal(t, 1, details.PeerCount)
+	assert.Equal(t, maxPeers, details.MaxPeers)
+}
+
+func TestHandleChainTip(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/tip")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	bc.GenerateGenesisBlock([]Transaction{})
+	genesis := bc.GetLatestBlock()
+
+	require.NoError(t, bc.AddTransaction(newTestMessage(t, "in the next block")))
+	bc.createNewBlock(1)
+	require.Equal(t, 2, bc.GetBlockCount())
+
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/tip")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var tip struct {
+		Index        int    `json:"index"`
+		Hash         string `json:"hash"`
+		PreviousHash string `json:"previous_hash"`
+		TxCount      int    `json:"tx_count"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tip))
+	assert.Equal(t, 1, tip.Index)
+	assert.Equal(t, bc.GetLatestBlock().Hash, tip.Hash)
+	assert.Equal(t, genesis.Hash, tip.PreviousHash)
+	assert.Equal(t, 1, tip.TxCount)
+}
+
+func TestHandleValidateChain(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	assert.False(t, isPublicPath("/blockchain/validate"))
+
+	bc.GenerateGenesisBlock([]Transaction{})
+	require.NoError(t, bc.AddTransaction(newTestMessage(t, "in the next block")))
+	bc.createNewBlock(1)
+	bc.createNewBlock(1)
+	require.Equal(t, 3, bc.GetBlockCount())
+
+	var report ChainValidationReport
+	rec := serveTestRequest(api, http.MethodPost, "/blockchain/validate")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.True(t, report.Valid)
+	assert.Empty(t, report.Error)
+	assert.Equal(t, 3, report.BlocksChecked)
+
+	// Tamper with the first mined block, validation stops once it has checked it
+	bc.Blocks[1].Header.Nonce++
+
+	report = ChainValidationReport{}
+	rec = serveTestRequest(api, http.MethodPost, "/blockchain/validate")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.False(t, report.Valid)
+	assert.Contains(t, report.Error, "block 1")
+	assert.Equal(t, 2, report.BlocksChecked)
+}
+
+func TestHandleTransactionReceipt(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	readReceipt := func(id string, expectedCode int) TransactionReceipt {
+		rec := serveTestRequest(api, http.MethodGet, "/blockchain/transactions/"+id+"/receipt")
+		require.Equal(t, expectedCode, rec.Code)
+
+		var receipt TransactionReceipt
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &receipt))
+		return receipt
+	}
+
+	// Unknown
+	receipt := readReceipt("unknown-transaction", http.StatusNotFound)
+	assert.Equal(t, ReceiptStatusNotFound, receipt.Status)
+
+	// Pending
+	tx := newTestMessage(t, "receipt")
+	require.NoError(t, bc.AddTransaction(tx))
+	receipt = readReceipt(tx.GetID(), http.StatusOK)
+	assert.Equal(t, ReceiptStatusPending, receipt.Status)
+	assert.Nil(t, receipt.BlockIndex)
+	assert.Equal(t, tx.GetFee(), receipt.Fee)
+
+	// Confirmed in block 1, then buried by block 2
+	bc.createNewBlock(1)
+	receipt = readReceipt(tx.GetID(), http.StatusOK)
+	assert.Equal(t, ReceiptStatusConfirmed, receipt.Status)
+	require.NotNil(t, receipt.BlockIndex)
+	assert.Equal(t, int64(1), receipt.BlockIndex.Int64())
+	assert.Equal(t, int64(1), receipt.Confirmations)
+
+	bc.createNewBlock(1)
+	receipt = readReceipt(tx.GetID(), http.StatusOK)
+	assert.Equal(t, int64(2), receipt.Confirmations)
+}
+
+func TestHandleRPCBatch(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+
+	bc.GenerateGenesisBlock([]Transaction{})
+	tx := newTestMessage(t, "rpc")
+	require.NoError(t, bc.AddTransaction(tx))
+	bc.createNewBlock(1)
+
+	body := `[
+		{"method": "getBlock", "params": {"index": 1}},
+		{"method": "getTransaction", "params": {"id": "` + tx.GetID() + `"}},
+		{"method": "getBalance", "params": {"address": "` + testAddr + `"}},
+		{"method": "getNothing"}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	api.router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var responses []struct {
+		Method string          `json:"method"`
+		Result json.RawMessage `json:"result"`
+		Error  string          `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &responses))
+	require.Len(t, responses, 4)
+
+	// getBlock
+	assert.Equal(t, "getBlock", responses[0].Method)
+	assert.Empty(t, responses[0].Error)
+	block, err := DecodeBlock(responses[0].Result)
+	require.NoError(t, err)
+	assert.Equal(t, bc.GetLatestBlock().Hash, block.Hash)
+
+	// getTransaction
+	assert.Empty(t, responses[1].Error)
+	var foundTx TransactionView
+	require.NoError(t, json.Unmarshal(responses[1].Result, &foundTx))
+	assert.Equal(t, tx.GetID(), foundTx.ID)
+	assert.Equal(t, MessageProtocolID, foundTx.Protocol)
+
+	// getBalance
+	assert.Empty(t, responses[2].Error)
+	var balance float64
+	require.NoError(t, json.Unmarshal(responses[2].Result, &balance))
+	assert.Equal(t, bc.GetBalance(testAddr), balance)
+
+	// Unknown methods fail on their own
+	assert.Contains(t, responses[3].Error, "unknown method")
+
+	req = httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(`{"method": "getBlock"}`))
+	rec = httptest.NewRecorder()
+	api.router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandleWalletQRCode(t *testing.T) {
+	useTestStorage(t)
+
+	wallet := &Wallet{
+		ID:      NewPUID(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(4)),
+		Address: testAddr,
+	}
+	require.NoError(t, localStorage.Set("wallet", wallet))
+
+	api := NewAPI(nil)
+
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/wallets/"+wallet.Address+"/qr")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+
+	img, err := png.Decode(rec.Body)
+	require.NoError(t, err)
+	bitmap, err := gozxing.NewBinaryBitmapFromImage(img)
+	require.NoError(t, err)
+	result, err := qrcodereader.NewQRCodeReader().Decode(bitmap, nil)
+	require.NoError(t, err)
+	assert.Equal(t, wallet.Address, result.GetText())
+
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/wallets/"+wallet.Address+"/qr?format=svg")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/svg+xml", rec.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(rec.Body.String(), "<svg"))
+
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/wallets/unknown/qr")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleViewTransaction(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	tx := newTestMessage(t, "view")
+	require.NoError(t, bc.AddTransaction(tx))
+	bc.createNewBlock(1)
+
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/transactions/"+tx.GetID())
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		CreatedAt   *time.Time `json:"created_at"`
+		ConfirmedAt *time.Time `json:"confirmed_at"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.NotNil(t, response.CreatedAt)
+	require.NotNil(t, response.ConfirmedAt)
+	assert.True(t, response.ConfirmedAt.Equal(*tx.GetConfirmedAt()))
+
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/transactions/unknown")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleWalletStatement(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	bank := func(from, to string, amount float64) *Bank {
+		tx := &Bank{Tx: newTestMessage(t, "").Tx, Amount: amount}
+		tx.Protocol = BankProtocolID
+		tx.From = &Wallet{Address: from}
+		tx.To = &Wallet{Address: to}
+		return tx
+	}
+
+	const other = "other-address"
+	require.NoError(t, bc.AddTransaction(bank(other, testAddr, 100)))
+	bc.createNewBlock(1)
+	transfer := bank(testAddr, other, 30)
+	message := newTestMessage(t, "costs a fee")
+	transfer.Nonce, message.Nonce = 1, 2 // Transactions from the same sender are ordered by nonce in a block
+	require.NoError(t, bc.AddTransaction(transfer))
+	require.NoError(t, bc.AddTransaction(message))
+	bc.createNewBlock(1)
+
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/wallets/"+testAddr+"/statement")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var statement []StatementLine
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statement))
+	require.Len(t, statement, 3)
+
+	assert.Equal(t, int64(1), statement[0].BlockIndex)
+	assert.Equal(t, 100.0, statement[0].Delta)
+	assert.Equal(t, int64(2), statement[1].BlockIndex)
+	assert.InDelta(t, -30-transactionFee, statement[1].Delta, 1e-9)
+	assert.InDelta(t, -transactionFee, statement[2].Delta, 1e-9)
+
+	// The statement ends at the wallet balance
+	assert.InDelta(t, bc.GetBalance(testAddr), statement[len(statement)-1].RunningBalance, 1e-9)
+}
+
+func TestHandleBlockProtocols(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	for i := 0; i < 3; i++ {
+		bank := &Bank{Tx: newTestMessage(t, "").Tx, Amount: 1}
+		bank.Protocol = BankProtocolID
+		require.NoError(t, bc.AddTransaction(bank))
+	}
+	require.NoError(t, bc.AddTransaction(newTestMessage(t, "mixed")))
+	bc.createNewBlock(1)
+
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/blocks/1/protocols")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var counts map[string]int
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &counts))
+	assert.Equal(t, map[string]int{BankProtocolID: 3, MessageProtocolID: 1}, counts)
+
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/blocks/9/protocols")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleBlockHeader(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+	require.NoError(t, bc.AddTransaction(newTestMessage(t, "header only")))
+	bc.createNewBlock(1)
+	block := bc.GetBlockByIndex(1)
+
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/blocks/1/header")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &fields))
+	assert.NotContains(t, fields, "transactions")
+	for _, field := range []string{"version", "previousHash", "merkleRoot", "timestamp", "difficulty", "nonce", "index", "hash"} {
+		assert.Contains(t, fields, field)
+	}
+
+	// The header is enough to check the block's hash
+	var header BlockHeaderSummary
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &header))
+	assert.Equal(t, int64(1), header.Index.Int64())
+	assert.Equal(t, block.Hash, header.Hash)
+	assert.Equal(t, block.Header.PreviousHash, header.PreviousHash)
+	fromHeader := &Block{
+		Header:          header.BlockHeader,
+		FeeRecipient:    header.FeeRecipient,
+		Reward:          header.Reward,
+		RewardRecipient: header.RewardRecipient,
+	}
+	assert.Equal(t, block.Hash, fromHeader.CalculateHash())
+
+	assert.Equal(t, http.StatusNotFound, serveTestRequest(api, http.MethodGet, "/blockchain/blocks/9/header").Code)
+	assert.Equal(t, http.StatusBadRequest, serveTestRequest(api, http.MethodGet, "/blockchain/blocks/x/header").Code)
+}
+
+func TestHandleExplorerBlock(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	msg := newTestMessage(t, "explorer")
+	require.NoError(t, bc.AddTransaction(msg))
+	bc.createNewBlock(1)
+
+	rec := serveTestRequest(api, http.MethodGet, "/explorer/blocks/1")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body := rec.Body.String()
+	assert.Contains(t, body, bc.GetBlockByIndex(1).Hash)
+	assert.Contains(t, body, `href="/blockchain/transactions/`+msg.GetID()+`"`)
+
+	rec = serveTestRequest(api, http.MethodGet, "/explorer/blocks/9")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleBrowseWalletsByTag(t *testing.T) {
+	useTestStorage(t)
+
+	miner, err := NewWallet(NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(4), "Miner", testPassPhrase, []string{"miner", "node"}))
+	require.NoError(t, err)
+	master, err := NewWallet(NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(5), "Master", testPassPhrase, []string{"master"}))
+	require.NoError(t, err)
+
+	api := NewAPI(nil)
+
+	browse := func(path string) []WalletSummary {
+		rec := serveTestRequest(api, http.MethodGet, path)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var wallets []WalletSummary
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &wallets))
+		return wallets
+	}
+
+	assert.Len(t, browse("/blockchain/wallets"), 2)
+
+	wallets := browse("/blockchain/wallets?tag=miner")
+	require.Len(t, wallets, 1)
+	assert.Equal(t, miner.GetAddress(), wallets[0].Address)
+	assert.Equal(t, []string{"miner", "node"}, wallets[0].Tags)
+
+	wallets = browse("/blockchain/wallets?tag=master")
+	require.Len(t, wallets, 1)
+	assert.Equal(t, master.GetAddress(), wallets[0].Address)
+
+	assert.Empty(t, browse("/blockchain/wallets?tag=unknown"))
+}
+
+func TestHandleStreamBlocks(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, bc.AddTransaction(newTestMessage(t, "streamed")))
+		bc.createNewBlock(1)
+	}
+	require.Equal(t, 4, bc.GetBlockCount())
+
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/blocks/stream?from=1&to=3")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	require.Len(t, lines, 3)
+	for i, line := range lines {
+		block, err := DecodeBlock([]byte(line))
+		require.NoError(t, err)
+
+		expected := bc.GetBlockByIndex(int64(i + 1))
+		assert.Equal(t, expected.Hash, block.Hash)
+		assert.Equal(t, expected.Header.PreviousHash, block.Header.PreviousHash)
+		assert.True(t, expected.Header.Timestamp.Equal(block.Header.Timestamp))
+		require.Len(t, block.Transactions, 1)
+		assert.Equal(t, expected.Transactions[0].GetID(), block.Transactions[0].GetID())
+	}
+
+	// "to" defaults to the latest block
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/blocks/stream?from=2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, strings.Split(strings.TrimSpace(rec.Body.String()), "\n"), 2)
+
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/blocks/stream?from=9")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/blocks/stream?from=3&to=1")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serveTestRequest(api, http.MethodGet, fmt.Sprintf("/blockchain/blocks/stream?from=0&to=%d", maxBlockStreamRange))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandleWaitForBlock(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	// A block that already exists is returned straight away
+	bc.createNewBlock(0)
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/blocks/waitfor?after=0")
+	require.Equal(t, http.StatusOK, rec.Code)
+	block, err := DecodeBlock(rec.Body.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, bc.GetBlockByIndex(1).Hash, block.Hash)
+
+	// Otherwise the request waits until the next block is mined
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		bc.createNewBlock(0)
+	}()
+	start := time.Now()
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/blocks/waitfor?after=1&timeout=10")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	block, err = DecodeBlock(rec.Body.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, "2", block.Index.String())
+
+	// No block arrives before the timeout
+	start = time.Now()
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/blocks/waitfor?after=2&timeout=1")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/blocks/waitfor?after=-1")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/blocks/waitfor?after=1&timeout=0")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+// maskTestWebSocketFrame masks an encoded frame with a payload under 126 bytes, as clients must.
+func maskTestWebSocketFrame(frame []byte) []byte {
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	masked := append([]byte{frame[0], frame[1] | 0x80}, mask...)
+	for i, b := range frame[2:] {
+		masked = append(masked, b^mask[i%4])
+	}
+	return masked
+}
+
+func TestWebSocketRejectsInvalidClientFrames(t *testing.T) {
+	tests := map[string][]byte{
+		"unmasked":        encodeWebSocketFrame(wsOpPing, []byte("ping")),
+		"reserved bits":   maskTestWebSocketFrame(append([]byte{0x80 | 0x40 | wsOpPing}, encodeWebSocketFrame(wsOpPing, nil)[1:]...)),
+		"fragmented ping": maskTestWebSocketFrame(append([]byte{wsOpPing}, encodeWebSocketFrame(wsOpPing, nil)[1:]...)),
+		"long ping":       append([]byte{0x80 | wsOpPing, 0x80 | 126, 0, 126, 0, 0, 0, 0}, make([]byte, 126)...),
+	}
+	for name, frame := range tests {
+		t.Run(name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+			ws := &wsConn{conn: server, reader: bufio.NewReader(server)}
+
+			done := make(chan error, 1)
+			go func() { done <- ws.ReadControl() }()
+
+			go client.Write(frame)
+			opcode, payload, err := readWebSocketFrame(client)
+			require.NoError(t, err)
+			assert.Equal(t, byte(wsOpClose), opcode)
+			assert.Equal(t, []byte{0x03, 0xEA}, payload, "the close status should be 1002")
+			assert.ErrorIs(t, <-done, ErrInvalidWebSocketFrame)
+		})
+	}
+
+	// A masked ping is answered
+	server, client := net.Pipe()
+	defer client.Close()
+	ws := &wsConn{conn: server, reader: bufio.NewReader(server)}
+	go ws.ReadControl()
+
+	go client.Write(maskTestWebSocketFrame(encodeWebSocketFrame(wsOpPing, []byte("ping"))))
+	opcode, payload, err := readWebSocketFrame(client)
+	require.NoError(t, err)
+	assert.Equal(t, byte(wsOpPong), opcode)
+	assert.Equal(t, []byte("ping"), payload)
+}
+
+func TestHandleWalletEvents(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	server := httptest.NewServer(api.router)
+	defer server.Close()
+
+	// Plain requests are refused
+	rec := serveTestRequest(api, http.MethodGet, "/ws/wallets/bob")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET /ws/wallets/bob HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n",
+		server.Listener.Addr().String(), key)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+
+	// Wait for the handler to subscribe before mining
+	require.Eventually(t, func() bool {
+		bc.mux.Lock()
+		defer bc.mux.Unlock()
+		return len(bc.addressSubscribers["bob"]) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	bank := newTestBankTx(t, "alice", "bob", 10)
+	bc.TransactionQueue = []Transaction{bank}
+	bc.createNewBlock(0)
+
+	opcode, payload, err := readWebSocketFrame(reader)
+	require.NoError(t, err)
+	require.Equal(t, byte(wsOpText), opcode)
+	var line StatementLine
+	require.NoError(t, json.Unmarshal(payload, &line))
+	assert.Equal(t, bank.GetID(), line.TxID)
+	assert.InDelta(t, 10, line.Delta, 1e-9)
+
+	// Closing the connection unsubscribes
+	_, err = conn.Write(maskTestWebSocketFrame(encodeWebSocketFrame(wsOpClose, nil)))
+	require.NoError(t, err)
+	opcode, _, err = readWebSocketFrame(reader)
+	require.NoError(t, err)
+	assert.Equal(t, byte(wsOpClose), opcode)
+	require.Eventually(t, func() bool {
+		bc.mux.Lock()
+		defer bc.mux.Unlock()
+		return len(bc.addressSubscribers["bob"]) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestHandleRawBlock(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+	require.NoError(t, bc.AddTransaction(newTestMessage(t, "raw")))
+	bc.createNewBlock(0)
+	block := bc.GetBlockByIndex(1)
+
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/blocks/1/raw")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+	assert.Equal(t, block.Hash, rec.Header().Get("X-Block-Hash"))
+
+	// The bytes decode back into the same block, which hashes to the advertised hash
+	decoded, err := DecodeBinaryBlock(rec.Body.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, rec.Header().Get("X-Block-Hash"), decoded.CalculateHash())
+	assert.Equal(t, block.Hash, decoded.Hash)
+	assert.Equal(t, block.Index.String(), decoded.Index.String())
+	require.Len(t, decoded.Transactions, 1)
+	assert.Equal(t, block.Transactions[0].GetID(), decoded.Transactions[0].GetID())
+	encoded, err := decoded.EncodeBinary()
+	require.NoError(t, err)
+	assert.Equal(t, rec.Body.Bytes(), encoded)
+
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/blocks/5/raw")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/blocks/abc/raw")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandleFeeEstimate(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/fees/estimate?fee=0.5")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var estimate FeeEstimate
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &estimate))
+	assert.Equal(t, 0.5, estimate.Fee)
+	assert.Equal(t, bc.cfg.MinTransactionFee, estimate.MinFee)
+	assert.Equal(t, float64(bc.cfg.BlockTime), estimate.EstimatedWaitInSecs)
+
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/fees/estimate?fee=-1")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAPIReadOnly(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	// Writes reach their handlers normally
+	rec := serveTestRequest(NewAPI(bc), http.MethodPost, "/blockchain/validate")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	bc.cfg.APIReadOnly = true
+	api := NewAPI(bc)
+
+	for _, path := range []string{"/rpc", "/blockchain/validate", "/blockchain/wallets/" + testAddr, "/consensus/tx"} {
+		rec = serveTestRequest(api, http.MethodPost, path)
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code, path)
+	}
+	rec = serveTestRequest(api, http.MethodDelete, "/blockchain/blocks/0")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, HEAD", rec.Header().Get("Allow"))
+
+	// Queries still work
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/blocks/0")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHandleRichList(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	bc.balances = map[string]float64{
+		"address-a": 5,
+		"address-b": 50,
+		"address-c": 0,
+		"address-d": 20,
+		"address-e": 20,
+	}
+	assert.Len(t, bc.GetAllBalances(), 4)
+	assert.NotContains(t, bc.GetAllBalances(), "address-c")
+
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/richlist")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var richList []RichListEntry
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &richList))
+	assert.Equal(t, []RichListEntry{
+		{Address: "address-b", Balance: 50},
+		{Address: "address-d", Balance: 20},
+		{Address: "address-e", Balance: 20},
+		{Address: "address-a", Balance: 5},
+	}, richList)
+
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/richlist?limit=2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &richList))
+	require.Len(t, richList, 2)
+	assert.Equal(t, "address-d", richList[1].Address)
+
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/richlist?limit=0")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandleExportWallet(t *testing.T) {
+	useTestStorage(t)
+	api := NewAPI(newTestBlockchain(t))
+	t.Cleanup(func() { exportAttempts = &exportLimiter{wallets: make(map[string]*exportFailures)} })
+
+	wallet, err := NewWallet(NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(4), "Backup", testPassPhrase, nil))
+	require.NoError(t, err)
+
+	exportRequest := func(id, remoteAddr, passphrase string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(WalletExportRequest{Passphrase: passphrase})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/blockchain/wallets/"+id+"/export", bytes.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "127.0.0.1")
+		rec := httptest.NewRecorder()
+		api.router.ServeHTTP(rec, req)
+		return rec
+	}
+	const local = "127.0.0.1:51234"
+
+	// Only the owner, who knows the passphrase, can download the keystore, and every refusal looks the same
+	missing := exportRequest(wallet.GetAddress(), local, "")
+	wrong := exportRequest(wallet.GetAddress(), local, "not the passphrase")
+	unknown := exportRequest(testAddr, local, testPassPhrase)
+	for _, rec := range []*httptest.ResponseRecorder{missing, wrong, unknown} {
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Equal(t, missing.Body.String(), rec.Body.String())
+	}
+
+	// Exports are only served to this host, whatever X-Forwarded-For claims
+	assert.Equal(t, http.StatusForbidden, exportRequest(wallet.GetAddress(), "192.0.2.1:1234", testPassPhrase).Code)
+
+	rec := exportRequest(wallet.GetAddress(), local, testPassPhrase)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), wallet.GetAddress()+".json")
+	assert.NotContains(t, rec.Body.String(), "PRIVATE KEY")
+
+	// The keystore restores the same key
+	imported, err := ImportWallet(rec.Body.Bytes(), testPassPhrase)
+	require.NoError(t, err)
+	assert.Equal(t, wallet.GetAddress(), imported.GetAddress())
+
+	// Too many wrong passphrases lock the wallet out, even for the right one, until the lockout expires. Guesses
+	// count against the same wallet whether it is named by its address or its PUID.
+	for i := 0; i < maxExportFailures; i++ {
+		id := wallet.GetAddress()
+		if i%2 == 1 {
+			id = wallet.ID.String()
+		}
+		exportRequest(id, local, "guess")
+	}
+	assert.Equal(t, http.StatusForbidden, exportRequest(wallet.GetAddress(), local, testPassPhrase).Code)
+	assert.True(t, exportAttempts.allowed(wallet.GetAddress(), time.Now().Add(exportLockout)))
+
+	require.NoError(t, wallet.Open(testPassPhrase))
+	assert.Equal(t, wallet.PrivatePEM(), imported.PrivatePEM())
+
+	// Unlocked wallets are never exported
+	_, err = wallet.Export()
+	assert.ErrorIs(t, err, ErrWalletNotLocked)
+}
+
+func TestConfirmationStats(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.cfg.RequiredConfirmations = 2
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	SetClock(func() time.Time { return now })
+	t.Cleanup(func() { SetClock(nil) })
+
+	assert.Zero(t, bc.GetConfirmationStats().Blocks)
+
+	// Each transaction waits 10 seconds in the mempool, and a block is mined every 10 seconds
+	for i := 0; i < 3; i++ {
+		tx := newTestMessage(t, "waiting")
+		tx.CreatedAt = now
+		bc.cfg.MaxBlockSize = tx.Size() * 4
+		require.NoError(t, bc.AddTransaction(tx))
+		now = now.Add(10 * time.Second)
+		bc.createNewBlock(1)
+	}
+
+	stats := bc.GetConfirmationStats()
+	assert.Equal(t, 3, stats.Blocks)
+	assert.Equal(t, 3, stats.Transactions)
+	assert.Equal(t, int64(2), stats.RequiredConfirmations)
+	assert.Equal(t, 2, stats.FinalBlocks) // The latest block has one confirmation
+	assert.InDelta(t, 10, stats.AvgTimeToFinal, 1e-9)
+	assert.InDelta(t, 10, stats.AvgMempoolWait, 1e-9)
+	assert.InDelta(t, 0.25, stats.AvgBlockFullness, 0.05)
+
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/health/detailed")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var served ConfirmationStats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	assert.Equal(t, stats, served)
+}
+
+func TestHandleNextBlockPreview(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	var high []*Message
+	for i := 0; i < 3; i++ {
+		tx := newTestMessage(t, "high")
+		tx.Fee = 1
+		require.NoError(t, bc.AddTransaction(tx))
+		high = append(high, tx)
+	}
+	low := newTestMessage(t, "low!")
+	low.Fee = minTransactionFee
+	require.NoError(t, bc.AddTransaction(low))
+
+	// Only two transactions fit in a block, the highest fees are chosen
+	bc.cfg.MaxBlockSize = high[0].Size()*2 + high[0].Size()/2
+
+	preview := bc.PreviewNextBlock()
+	ids := func(block *Block) []string {
+		var ids []string
+		for _, tx := range block.Transactions {
+			ids = append(ids, tx.GetID())
+		}
+		return ids
+	}
+	assert.ElementsMatch(t, []string{high[0].GetID(), high[1].GetID()}, ids(preview))
+	assert.Equal(t, int64(1), preview.Index.Int64())
+	assert.Equal(t, bc.GetLatestBlock().Hash, preview.Header.PreviousHash)
+
+	// Nothing is mined or taken from the mempool
+	assert.Len(t, bc.Blocks, 1)
+	assert.Equal(t, 4, bc.GetMempoolSize())
+	assert.Equal(t, StatusPending, high[0].GetStatus())
+
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/next-block/preview")
+	require.Equal(t, http.StatusOK, rec.Code)
+	block, err := DecodeBlock(rec.Body.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, ids(preview), ids(block))
+	assert.Equal(t, preview.Header.MerkleRoot, block.Header.MerkleRoot)
+
+	// The block that is mined holds the previewed transactions
+	bc.createNewBlock(1)
+	assert.Equal(t, ids(preview), ids(bc.GetLatestBlock()))
+}
+
+func TestBrowseWithCursorWhileChainGrows(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+	for i := 0; i < 4; i++ {
+		require.NoError(t, bc.AddTransaction(newTestMessage(t, "before")))
+		bc.createNewBlock(1)
+	}
+
+	// Blocks are added while the explorer pages through the chain
+	const added = 12
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < added; i++ {
+			bc.AddTransaction(newTestMessage(t, "during"))
+			bc.createNewBlock(1)
+		}
+	}()
+
+	browse := func(path, cursor string, page interface{}) string {
+		rec := serveTestRequest(api, http.MethodGet, path+"?limit=3&cursor="+cursor)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var response struct {
+			Items      json.RawMessage `json:"items"`
+			NextCursor string          `json:"next_cursor"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		require.NoError(t, json.Unmarshal(response.Items, page))
+		return response.NextCursor
+	}
+
+	var indexes []int64
+	cursor := ""
+	finished := false
+	for {
+		var blocks []struct {
+			Index *big.Int `json:"index"`
+		}
+		cursor = browse("/blockchain/blocks", cursor, &blocks)
+		for _, block := range blocks {
+			indexes = append(indexes, block.Index.Int64())
+		}
+		if len(blocks) < 3 {
+			if finished {
+				break
+			}
+			select {
+			case <-done:
+				finished = true // One more page picks up the blocks added since
+			default:
+			}
+		}
+	}
+
+	require.Len(t, indexes, 5+added)
+	for i, index := range indexes {
+		assert.Equal(t, int64(i), index, "blocks must be returned once, in order")
+	}
+
+	// Transactions are paged the same way, across block boundaries
+	var ids []string
+	cursor = ""
+	for {
+		var txs []TransactionView
+		cursor = browse("/blockchain/transactions", cursor, &txs)
+		for _, tx := range txs {
+			ids = append(ids, tx.ID)
+		}
+		if len(txs) < 3 {
+			break
+		}
+	}
+	var expected []string
+	for _, block := range bc.Blocks {
+		for _, tx := range block.Transactions {
+			expected = append(expected, tx.GetID())
+		}
+	}
+	assert.Equal(t, expected, ids)
+
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/blocks?cursor=not-a-cursor")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestPrettyJSONResponses(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+	bc.balances = map[string]float64{"address-a": 5, "address-b": 50}
+
+	compact := serveTestRequest(api, http.MethodGet, "/blockchain/richlist")
+	require.Equal(t, http.StatusOK, compact.Code)
+	assert.NotContains(t, compact.Body.String(), "\n")
+
+	pretty := serveTestRequest(api, http.MethodGet, "/blockchain/richlist?pretty=true")
+	require.Equal(t, http.StatusOK, pretty.Code)
+	assert.Equal(t, "application/json", pretty.Header().Get("Content-Type"))
+	assert.Contains(t, pretty.Body.String(), "\n  {\n    \"address\"")
+
+	// Both parse to the same data
+	var compactList, prettyList []RichListEntry
+	require.NoError(t, json.Unmarshal(compact.Body.Bytes(), &compactList))
+	require.NoError(t, json.Unmarshal(pretty.Body.Bytes(), &prettyList))
+	assert.Equal(t, compactList, prettyList)
+
+	// Other content types are left alone
+	rec := serveTestRequest(api, http.MethodGet, "/metrics?pretty=true")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "# TYPE http_requests_total counter")
+}
+
+func TestHandleBalances(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	bc.balances = map[string]float64{
+		"address-a": 5,
+		"address-b": 50,
+	}
+
+	query := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/blockchain/balances", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		api.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := query(`["address-a", "address-b", "address-unknown"]`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var balances map[string]float64
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &balances))
+	assert.Equal(t, map[string]float64{
+		"address-a":       5,
+		"address-b":       50,
+		"address-unknown": 0,
+	}, balances)
+
+	assert.Equal(t, http.StatusBadRequest, query(`{"address": "address-a"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, query(`[]`).Code)
+
+	tooMany, err := json.Marshal(make([]string, maxBalanceQueryAddresses+1))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, query(string(tooMany)).Code)
+}
+
+func TestHandleConsensusRegister(t *testing.T) {
+	cfg := &Config{}
+	cfg.setDefaultValues()
+
+	previous := node
+	node = &Node{ID: "test-node", Config: cfg, P2P: NewP2P()}
+	t.Cleanup(func() { node = previous })
+	require.NoError(t, node.P2P.RegisterNode(node))
+
+	register := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/consensus/register", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		NewAPI(nil).handleConsensusRegister(rec, req)
+		return rec
+	}
+
+	rec := register(`{"id":"peer","address":"10.0.0.2:8101"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var nodes []NodeInfo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &nodes))
+	assert.ElementsMatch(t, []NodeInfo{
+		{ID: "test-node", Address: cfg.P2PHostName},
+		{ID: "peer", Address: "10.0.0.2:8101"},
+	}, nodes)
+	assert.Equal(t, []NodeInfo{{ID: "peer", Address: "10.0.0.2:8101"}}, node.P2P.GetPeers())
+
+	// Registering again returns the node list without adding the peer twice
+	rec = register(`{"id":"peer","address":"10.0.0.2:8101"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, node.P2P.GetPeers(), 1)
+
+	rec = register(`{"id":"no-address"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	node.P2P.SetMaxPeers(1)
+	rec = register(`{"id":"another-peer","address":"10.0.0.3:8101"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestAuthenticateNode(t *testing.T) {
+	cfg := &Config{}
+	cfg.setDefaultValues()
+	cfg.NodeToken = "shared-node-token-0123"
+
+	previous := node
+	node = &Node{ID: "test-node", Config: cfg, P2P: NewP2P()}
+	t.Cleanup(func() { node = previous })
+	require.NoError(t, node.P2P.RegisterNode(node))
+
+	peerKey, err := GenerateKey(KeyTypeP256)
+	require.NoError(t, err)
+	require.NoError(t, node.P2P.RegisterPeer(NodeInfo{ID: "peer", Address: "10.0.0.2:8101", PublicKey: NewPEM(peerKey).GetPublic()}))
+	peerHash, err := publicKeyHash(NewPEM(peerKey).GetPublic())
+	require.NoError(t, err)
+	cfg.TrustedPeers = []string{EncodeAddress(peerHash)}
+
+	// A registered peer whose key is not trusted
+	untrustedKey, err := GenerateKey(KeyTypeP256)
+	require.NoError(t, err)
+	require.NoError(t, node.P2P.RegisterPeer(NodeInfo{ID: "untrusted", Address: "10.0.0.4:8101", PublicKey: NewPEM(untrustedKey).GetPublic()}))
+
+	api := NewAPI(nil)
+	body := `{"id":"peer","address":"10.0.0.2:8101"}`
+	post := func(prepare func(r *http.Request)) int {
+		req := httptest.NewRequest(http.MethodPost, "/consensus/register", strings.NewReader(body))
+		prepare(req)
+		rec := httptest.NewRecorder()
+		api.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// A request signed by a registered peer is accepted
+	assert.Equal(t, http.StatusOK, post(func(r *http.Request) {
+		require.NoError(t, SignNodeRequest(r, "peer", peerKey))
+	}))
+
+	// As is one with the shared node token
+	assert.Equal(t, http.StatusOK, post(func(r *http.Request) {
+		r.Header.Set(NodeTokenHeader, cfg.NodeToken)
+	}))
+
+	// Requests without credentials, or from unknown or forged peers, are refused
+	forgedKey, err := GenerateKey(KeyTypeP256)
+	require.NoError(t, err)
+	for name, prepare := range map[string]func(r *http.Request){
+		"no credentials": func(r *http.Request) {},
+		"unknown peer": func(r *http.Request) {
+			require.NoError(t, SignNodeRequest(r, "stranger", forgedKey))
+		},
+		"forged signature": func(r *http.Request) {
+			require.NoError(t, SignNodeRequest(r, "peer", forgedKey))
+		},
+		"untrusted peer": func(r *http.Request) {
+			require.NoError(t, SignNodeRequest(r, "untrusted", untrustedKey))
+		},
+		"no nonce": func(r *http.Request) {
+			require.NoError(t, SignNodeRequest(r, "peer", peerKey))
+			r.Header.Del(NodeNonceHeader)
+		},
+		"changed nonce": func(r *http.Request) {
+			require.NoError(t, SignNodeRequest(r, "peer", peerKey))
+			r.Header.Set(NodeNonceHeader, generateRandomToken())
+		},
+		"wrong token": func(r *http.Request) {
+			r.Header.Set(NodeTokenHeader, "not-the-node-token")
+		},
+		"stale timestamp": func(r *http.Request) {
+			require.NoError(t, SignNodeRequest(r, "peer", peerKey))
+			r.Header.Set(NodeTimestampHeader, strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+		},
+		"tampered body": func(r *http.Request) {
+			require.NoError(t, SignNodeRequest(r, "peer", peerKey))
+			r.Body = io.NopCloser(strings.NewReader(`{"id":"other","address":"10.0.0.9:8101"}`))
+		},
+	} {
+		assert.Equal(t, http.StatusUnauthorized, post(prepare), name)
+	}
+	assert.False(t, node.P2P.IsRegistered("other"))
+
+	// A signed request is only accepted once
+	signed := httptest.NewRequest(http.MethodPost, "/consensus/register", strings.NewReader(body))
+	require.NoError(t, SignNodeRequest(signed, "peer", peerKey))
+	replay := func(r *http.Request) { r.Header = signed.Header.Clone() }
+	assert.Equal(t, http.StatusOK, post(replay))
+	assert.Equal(t, http.StatusUnauthorized, post(replay), "replayed request")
+
+	// Bodies larger than a P2P message are not read into memory
+	large := strings.Repeat(" ", maxP2PMessageSize+1)
+	assert.Equal(t, http.StatusUnauthorized, post(func(r *http.Request) {
+		require.NoError(t, SignNodeRequest(r, "peer", peerKey))
+		r.Body = io.NopCloser(strings.NewReader(large))
+	}))
+	assert.Error(t, SignNodeRequest(httptest.NewRequest(http.MethodPost, "/consensus/register", strings.NewReader(large)), "peer", peerKey))
+}
+
+func TestHandleConfigSchema(t *testing.T) {
+	rec := serveTestRequest(NewAPI(nil), http.MethodGet, "/info/config/schema")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var fields []ConfigField
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &fields))
+	byName := make(map[string]ConfigField)
+	for _, field := range fields {
+		byName[field.Name] = field
+	}
+
+	difficulty := byName["Difficulty"]
+	assert.Equal(t, "integer", difficulty.Type)
+	assert.Equal(t, float64(proofOfWorkDifficulty), difficulty.Default)
+	require.NotNil(t, difficulty.Constraints)
+	assert.Equal(t, 0.0, *difficulty.Constraints.Minimum)
+
+	blockTime := byName["BlockTime"]
+	assert.Equal(t, "integer", blockTime.Type)
+	assert.Equal(t, float64(blockTimeInSec), blockTime.Default)
+	require.NotNil(t, blockTime.Constraints)
+	assert.Equal(t, 0.0, *blockTime.Constraints.ExclusiveMinimum)
+
+	assert.Equal(t, "number", byName["TransactionFee"].Type)
+	assert.Equal(t, "boolean", byName["EnableAPI"].Type)
+	assert.Equal(t, "array", byName["SeedAddresses"].Type)
+	assert.Equal(t, []string{FeePolicyMiner, FeePolicyBurn, FeePolicyTreasury}, byName["FeePolicy"].Constraints.Enum)
+
+	// Secrets are marked, and their values never sent
+	assert.True(t, byName["GMailPassword"].Secret)
+	assert.Nil(t, byName["GMailPassword"].Default)
+	assert.True(t, byName["NodeToken"].Secret)
+
+	// The numeric bounds are the ones Validate enforces
+	for _, field := range ConfigSchema() {
+		c := field.Constraints
+		if c == nil || (field.Type != "integer" && field.Type != "number") || c.Note != "" {
+			continue
+		}
+		check := func(value float64) error {
+			cfg := NewConfig()
+			v := reflect.ValueOf(cfg).Elem().FieldByName(field.Name)
+			if v.CanInt() {
+				v.SetInt(int64(value))
+			} else {
+				v.SetFloat(value)
+			}
+			return cfg.Validate()
+		}
+		if c.Minimum != nil {
+			assert.NoError(t, check(*c.Minimum), field.Name)
+			assert.Error(t, check(*c.Minimum-1), field.Name)
+		}
+		if c.ExclusiveMinimum != nil {
+			assert.NoError(t, check(*c.ExclusiveMinimum+1), field.Name)
+			assert.Error(t, check(*c.ExclusiveMinimum), field.Name)
+		}
+		if c.Maximum != nil {
+			assert.NoError(t, check(*c.Maximum), field.Name)
+			assert.Error(t, check(*c.Maximum+1), field.Name)
+		}
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+	api := NewAPI(bc)
+
+	const route = "/blockchain/blocks/{index}"
+	assert.Zero(t, api.metrics.RequestCount(http.MethodGet, route, http.StatusOK))
+
+	serveTestRequest(api, http.MethodGet, "/blockchain/blocks/0")
+	serveTestRequest(api, http.MethodGet, "/blockchain/blocks/0")
+	serveTestRequest(api, http.MethodGet, "/blockchain/blocks/9")
+	assert.Equal(t, uint64(2), api.metrics.RequestCount(http.MethodGet, route, http.StatusOK))
+	assert.Equal(t, uint64(1), api.metrics.RequestCount(http.MethodGet, route, http.StatusNotFound))
+
+	rec := serveTestRequest(api, http.MethodGet, "/metrics")
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/blockchain/blocks/{index}",code="200"} 2`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/blockchain/blocks/{index}",code="404"} 1`)
+	assert.Contains(t, body, `http_request_duration_seconds_bucket{method="GET",route="/blockchain/blocks/{index}",le="+Inf"} 3`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/blockchain/blocks/{index}"} 3`)
+}
+
+func TestHandleConsensusBlockRejectsDuplicates(t *testing.T) {
+	useTestStorage(t)
+	cfg := &Config{}
+	cfg.setDefaultValues()
+	cfg.NodeToken = "shared-node-token-0123"
+
+	previous := node
+	node = &Node{ID: "test-node", Config: cfg, P2P: NewP2P()}
+	t.Cleanup(func() { node = previous })
+
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+	msg := newSignedTestMessage(t, "from a peer")
+	bc.GenerateGenesisBlock(genesisAllocations(map[string]float64{msg.From.GetAddress(): 1}))
+
+	block := newPeerTestBlock(t, bc.GetLatestBlock(), msg)
+	body, err := json.Marshal(block)
+	require.NoError(t, err)
+
+	submit := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/consensus/block", strings.NewReader(string(body)))
+		req.Header.Set(NodeTokenHeader, cfg.NodeToken)
+		rec := httptest.NewRecorder()
+		api.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	require.Equal(t, http.StatusCreated, submit().Code)
+	require.Len(t, bc.Blocks, 2)
+	assert.Equal(t, block.Hash, bc.GetLatestBlock().Hash)
+	balance := bc.GetBalance(msg.From.GetAddress())
+
+	// The same block again is refused and leaves the chain and balances as they were
+	assert.Equal(t, http.StatusConflict, submit().Code)
+	assert.Len(t, bc.Blocks, 2)
+	assert.Equal(t, balance, bc.GetBalance(msg.From.GetAddress()))
+	assert.ErrorIs(t, bc.AddBlock(block), ErrDuplicateBlock)
+}
+
+func TestConsensusTxIdempotencyKey(t *testing.T) {
+	useTestStorage(t)
+	cfg := &Config{}
+	cfg.setDefaultValues()
+	cfg.NodeToken = "shared-node-token-0123"
+
+	previous := node
+	node = &Node{ID: "test-node", Config: cfg, P2P: NewP2P()}
+	t.Cleanup(func() { node = previous })
+
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+
+	persisted, err := NewPersistedTransaction(newSignedTestMessage(t, "submitted once"))
+	require.NoError(t, err)
+	body, err := json.Marshal(persisted)
+	require.NoError(t, err)
+
+	submit := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/consensus/tx", strings.NewReader(string(body)))
+		req.Header.Set(NodeTokenHeader, cfg.NodeToken)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		api.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := submit("retry-1")
+	assert.Equal(t, http.StatusAccepted, first.Code)
+	assert.Empty(t, first.Header().Get(IdempotentReplayedHeader))
+
+	// A retry with the same key gets the first response without queuing the transaction again
+	retry := submit("retry-1")
+	assert.Equal(t, http.StatusAccepted, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 1, bc.GetMempoolSize())
+
+	// Without the key the duplicate is handled, and refused, as usual
+	assert.Equal(t, http.StatusConflict, submit("").Code)
+	assert.Equal(t, 1, bc.GetMempoolSize())
+}
+
+func TestRequestIDAndResponseEnvelope(t *testing.T) {
+	get := func(api *API, path, requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+		rec := httptest.NewRecorder()
+		api.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Every response carries a request ID, the client's own when it sent a usable one
+	plain := NewAPI(newTestBlockchain(t))
+	rec := get(plain, "/blockchain", "")
+	assert.NotEmpty(t, rec.Header().Get(RequestIDHeader))
+	assert.NotContains(t, rec.Body.String(), "request_id", "responses are not wrapped unless configured")
+	assert.Equal(t, "client-request-1", get(plain, "/blockchain", "client-request-1").Header().Get(RequestIDHeader))
+	assert.NotEqual(t, "bad id", get(plain, "/blockchain", "bad id").Header().Get(RequestIDHeader))
+
+	bc := newTestBlockchain(t)
+	bc.cfg.APIResponseEnvelope = true
+	enveloped := NewAPI(bc)
+
+	// Data is the response the handler wrote
+	rec = get(enveloped, "/blockchain", "client-request-2")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "client-request-2", rec.Header().Get(RequestIDHeader))
+	var envelope struct {
+		RequestID string `json:"request_id"`
+		Data      struct {
+			NumBlocks int `json:"num_blocks"`
+		} `json:"data"`
+		Error *ErrorResponse `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &envelope))
+	assert.Equal(t, "client-request-2", envelope.RequestID)
+	assert.Equal(t, 0, envelope.Data.NumBlocks)
+	assert.Nil(t, envelope.Error)
+
+	// Errors are wrapped too, with a generated ID when the client sent none
+	rec = get(enveloped, "/blockchain/blocks/99", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	var failed ResponseEnvelope
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &failed))
+	assert.Equal(t, rec.Header().Get(RequestIDHeader), failed.RequestID)
+	assert.NotEmpty(t, failed.RequestID)
+	assert.Equal(t, "null", string(failed.Data))
+	if assert.NotNil(t, failed.Error) {
+		assert.NotEmpty(t, failed.Error.Message)
+	}
+}
@@ -0,0 +1,34 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/balanceproof.go - Checking the balance held in a wallet against the chain
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrBalanceMismatch is returned by VerifyBalanceProof when the balance held in a wallet's vault is not the balance
+// calculated from the chain.
+var ErrBalanceMismatch = errors.New("wallet balance does not match the chain")
+
+// VerifyBalanceProof recalculates the wallet's balance by replaying every transaction in the chain and compares it
+// with the balance held in the wallet's vault, which is only updated by this node and can drift from the chain.
+// A difference is returned as an error wrapping ErrBalanceMismatch with both balances. The wallet must be unlocked.
+func (w *Wallet) VerifyBalanceProof(bc *Blockchain) (bool, error) {
+	if w.Encrypted {
+		return false, errors.New("wallet must be unlocked to verify its balance")
+	}
+
+	address := w.GetAddress()
+	held := w.GetBalance()
+
+	bc.mux.Lock()
+	calculated := bc.calculateBalance(address)
+	bc.mux.Unlock()
+
+	if math.Abs(held-calculated) >= balanceEpsilon {
+		return false, fmt.Errorf("%w: wallet %s holds %f, the chain gives %f", ErrBalanceMismatch, address, held, calculated)
+	}
+	return true, nil
+}
@@ -3,9 +3,26 @@
 package sdk
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"sync/atomic"
 )
 
+// Bank transaction input errors, returned wrapped by NewBankTransaction.
+var (
+	ErrInvalidAmount = errors.New("amount must be a positive number")
+	ErrSelfTransfer  = errors.New("sender and recipient are the same wallet")
+)
+
+// selfTransfersAllowed is set from Config.AllowSelfTransfers when the blockchain is created.
+var selfTransfersAllowed atomic.Bool
+
+// SetAllowSelfTransfers sets whether NewBankTransaction accepts transfers where the sender is also the recipient.
+func SetAllowSelfTransfers(allow bool) {
+	selfTransfersAllowed.Store(allow)
+}
+
 // Bank is a transaction that represents a bank transfer.
 // It embeds the Tx struct and adds an Amount field to represent the transfer amount.
 type Bank struct {
@@ -14,11 +31,26 @@ type Bank struct {
 }
 
 // NewBankTransaction creates a new Bank transaction. It takes a from wallet, a to wallet, and an amount to transfer.
-// It first creates a new Transaction using the BankProtocolID, the from wallet, and the to wallet.
-// It then checks if the from wallet has enough balance to cover the transfer amount plus the transaction fee.
+// Both wallets must be set and have valid addresses, and the amount must be positive. Transfers to the sending
+// wallet are refused with ErrSelfTransfer unless allowed by SetAllowSelfTransfers.
+// It then creates a new Transaction using the BankProtocolID, the from wallet, and the to wallet.
+// Finally it checks if the from wallet has enough balance to cover the transfer amount plus the transaction fee.
 // If the balance is sufficient, it returns a new Bank transaction with the created Transaction and the transfer amount.
 // If the balance is insufficient, it returns an error.
 func NewBankTransaction(from *Wallet, to *Wallet, amount float64) (*Bank, error) {
+	err := validateParties(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	if amount <= 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAmount, amount)
+	}
+
+	if from.GetAddress() == to.GetAddress() && !selfTransfersAllowed.Load() {
+		return nil, fmt.Errorf("%w: %s", ErrSelfTransfer, from.GetAddress())
+	}
+
 	tx, err := NewTransaction(BankProtocolID, from, to)
 	if err != nil {
 		return nil, err
@@ -30,10 +62,13 @@ func NewBankTransaction(from *Wallet, to *Wallet, amount float64) (*Bank, error)
 		return nil, fmt.Errorf("insufficient balance in the wallet")
 	}
 
-	return &Bank{
+	bank := &Bank{
 		Tx:     *tx,
 		Amount: amount,
-	}, nil
+	}
+	bank.ID = bank.computeID(amount)
+
+	return bank, nil
 }
 
 // Process processes the bank transaction. It first checks if the "From" wallet has enough balance to cover the transaction amount plus the transaction fee. If the balance is sufficient, it subtracts the amount and fee from the "From" wallet and adds the amount to the "To" wallet. It returns a formatted string indicating the success or failure of the transaction.
@@ -54,3 +89,8 @@ func (b *Bank) Process() string {
 
 	return fmt.Sprintf("Transferred %f from %s to %s", b.Amount, b.From.Address, b.To.Address)
 }
+
+// Size returns the size of the bank transaction in bytes, including its protocol specific fields.
+func (b *Bank) Size() int {
+	return serializedSize(b)
+}
@@ -15,6 +15,7 @@ import (
 	"math"
 	"math/big"
 	"os"
+	"sort"
 	"time"
 )
 
@@ -29,6 +30,20 @@ const (
 	InitialBlockReward = 50.0
 )
 
+// timeNow returns the time blocks are stamped and checked with. It is replaced with SetClock to freeze time for
+// reproducible blocks.
+var timeNow = time.Now
+
+// SetClock sets the clock blocks are stamped with when they are created, and their timestamps are checked against
+// when they are validated. Blocks with the same content created at the same time have the same hash, so a frozen
+// clock gives reproducible chains. A nil clock restores the real time.
+func SetClock(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	timeNow = now
+}
+
 // BlockHeader represents the header of a block in the blockchain.
 type BlockHeader struct {
 	Version      int32     `json:"version"`
@@ -44,8 +59,38 @@ type Block struct {
 	Header       BlockHeader   `json:"header"`
 	Transactions []Transaction `json:"transactions"`
 	bloomFilter  *BloomFilter
-	Index        big.Int `json:"index"` // Maintain original Index for backwards compatibility
-	Hash         string  `json:"hash"`  // Maintain original Hash for backwards compatibility
+	Index        big.Int `json:"index"`                   // Maintain original Index for backwards compatibility
+	Hash         string  `json:"hash"`                    // Maintain original Hash for backwards compatibility
+	FeeRecipient string  `json:"fee_recipient,omitempty"` // Address credited with the block's fees, empty when they are burned
+
+	// The coinbase credit of a mined block: Reward new coins, created by the block, are credited to RewardRecipient.
+	// Both are empty for the genesis block and blocks mined before rewards were paid.
+	Reward          float64 `json:"reward,omitempty"`
+	RewardRecipient string  `json:"reward_recipient,omitempty"`
+}
+
+// BlockHeaderSummary is a block without its transactions: the header with the index and hash, and the fee
+// recipient and reward the hash commits to. Light clients follow the chain with these and fetch full blocks on
+// demand.
+type BlockHeaderSummary struct {
+	BlockHeader
+	Index           *big.Int `json:"index"`
+	Hash            string   `json:"hash"`
+	FeeRecipient    string   `json:"fee_recipient,omitempty"`
+	Reward          float64  `json:"reward,omitempty"`
+	RewardRecipient string   `json:"reward_recipient,omitempty"`
+}
+
+// HeaderSummary returns the block's header, index and hash without its transactions.
+func (b *Block) HeaderSummary() BlockHeaderSummary {
+	return BlockHeaderSummary{
+		BlockHeader:     b.Header,
+		Index:           new(big.Int).Set(&b.Index),
+		Hash:            b.Hash,
+		FeeRecipient:    b.FeeRecipient,
+		Reward:          b.Reward,
+		RewardRecipient: b.RewardRecipient,
+	}
 }
 
 // NewBlock creates a new block with the given transactions and previous hash.
@@ -54,11 +99,11 @@ func NewBlock(transactions []Transaction, previousHash string) *Block {
 		Header: BlockHeader{
 			Version:      1,
 			PreviousHash: previousHash,
-			Timestamp:    time.Now(),
+			Timestamp:    timeNow().Round(0), // Strip the monotonic clock reading, it is part of the hash but is never persisted
 			Difficulty:   InitialDifficulty,
 			Nonce:        0,
 		},
-		Transactions: transactions,
+		Transactions: canonicalOrder(transactions),
 		Index:        *big.NewInt(0), // Initialize with zero, should be set properly when adding to blockchain
 	}
 	block.Header.MerkleRoot = block.CalculateMerkleRoot()
@@ -67,6 +112,24 @@ func NewBlock(transactions []Transaction, previousHash string) *Block {
 	return block
 }
 
+// canonicalOrder returns the transactions sorted by sender address, then nonce, then ID. Blocks are always
+// assembled in this order, so nodes that put the same transactions in a block get the same Merkle root whatever
+// order they were queued in.
+func canonicalOrder(transactions []Transaction) []Transaction {
+	ordered := append([]Transaction{}, transactions...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		senderI, senderJ := ordered[i].GetSenderWallet().GetAddress(), ordered[j].GetSenderWallet().GetAddress()
+		if senderI != senderJ {
+			return senderI < senderJ
+		}
+		if ordered[i].GetNonce() != ordered[j].GetNonce() {
+			return ordered[i].GetNonce() < ordered[j].GetNonce()
+		}
+		return ordered[i].GetID() < ordered[j].GetID()
+	})
+	return ordered
+}
+
 // String returns a string representation of the block.
 func (b *Block) String() string {
 	return fmt.Sprintf("Index: %v, Timestamp: %s, Transactions: %d, Nonce: %d, Hash: %s, PreviousHash: %s",
@@ -129,28 +192,81 @@ func (b *Block) load(blockNumber big.Int) error {
 	return nil
 }
 
-// Validate checks if the block is valid.
+// Block validation errors, returned wrapped by Block.Validate so callers can check them with errors.Is.
+var (
+	ErrInvalidPreviousHash = errors.New("invalid previous hash")
+	ErrFutureTimestamp     = errors.New("block timestamp is in the future")
+	ErrInvalidHash         = errors.New("invalid block hash")
+	ErrInvalidTransaction  = errors.New("invalid transaction")
+	ErrInvalidMerkleRoot   = errors.New("invalid merkle root")
+)
+
+// Validate checks if the block is valid. The error wraps one of ErrInvalidPreviousHash, ErrFutureTimestamp,
+// ErrInvalidTransaction or ErrInvalidHash. Timestamps may be up to the default clock skew in the future.
 func (b *Block) Validate(previousBlock *Block) error {
+	return b.ValidateWithClockSkew(previousBlock, maxClockSkewInSec*time.Second)
+}
+
+// ValidateWithClockSkew checks if the block is valid like Validate, allowing the block timestamp to be up to
+// maxSkew ahead of this node's clock to tolerate small differences between the clocks of peers.
+func (b *Block) ValidateWithClockSkew(previousBlock *Block, maxSkew time.Duration) error {
 	if b.Header.PreviousHash != previousBlock.Hash {
-		return errors.New("invalid previous hash")
+		return ErrInvalidPreviousHash
 	}
-	if b.Header.Timestamp.After(time.Now()) {
-		return errors.New("block timestamp is in the future")
+	if b.Header.Timestamp.After(timeNow().Add(maxSkew)) {
+		return ErrFutureTimestamp
 	}
 	for _, tx := range b.Transactions {
 		if tx.GetStatus() != StatusConfirmed {
-			return fmt.Errorf("invalid transaction status: %v", tx.GetStatus())
+			return fmt.Errorf("%w status: %v", ErrInvalidTransaction, tx.GetStatus())
 		}
 		if err := tx.Validate(); err != nil {
-			return fmt.Errorf("invalid transaction: %v", err)
+			return fmt.Errorf("%w: %v", ErrInvalidTransaction, err)
 		}
 	}
 	if b.Hash != b.CalculateHash() {
-		return errors.New("invalid block hash")
+		return ErrInvalidHash
 	}
 	return nil
 }
 
+// VerifyBlockFile checks a block saved as JSON, such as one from the blocks data folder, without loading the rest
+// of the chain. The Merkle root and hash are recomputed from the block's contents and its previous hash is compared
+// with previousHash, unless previousHash is empty. The error wraps ErrInvalidPreviousHash, ErrInvalidMerkleRoot or
+// ErrInvalidHash when the block does not match.
+func VerifyBlockFile(path string, previousHash string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	block, err := DecodeBlock(data)
+	if err != nil {
+		return err
+	}
+
+	if previousHash != "" && block.Header.PreviousHash != previousHash {
+		return fmt.Errorf("%w: block %s follows %s, not %s", ErrInvalidPreviousHash, block.Index.String(),
+			block.Header.PreviousHash, previousHash)
+	}
+	if !bytes.Equal(block.Header.MerkleRoot, block.CalculateMerkleRoot()) {
+		return fmt.Errorf("%w: block %s", ErrInvalidMerkleRoot, block.Index.String())
+	}
+	if block.Hash != block.CalculateHash() {
+		return fmt.Errorf("%w: block %s", ErrInvalidHash, block.Index.String())
+	}
+	return nil
+}
+
+// ProtocolCounts returns the number of transactions in the block for each protocol.
+func (b *Block) ProtocolCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, tx := range b.Transactions {
+		counts[tx.GetProtocol()]++
+	}
+	return counts
+}
+
 // CalculateMerkleRoot calculates the Merkle root of the block's transactions.
 func (b *Block) CalculateMerkleRoot() []byte {
 	var transactions [][]byte
@@ -164,14 +280,34 @@ func (b *Block) CalculateMerkleRoot() []byte {
 	return tree.Root.Data
 }
 
-// AdjustDifficulty adjusts the mining difficulty based on the time taken to mine recent blocks.
+// AdjustDifficulty adjusts the mining difficulty based on the time taken to mine recent blocks. The result is kept
+// within the default difficulty range.
 func (b *Block) AdjustDifficulty(previousBlock *Block, targetBlockTime time.Duration) uint32 {
+	return b.AdjustDifficultyWithBounds(previousBlock, targetBlockTime, minDifficulty, maxDifficulty)
+}
+
+// AdjustDifficultyWithBounds adjusts the mining difficulty like AdjustDifficulty, keeping the result between
+// minDiff and maxDiff.
+func (b *Block) AdjustDifficultyWithBounds(previousBlock *Block, targetBlockTime time.Duration, minDiff, maxDiff uint32) uint32 {
+	// Work in int64 so that lowering a difficulty of 0 can't wrap around
+	difficulty := int64(previousBlock.Header.Difficulty)
 	if b.Header.Timestamp.Sub(previousBlock.Header.Timestamp) < targetBlockTime/2 {
-		return previousBlock.Header.Difficulty + 1
+		difficulty++
 	} else if b.Header.Timestamp.Sub(previousBlock.Header.Timestamp) > targetBlockTime*2 {
-		return previousBlock.Header.Difficulty - 1
+		difficulty--
 	}
-	return previousBlock.Header.Difficulty
+	return clampDifficulty(difficulty, minDiff, maxDiff)
+}
+
+// clampDifficulty returns the difficulty limited to the range minDiff to maxDiff.
+func clampDifficulty(difficulty int64, minDiff, maxDiff uint32) uint32 {
+	if difficulty < int64(minDiff) {
+		return minDiff
+	}
+	if difficulty > int64(maxDiff) {
+		return maxDiff
+	}
+	return uint32(difficulty)
 }
 
 // Serialize serializes the block into a byte slice.
@@ -205,10 +341,19 @@ func (b *Block) CalculateTotalFees() float64 {
 	return totalFees
 }
 
+// BurnedFees returns the fees removed from circulation by the block, which is all of them when the block
+// has no FeeRecipient.
+func (b *Block) BurnedFees() float64 {
+	if b.FeeRecipient != "" {
+		return 0
+	}
+	return b.CalculateTotalFees()
+}
+
 // CanAddTransaction checks if adding a new transaction would exceed the maximum block size.
+// Both the block and the transaction are measured by their JSON encoding so the sizes are comparable.
 func (b *Block) CanAddTransaction(tx Transaction) bool {
-	blockSize, _ := b.Serialize()
-	return len(blockSize)+tx.Size() <= MaxBlockSize
+	return len(b.Bytes())+tx.Size() <= MaxBlockSize
 }
 
 // CreateBloomFilter creates a Bloom filter for quick transaction lookups within the block.
@@ -241,10 +386,20 @@ func (b *Block) Mine(difficulty uint) {
 	}
 }
 
-// CalculateBlockReward calculates the block reward based on the current block height.
-func (b *Block) CalculateBlockReward(currentBlockHeight int64) float64 {
-	halvings := currentBlockHeight / BlockRewardHalvingInterval
-	return InitialBlockReward * math.Pow(0.5, float64(halvings))
+// CalculateBlockReward calculates the block reward based on the current block height and the reward schedule
+// in cfg. If cfg is nil, InitialBlockReward and BlockRewardHalvingInterval are used.
+func (b *Block) CalculateBlockReward(currentBlockHeight int64, cfg *Config) float64 {
+	initialReward := float64(InitialBlockReward)
+	halvingInterval := int64(BlockRewardHalvingInterval)
+	if cfg != nil {
+		initialReward = cfg.InitialBlockReward
+		if cfg.HalvingInterval > 0 {
+			halvingInterval = cfg.HalvingInterval
+		}
+	}
+
+	halvings := currentBlockHeight / halvingInterval
+	return initialReward * math.Pow(0.5, float64(halvings))
 }
 
 // CalculateHash calculates and returns the hash of the block.
@@ -256,6 +411,16 @@ func (b *Block) CalculateHash() string {
 		b.Header.Timestamp.String(),
 		b.Header.Difficulty,
 		b.Header.Nonce)
+
+	// Only blocks that pay out their fees commit to the recipient, so older block hashes are unchanged
+	if b.FeeRecipient != "" {
+		record += b.FeeRecipient
+	}
+	// Likewise only blocks that pay a reward commit to it
+	if b.RewardRecipient != "" {
+		record += fmt.Sprintf("%s%g", b.RewardRecipient, b.Reward)
+	}
+
 	h := sha256.New()
 	h.Write([]byte(record))
 	hashed := h.Sum(nil)
@@ -0,0 +1,332 @@
+package sdk
+
+import (
+	"errors"
+	"math/big"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestChildBlock returns a valid block following previous.
+func newTestChildBlock(t *testing.T, previous *Block) *Block {
+	t.Helper()
+
+	msg := newTestMessage(t, "child")
+	msg.SetStatus(StatusConfirmed)
+
+	block := NewBlock([]Transaction{msg}, previous.Hash)
+	block.Hash = block.CalculateHash()
+	return block
+}
+
+// newPeerTestBlock builds the block a peer would send after previous, holding the confirmed transactions and
+// mined at difficulty 1.
+func newPeerTestBlock(t *testing.T, previous *Block, txs ...Transaction) *Block {
+	t.Helper()
+
+	for _, tx := range txs {
+		tx.SetStatus(StatusConfirmed)
+	}
+	block := NewBlock(txs, previous.Hash)
+	block.Index.SetInt64(previous.Index.Int64() + 1)
+	mineTestBlock(t, block, 1)
+	return block
+}
+
+// mineTestBlock finds a nonce for the block at the difficulty, so the block passes the proof of work check.
+func mineTestBlock(t *testing.T, block *Block, difficulty uint32) {
+	t.Helper()
+
+	newTestBlockchain(t).mine(block, int(difficulty), 1)
+	require.True(t, strings.HasPrefix(block.Hash, strings.Repeat("0", int(difficulty))))
+}
+
+func TestBlockValidateErrors(t *testing.T) {
+	previous := newTestBlock(t)
+	require.NoError(t, newTestChildBlock(t, previous).Validate(previous))
+
+	tests := []struct {
+		name   string
+		tamper func(b *Block)
+		want   error
+	}{
+		{"previous hash", func(b *Block) { b.Header.PreviousHash = "other" }, ErrInvalidPreviousHash},
+		{"future timestamp", func(b *Block) { b.Header.Timestamp = time.Now().Add(time.Hour) }, ErrFutureTimestamp},
+		{"pending transaction", func(b *Block) { b.Transactions[0].SetStatus(StatusPending) }, ErrInvalidTransaction},
+		{"hash", func(b *Block) { b.Header.Nonce++ }, ErrInvalidHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := newTestChildBlock(t, previous)
+			tt.tamper(block)
+
+			err := block.Validate(previous)
+			assert.ErrorIs(t, err, tt.want)
+			for _, other := range []error{ErrInvalidPreviousHash, ErrFutureTimestamp, ErrInvalidTransaction, ErrInvalidHash} {
+				if other != tt.want {
+					assert.False(t, errors.Is(err, other), "unexpected %v", other)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateChainWrapsBlockErrors(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+	require.NoError(t, bc.AddTransaction(newTestMessage(t, "mined")))
+	bc.createNewBlock(1)
+	require.NoError(t, bc.ValidateChain())
+
+	bc.GetLatestBlock().Header.Nonce++
+	assert.ErrorIs(t, bc.ValidateChain(), ErrInvalidHash)
+}
+
+func TestBlockValidateClockSkew(t *testing.T) {
+	previous := newTestBlock(t)
+
+	// Slightly ahead of our clock is tolerated
+	block := newTestChildBlock(t, previous)
+	block.Header.Timestamp = time.Now().Add(2 * time.Second)
+	block.Hash = block.CalculateHash()
+	assert.NoError(t, block.ValidateWithClockSkew(previous, 5*time.Second))
+	assert.NoError(t, block.Validate(previous))
+	assert.ErrorIs(t, block.ValidateWithClockSkew(previous, 0), ErrFutureTimestamp)
+
+	// Far in the future is rejected
+	block.Header.Timestamp = time.Now().Add(time.Minute)
+	block.Hash = block.CalculateHash()
+	assert.ErrorIs(t, block.ValidateWithClockSkew(previous, 5*time.Second), ErrFutureTimestamp)
+	assert.ErrorIs(t, block.Validate(previous), ErrFutureTimestamp)
+}
+
+func TestValidateChainUsesConfiguredClockSkew(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+	require.NoError(t, bc.AddTransaction(newTestMessage(t, "mined")))
+	bc.createNewBlock(1)
+
+	block := bc.GetLatestBlock()
+	block.Header.Timestamp = time.Now().Add(30 * time.Second)
+	mineTestBlock(t, block, 1)
+	assert.ErrorIs(t, bc.ValidateChain(), ErrFutureTimestamp)
+
+	bc.cfg.MaxClockSkew = 60
+	assert.NoError(t, bc.ValidateChain())
+}
+
+func TestBlocksMustMeetTheirDifficulty(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	msg := newSignedTestMessage(t, "from a peer")
+	bc.GenerateGenesisBlock(genesisAllocations(map[string]float64{msg.From.GetAddress(): 1}))
+
+	// Mined blocks record the difficulty they were mined at
+	require.NoError(t, bc.AddTransaction(newTestMessage(t, "mined")))
+	bc.createNewBlock(2)
+	mined := bc.GetLatestBlock()
+	assert.Equal(t, uint32(2), mined.Header.Difficulty)
+	assert.True(t, strings.HasPrefix(mined.Hash, "00"))
+	assert.NoError(t, bc.ValidateChain())
+	assert.Equal(t, "256", blockWork(mined).String())
+
+	// A block whose hash does not meet its difficulty is refused
+	block := newPeerTestBlock(t, mined, msg)
+	block.Header.Difficulty = 2
+	for block.Hash = block.CalculateHash(); strings.HasPrefix(block.Hash, "00"); block.Hash = block.CalculateHash() {
+		block.Header.Nonce++
+	}
+	assert.ErrorIs(t, bc.AddBlock(block), ErrInvalidProof)
+
+	// So is one claiming more difficulty than blocks are mined at, which would otherwise inflate its work
+	block.Header.Difficulty = 200
+	block.Hash = block.CalculateHash()
+	assert.ErrorIs(t, bc.AddBlock(block), ErrInvalidProof)
+	assert.Equal(t, blockWork(&Block{Header: BlockHeader{Difficulty: difficultyLimit}}), blockWork(block))
+
+	mineTestBlock(t, block, 1)
+	require.NoError(t, bc.AddBlock(block))
+
+	// Validating the chain checks every block's proof of work too
+	mined.Header.Difficulty = 3
+	for mined.Hash = mined.CalculateHash(); strings.HasPrefix(mined.Hash, "000"); mined.Hash = mined.CalculateHash() {
+		mined.Header.Nonce++
+	}
+	block.Header.PreviousHash = mined.Hash
+	mineTestBlock(t, block, 1)
+	assert.ErrorIs(t, bc.ValidateChain(), ErrInvalidProof)
+}
+
+func TestAdjustDifficultyBounds(t *testing.T) {
+	previous := newTestBlock(t)
+	target := 10 * time.Second
+
+	tests := []struct {
+		name     string
+		previous uint32
+		elapsed  time.Duration
+		min, max uint32
+		want     uint32
+	}{
+		{"fast blocks raise difficulty", 4, time.Second, 1, 8, 5},
+		{"slow blocks lower difficulty", 4, time.Minute, 1, 8, 3},
+		{"on target keeps difficulty", 4, target, 1, 8, 4},
+		{"ceiling", 8, time.Second, 1, 8, 8},
+		{"floor", 2, time.Minute, 2, 8, 2},
+		{"zero does not wrap around", 0, time.Minute, 0, 8, 0},
+		{"below the floor is raised", 0, target, 3, 8, 3},
+		{"above the ceiling is lowered", 20, target, 1, 8, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous.Header.Difficulty = tt.previous
+			block := newTestChildBlock(t, previous)
+			block.Header.Timestamp = previous.Header.Timestamp.Add(tt.elapsed)
+			assert.Equal(t, tt.want, block.AdjustDifficultyWithBounds(previous, target, tt.min, tt.max))
+		})
+	}
+
+	// The defaults apply without explicit bounds
+	previous.Header.Difficulty = maxDifficulty
+	block := newTestChildBlock(t, previous)
+	block.Header.Timestamp = previous.Header.Timestamp
+	assert.Equal(t, uint32(maxDifficulty), block.AdjustDifficulty(previous, target))
+}
+
+func TestAdjustDifficultyZeroDoesNotUnderflow(t *testing.T) {
+	previous := newTestBlock(t)
+	previous.Header.Difficulty = 0
+
+	// A slow block after a zero difficulty block used to wrap around to math.MaxUint32
+	block := newTestChildBlock(t, previous)
+	block.Header.Timestamp = previous.Header.Timestamp.Add(time.Hour)
+	assert.Equal(t, uint32(minDifficulty), block.AdjustDifficulty(previous, 10*time.Second))
+}
+
+func TestCreateNewBlockClampsDifficulty(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	// Asking for no work still mines at the floor
+	bc.cfg.MinDifficulty = 2
+	bc.cfg.MaxDifficulty = 3
+	bc.createNewBlock(0)
+	assert.Regexp(t, "^00", bc.GetLatestBlock().Hash)
+
+	// Asking for more than the ceiling mines at the ceiling
+	bc.createNewBlock(60)
+	require.Len(t, bc.Blocks, 3)
+	assert.Regexp(t, "^000", bc.GetLatestBlock().Hash)
+	assert.NoError(t, bc.ValidateChain())
+
+	cfg := &Config{}
+	cfg.setDefaultValues()
+	require.NoError(t, cfg.Validate())
+	cfg.MaxDifficulty = cfg.MinDifficulty - 1
+	assert.Error(t, cfg.Validate())
+	cfg.MaxDifficulty = difficultyLimit + 1
+	assert.Error(t, cfg.Validate())
+}
+
+func TestVerifyBlockFile(t *testing.T) {
+	useTestStorage(t)
+	previous := newTestBlock(t)
+
+	// saveChild stores a child of previous, changed by tamper after it was hashed, and returns its path
+	saveChild := func(tamper func(b *Block)) string {
+		block := newTestChildBlock(t, previous)
+		block.Index = *big.NewInt(43)
+		tamper(block)
+		require.NoError(t, block.save())
+
+		path, err := localStorage.file(block)
+		require.NoError(t, err)
+		return path
+	}
+
+	path := saveChild(func(b *Block) {})
+	assert.NoError(t, VerifyBlockFile(path, previous.Hash))
+	assert.NoError(t, VerifyBlockFile(path, ""), "the previous hash is only checked when given")
+	assert.ErrorIs(t, VerifyBlockFile(path, "other"), ErrInvalidPreviousHash)
+
+	tests := []struct {
+		name   string
+		tamper func(b *Block)
+		want   error
+	}{
+		{"transaction", func(b *Block) { b.Transactions[0].(*Message).Fee += 1 }, ErrInvalidMerkleRoot},
+		{"header", func(b *Block) { b.Header.Nonce++ }, ErrInvalidHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, VerifyBlockFile(saveChild(tt.tamper), previous.Hash), tt.want)
+		})
+	}
+
+	assert.Error(t, VerifyBlockFile(filepath.Join(t.TempDir(), "missing.json"), previous.Hash))
+}
+
+func TestSetClockMakesBlocksReproducible(t *testing.T) {
+	frozen := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	SetClock(func() time.Time { return frozen })
+	t.Cleanup(func() { SetClock(nil) })
+
+	msg := newTestMessage(t, "same content")
+	first := NewBlock([]Transaction{msg}, "0000abcdef")
+	time.Sleep(time.Millisecond)
+	second := NewBlock([]Transaction{msg}, "0000abcdef")
+
+	assert.Equal(t, frozen, first.Header.Timestamp)
+	assert.Equal(t, first.Hash, second.Hash)
+
+	SetClock(nil)
+	assert.WithinDuration(t, time.Now(), NewBlock([]Transaction{msg}, "0000abcdef").Header.Timestamp, time.Minute)
+}
+
+func TestNewBlockCanonicalOrder(t *testing.T) {
+	SetClock(func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) })
+	t.Cleanup(func() { SetClock(nil) })
+
+	other := EncodeAddress(make([]byte, addressHashLength))
+	var txs []Transaction
+	for i := 0; i < 8; i++ {
+		msg := newTestMessage(t, "ordered")
+		msg.Nonce = uint64(i % 3) // Equal nonces fall back to the ID
+		if i%2 == 0 {
+			msg.From = &Wallet{Address: other}
+		}
+		txs = append(txs, msg)
+	}
+
+	expected := NewBlock(txs, "0000abcdef")
+	for i := 0; i < 5; i++ {
+		shuffled := append([]Transaction{}, txs...)
+		rand.Shuffle(len(shuffled), func(a, b int) { shuffled[a], shuffled[b] = shuffled[b], shuffled[a] })
+
+		block := NewBlock(shuffled, "0000abcdef")
+		assert.Equal(t, expected.Header.MerkleRoot, block.Header.MerkleRoot)
+		assert.Equal(t, expected.Hash, block.Hash)
+	}
+
+	// Sender first, then nonce
+	for i := 1; i < len(expected.Transactions); i++ {
+		previous, current := expected.Transactions[i-1], expected.Transactions[i]
+		if previous.GetSenderWallet().GetAddress() == current.GetSenderWallet().GetAddress() {
+			assert.LessOrEqual(t, previous.GetNonce(), current.GetNonce())
+		} else {
+			assert.Less(t, previous.GetSenderWallet().GetAddress(), current.GetSenderWallet().GetAddress())
+		}
+	}
+}
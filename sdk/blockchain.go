@@ -4,18 +4,71 @@
 package sdk
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"math/big"
-	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrDuplicateTransaction is returned when a transaction is already queued or mined.
+var ErrDuplicateTransaction = errors.New("duplicate transaction")
+
+// Transaction verification errors, returned wrapped by VerifySignature.
+var (
+	ErrSenderKeyMismatch     = errors.New("public key does not belong to the sender")
+	ErrTransactionIDMismatch = errors.New("transaction ID does not match its content")
+)
+
+// Fee policies, deciding where the transaction fees collected by a block go
+const (
+	FeePolicyMiner    = "miner"    // Fees are paid to Config.MiningRewardAddress, or Config.MinerAddress when it is not set
+	FeePolicyBurn     = "burn"     // Fees are removed from circulation
+	FeePolicyTreasury = "treasury" // Fees are paid to Config.DevAddress
+)
+
+// GenesisTimestamp is the timestamp of the genesis block when Config.DeterministicGenesis is set.
+var GenesisTimestamp = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// ErrInvalidRewardAddress is returned by ValidateRewardAddresses when Config.StrictRewards is set and a reward
+// address is malformed or has no wallet on this node.
+var ErrInvalidRewardAddress = errors.New("invalid reward address")
+
+// ErrInvalidBlockReward is returned when a block pays a reward other than the one the reward schedule gives its
+// height.
+var ErrInvalidBlockReward = errors.New("invalid block reward")
+
+// ErrMempoolFull is returned when the mempool is full and the transaction pays too low a fee to replace
+// any of the queued transactions.
+var ErrMempoolFull = errors.New("mempool is full")
+
+// ErrTooManyPending is returned when the sender of a transaction already has Config.MaxPendingPerSender
+// transactions in the mempool.
+var ErrTooManyPending = errors.New("too many pending transactions from sender")
+
+// Errors returned by ReplaceChain and AddBlock when blocks from a peer are refused.
+var (
+	ErrGenesisMismatch  = errors.New("chain has a different genesis block")
+	ErrInsufficientWork = errors.New("chain does not have more work than the local chain")
+	ErrDuplicateBlock   = errors.New("block is already in the chain")
+	ErrInvalidProof     = errors.New("block hash does not meet its difficulty")
+
+	ErrInvalidFeeRecipient = errors.New("block pays its fees to the wrong recipient")
+	ErrInsufficientBalance = errors.New("block spends more than the sender holds")
+)
+
 // State represents the current state of the blockchain.
 type State struct {
 	// Add state-related fields here if needed
@@ -23,14 +76,16 @@ type State struct {
 
 // BlockchainPersistData represents the data that is persisted for a blockchain to disk.
 type BlockchainPersistData struct {
-	TXLookup       *Index `json:"tx_lookup"`
-	CurrBlockIndex *int   `json:"current_block_index"`
-	NextBlockIndex *int   `json:"next_block_index"`
+	TXLookup         *Index                  `json:"tx_lookup"`
+	CurrBlockIndex   *int                    `json:"current_block_index"`
+	NextBlockIndex   *int                    `json:"next_block_index"`
+	TransactionQueue []*PersistedTransaction `json:"transaction_queue"`
+	Processed        []string                `json:"processed_transactions,omitempty"` // IDs of every mined transaction
 }
 
 // String returns a string representation of the BlockchainPersistData.
 func (b *BlockchainPersistData) String() string {
-	return fmt.Sprintf("TXLookup: %v, CurrBlockIndex: %v, NextBlockIndex: %v", b.TXLookup, b.CurrBlockIndex, b.NextBlockIndex)
+	return fmt.Sprintf("TXLookup: %v, CurrBlockIndex: %v, NextBlockIndex: %v, TransactionQueue: %d", b.TXLookup, b.CurrBlockIndex, b.NextBlockIndex, len(b.TransactionQueue))
 }
 
 // Blockchain is the main struct that represents the blockchain.
@@ -44,11 +99,28 @@ type Blockchain struct {
 	NextBlockIndex    int              // Next block index
 	AvgTxsPerBlock    float64          // Average number of transactions per block
 	State             *State           // Current state of the blockchain
+
+	cancelRun          context.CancelFunc              // Stops the goroutines started by RunWithContext
+	runWG              sync.WaitGroup                  // Tracks the goroutines started by RunWithContext
+	onTransactionAdded func(Transaction)               // Called when a transaction is accepted into the mempool
+	balances           map[string]float64              // Balance index by address, nil until RebuildBalances is called
+	balanceUndo        map[string]map[string]float64   // Balance changes applied by each block, by block hash, undone in a reorg
+	tokenBalances      map[tokenKey]int64              // Token balance index by address and token ID, built along with balances
+	tokenUndo          map[string]map[tokenKey]int64   // Token balance changes applied by each block, by block hash
+	treasury           *Wallet                         // Open dev wallet used to fund new wallets, nil when not available
+	blockAdded         chan struct{}                   // Closed when a block is added to the chain, see WaitForBlock
+	addressSubscribers map[string][]chan StatementLine // Subscribers to confirmed changes by address, see SubscribeAddress
+	pinned             map[string]bool                 // IDs of pending transactions pinned for the next block, see PinTransaction
+	processed          map[string]bool                 // IDs of mined transactions, persisted so they are never queued again
+	blockStats         []blockStat                     // Statistics of the blocks most recently mined here, see GetConfirmationStats
 }
 
 // NewBlockchain creates a new instance of the Blockchain struct with the provided configuration.
 func NewBlockchain(cfg *Config) *Blockchain {
 	log.Println("NewBlockchain called")
+	SetAddressPrefix(cfg.AddressPrefix)
+	SetAllowSelfTransfers(cfg.AllowSelfTransfers)
+
 	bc := &Blockchain{
 		cfg:               cfg,
 		Blocks:            []*Block{},
@@ -71,10 +143,26 @@ func NewBlockchain(cfg *Config) *Blockchain {
 	}
 
 	if len(bc.Blocks) == 0 {
-		log.Println("No blocks found, creating genesis block")
-		bc.GenerateGenesisBlock([]Transaction{})
+		report, err := bc.LoadExistingBlocks()
+		if err != nil {
+			log.Printf("Error loading blocks: %v", err)
+			return nil
+		}
+
+		if report.BlocksLoaded == 0 {
+			log.Println("No blocks found, creating genesis block")
+			bc.GenerateGenesisBlock([]Transaction{})
+		}
+	}
+
+	err = bc.ValidateRewardAddresses()
+	if err != nil {
+		log.Printf("Error validating reward addresses: %v", err)
+		return nil
 	}
 
+	bc.RebuildBalances()
+
 	log.Printf("Blockchain initialized with %d blocks", len(bc.Blocks))
 	return bc
 }
@@ -126,23 +214,76 @@ func (bc *Blockchain) Load() error {
 		bc.NextBlockIndex = *data.NextBlockIndex
 	}
 
+	bc.processed = make(map[string]bool, len(data.Processed))
+	for _, id := range data.Processed {
+		bc.processed[id] = true
+	}
+
+	for _, persisted := range data.TransactionQueue {
+		tx, err := persisted.Transaction()
+		if err != nil {
+			log.Printf("Error restoring queued transaction: %v\n", err)
+			continue
+		}
+
+		// A queue saved before its transactions were mined must not bring them back
+		if bc.isProcessed(tx.GetID()) {
+			log.Printf("Dropping queued transaction %s, it has already been mined\n", tx.GetID())
+			continue
+		}
+		bc.TransactionQueue = append(bc.TransactionQueue, tx)
+	}
+
 	return nil
 }
 
 // Save saves the blockchain state to disk.
 func (bc *Blockchain) Save() error {
-	data := &BlockchainPersistData{
-		TXLookup:       bc.TXLookup.index.Get(),
-		CurrBlockIndex: &bc.CurrentBlockIndex,
-		NextBlockIndex: &bc.NextBlockIndex,
-	}
-
 	bc.mux.Lock()
 	defer bc.mux.Unlock()
 
+	return bc.save()
+}
+
+// save saves the blockchain state, including the pending transaction queue, to disk.
+// The caller must hold bc.mux.
+func (bc *Blockchain) save() error {
+	queue := make([]*PersistedTransaction, 0, len(bc.TransactionQueue))
+	for _, tx := range bc.TransactionQueue {
+		persisted, err := NewPersistedTransaction(tx)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, persisted)
+	}
+
+	data := &BlockchainPersistData{
+		TXLookup:         bc.TXLookup.index.Get(),
+		CurrBlockIndex:   &bc.CurrentBlockIndex,
+		NextBlockIndex:   &bc.NextBlockIndex,
+		TransactionQueue: queue,
+		Processed:        bc.processedIDs(),
+	}
+
 	return localStorage.Set("state", data)
 }
 
+// Cleanup stops the Run loop and flushes the blockchain state, including any pending transactions, to disk
+// so that nothing is lost when the process exits.
+func (bc *Blockchain) Cleanup() error {
+	bc.Stop()
+
+	log.Println("Flushing blockchain state to disk...")
+
+	err := bc.Save()
+	if err != nil {
+		return fmt.Errorf("error saving blockchain state: %w", err)
+	}
+
+	log.Printf("Blockchain state saved with [%d] pending transactions", bc.GetMempoolSize())
+	return nil
+}
+
 // createBlockchain initializes a new blockchain with a genesis block and sets up
 // the necessary wallets and transactions. It performs the following steps:
 // 1. Initializes blockchain organization, application, admin user, developer asset, and miner asset IDs.
@@ -152,6 +293,13 @@ func (bc *Blockchain) Save() error {
 // 5. Generates a bank transaction to fund the miner wallet with a specified amount.
 // 6. Generates the genesis block with the created transactions.
 //
+// If blocks already exist on disk nothing is created, the existing blocks are loaded instead and the dev
+// and miner addresses are taken from the genesis block.
+//
+// When Config.DeterministicGenesis is set no wallets are created. The genesis block only holds the
+// Config.GenesisAllocations and is stamped with GenesisTimestamp, so every node with the same configuration
+// creates the same genesis block, and the dev and miner addresses are taken from the configuration.
+//
 // Returns an error if any step in the process fails.
 func (bc *Blockchain) createBlockchain() error {
 	log.Println("Creating a new Blockchain...")
@@ -161,6 +309,20 @@ func (bc *Blockchain) createBlockchain() error {
 	ThisBlockchainDevAssetID = NewBigInt(BlockchainDevAssetID)
 	ThisBlockchainMinerID = NewBigInt(BlockchainMinerAssetID)
 
+	// Never recreate the genesis block, or its wallets, over existing chain data
+	report, err := bc.LoadExistingBlocks()
+	if err != nil {
+		return err
+	}
+	if report.BlocksLoaded > 0 {
+		return nil
+	}
+
+	if bc.cfg.DeterministicGenesis {
+		bc.GenerateGenesisBlock(genesisAllocations(bc.cfg.GenesisAllocations))
+		return nil
+	}
+
 	genesisTxs := []Transaction{}
 
 	devWalletPW, err := GenerateRandomPassword()
@@ -184,6 +346,7 @@ func (bc *Blockchain) createBlockchain() error {
 	}
 
 	bc.cfg.DevAddress = devWallet.GetAddress()
+	bc.treasury = devWallet
 	log.Printf("A Blockchain project Dev wallet was created for you with address [%s] and password [%s] (you can change this later)\n", bc.cfg.DevAddress, devWalletPW)
 
 	minerWalletPW, err := GenerateRandomPassword()
@@ -245,16 +408,36 @@ func (bc *Blockchain) createBlockchain() error {
 	return nil
 }
 
-// GenerateGenesisBlock generates the genesis block if there are no existing blocks.
+// GenerateGenesisBlock generates the genesis block if there are no existing blocks. When
+// Config.DeterministicGenesis is set the block is stamped with GenesisTimestamp, pays no fees and is mined on a
+// single thread, so the same transactions always give the same block.
 func (bc *Blockchain) GenerateGenesisBlock(txs []Transaction) {
 	if len(bc.Blocks) == 0 {
 		log.Println("Generating Genesis Block...")
+		deterministic := bc.cfg != nil && bc.cfg.DeterministicGenesis
+
+		confirmedAt := timeNow()
+		if deterministic {
+			confirmedAt = GenesisTimestamp
+		}
+		for _, tx := range txs {
+			tx.SetStatus(StatusConfirmed)
+			tx.SetConfirmedAt(confirmedAt)
+		}
 
 		genesisBlock := NewBlock(txs, "")
 		genesisBlock.Index = *big.NewInt(0)
+		threads := bc.miningThreads()
+		if deterministic {
+			// With one thread the lowest nonce is always the one found
+			genesisBlock.Header.Timestamp = GenesisTimestamp
+			threads = 1
+		} else {
+			genesisBlock.FeeRecipient = bc.feeRecipient()
+		}
 		genesisBlock.Hash = bc.generateHash(genesisBlock)
 
-		bc.Mine(genesisBlock, 1)
+		bc.mine(genesisBlock, 1, threads)
 
 		err := genesisBlock.save()
 		if err != nil {
@@ -262,6 +445,8 @@ func (bc *Blockchain) GenerateGenesisBlock(txs []Transaction) {
 		}
 
 		bc.Blocks = append(bc.Blocks, genesisBlock)
+		bc.indexBalances(genesisBlock)
+		bc.markProcessed(genesisBlock)
 
 		err = bc.TXLookup.Add(genesisBlock)
 		if err != nil {
@@ -277,20 +462,55 @@ func (bc *Blockchain) GenerateGenesisBlock(txs []Transaction) {
 	}
 }
 
+// genesisAllocations returns the bank transfers crediting each address with its allocation, in address order.
+// The transfers have no sender, and no times other than GenesisTimestamp, so they are the same on every node.
+func genesisAllocations(allocations map[string]float64) []Transaction {
+	addresses := make([]string, 0, len(allocations))
+	for address := range allocations {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	txs := make([]Transaction, 0, len(addresses))
+	for i, address := range addresses {
+		allocation := &Bank{
+			Tx: Tx{
+				Time:      GenesisTimestamp,
+				CreatedAt: GenesisTimestamp,
+				Version:   TransactionVersion,
+				Protocol:  BankProtocolID,
+				To:        &Wallet{Address: address},
+				Status:    StatusConfirmed,
+				Nonce:     uint64(i),
+			},
+			Amount: allocations[address],
+		}
+		allocation.ID = allocation.computeID(allocation.Amount)
+		txs = append(txs, allocation)
+	}
+	return txs
+}
+
 // HasTransaction checks if a transaction with the given ID exists in the blockchain.
 func (bc *Blockchain) HasTransaction(id *PUID) bool {
 	bc.mux.Lock()
 	defer bc.mux.Unlock()
 
+	return bc.hasTransaction(id.String())
+}
+
+// hasTransaction checks the transaction queue and the mined blocks for a transaction ID.
+// The caller must hold bc.mux.
+func (bc *Blockchain) hasTransaction(id string) bool {
 	for _, tx := range bc.TransactionQueue {
-		if tx.GetID() == id.String() {
+		if tx.GetID() == id {
 			return true
 		}
 	}
 
 	for _, block := range bc.Blocks {
 		for _, tx := range block.Transactions {
-			if tx.GetID() == id.String() {
+			if tx.GetID() == id {
 				return true
 			}
 		}
@@ -299,120 +519,401 @@ func (bc *Blockchain) HasTransaction(id *PUID) bool {
 	return false
 }
 
-// LoadExistingBlocks loads any existing blocks from disk and appends them to the blockchain.
-func (bc *Blockchain) LoadExistingBlocks() error {
-	files, _ := filepath.Glob(fmt.Sprintf("%s/*.json", blockFolder))
-	if len(files) == 0 {
-		log.Printf("[%s] No existing Blocks\n", time.Now().Format(logDateTimeFormat))
-		bc.createBlockchain()
-		return nil
+// AddTransaction adds a new transaction to the transaction queue. Transactions that are already queued or
+// mined are rejected with ErrDuplicateTransaction, so re-broadcasts can not be mined twice. Mined transactions
+// are remembered across restarts and rejected with ErrAlreadyProcessed, which wraps ErrDuplicateTransaction.
+//
+// When the queue holds Config.MaxMempoolSize transactions the lowest fee transaction is evicted to make room.
+// If the new transaction does not pay more than that it is rejected with ErrMempoolFull instead. So that one
+// sender can't crowd out the rest, transactions from a sender that already has Config.MaxPendingPerSender queued
+// are rejected with ErrTooManyPending.
+//
+// Transactions are first passed to any routers registered for their protocol, see RegisterProtocol.
+func (bc *Blockchain) AddTransaction(transaction Transaction) error {
+	err := routeTransaction(bc, transaction)
+	if err != nil {
+		return err
 	}
 
-	log.Printf("[%s] Loading Blockchain [%d]...\n", time.Now().Format(logDateTimeFormat), len(files))
-
-	// TODO: Implement block loading logic here
+	err = bc.addTransaction(transaction)
+	if err != nil {
+		return err
+	}
 
-	log.Printf("[%s] Done\n", time.Now().Format(logDateTimeFormat))
+	bc.mux.Lock()
+	onTransactionAdded := bc.onTransactionAdded
+	bc.mux.Unlock()
 
+	if onTransactionAdded != nil {
+		onTransactionAdded(transaction)
+	}
 	return nil
 }
 
-// AddTransaction adds a new transaction to the transaction queue.
-func (bc *Blockchain) AddTransaction(transaction Transaction) {
+// transactionSender returns the address of the sender of the transaction, empty if it has no sender wallet.
+func transactionSender(tx Transaction) string {
+	if from := tx.GetSenderWallet(); from != nil {
+		return from.GetAddress()
+	}
+	return ""
+}
+
+// OnTransactionAdded sets a function that is called, without the blockchain lock held, each time a
+// transaction is accepted into the mempool. The node uses it to gossip new transactions to its peers.
+func (bc *Blockchain) OnTransactionAdded(fn func(Transaction)) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.onTransactionAdded = fn
+}
+
+// addTransaction validates and queues a transaction.
+func (bc *Blockchain) addTransaction(transaction Transaction) error {
 	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	if bc.isProcessed(transaction.GetID()) {
+		return fmt.Errorf("%w: %s", ErrAlreadyProcessed, transaction.GetID())
+	}
+	if bc.hasTransaction(transaction.GetID()) {
+		return fmt.Errorf("%w: %s", ErrDuplicateTransaction, transaction.GetID())
+	}
+
+	if bc.cfg != nil && bc.cfg.MaxPendingPerSender > 0 {
+		sender := transactionSender(transaction)
+		pending := 0
+		for _, tx := range bc.TransactionQueue {
+			if transactionSender(tx) == sender {
+				pending++
+			}
+		}
+		if pending >= bc.cfg.MaxPendingPerSender {
+			return fmt.Errorf("%w: %s has %d queued", ErrTooManyPending, sender, pending)
+		}
+	}
+
+	if bc.cfg != nil && bc.cfg.MaxMempoolSize > 0 && len(bc.TransactionQueue) >= bc.cfg.MaxMempoolSize {
+		// Pinned transactions are never evicted
+		lowest := -1
+		for i, tx := range bc.TransactionQueue {
+			if !bc.pinned[tx.GetID()] && (lowest < 0 || tx.GetFee() < bc.TransactionQueue[lowest].GetFee()) {
+				lowest = i
+			}
+		}
+		if lowest < 0 {
+			return fmt.Errorf("%w: every queued transaction is pinned", ErrMempoolFull)
+		}
+
+		evicted := bc.TransactionQueue[lowest]
+		if transaction.GetFee() <= evicted.GetFee() {
+			return fmt.Errorf("%w: transaction %s fee %f does not exceed the lowest queued fee %f",
+				ErrMempoolFull, transaction.GetID(), transaction.GetFee(), evicted.GetFee())
+		}
+
+		bc.TransactionQueue = append(bc.TransactionQueue[:lowest], bc.TransactionQueue[lowest+1:]...)
+		log.Printf("[%s] Mempool full, evicted TX %s with fee %f\n", time.Now().Format(logDateTimeFormat), evicted.GetID(), evicted.GetFee())
+	}
+
 	transaction.Hash()
 	bc.TransactionQueue = append(bc.TransactionQueue, transaction)
-	bc.mux.Unlock()
 	log.Printf("[%s] Added TX to queue: %v\n", time.Now().Format(logDateTimeFormat), transaction)
+	return nil
 }
 
-// Mine attempts to mine a new block for the blockchain.
+// Mine searches for a nonce that gives the block a hash with the required number of leading zeros.
+// Mining only sets the nonce and hash, the caller is responsible for saving the block and adding it to the chain.
+// The nonce range is split between Config.MiningThreads goroutines, every CPU core when it is 0.
 func (bc *Blockchain) Mine(block *Block, difficulty int) *Block {
-	prefix := strings.Repeat("0", difficulty)
-	log.Printf("Mining a new Block [#%s] with [%d] Txs...", block.Index.String(), len(block.Transactions))
-	for i := 0; i < maxNonce; i++ {
-		block.Header.Nonce = uint32(i)
-		block.Hash = block.CalculateHash()
+	return bc.mine(block, difficulty, bc.miningThreads())
+}
 
-		if strings.HasPrefix(block.Hash, prefix) {
-			err := block.save()
-			if err != nil {
-				log.Printf("[%s] Error saving block: %v\n", time.Now().Format(logDateTimeFormat), err)
+// mine searches for the block's nonce like Mine, on the given number of goroutines.
+func (bc *Blockchain) mine(block *Block, difficulty int, threads int) *Block {
+	// The hash commits to the difficulty, so peers can check it was met
+	block.Header.Difficulty = uint32(difficulty)
+	prefix := strings.Repeat("0", difficulty)
+	log.Printf("Mining a new Block [#%s] with [%d] Txs on [%d] threads...", block.Index.String(), len(block.Transactions), threads)
+
+	var found atomic.Bool
+	results := make(chan *Block, threads)
+	var wg sync.WaitGroup
+	for worker := 0; worker < threads; worker++ {
+		wg.Add(1)
+		go func(first uint64) {
+			defer wg.Done()
+
+			// Each worker hashes its own copy, the hash only covers the header, the fee recipient and the reward
+			candidate := &Block{
+				Header:          block.Header,
+				FeeRecipient:    block.FeeRecipient,
+				Reward:          block.Reward,
+				RewardRecipient: block.RewardRecipient,
 			}
-			bc.Blocks = append(bc.Blocks, block)
-			bc.TransactionQueue = []Transaction{}
-
-			log.Printf("[%s] Mined a new Block [#%s] with [%d] TXs & Hash [%s]\n",
-				time.Now().Format(logDateTimeFormat),
-				block.Index.String(),
-				len(block.Transactions),
-				block.Hash)
-			break
-		}
+			for i := first; i <= math.MaxUint32 && !found.Load(); i += uint64(threads) {
+				candidate.Header.Nonce = uint32(i)
+				candidate.Hash = candidate.CalculateHash()
+
+				if strings.HasPrefix(candidate.Hash, prefix) {
+					found.Store(true)
+					results <- candidate
+					return
+				}
+			}
+		}(uint64(worker))
+	}
+	wg.Wait()
+	close(results)
+
+	// Several workers may find a nonce before they stop, any of them will do
+	mined, ok := <-results
+	if !ok {
+		log.Printf("[%s] No nonce found for Block [#%s] at difficulty %d\n", time.Now().Format(logDateTimeFormat), block.Index.String(), difficulty)
+		return block
 	}
 
+	block.Header.Nonce = mined.Header.Nonce
+	block.Hash = mined.Hash
+	log.Printf("[%s] Mined a new Block [#%s] with [%d] TXs & Hash [%s]\n",
+		time.Now().Format(logDateTimeFormat),
+		block.Index.String(),
+		len(block.Transactions),
+		block.Hash)
 	return block
 }
 
-// VerifySignature verifies the signature of the given transaction.
+// miningThreads returns the number of goroutines used to mine a block, Config.MiningThreads or the number of
+// CPU cores when it is not set.
+func (bc *Blockchain) miningThreads() int {
+	if bc.cfg == nil || bc.cfg.MiningThreads <= 0 {
+		return runtime.NumCPU()
+	}
+	return bc.cfg.MiningThreads
+}
+
+// VerifySignature verifies that the transaction was signed by its sender and has not been changed since. The
+// public key stored with the transaction must belong to the sender address, so a key can't sign for another
+// wallet, and the transaction ID must match its content. The ID is covered by the signature and is a hash of the
+// protocol specific fields, such as the amount of a bank transfer, so the signature covers them too. Signatures
+// made with the legacy scheme are only accepted while Config.AcceptLegacySignatures is set.
 func (bc *Blockchain) VerifySignature(tx Transaction) error {
-	_, err := tx.Verify([]byte(tx.GetSenderWallet().PublicPEM()), tx.GetSignature())
-	return err
+	sender := tx.GetSenderWallet()
+	if sender == nil {
+		return fmt.Errorf("%w: transaction %s has no sender", ErrSenderKeyMismatch, tx.GetID())
+	}
+	keyHash, err := publicKeyHash(tx.GetSenderPublicKey())
+	if err != nil {
+		return err
+	}
+	addressHash, err := DecodeAddress(sender.GetAddress())
+	if err != nil || !bytes.Equal(keyHash, addressHash) {
+		return fmt.Errorf("%w: transaction %s from %s", ErrSenderKeyMismatch, tx.GetID(), sender.GetAddress())
+	}
+
+	id, err := NewTransactionID(tx)
+	if err != nil {
+		return err
+	}
+	if id.String() != tx.GetID() {
+		return fmt.Errorf("%w: transaction %s", ErrTransactionIDMismatch, tx.GetID())
+	}
+
+	// Transactions built on Tx can be told whether to accept the legacy signature scheme
+	var valid bool
+	if verifier, ok := tx.(schemeVerifier); ok {
+		valid, err = verifier.verify([]byte(tx.GetSenderPublicKey()), tx.GetSignature(), bc.acceptLegacySignatures())
+	} else {
+		valid, err = tx.Verify([]byte(tx.GetSenderPublicKey()), tx.GetSignature())
+	}
+	if err != nil {
+		return err
+	}
+
+	if !valid {
+		return fmt.Errorf("invalid signature for transaction %s", tx.GetID())
+	}
+
+	return nil
 }
 
-// Run is a long-running function that manages the blockchain.
+// Run is a long-running function that manages the blockchain. It runs until Stop is called.
 func (bc *Blockchain) Run(difficulty int) {
+	bc.RunWithContext(context.Background(), difficulty)
+}
+
+// RunWithContext starts the goroutines that report status and create new blocks. They run until ctx is
+// cancelled or Stop is called.
+func (bc *Blockchain) RunWithContext(ctx context.Context, difficulty int) {
 	log.Println("Blockchain.Run started")
+	ctx, cancel := context.WithCancel(ctx)
+
+	bc.mux.Lock()
+	bc.cancelRun = cancel
+	bc.mux.Unlock()
+
 	statusTicker := time.NewTicker(time.Second)
 	blockTicker := time.NewTicker(time.Duration(bc.cfg.BlockTime) * time.Second)
+	bc.runWG.Add(2)
 
 	go func() {
-		for range statusTicker.C {
-			bc.DisplayStatus()
+		defer bc.runWG.Done()
+		defer statusTicker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-statusTicker.C:
+				bc.DisplayStatus()
+			}
 		}
 	}()
 
 	go func() {
-		for range blockTicker.C {
-			bc.createNewBlock(difficulty)
+		defer bc.runWG.Done()
+		defer blockTicker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-blockTicker.C:
+				// Both cases may be ready at once, never start a block after cancellation
+				if ctx.Err() != nil {
+					return
+				}
+				bc.createNewBlock(difficulty)
+			}
 		}
 	}()
 }
 
+// Stop cancels the goroutines started by Run and waits for them to exit. A block that is being created
+// is finished first.
+func (bc *Blockchain) Stop() {
+	bc.mux.Lock()
+	cancel := bc.cancelRun
+	bc.cancelRun = nil
+	bc.mux.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	bc.runWG.Wait()
+}
+
 func (bc *Blockchain) createNewBlock(difficulty int) {
 	bc.mux.Lock()
 	defer bc.mux.Unlock()
 
+	// Never mine below the configured floor or above the ceiling, whatever difficulty was asked for
+	minDiff, maxDiff := bc.difficultyBounds()
+	difficulty = int(clampDifficulty(int64(difficulty), minDiff, maxDiff))
+
 	previousHash := ""
 	if len(bc.Blocks) > 0 {
 		previousHash = bc.Blocks[len(bc.Blocks)-1].Hash
 	}
 
-	newBlock := NewBlock(bc.TransactionQueue, previousHash)
+	// Transactions are confirmed once they are included in a block. Those that don't fit stay queued.
+	selected, remaining := bc.nextBlockTransactions()
+	confirmedAt := timeNow()
+	for _, tx := range selected {
+		tx.SetStatus(StatusConfirmed)
+		tx.SetConfirmedAt(confirmedAt)
+	}
+
+	newBlock := NewBlock(selected, previousHash)
 	newBlock.Index = *big.NewInt(int64(len(bc.Blocks)))
+	newBlock.FeeRecipient = bc.feeRecipient()
+	bc.setBlockReward(newBlock)
 	bc.Mine(newBlock, difficulty)
 
-	err := bc.TXLookup.Add(newBlock)
+	// A block that can't be saved is dropped and its transactions stay queued for the next block, rather than
+	// being kept in memory only and lost on restart
+	err := bc.saveWithRetry("block", newBlock.save)
 	if err != nil {
-		log.Printf("[%s] Error adding block to TXLookup: %v\n", time.Now().Format(logDateTimeFormat), err)
+		log.Printf("[%s] Error saving block, transactions returned to the queue: %v\n", time.Now().Format(logDateTimeFormat), err)
+		unconfirm(selected)
+		return
 	}
 
-	err = newBlock.save()
+	queue := bc.TransactionQueue
+	lookup := append(Index{}, *bc.TXLookup.Get()...)
+
+	err = bc.TXLookup.Add(newBlock)
 	if err != nil {
-		log.Printf("[%s] Error saving block: %v\n", time.Now().Format(logDateTimeFormat), err)
+		log.Printf("[%s] Error adding block to TXLookup: %v\n", time.Now().Format(logDateTimeFormat), err)
 	}
 
 	bc.Blocks = append(bc.Blocks, newBlock)
-	bc.TransactionQueue = []Transaction{} // Clear the queue
+	bc.indexBalances(newBlock)
+	bc.markProcessed(newBlock)
+	bc.TransactionQueue = append([]Transaction{}, remaining...) // Keep what didn't fit for the next block
 
-	err = bc.Save()
+	err = bc.saveWithRetry("blockchain state", bc.save)
 	if err != nil {
-		log.Printf("[%s] Error saving blockchain state: %v\n", time.Now().Format(logDateTimeFormat), err)
+		log.Printf("[%s] Error saving blockchain state, rolling back block [#%s]: %v\n", time.Now().Format(logDateTimeFormat), newBlock.Index.String(), err)
+		bc.rollbackBlock(newBlock, queue, &lookup)
+		return
 	}
 
+	bc.unpin(selected)
+	bc.recordBlockStat(newBlock, timeNow())
+	bc.notifyNewBlock()
+	bc.notifyAddresses([]*Block{newBlock})
 	log.Printf("New block created: [#%s] Hash: %s", newBlock.Index.String(), newBlock.Hash)
 }
 
+// saveWithRetry calls save up to Config.SaveRetries times, doubling the delay after each failure, and returns
+// the last error if every attempt fails.
+func (bc *Blockchain) saveWithRetry(what string, save func() error) error {
+	attempts := saveRetries
+	if bc.cfg != nil && bc.cfg.SaveRetries > 0 {
+		attempts = bc.cfg.SaveRetries
+	}
+
+	delay := saveRetryDelayInMs * time.Millisecond
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = save()
+		if err == nil {
+			return nil
+		}
+
+		if attempt < attempts {
+			log.Printf("[%s] Error saving %s (attempt %d of %d), retrying in %v: %v\n", time.Now().Format(logDateTimeFormat), what, attempt, attempts, delay, err)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
+}
+
+// rollbackBlock removes the newest block from the chain and from disk, restoring the transaction queue and
+// lookup index from before it was added. The caller must hold bc.mux.
+func (bc *Blockchain) rollbackBlock(block *Block, queue []Transaction, lookup *Index) {
+	bc.Blocks = bc.Blocks[:len(bc.Blocks)-1]
+	bc.unmarkProcessed(block)
+
+	err := localStorage.DeleteBlock(block.Index.Int64())
+	if err != nil {
+		log.Printf("[%s] Error removing block [#%s]: %v\n", time.Now().Format(logDateTimeFormat), block.Index.String(), err)
+	}
+
+	unconfirm(queue)
+	bc.TransactionQueue = queue
+	bc.TXLookup.Set(lookup)
+
+	if !bc.unindexBalances(block) {
+		bc.rebuildBalances()
+	}
+}
+
+// unconfirm returns transactions that were to be included in a block to the pending state.
+func unconfirm(transactions []Transaction) {
+	for _, tx := range transactions {
+		tx.SetStatus(StatusPending)
+		tx.SetConfirmedAt(time.Time{})
+	}
+}
+
 // generateHash generates a SHA-512 hash for the given block.
 func (bc *Blockchain) generateHash(block *Block) string {
 	record := block.Index.Text(10) + block.Header.Timestamp.String() + strconv.FormatUint(uint64(block.Header.Nonce), 10) + block.Header.PreviousHash
@@ -422,6 +923,25 @@ func (bc *Blockchain) generateHash(block *Block) string {
 	return hex.EncodeToString(hashed)
 }
 
+// NetworkID identifies the chain, so that nodes of different chains, such as a mainnet and a testnet, refuse to
+// peer. It is derived from the chain name, and from the genesis block hash when Config.DeterministicGenesis has
+// every node create the same genesis block.
+func (bc *Blockchain) NetworkID() string {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	name, genesis := BlockchainName, ""
+	if bc.cfg != nil {
+		name = bc.cfg.BlockchainName
+		if bc.cfg.DeterministicGenesis && len(bc.Blocks) > 0 {
+			genesis = bc.Blocks[0].Hash
+		}
+	}
+
+	sum := sha256.Sum256([]byte(name + "\n" + genesis))
+	return hex.EncodeToString(sum[:8])
+}
+
 // GetLatestBlock returns the latest block in the blockchain.
 func (bc *Blockchain) GetLatestBlock() *Block {
 	bc.mux.Lock()
@@ -432,10 +952,45 @@ func (bc *Blockchain) GetLatestBlock() *Block {
 	return bc.Blocks[len(bc.Blocks)-1]
 }
 
+// ChainTip summarizes the latest block so light clients can detect new blocks cheaply.
+type ChainTip struct {
+	Index        *big.Int  `json:"index"`
+	Hash         string    `json:"hash"`
+	PreviousHash string    `json:"previous_hash"`
+	Timestamp    time.Time `json:"timestamp"`
+	TxCount      int       `json:"tx_count"`
+}
+
+// GetBlockReward returns the reward for mining the block at the given height, using the configured schedule.
+func (bc *Blockchain) GetBlockReward(height int64) float64 {
+	return (&Block{}).CalculateBlockReward(height, bc.cfg)
+}
+
+// GetChainTip returns a summary of the latest block, or nil if there are no blocks yet.
+func (bc *Blockchain) GetChainTip() *ChainTip {
+	block := bc.GetLatestBlock()
+	if block == nil {
+		return nil
+	}
+
+	return &ChainTip{
+		Index:        new(big.Int).Set(&block.Index),
+		Hash:         block.Hash,
+		PreviousHash: block.Header.PreviousHash,
+		Timestamp:    block.Header.Timestamp,
+		TxCount:      len(block.Transactions),
+	}
+}
+
 // GetBlockByHash returns a block with the given hash.
 func (bc *Blockchain) GetBlockByHash(hash string) *Block {
 	bc.mux.Lock()
 	defer bc.mux.Unlock()
+	return bc.blockByHash(hash)
+}
+
+// blockByHash returns the block with the given hash, or nil if it is not in the chain. The caller must hold bc.mux.
+func (bc *Blockchain) blockByHash(hash string) *Block {
 	for _, block := range bc.Blocks {
 		if block.Hash == hash {
 			return block
@@ -454,6 +1009,26 @@ func (bc *Blockchain) GetBlockByIndex(index int64) *Block {
 	return bc.Blocks[index]
 }
 
+// GetBlocks returns the blocks from index from to index to, inclusive, answering a GET_BLOCKS request from a peer.
+// At most maxBlockStreamRange blocks are returned, and the range is cut short at the latest block.
+func (bc *Blockchain) GetBlocks(from, to int64) ([]*Block, error) {
+	if from < 0 || to < from {
+		return nil, fmt.Errorf("invalid block range %d to %d", from, to)
+	}
+	if to-from+1 > maxBlockStreamRange {
+		return nil, fmt.Errorf("range exceeds the maximum of %d blocks", maxBlockStreamRange)
+	}
+
+	blocks := bc.snapshotBlocks()
+	if from >= int64(len(blocks)) {
+		return nil, fmt.Errorf("block %d not found", from)
+	}
+	if to >= int64(len(blocks)) {
+		to = int64(len(blocks)) - 1
+	}
+	return blocks[from : to+1], nil
+}
+
 // GetTransactionByID returns a transaction with the given ID.
 func (bc *Blockchain) GetTransactionByID(id string) Transaction {
 	bc.mux.Lock()
@@ -478,78 +1053,1007 @@ func (bc *Blockchain) GetTransactionByID(id string) Transaction {
 	return nil
 }
 
-// GetBalance returns the balance of a given wallet address.
-func (bc *Blockchain) GetBalance(address string) float64 {
+// Transaction receipt statuses
+const (
+	ReceiptStatusPending             = "pending"
+	ReceiptStatusPendingConfirmation = "pending_confirmation"
+	ReceiptStatusConfirmed           = "confirmed"
+	ReceiptStatusNotFound            = "not_found"
+)
+
+// TransactionReceipt reports what happened to a submitted transaction.
+type TransactionReceipt struct {
+	Status        string     `json:"status"`
+	BlockIndex    *big.Int   `json:"block_index,omitempty"`
+	Confirmations int64      `json:"confirmations"`
+	Fee           float64    `json:"fee"`
+	CreatedAt     *time.Time `json:"created_at,omitempty"`
+	ConfirmedAt   *time.Time `json:"confirmed_at,omitempty"`
+}
+
+// GetTransactionReceipt returns the receipt for the transaction with the given ID. A mined transaction has
+// tipHeight - blockHeight + 1 confirmations and is pending_confirmation until it has Config.RequiredConfirmations.
+// Queued transactions are pending and unknown ones are not_found.
+func (bc *Blockchain) GetTransactionReceipt(id string) *TransactionReceipt {
+	tx := bc.GetTransactionByID(id)
+	if tx == nil {
+		return &TransactionReceipt{Status: ReceiptStatusNotFound}
+	}
+
+	receipt := &TransactionReceipt{
+		Status:      ReceiptStatusPending,
+		Fee:         tx.GetFee(),
+		ConfirmedAt: tx.GetConfirmedAt(),
+	}
+	if createdAt := tx.GetCreatedAt(); !createdAt.IsZero() {
+		receipt.CreatedAt = &createdAt
+	}
+
 	bc.mux.Lock()
 	defer bc.mux.Unlock()
 
-	balance := 0.0
-	for _, block := range bc.Blocks {
-		for _, tx := range block.Transactions {
-			if tx.GetSenderWallet().GetAddress() == address {
-				balance -= tx.GetFee()
-				if bankTx, ok := tx.(*Bank); ok {
-					balance -= bankTx.Amount
-				}
-			}
-			if tx.GetProtocol() == BankProtocolID {
-				if bankTx, ok := tx.(*Bank); ok {
-					if bankTx.To.GetAddress() == address {
-						balance += bankTx.Amount
-					}
+	blockNumber, found := bc.TXLookup.FindBlockNumber(id)
+	if !found {
+		// The index only caches recent transactions, fall back to searching the blocks
+		for _, block := range bc.Blocks {
+			for _, blockTx := range block.Transactions {
+				if blockTx.GetID() == id {
+					blockNumber, found = new(big.Int).Set(&block.Index), true
 				}
 			}
 		}
 	}
-	return balance
+
+	if found && len(bc.Blocks) > 0 {
+		tipHeight := &bc.Blocks[len(bc.Blocks)-1].Index
+		receipt.BlockIndex = blockNumber
+		receipt.Confirmations = new(big.Int).Sub(tipHeight, blockNumber).Int64() + 1
+
+		receipt.Status = ReceiptStatusPendingConfirmation
+		if receipt.Confirmations >= bc.requiredConfirmations() {
+			receipt.Status = ReceiptStatusConfirmed
+		}
+	}
+
+	return receipt
 }
 
-// CalculateTotalSupply calculates the total supply of tokens in the blockchain.
-func (bc *Blockchain) CalculateTotalSupply() float64 {
+// GetBalance returns the balance of a given wallet address. The balance index is used once it has been built,
+// otherwise the balance is calculated from every block.
+func (bc *Blockchain) GetBalance(address string) float64 {
 	bc.mux.Lock()
 	defer bc.mux.Unlock()
 
-	totalSupply := 0.0
-	for _, block := range bc.Blocks {
-		for _, tx := range block.Transactions {
-			if tx.GetProtocol() == CoinbaseProtocolID {
-				if coinbaseTx, ok := tx.(*Coinbase); ok {
-					totalSupply += float64(coinbaseTx.TokenCount)
-				}
-			}
-		}
+	if bc.balances != nil {
+		return bc.balances[address]
 	}
-	return totalSupply
+	return bc.calculateBalance(address)
 }
 
-// ValidateChain validates the entire blockchain.
-func (bc *Blockchain) ValidateChain() error {
+// GetBalances returns the balance of each of the addresses, read from the balance index in one pass. Addresses
+// that have never been used have a balance of 0.
+func (bc *Blockchain) GetBalances(addresses []string) map[string]float64 {
 	bc.mux.Lock()
 	defer bc.mux.Unlock()
 
-	for i := 1; i < len(bc.Blocks); i++ {
-		currentBlock := bc.Blocks[i]
-		previousBlock := bc.Blocks[i-1]
+	if bc.balances == nil {
+		bc.rebuildBalances()
+	}
+
+	balances := make(map[string]float64, len(addresses))
+	for _, address := range addresses {
+		balances[address] = bc.balances[address]
+	}
+	return balances
+}
+
+// calculateBalance replays every block to calculate the balance of the address. The caller must hold bc.mux.
+func (bc *Blockchain) calculateBalance(address string) float64 {
+	balance := 0.0
+	for _, block := range bc.Blocks {
+		for _, tx := range block.Transactions {
+			if delta, ok := balanceDelta(tx, address); ok {
+				balance += delta
+			}
+		}
+		if fees, ok := feeCredit(block, address); ok {
+			balance += fees
+		}
+		if reward, ok := rewardCredit(block, address); ok {
+			balance += reward
+		}
+	}
+	return balance
+}
+
+// GetConfirmedBalance returns the balance of a given wallet address, leaving out credits from blocks that do
+// not have Config.RequiredConfirmations yet. Debits are always counted so the balance is safe to spend.
+func (bc *Blockchain) GetConfirmedBalance(address string) float64 {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	required := bc.requiredConfirmations()
+	balance := 0.0
+	for i, block := range bc.Blocks {
+		confirmed := int64(len(bc.Blocks)-i) >= required
+		for _, tx := range block.Transactions {
+			delta, ok := balanceDelta(tx, address)
+			if !ok || (!confirmed && delta > 0) {
+				continue
+			}
+			balance += delta
+		}
+		if fees, ok := feeCredit(block, address); ok && confirmed {
+			balance += fees
+		}
+		if reward, ok := rewardCredit(block, address); ok && confirmed {
+			balance += reward
+		}
+	}
+	return balance
+}
+
+// ValidateRewardAddresses checks the miner and dev addresses that block rewards and fees are paid to. Each must
+// be a well formed address with a wallet saved on this node, so the rewards can be spent. Addresses still set to
+// their placeholder defaults are skipped, as they are replaced when the genesis block is created. Problems are
+// logged as warnings, or returned wrapping ErrInvalidRewardAddress when Config.StrictRewards is set.
+func (bc *Blockchain) ValidateRewardAddresses() error {
+	rewards := []struct {
+		name        string
+		address     string
+		placeholder string
+	}{
+		{"miner", bc.cfg.MinerAddress, minerAddress},
+		{"dev", bc.cfg.DevAddress, devAddress},
+	}
+
+	var errs []error
+	for _, reward := range rewards {
+		if reward.address == "" || reward.address == reward.placeholder {
+			continue
+		}
+
+		err := ValidateAddress(reward.address)
+		if err == nil {
+			_, err = GetWalletByAddress(reward.address)
+		}
+		if err == nil {
+			continue
+		}
+
+		if bc.cfg.StrictRewards {
+			errs = append(errs, fmt.Errorf("%w: %s address %s: %v", ErrInvalidRewardAddress, reward.name, reward.address, err))
+			continue
+		}
+		log.Printf("[%s] Warning: %s address %s can not be used for rewards: %v\n", time.Now().Format(logDateTimeFormat),
+			reward.name, reward.address, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// SetTreasuryWallet sets the open dev wallet that new wallets are funded from. A new blockchain uses the dev wallet
+// it creates, a blockchain loaded from disk has no treasury wallet until one is set.
+func (bc *Blockchain) SetTreasuryWallet(wallet *Wallet) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	bc.treasury = wallet
+}
+
+// NewWallet creates a new wallet and, when Config.FundNewWallets is set, funds it with FundWallet.
+func (bc *Blockchain) NewWallet(options *WalletOptions) (*Wallet, error) {
+	wallet, err := NewWallet(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if bc.cfg != nil && bc.cfg.FundNewWallets {
+		_, err = bc.FundWallet(wallet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fund wallet %s: %w", wallet.GetAddress(), err)
+		}
+	}
+
+	return wallet, nil
+}
+
+// FundWallet queues a Bank transaction sending Config.FundWalletAmount from the treasury wallet to the wallet.
+// Funds are moved rather than created, so the total supply is unchanged.
+func (bc *Blockchain) FundWallet(wallet *Wallet) (*Bank, error) {
+	bc.mux.Lock()
+	treasury := bc.treasury
+	bc.mux.Unlock()
+
+	if treasury == nil {
+		return nil, errors.New("no treasury wallet to fund new wallets from")
+	}
+
+	bankTX, err := NewBankTransaction(treasury, wallet, bc.cfg.FundWalletAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	bankTX.Signature, err = bankTX.Sign([]byte(treasury.PrivatePEM()))
+	if err != nil {
+		return nil, err
+	}
+
+	// The balances are moved when the transaction is mined, like any other transfer
+	err = bc.AddTransaction(bankTX)
+	if err != nil {
+		return nil, err
+	}
+
+	return bankTX, nil
+}
+
+// GetAllBalances returns every address with a non-zero balance, read from the balance index. The index is built
+// first if it has not been already.
+func (bc *Blockchain) GetAllBalances() map[string]float64 {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	if bc.balances == nil {
+		bc.rebuildBalances()
+	}
+
+	balances := make(map[string]float64, len(bc.balances))
+	for address, balance := range bc.balances {
+		if balance != 0 {
+			balances[address] = balance
+		}
+	}
+	return balances
+}
+
+// RebuildBalances zeroes the balance index and replays every transaction in the chain to recalculate each
+// balance from scratch. It is run at startup and can be used to recover from a corrupt index.
+func (bc *Blockchain) RebuildBalances() {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	bc.rebuildBalances()
+}
+
+// rebuildBalances rebuilds the balance index. The caller must hold bc.mux.
+func (bc *Blockchain) rebuildBalances() {
+	start := time.Now()
+	bc.balances = make(map[string]float64)
+	bc.balanceUndo = make(map[string]map[string]float64)
+	bc.tokenBalances = make(map[tokenKey]int64)
+	bc.tokenUndo = make(map[string]map[tokenKey]int64)
+
+	for i, block := range bc.Blocks {
+		bc.indexBalances(block)
+
+		if (i+1)%rebuildBalancesLogInterval == 0 {
+			log.Printf("[%s] Rebuilding balances: %d/%d blocks\n", time.Now().Format(logDateTimeFormat), i+1, len(bc.Blocks))
+		}
+	}
+
+	log.Printf("[%s] Rebuilt balances for %d addresses from %d blocks in %v\n", time.Now().Format(logDateTimeFormat),
+		len(bc.balances), len(bc.Blocks), time.Since(start))
+}
+
+// indexBalances applies the transactions in the block to the balance index, recording the changes so that
+// unindexBalances can undo them. It does nothing until the index has been built by RebuildBalances. The caller
+// must hold bc.mux.
+func (bc *Blockchain) indexBalances(block *Block) {
+	if bc.balances == nil {
+		return
+	}
+
+	changes := blockBalanceChanges(block)
+	for address, delta := range changes {
+		bc.balances[address] += delta
+	}
+	bc.balanceUndo[block.Hash] = changes
+	bc.indexTokens(block)
+}
+
+// blockBalanceChanges returns how much the block changes the balance of each address it touches, counting the
+// transfers, fees and reward it pays.
+func blockBalanceChanges(block *Block) map[string]float64 {
+	changes := make(map[string]float64)
+	for _, tx := range block.Transactions {
+		var addresses []string
+		sender := ""
+		if wallet := tx.GetSenderWallet(); wallet != nil {
+			sender = wallet.GetAddress()
+			addresses = append(addresses, sender)
+		}
+		if bankTx, ok := tx.(*Bank); ok && tx.GetProtocol() == BankProtocolID && bankTx.To != nil && bankTx.To.GetAddress() != sender {
+			addresses = append(addresses, bankTx.To.GetAddress())
+		}
+
+		for _, address := range addresses {
+			if delta, ok := balanceDelta(tx, address); ok {
+				changes[address] += delta
+			}
+		}
+	}
+
+	if fees, ok := feeCredit(block, block.FeeRecipient); ok {
+		changes[block.FeeRecipient] += fees
+	}
+	if reward, ok := rewardCredit(block, block.RewardRecipient); ok {
+		changes[block.RewardRecipient] += reward
+	}
+	return changes
+}
+
+// checkBalances returns an error wrapping ErrInsufficientBalance if the block leaves any address it debits with
+// a negative balance, starting from the balances before the block.
+func checkBalances(balances map[string]float64, block *Block) error {
+	for address, delta := range blockBalanceChanges(block) {
+		if delta < 0 && balances[address]+delta < -balanceEpsilon {
+			return fmt.Errorf("%w: %s spends %g in block %s but holds %g", ErrInsufficientBalance, address, -delta,
+				block.Index.String(), balances[address])
+		}
+	}
+	return nil
+}
+
+// checkPeerBlock runs the checks a block from a peer must pass before it is applied after chain, on top of its
+// proof of work and reward: its fee recipient, the signature of every transaction, that no sender spends more than
+// it holds in balances, and that only a token's issuer mints it. The caller must hold bc.mux.
+func (bc *Blockchain) checkPeerBlock(chain []*Block, block *Block, balances map[string]float64) error {
+	err := bc.checkFeeRecipient(block)
+	if err != nil {
+		return err
+	}
+	for _, tx := range block.Transactions {
+		if err := bc.VerifySignature(tx); err != nil {
+			return fmt.Errorf("%w %s: %v", ErrInvalidTransaction, tx.GetID(), err)
+		}
+	}
+	err = checkBalances(balances, block)
+	if err != nil {
+		return err
+	}
+	return checkTokenMints(chain, block)
+}
+
+// checkForkBlocks runs checkPeerBlock on each block of a chain from a peer after the fork point, the first block
+// it does not share with the local chain. Balances are replayed from the fork point: the local balances with the
+// changes of the blocks the chain orphans undone, then each checked block applied in turn. The caller must hold
+// bc.mux.
+func (bc *Blockchain) checkForkBlocks(blocks []*Block, fork int) error {
+	if bc.balances == nil {
+		bc.rebuildBalances()
+	}
+	balances := make(map[string]float64, len(bc.balances))
+	for address, balance := range bc.balances {
+		balances[address] = balance
+	}
+	for _, block := range bc.Blocks[fork:] {
+		for address, delta := range blockBalanceChanges(block) {
+			balances[address] -= delta
+		}
+	}
+
+	for i := fork; i < len(blocks); i++ {
+		// The genesis block funds the chain, it is only checked against the local one
+		if i > 0 {
+			err := bc.checkPeerBlock(blocks[:i], blocks[i], balances)
+			if err != nil {
+				return err
+			}
+		}
+		for address, delta := range blockBalanceChanges(blocks[i]) {
+			balances[address] += delta
+		}
+	}
+	return nil
+}
+
+// unindexBalances undoes the changes indexBalances made to the balance index for the block, when the block is
+// orphaned by a reorg or rolled back. Balances left within rounding error of zero are removed. It returns false
+// if there is no record of the block's changes, in which case the index must be rebuilt. The caller must hold
+// bc.mux.
+func (bc *Blockchain) unindexBalances(block *Block) bool {
+	if bc.balances == nil {
+		return true
+	}
+
+	changes, ok := bc.balanceUndo[block.Hash]
+	if !ok {
+		return false
+	}
+
+	for address, delta := range changes {
+		bc.balances[address] -= delta
+		if math.Abs(bc.balances[address]) < balanceEpsilon {
+			delete(bc.balances, address)
+		}
+	}
+	delete(bc.balanceUndo, block.Hash)
+	bc.unindexTokens(block)
+	return true
+}
+
+// requiredConfirmations returns the number of confirmations a transaction needs before it is confirmed.
+func (bc *Blockchain) requiredConfirmations() int64 {
+	if bc.cfg == nil || bc.cfg.RequiredConfirmations <= 0 {
+		return requiredConfirmations
+	}
+	return int64(bc.cfg.RequiredConfirmations)
+}
+
+// difficultyBounds returns the lowest and highest difficulty blocks are mined or retargeted at.
+func (bc *Blockchain) difficultyBounds() (uint32, uint32) {
+	if bc.cfg == nil || bc.cfg.MinDifficulty < 0 || bc.cfg.MaxDifficulty < bc.cfg.MinDifficulty || bc.cfg.MaxDifficulty > difficultyLimit {
+		return minDifficulty, maxDifficulty
+	}
+	return uint32(bc.cfg.MinDifficulty), uint32(bc.cfg.MaxDifficulty)
+}
+
+// acceptLegacySignatures returns whether transactions signed with the legacy signature scheme are accepted.
+func (bc *Blockchain) acceptLegacySignatures() bool {
+	if bc.cfg == nil {
+		return acceptLegacySignatures
+	}
+	return bc.cfg.AcceptLegacySignatures
+}
+
+// maxClockSkew returns how far ahead of this node's clock a block timestamp may be.
+func (bc *Blockchain) maxClockSkew() time.Duration {
+	if bc.cfg == nil || bc.cfg.MaxClockSkew < 0 {
+		return maxClockSkewInSec * time.Second
+	}
+	return time.Duration(bc.cfg.MaxClockSkew) * time.Second
+}
+
+// balanceDelta returns how much the transaction changes the balance of the address. The second return value
+// is false if the transaction does not affect the address.
+func balanceDelta(tx Transaction, address string) (float64, bool) {
+	delta := 0.0
+	affected := false
+
+	if sender := tx.GetSenderWallet(); sender != nil && sender.GetAddress() == address {
+		affected = true
+		delta -= tx.GetFee()
+		if bankTx, ok := tx.(*Bank); ok {
+			delta -= bankTx.Amount
+		}
+	}
+	if tx.GetProtocol() == BankProtocolID {
+		if bankTx, ok := tx.(*Bank); ok && bankTx.To != nil {
+			if bankTx.To.GetAddress() == address {
+				affected = true
+				delta += bankTx.Amount
+			}
+		}
+	}
+
+	return delta, affected
+}
+
+// feeCredit returns the fees the block pays to the address. The second return value is false if the address
+// is not the block's fee recipient.
+func feeCredit(block *Block, address string) (float64, bool) {
+	if block.FeeRecipient == "" || block.FeeRecipient != address {
+		return 0, false
+	}
+	return block.CalculateTotalFees(), true
+}
+
+// rewardCredit returns the reward the block pays to the address. The second return value is false if the address
+// is not the block's reward recipient.
+func rewardCredit(block *Block, address string) (float64, bool) {
+	if block.RewardRecipient == "" || block.RewardRecipient != address {
+		return 0, false
+	}
+	return block.Reward, true
+}
+
+// rewardRecipient returns the address paid for mining a new block: Config.MiningRewardAddress, or
+// Config.MinerAddress when it is not set.
+func (bc *Blockchain) rewardRecipient() string {
+	if bc.cfg == nil {
+		return ""
+	}
+	if bc.cfg.MiningRewardAddress != "" {
+		return bc.cfg.MiningRewardAddress
+	}
+	return bc.cfg.MinerAddress
+}
+
+// setBlockReward sets the coinbase credit of a new block: the reward the schedule gives its height, paid to
+// rewardRecipient. Nothing is paid once the reward has halved to nothing.
+func (bc *Blockchain) setBlockReward(block *Block) {
+	recipient := bc.rewardRecipient()
+	if recipient == "" {
+		return
+	}
+
+	reward := bc.GetBlockReward(block.Index.Int64())
+	if reward <= 0 {
+		return
+	}
+	block.Reward = reward
+	block.RewardRecipient = recipient
+}
+
+// checkBlockReward returns an error wrapping ErrInvalidBlockReward if the block pays a reward other than the one
+// the reward schedule gives its height. Blocks that pay no reward, such as those mined before rewards were paid,
+// are accepted.
+func (bc *Blockchain) checkBlockReward(block *Block) error {
+	if block.RewardRecipient == "" {
+		if block.Reward != 0 {
+			return fmt.Errorf("%w: block %s pays %g to no one", ErrInvalidBlockReward, block.Index.String(), block.Reward)
+		}
+		return nil
+	}
+
+	expected := bc.GetBlockReward(block.Index.Int64())
+	if block.Index.Sign() == 0 || math.Abs(block.Reward-expected) > balanceEpsilon {
+		return fmt.Errorf("%w: block %s pays %g, the schedule gives %g", ErrInvalidBlockReward, block.Index.String(),
+			block.Reward, expected)
+	}
+	return nil
+}
+
+// feeRecipient returns the address credited with the fees of a new block under Config.FeePolicy, or an empty
+// string when fees are burned.
+func (bc *Blockchain) feeRecipient() string {
+	switch bc.feePolicy() {
+	case FeePolicyMiner:
+		return bc.rewardRecipient()
+	case FeePolicyTreasury:
+		if bc.cfg != nil {
+			return bc.cfg.DevAddress
+		}
+	}
+	return ""
+}
+
+// feePolicy returns Config.FeePolicy, or the default policy when it is not set.
+func (bc *Blockchain) feePolicy() string {
+	if bc.cfg != nil && bc.cfg.FeePolicy != "" {
+		return bc.cfg.FeePolicy
+	}
+	return feePolicy
+}
+
+// checkFeeRecipient returns an error wrapping ErrInvalidFeeRecipient if the block pays its fees somewhere
+// Config.FeePolicy does not allow. Under the miner policy the block's miner chooses the recipient, which must be a
+// valid address and, when the block pays a reward, the reward's recipient. A miner may also burn its fees.
+func (bc *Blockchain) checkFeeRecipient(block *Block) error {
+	recipient := block.FeeRecipient
+	switch bc.feePolicy() {
+	case FeePolicyMiner:
+		if recipient == "" {
+			return nil
+		}
+		if err := ValidateAddress(recipient); err != nil {
+			return fmt.Errorf("%w: block %s pays %s: %v", ErrInvalidFeeRecipient, block.Index.String(), recipient, err)
+		}
+		if block.RewardRecipient != "" && block.RewardRecipient != recipient {
+			return fmt.Errorf("%w: block %s pays its fees to %s and its reward to %s", ErrInvalidFeeRecipient,
+				block.Index.String(), recipient, block.RewardRecipient)
+		}
+	default:
+		if expected := bc.feeRecipient(); recipient != expected {
+			return fmt.Errorf("%w: block %s pays %q, the %s policy pays %q", ErrInvalidFeeRecipient,
+				block.Index.String(), recipient, bc.feePolicy(), expected)
+		}
+	}
+	return nil
+}
+
+// StatementLine is a single credit or debit on a wallet statement.
+type StatementLine struct {
+	TxID           string    `json:"tx_id"` // Empty for the fees and reward a block pays its recipients
+	BlockIndex     int64     `json:"block_index"`
+	Timestamp      time.Time `json:"timestamp"`
+	Delta          float64   `json:"delta"`
+	RunningBalance float64   `json:"running_balance"`
+}
+
+// GetStatement returns every mined transaction that changed the balance of the address, in chain order,
+// with the balance after each one. The running balance of the last line matches GetBalance.
+func (bc *Blockchain) GetStatement(address string) []StatementLine {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	statement := []StatementLine{}
+	balance := 0.0
+	for _, block := range bc.Blocks {
+		var lines []StatementLine
+		lines, balance = blockStatement(block, address, balance)
+		statement = append(statement, lines...)
+	}
+	return statement
+}
+
+// blockStatement returns the statement lines for the address in a single block, starting from balance, along
+// with the balance after the block.
+func blockStatement(block *Block, address string, balance float64) ([]StatementLine, float64) {
+	var lines []StatementLine
+	for _, tx := range block.Transactions {
+		delta, ok := balanceDelta(tx, address)
+		if !ok {
+			continue
+		}
+
+		balance += delta
+		lines = append(lines, StatementLine{
+			TxID:           tx.GetID(),
+			BlockIndex:     block.Index.Int64(),
+			Timestamp:      block.Header.Timestamp,
+			Delta:          delta,
+			RunningBalance: balance,
+		})
+	}
+
+	if fees, ok := feeCredit(block, address); ok {
+		balance += fees
+		lines = append(lines, StatementLine{
+			BlockIndex:     block.Index.Int64(),
+			Timestamp:      block.Header.Timestamp,
+			Delta:          fees,
+			RunningBalance: balance,
+		})
+	}
+	if reward, ok := rewardCredit(block, address); ok {
+		balance += reward
+		lines = append(lines, StatementLine{
+			BlockIndex:     block.Index.Int64(),
+			Timestamp:      block.Header.Timestamp,
+			Delta:          reward,
+			RunningBalance: balance,
+		})
+	}
+	return lines, balance
+}
+
+// CalculateTotalSupply calculates the total supply of tokens in the blockchain.
+func (bc *Blockchain) CalculateTotalSupply() float64 {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	totalSupply := 0.0
+	for _, block := range bc.Blocks {
+		for _, tx := range block.Transactions {
+			if tx.GetProtocol() == CoinbaseProtocolID {
+				if coinbaseTx, ok := tx.(*Coinbase); ok {
+					totalSupply += float64(coinbaseTx.TokenCount)
+				}
+			}
+		}
+		totalSupply += block.Reward
+		totalSupply -= block.BurnedFees()
+	}
+	return totalSupply
+}
+
+// ChainValidationReport is the outcome of validating the blockchain.
+type ChainValidationReport struct {
+	Valid         bool   `json:"valid"`
+	Error         string `json:"error,omitempty"`
+	BlocksChecked int    `json:"blocks_checked"`
+	DurationMS    int64  `json:"duration_ms"`
+}
+
+// ValidateChain validates the entire blockchain.
+func (bc *Blockchain) ValidateChain() error {
+	_, err := bc.validateBlocks(bc.snapshotBlocks())
+	return err
+}
+
+// ValidateChainReport validates a snapshot of the blockchain and reports how many blocks were checked and
+// how long it took. The chain is only locked while the snapshot is taken, so it is safe to call while mining.
+func (bc *Blockchain) ValidateChainReport() *ChainValidationReport {
+	start := time.Now()
+	checked, err := bc.validateBlocks(bc.snapshotBlocks())
+
+	report := &ChainValidationReport{
+		Valid:         err == nil,
+		BlocksChecked: checked,
+		DurationMS:    time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report
+}
+
+// snapshotBlocks returns a copy of the block slice taken under the blockchain lock.
+func (bc *Blockchain) snapshotBlocks() []*Block {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	blocks := make([]*Block, len(bc.Blocks))
+	copy(blocks, bc.Blocks)
+	return blocks
+}
+
+// validateBlocks validates each block against its predecessor, allowing timestamps up to Config.MaxClockSkew in
+// the future, and checks the reward each block pays. It returns the number of blocks checked, counting the genesis
+// block and any block found invalid.
+func (bc *Blockchain) validateBlocks(blocks []*Block) (int, error) {
+	maxSkew := bc.maxClockSkew()
+	for i := 1; i < len(blocks); i++ {
+		currentBlock := blocks[i]
+		previousBlock := blocks[i-1]
 
 		if currentBlock.Header.PreviousHash != previousBlock.Hash {
-			return fmt.Errorf("invalid previous hash at block %d", i)
+			return i + 1, fmt.Errorf("%w at block %d", ErrInvalidPreviousHash, i)
 		}
 
 		if currentBlock.Hash != currentBlock.CalculateHash() {
-			return fmt.Errorf("invalid hash at block %d", i)
+			return i + 1, fmt.Errorf("invalid hash at block %d: %w", i, ErrInvalidHash)
+		}
+
+		if err := currentBlock.ValidateWithClockSkew(previousBlock, maxSkew); err != nil {
+			return i + 1, fmt.Errorf("invalid block at index %d: %w", i, err)
 		}
 
-		if err := currentBlock.Validate(previousBlock); err != nil {
-			return fmt.Errorf("invalid block at index %d: %v", i, err)
+		if err := bc.checkProofOfWork(currentBlock); err != nil {
+			return i + 1, err
+		}
+
+		if err := bc.checkBlockReward(currentBlock); err != nil {
+			return i + 1, err
 		}
 
 		for _, tx := range currentBlock.Transactions {
 			if err := tx.Validate(); err != nil {
-				return fmt.Errorf("invalid transaction %s in block %d: %v", tx.GetID(), i, err)
+				return i + 1, fmt.Errorf("%w %s in block %d: %v", ErrInvalidTransaction, tx.GetID(), i, err)
+			}
+		}
+	}
+
+	return len(blocks), nil
+}
+
+// checkProofOfWork returns an error wrapping ErrInvalidProof if the block's difficulty is outside the range blocks
+// are mined at or its hash does not start with as many zeros as its difficulty asks for.
+func (bc *Blockchain) checkProofOfWork(block *Block) error {
+	minDiff, maxDiff := bc.difficultyBounds()
+	difficulty := block.Header.Difficulty
+	if difficulty < minDiff || difficulty > maxDiff {
+		return fmt.Errorf("%w: block %s has difficulty %d, outside %d to %d", ErrInvalidProof, block.Index.String(),
+			difficulty, minDiff, maxDiff)
+	}
+	if !strings.HasPrefix(block.Hash, strings.Repeat("0", int(difficulty))) {
+		return fmt.Errorf("%w: block %s at difficulty %d", ErrInvalidProof, block.Index.String(), difficulty)
+	}
+	return nil
+}
+
+// blockWork returns the expected number of hashes needed to mine the block, 16^difficulty, as each unit of
+// difficulty is one more leading zero hex digit. Difficulties above difficultyLimit can't be met and count as it.
+func blockWork(block *Block) *big.Int {
+	difficulty := min(uint(block.Header.Difficulty), difficultyLimit)
+	return new(big.Int).Lsh(big.NewInt(1), 4*difficulty)
+}
+
+// chainWork returns the cumulative work of the blocks.
+func chainWork(blocks []*Block) *big.Int {
+	work := new(big.Int)
+	for _, block := range blocks {
+		work.Add(work, blockWork(block))
+	}
+	return work
+}
+
+// TotalWork returns the cumulative work of the chain, the sum of 16^difficulty for every block.
+func (bc *Blockchain) TotalWork() *big.Int {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	return chainWork(bc.Blocks)
+}
+
+// ReplaceChain replaces the local chain with blocks, a chain received from a peer, if it is valid, starts from
+// the same genesis block and has more cumulative work than the local chain. The chain with the most work wins
+// even if it is shorter. The error wraps ErrGenesisMismatch or ErrInsufficientWork if the chain is refused.
+// The blocks after the fork point must also pass the checks AddBlock makes on a block from a peer, against the
+// balances replayed from the fork point.
+// The balance changes of local blocks orphaned by the new chain are undone before its own blocks are applied, and
+// their transactions that the new chain has not mined are queued again.
+func (bc *Blockchain) ReplaceChain(blocks []*Block) error {
+	if len(blocks) == 0 {
+		return errors.New("cannot replace chain with an empty chain")
+	}
+
+	_, err := bc.validateBlocks(blocks)
+	if err != nil {
+		return err
+	}
+
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	if len(bc.Blocks) > 0 && blocks[0].Hash != bc.Blocks[0].Hash {
+		return ErrGenesisMismatch
+	}
+
+	work, localWork := chainWork(blocks), chainWork(bc.Blocks)
+	if work.Cmp(localWork) <= 0 {
+		return fmt.Errorf("%w: %s <= %s", ErrInsufficientWork, work, localWork)
+	}
+
+	// Only the blocks after the last one the chains have in common change
+	fork := 0
+	for fork < len(blocks) && fork < len(bc.Blocks) && blocks[fork].Hash == bc.Blocks[fork].Hash {
+		fork++
+	}
+
+	// A new block that is already in the local chain, at another height, would be indexed twice
+	for _, block := range blocks[fork:] {
+		if bc.blockByHash(block.Hash) != nil {
+			return fmt.Errorf("%w: %s", ErrDuplicateBlock, block.Hash)
+		}
+	}
+
+	err = bc.checkForkBlocks(blocks, fork)
+	if err != nil {
+		return err
+	}
+
+	// Blocks beyond the end of the new chain no longer belong to it
+	for i := len(blocks); i < len(bc.Blocks); i++ {
+		err = localStorage.DeleteBlock(int64(i))
+		if err != nil {
+			log.Printf("[%s] Error removing block %d: %v\n", time.Now().Format(logDateTimeFormat), i, err)
+		}
+	}
+
+	bc.TXLookup = NewTXLookupManager()
+	for i, block := range blocks {
+		err = bc.TXLookup.Add(block)
+		if err != nil {
+			log.Printf("[%s] Error adding block to TXLookup: %v\n", time.Now().Format(logDateTimeFormat), err)
+		}
+
+		if i < fork {
+			continue
+		}
+		err = block.save()
+		if err != nil {
+			log.Printf("[%s] Error saving block: %v\n", time.Now().Format(logDateTimeFormat), err)
+		}
+	}
+
+	// Undo the orphaned blocks' balance changes, newest first, then apply the new blocks
+	undone := true
+	for i := len(bc.Blocks) - 1; i >= fork; i-- {
+		undone = bc.unindexBalances(bc.Blocks[i]) && undone
+	}
+
+	orphanedBlocks := bc.Blocks[fork:]
+	bc.unmarkProcessed(orphanedBlocks...)
+	bc.Blocks = blocks
+	bc.markProcessed(blocks[fork:]...)
+	for _, block := range blocks[fork:] {
+		bc.indexBalances(block)
+	}
+	if !undone {
+		bc.rebuildBalances()
+	}
+
+	// Queue the orphaned blocks' transactions again, they are only lost if the new chain has mined them too
+	orphaned := []Transaction{}
+	for _, block := range orphanedBlocks {
+		for _, tx := range block.Transactions {
+			if _, mined := bc.TXLookup.FindBlockNumber(tx.GetID()); !mined {
+				orphaned = append(orphaned, tx)
 			}
 		}
 	}
+	unconfirm(orphaned)
 
+	// Drop queued transactions that the new chain has already mined
+	queue := orphaned
+	for _, tx := range bc.TransactionQueue {
+		if _, mined := bc.TXLookup.FindBlockNumber(tx.GetID()); !mined {
+			queue = append(queue, tx)
+		} else {
+			delete(bc.pinned, tx.GetID())
+		}
+	}
+	bc.TransactionQueue = queue
+
+	err = bc.save()
+	if err != nil {
+		log.Printf("[%s] Error saving blockchain state: %v\n", time.Now().Format(logDateTimeFormat), err)
+	}
+
+	bc.notifyNewBlock()
+	bc.notifyAddresses(blocks[fork:])
+	log.Printf("[%s] Replaced chain with %d blocks and total work %s\n", time.Now().Format(logDateTimeFormat), len(blocks), work)
+	return nil
+}
+
+// AddBlock appends a block mined by a peer to the chain. The block must be valid and follow the latest block. A
+// block that is already in the chain is refused with ErrDuplicateBlock, so a block that is submitted twice is only
+// processed once. Queued transactions the block has mined are removed from the mempool.
+//
+// Before the block is applied its proof of work and reward are checked, none of its transactions may have been
+// processed already, and it must pass checkPeerBlock.
+func (bc *Blockchain) AddBlock(block *Block) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	if bc.blockByHash(block.Hash) != nil {
+		return fmt.Errorf("%w: %s", ErrDuplicateBlock, block.Hash)
+	}
+	if len(bc.Blocks) == 0 {
+		return errors.New("cannot add a block to a chain without a genesis block")
+	}
+
+	latest := bc.Blocks[len(bc.Blocks)-1]
+	if block.Index.Int64() != int64(len(bc.Blocks)) {
+		return fmt.Errorf("%w: block %s does not follow block %s", ErrInvalidPreviousHash, block.Index.String(), latest.Index.String())
+	}
+	err := block.ValidateWithClockSkew(latest, bc.maxClockSkew())
+	if err != nil {
+		return err
+	}
+	err = bc.checkProofOfWork(block)
+	if err != nil {
+		return err
+	}
+	err = bc.checkBlockReward(block)
+	if err != nil {
+		return err
+	}
+	for _, tx := range block.Transactions {
+		if bc.isProcessed(tx.GetID()) {
+			return fmt.Errorf("%w: %s", ErrAlreadyProcessed, tx.GetID())
+		}
+	}
+	if bc.balances == nil {
+		bc.rebuildBalances()
+	}
+	err = bc.checkPeerBlock(bc.Blocks, block, bc.balances)
+	if err != nil {
+		return err
+	}
+
+	err = bc.saveWithRetry("block", block.save)
+	if err != nil {
+		return err
+	}
+
+	queue := bc.TransactionQueue
+	lookup := append(Index{}, *bc.TXLookup.Get()...)
+
+	err = bc.TXLookup.Add(block)
+	if err != nil {
+		log.Printf("[%s] Error adding block to TXLookup: %v\n", time.Now().Format(logDateTimeFormat), err)
+	}
+
+	bc.Blocks = append(bc.Blocks, block)
+	bc.indexBalances(block)
+	bc.markProcessed(block)
+
+	// Drop queued transactions that the block has mined
+	remaining := []Transaction{}
+	var mined []Transaction
+	for _, tx := range queue {
+		if bc.isProcessed(tx.GetID()) {
+			mined = append(mined, tx)
+		} else {
+			remaining = append(remaining, tx)
+		}
+	}
+	bc.TransactionQueue = remaining
+
+	err = bc.saveWithRetry("blockchain state", bc.save)
+	if err != nil {
+		bc.rollbackBlock(block, queue, &lookup)
+		return err
+	}
+
+	bc.unpin(mined)
+	bc.notifyNewBlock()
+	bc.notifyAddresses([]*Block{block})
+	log.Printf("[%s] Added block [#%s] from a peer\n", time.Now().Format(logDateTimeFormat), block.Index.String())
 	return nil
 }
 
@@ -571,6 +2075,44 @@ func (bc *Blockchain) GetTransactionHistory(address string) []Transaction {
 	return history
 }
 
+// GetTransactionsByTimeRange returns the transactions in blocks with a timestamp from "from" to "to", inclusive.
+// Block timestamps only move forward, so the first block in the range is found with a binary search and the scan
+// stops at the first block after it.
+func (bc *Blockchain) GetTransactionsByTimeRange(from, to time.Time) []Transaction {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	first := sort.Search(len(bc.Blocks), func(i int) bool {
+		return !bc.Blocks[i].Header.Timestamp.Before(from)
+	})
+
+	var txs []Transaction
+	for _, block := range bc.Blocks[first:] {
+		if block.Header.Timestamp.After(to) {
+			break
+		}
+		txs = append(txs, block.Transactions...)
+	}
+
+	return txs
+}
+
+// GetBlockAtTime returns the block that was the tip of the chain at time t, the last block with a timestamp at
+// or before t. It returns nil if t is before the genesis block.
+func (bc *Blockchain) GetBlockAtTime(t time.Time) *Block {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	// Block timestamps only move forward, so the first block after t is found with a binary search
+	next := sort.Search(len(bc.Blocks), func(i int) bool {
+		return bc.Blocks[i].Header.Timestamp.After(t)
+	})
+	if next == 0 {
+		return nil
+	}
+	return bc.Blocks[next-1]
+}
+
 // GetPendingTransactions returns all pending transactions in the queue.
 func (bc *Blockchain) GetPendingTransactions() []Transaction {
 	bc.mux.Lock()
@@ -587,6 +2129,7 @@ func (bc *Blockchain) RemoveTransaction(id string) bool {
 	for i, tx := range bc.TransactionQueue {
 		if tx.GetID() == id {
 			bc.TransactionQueue = append(bc.TransactionQueue[:i], bc.TransactionQueue[i+1:]...)
+			delete(bc.pinned, id)
 			return true
 		}
 	}
@@ -634,6 +2177,49 @@ func (bc *Blockchain) GetMempoolSize() int {
 	return len(bc.TransactionQueue)
 }
 
+// EstimateConfirmationTime predicts how long a transaction paying fee would wait before it is included in a block.
+// Transactions already in the mempool paying at least as much are assumed to go first, and blocks are assumed to
+// hold as many transactions of the mempool's average size as fit in Config.MaxBlockSize, arriving at the average
+// interval of the recent blocks.
+func (bc *Blockchain) EstimateConfirmationTime(fee float64) time.Duration {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	// Rank the fee in the mempool
+	ahead := 0
+	totalSize := 0
+	for _, tx := range bc.TransactionQueue {
+		if tx.GetFee() >= fee {
+			ahead++
+		}
+		totalSize += tx.Size()
+	}
+
+	// Number of transactions that fit in a block
+	capacity := len(bc.TransactionQueue) + 1
+	if totalSize > 0 && bc.cfg.MaxBlockSize > 0 {
+		avgSize := totalSize / len(bc.TransactionQueue)
+		capacity = max(1, bc.cfg.MaxBlockSize/max(1, avgSize))
+	}
+
+	blocks := ahead/capacity + 1
+	return time.Duration(blocks) * bc.averageBlockInterval()
+}
+
+// averageBlockInterval returns the average time between the most recent blocks, or the configured block time if
+// there are not enough blocks yet. The caller must hold bc.mux.
+func (bc *Blockchain) averageBlockInterval() time.Duration {
+	n := min(len(bc.Blocks)-1, confirmationEstimateWindow)
+	if n > 0 {
+		latest := bc.Blocks[len(bc.Blocks)-1].Header.Timestamp
+		earliest := bc.Blocks[len(bc.Blocks)-1-n].Header.Timestamp
+		if interval := latest.Sub(earliest) / time.Duration(n); interval > 0 {
+			return interval
+		}
+	}
+	return time.Duration(bc.cfg.BlockTime) * time.Second
+}
+
 // GetBlockCount returns the total number of blocks in the blockchain.
 func (bc *Blockchain) GetBlockCount() int {
 	bc.mux.Lock()
@@ -1,14 +1,22 @@
 package sdk
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"math/big"
 	"math/rand"
+	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -76,3 +84,1093 @@ func TestBlockchain(t *testing.T) {
 
 	// Further test cases to be added
 }
+
+// newTestBlockchain creates an empty blockchain with default configuration that persists to the
+// test storage. No genesis block or wallets are created.
+func newTestBlockchain(t *testing.T) *Blockchain {
+	t.Helper()
+
+	cfg := &Config{}
+	cfg.setDefaultValues()
+
+	return &Blockchain{
+		cfg:              cfg,
+		Blocks:           []*Block{},
+		TransactionQueue: []Transaction{},
+		TXLookup:         NewTXLookupManager(),
+		NextBlockIndex:   1,
+		State:            &State{},
+	}
+}
+
+// newTestMessage creates an unsigned message transaction with a unique ID between two address only wallets.
+func newTestMessage(t *testing.T, message string) *Message {
+	t.Helper()
+
+	assetID, err := NewRandomBigInt()
+	assert.NoError(t, err)
+
+	return &Message{
+		Tx: Tx{
+			ID:        NewPUID(ThisBlockchainOrganizationID, ThisBlockchainAppID, ThisBlockchainAdminUserID, assetID),
+			Time:      time.Now(),
+			Version:   TransactionVersion,
+			From:      &Wallet{Address: testAddr},
+			To:        &Wallet{Address: testAddr},
+			Fee:       transactionFee,
+			Status:    StatusPending,
+			Protocol:  MessageProtocolID,
+			CreatedAt: time.Now(),
+		},
+		Message: message,
+	}
+}
+
+// newSignedTestMessage creates a message transaction signed by a new wallet, the way a peer sends it: the wallet
+// is locked again after signing, and the sender is replaced with a wallet that only has its address. The wallet is
+// saved, so the test must use test storage.
+func newSignedTestMessage(t *testing.T, message string) *Message {
+	t.Helper()
+
+	wallet, err := NewWallet(NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(4), "Signer", testPassPhrase, nil))
+	require.NoError(t, err)
+	require.NoError(t, wallet.Unlock(testPassPhrase))
+
+	msg := newTestMessage(t, message)
+	msg.From = wallet
+	msg.ID = msg.computeID(message)
+	msg.Signature, err = msg.Sign([]byte(wallet.PrivatePEM()))
+	require.NoError(t, err)
+
+	require.NoError(t, wallet.Lock(testPassPhrase))
+	msg.From = &Wallet{Address: wallet.GetAddress()}
+	return msg
+}
+
+func TestBlockchainCleanupPersistsState(t *testing.T) {
+	useTestStorage(t)
+
+	bc := newTestBlockchain(t)
+	tx := newTestMessage(t, "still here after a restart")
+	bc.AddTransaction(tx)
+	bc.CurrentBlockIndex = 7
+	bc.NextBlockIndex = 8
+
+	assert.NoError(t, bc.Cleanup())
+
+	reloaded := newTestBlockchain(t)
+	reloaded.TransactionQueue = nil
+	assert.NoError(t, reloaded.Load())
+
+	assert.Equal(t, 7, reloaded.CurrentBlockIndex)
+	assert.Equal(t, 8, reloaded.NextBlockIndex)
+	if assert.Len(t, reloaded.TransactionQueue, 1) {
+		msg, ok := reloaded.TransactionQueue[0].(*Message)
+		assert.True(t, ok)
+		assert.Equal(t, tx.GetID(), msg.GetID())
+		assert.Equal(t, "still here after a restart", msg.Message)
+	}
+}
+
+func TestAddTransactionRejectsDuplicates(t *testing.T) {
+	bc := newTestBlockchain(t)
+	tx := newTestMessage(t, "only once")
+
+	assert.NoError(t, bc.AddTransaction(tx))
+	assert.ErrorIs(t, bc.AddTransaction(tx), ErrDuplicateTransaction)
+	assert.Equal(t, 1, bc.GetMempoolSize())
+
+	// Transactions that have already been mined are rejected too
+	mined := newTestMessage(t, "already in a block")
+	bc.Blocks = append(bc.Blocks, NewBlock([]Transaction{mined}, ""))
+	assert.ErrorIs(t, bc.AddTransaction(mined), ErrDuplicateTransaction)
+	assert.Equal(t, 1, bc.GetMempoolSize())
+}
+
+func TestMempoolEvictsLowestFee(t *testing.T) {
+	bc := newTestBlockchain(t)
+	bc.cfg.MaxMempoolSize = 3
+
+	for _, fee := range []float64{0.02, 0.05, 0.03} {
+		tx := newTestMessage(t, "fill")
+		tx.Fee = fee
+		require.NoError(t, bc.AddTransaction(tx))
+	}
+	assert.Equal(t, 3, bc.GetMempoolSize())
+
+	// A lower fee than anything queued is rejected
+	cheap := newTestMessage(t, "cheap")
+	cheap.Fee = 0.01
+	assert.ErrorIs(t, bc.AddTransaction(cheap), ErrMempoolFull)
+
+	// A higher fee replaces the cheapest queued transaction
+	generous := newTestMessage(t, "generous")
+	generous.Fee = 0.10
+	require.NoError(t, bc.AddTransaction(generous))
+	assert.Equal(t, 3, bc.GetMempoolSize())
+
+	fees := []float64{}
+	for _, tx := range bc.TransactionQueue {
+		fees = append(fees, tx.GetFee())
+	}
+	assert.ElementsMatch(t, []float64{0.05, 0.03, 0.10}, fees)
+}
+
+func TestMaxPendingPerSender(t *testing.T) {
+	const otherAddr = "0000000000000000000000000000000000000000000000000000000000000001"
+	bc := newTestBlockchain(t)
+	bc.cfg.MaxPendingPerSender = 2
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, bc.AddTransaction(newTestMessage(t, "flood")))
+	}
+
+	// The flooding sender is refused, even with a higher fee
+	flood := newTestMessage(t, "flood")
+	flood.Fee = 1
+	assert.ErrorIs(t, bc.AddTransaction(flood), ErrTooManyPending)
+
+	// Other senders are still accepted
+	other := newTestMessage(t, "other")
+	other.From = &Wallet{Address: otherAddr}
+	require.NoError(t, bc.AddTransaction(other))
+	assert.Equal(t, 3, bc.GetMempoolSize())
+
+	// Once a transaction is mined the sender may queue another
+	bc.TransactionQueue = bc.TransactionQueue[1:]
+	assert.NoError(t, bc.AddTransaction(flood))
+}
+
+func TestPinTransaction(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+	api := NewAPI(bc)
+
+	var high []*Message
+	for i := 0; i < 3; i++ {
+		tx := newTestMessage(t, "high")
+		tx.Fee = 1
+		require.NoError(t, bc.AddTransaction(tx))
+		high = append(high, tx)
+	}
+	low := newTestMessage(t, "low!")
+	low.Fee = minTransactionFee
+	require.NoError(t, bc.AddTransaction(low))
+
+	// Only two transactions fit in a block
+	bc.cfg.MaxBlockSize = low.Size() + high[0].Size() + high[0].Size()/2
+
+	rec := serveTestRequest(api, http.MethodPost, "/blockchain/transactions/"+low.GetID()+"/pin")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.True(t, bc.IsPinned(low.GetID()))
+
+	// The pinned transaction is always taken, the highest fees fill the rest of the block
+	bc.createNewBlock(1)
+	block := bc.Blocks[len(bc.Blocks)-1]
+	require.Len(t, block.Transactions, 2)
+	assert.ElementsMatch(t, []string{low.GetID(), high[0].GetID()},
+		[]string{block.Transactions[0].GetID(), block.Transactions[1].GetID()})
+	assert.False(t, bc.IsPinned(low.GetID()))
+	assert.Equal(t, 2, bc.GetMempoolSize())
+
+	// Only pending transactions can be pinned
+	assert.ErrorIs(t, bc.PinTransaction(low.GetID()), ErrNotPending)
+	rec = serveTestRequest(api, http.MethodPost, "/blockchain/transactions/"+low.GetID()+"/pin")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestNewBlockchainDoesNotRecreateGenesis(t *testing.T) {
+	dataPath := useTestStorage(t)
+
+	// Simulate a populated data dir, the dev wallet was funded by the coinbase and the miner by a bank transfer
+	coinbase := &Coinbase{Tx: Tx{ID: NewPUIDEmpty(), Protocol: CoinbaseProtocolID, To: &Wallet{Address: "dev-address"}, Status: StatusConfirmed}}
+	bank := &Bank{Tx: Tx{ID: NewPUIDEmpty(), Protocol: BankProtocolID, To: &Wallet{Address: "miner-address"}, Status: StatusConfirmed}, Amount: 100}
+	genesis := NewBlock([]Transaction{coinbase, bank}, "")
+	genesis.Hash = genesis.CalculateHash()
+	require.NoError(t, genesis.save())
+
+	// A state file that can not be loaded
+	require.NoError(t, os.WriteFile(filepath.Join(dataPath, "blockchain.json"), []byte("{corrupt"), 0644))
+
+	cfg := &Config{}
+	cfg.setDefaultValues()
+	bc := NewBlockchain(cfg)
+	require.NotNil(t, bc)
+
+	require.Equal(t, 1, bc.GetBlockCount())
+	assert.Equal(t, genesis.Hash, bc.GetLatestBlock().Hash)
+	assert.Equal(t, "dev-address", cfg.DevAddress)
+	assert.Equal(t, "miner-address", cfg.MinerAddress)
+
+	wallets, err := localStorage.walletFiles()
+	require.NoError(t, err)
+	assert.Empty(t, wallets, "no dev or miner wallets should have been created")
+}
+
+func TestBlockRewardSchedule(t *testing.T) {
+	bc := newTestBlockchain(t)
+	bc.cfg.InitialBlockReward = 16
+	bc.cfg.HalvingInterval = 10
+	require.NoError(t, bc.cfg.Validate())
+
+	assert.Equal(t, 16.0, bc.GetBlockReward(0))
+	assert.Equal(t, 16.0, bc.GetBlockReward(9))
+	assert.Equal(t, 8.0, bc.GetBlockReward(10))
+	assert.Equal(t, 4.0, bc.GetBlockReward(25))
+	assert.Equal(t, 1.0, bc.GetBlockReward(40))
+
+	// Without a config the default schedule applies
+	block := &Block{}
+	assert.Equal(t, float64(InitialBlockReward), block.CalculateBlockReward(BlockRewardHalvingInterval-1, nil))
+	assert.Equal(t, float64(InitialBlockReward)/2, block.CalculateBlockReward(BlockRewardHalvingInterval, nil))
+}
+
+func TestAddBlockChecksTransactionsAndFees(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.cfg.InitialBlockReward = 0
+	paid := newSignedTestMessage(t, "paid for")
+	unpaid := newSignedTestMessage(t, "the sender can't pay the fee")
+	sender := paid.From.GetAddress()
+	bc.GenerateGenesisBlock(genesisAllocations(map[string]float64{sender: 1}))
+	genesis := bc.GetLatestBlock()
+
+	// Every transaction must be signed by its sender
+	assert.ErrorIs(t, bc.AddBlock(newPeerTestBlock(t, genesis, newTestMessage(t, "unsigned"))), ErrInvalidTransaction)
+
+	// and the sender must hold what it spends
+	assert.ErrorIs(t, bc.AddBlock(newPeerTestBlock(t, genesis, unpaid)), ErrInsufficientBalance)
+
+	// The fees must go where the fee policy sends them
+	miner := EncodeAddress(make([]byte, addressHashLength))
+	block := newPeerTestBlock(t, genesis, paid)
+	block.FeeRecipient = miner
+	mineTestBlock(t, block, 1)
+	bc.cfg.FeePolicy = FeePolicyBurn
+	assert.ErrorIs(t, bc.AddBlock(block), ErrInvalidFeeRecipient)
+
+	bc.cfg.FeePolicy = FeePolicyMiner
+	block.FeeRecipient = "not-an-address"
+	mineTestBlock(t, block, 1)
+	assert.ErrorIs(t, bc.AddBlock(block), ErrInvalidFeeRecipient)
+
+	block.FeeRecipient = miner
+	mineTestBlock(t, block, 1)
+	require.NoError(t, bc.AddBlock(block))
+	assert.InDelta(t, 1-paid.GetFee(), bc.GetBalance(sender), 1e-9)
+	assert.InDelta(t, paid.GetFee(), bc.GetBalance(miner), 1e-9)
+}
+
+func TestMinedBlocksPayReward(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.cfg.InitialBlockReward = 16
+	bc.cfg.HalvingInterval = 2
+	bc.cfg.MinerAddress = testAddr
+	bc.cfg.FeePolicy = FeePolicyBurn // Only the reward is paid to the miner
+	bc.GenerateGenesisBlock([]Transaction{})
+	bc.RebuildBalances()
+
+	// Block 1 pays the full reward, blocks 2 and 3 are past the first halving
+	for i := 0; i < 3; i++ {
+		bc.createNewBlock(1)
+	}
+	assert.Zero(t, bc.Blocks[0].Reward, "the genesis block pays no reward")
+	assert.Equal(t, 16.0, bc.Blocks[1].Reward)
+	assert.Equal(t, testAddr, bc.Blocks[1].RewardRecipient)
+	assert.Equal(t, 8.0, bc.Blocks[2].Reward)
+
+	assert.InDelta(t, 32.0, bc.GetBalance(testAddr), 1e-9)
+	assert.InDelta(t, 32.0, bc.GetAllBalances()[testAddr], 1e-9)
+	assert.InDelta(t, 32.0, bc.CalculateTotalSupply(), 1e-9)
+	statement := bc.GetStatement(testAddr)
+	require.Len(t, statement, 3)
+	assert.InDelta(t, 32.0, statement[2].RunningBalance, 1e-9)
+	require.NoError(t, bc.ValidateChain())
+
+	// A block paying itself more than the schedule gives is refused, even though it is properly mined
+	greedy := NewBlock([]Transaction{}, bc.GetLatestBlock().Hash)
+	greedy.Index = *big.NewInt(int64(len(bc.Blocks)))
+	bc.setBlockReward(greedy)
+	greedy.Reward *= 2
+	bc.Mine(greedy, 1)
+	assert.ErrorIs(t, bc.AddBlock(greedy), ErrInvalidBlockReward)
+	assert.InDelta(t, 32.0, bc.GetBalance(testAddr), 1e-9)
+
+	bc.mux.Lock()
+	bc.Blocks = append(bc.Blocks, greedy)
+	bc.mux.Unlock()
+	assert.ErrorIs(t, bc.ValidateChain(), ErrInvalidBlockReward)
+}
+
+func TestTransactionConfirmedAtSetWhenMined(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	tx := newTestMessage(t, "timestamps")
+	require.NoError(t, bc.AddTransaction(tx))
+	assert.False(t, tx.GetCreatedAt().IsZero())
+	assert.Nil(t, tx.GetConfirmedAt())
+
+	receipt := bc.GetTransactionReceipt(tx.GetID())
+	require.NotNil(t, receipt.CreatedAt)
+	assert.Nil(t, receipt.ConfirmedAt)
+
+	bc.createNewBlock(1)
+	require.NotNil(t, tx.GetConfirmedAt())
+	assert.False(t, tx.GetConfirmedAt().Before(tx.GetCreatedAt()))
+
+	receipt = bc.GetTransactionReceipt(tx.GetID())
+	require.NotNil(t, receipt.ConfirmedAt)
+	assert.True(t, receipt.ConfirmedAt.Equal(*tx.GetConfirmedAt()))
+}
+
+func TestRunWithContextStopsAfterCancel(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.cfg.BlockTime = 1
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bc.RunWithContext(ctx, 1)
+
+	require.Eventually(t, func() bool { return bc.GetBlockCount() > 1 }, 3*time.Second, 50*time.Millisecond)
+
+	cancel()
+	bc.Stop()
+	blocks := bc.GetBlockCount()
+
+	// No blocks are created once the loop has been cancelled
+	time.Sleep(1500 * time.Millisecond)
+	assert.Equal(t, blocks, bc.GetBlockCount())
+}
+
+func TestRequiredConfirmations(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.cfg.RequiredConfirmations = 3
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	credit := &Bank{Tx: newTestMessage(t, "").Tx, Amount: 10}
+	credit.Protocol = BankProtocolID
+	credit.From = &Wallet{Address: "other-address"}
+	require.NoError(t, bc.AddTransaction(credit))
+	assert.Equal(t, ReceiptStatusPending, bc.GetTransactionReceipt(credit.GetID()).Status)
+
+	for confirmations := int64(1); confirmations < 3; confirmations++ {
+		bc.createNewBlock(1)
+		receipt := bc.GetTransactionReceipt(credit.GetID())
+		assert.Equal(t, ReceiptStatusPendingConfirmation, receipt.Status)
+		assert.Equal(t, confirmations, receipt.Confirmations)
+
+		// The credit is not spendable yet
+		assert.Equal(t, 10.0, bc.GetBalance(testAddr))
+		assert.Equal(t, 0.0, bc.GetConfirmedBalance(testAddr))
+	}
+
+	bc.createNewBlock(1)
+	receipt := bc.GetTransactionReceipt(credit.GetID())
+	assert.Equal(t, ReceiptStatusConfirmed, receipt.Status)
+	assert.Equal(t, int64(3), receipt.Confirmations)
+	assert.Equal(t, 10.0, bc.GetConfirmedBalance(testAddr))
+}
+
+func TestRebuildBalances(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+	bc.RebuildBalances()
+
+	credit := &Bank{Tx: newTestMessage(t, "").Tx, Amount: 10}
+	credit.Protocol = BankProtocolID
+	credit.From = &Wallet{Address: "other-address"}
+	require.NoError(t, bc.AddTransaction(credit))
+	require.NoError(t, bc.AddTransaction(newTestMessage(t, "fee only")))
+	bc.createNewBlock(1)
+
+	// The index is kept up to date as blocks are added
+	expected := bc.calculateBalance(testAddr)
+	assert.Equal(t, 10.0-transactionFee, expected)
+	assert.Equal(t, expected, bc.GetBalance(testAddr))
+	assert.Equal(t, bc.calculateBalance("other-address"), bc.GetBalance("other-address"))
+
+	// Corrupt the cached balance
+	bc.balances[testAddr] = 999
+	assert.Equal(t, 999.0, bc.GetBalance(testAddr))
+
+	bc.RebuildBalances()
+	assert.Equal(t, expected, bc.GetBalance(testAddr))
+	assert.Equal(t, bc.calculateBalance("other-address"), bc.GetBalance("other-address"))
+}
+
+func TestFeePolicy(t *testing.T) {
+	tests := []struct {
+		policy        string
+		minerBalance  float64
+		devBalance    float64
+		supplyChanged float64
+	}{
+		{FeePolicyMiner, transactionFee, 0, 0},
+		{FeePolicyBurn, 0, 0, -transactionFee},
+		{FeePolicyTreasury, 0, transactionFee, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			useTestStorage(t)
+			bc := newTestBlockchain(t)
+			bc.cfg.FeePolicy = tt.policy
+			bc.cfg.MinerAddress = "miner-address"
+			bc.cfg.DevAddress = "dev-address"
+			bc.cfg.InitialBlockReward = 0 // Only the fees are paid out
+			bc.GenerateGenesisBlock([]Transaction{})
+			bc.RebuildBalances()
+			supply := bc.CalculateTotalSupply()
+
+			require.NoError(t, bc.AddTransaction(newTestMessage(t, "pays a fee")))
+			bc.createNewBlock(1)
+
+			assert.Equal(t, -transactionFee, bc.GetBalance(testAddr))
+			assert.InDelta(t, tt.minerBalance, bc.GetBalance("miner-address"), 1e-9)
+			assert.InDelta(t, tt.devBalance, bc.GetBalance("dev-address"), 1e-9)
+			assert.InDelta(t, supply+tt.supplyChanged, bc.CalculateTotalSupply(), 1e-9)
+
+			// The index agrees with a full replay of the chain
+			assert.Equal(t, bc.calculateBalance("miner-address"), bc.GetBalance("miner-address"))
+			assert.Equal(t, bc.calculateBalance("dev-address"), bc.GetBalance("dev-address"))
+		})
+	}
+}
+
+func TestMiningRewardAddress(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.cfg.FeePolicy = FeePolicyMiner
+	bc.cfg.MinerAddress = "miner-address"
+	pool := EncodeAddress(make([]byte, addressHashLength))
+	bc.cfg.MiningRewardAddress = pool
+	bc.cfg.InitialBlockReward = 10
+	require.NoError(t, bc.cfg.Validate())
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	// The pool receives the block reward and the fees instead of the miner address
+	require.NoError(t, bc.AddTransaction(newTestMessage(t, "pays the pool")))
+	bc.createNewBlock(1)
+
+	assert.Equal(t, pool, bc.GetLatestBlock().FeeRecipient)
+	assert.Equal(t, pool, bc.GetLatestBlock().RewardRecipient)
+	assert.InDelta(t, 10+transactionFee, bc.GetBalance(pool), 1e-9)
+	assert.Zero(t, bc.GetBalance("miner-address"))
+
+	// Without an override the miner address is paid
+	bc.cfg.MiningRewardAddress = ""
+	require.NoError(t, bc.AddTransaction(newTestMessage(t, "pays the miner")))
+	bc.createNewBlock(1)
+	assert.InDelta(t, 10+transactionFee, bc.GetBalance("miner-address"), 1e-9)
+
+	// Under the burn policy the override still receives the reward
+	bc.cfg.FeePolicy = FeePolicyBurn
+	bc.cfg.MiningRewardAddress = pool
+	require.NoError(t, bc.cfg.Validate())
+	bc.createNewBlock(1)
+	assert.Empty(t, bc.GetLatestBlock().FeeRecipient)
+	assert.InDelta(t, 20+transactionFee, bc.GetBalance(pool), 1e-9)
+
+	// Without a reward it would receive nothing, so it is refused
+	bc.cfg.InitialBlockReward = 0
+	assert.Error(t, bc.cfg.Validate())
+	bc.cfg.FeePolicy = FeePolicyMiner
+	require.NoError(t, bc.cfg.Validate())
+
+	// A malformed override is refused
+	bc.cfg.MiningRewardAddress = "not-an-address"
+	assert.Error(t, bc.cfg.Validate())
+}
+
+func TestFundNewWallets(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.cfg.FundNewWallets = true
+	bc.cfg.InitialBlockReward = 0 // No new coins are created, so the supply only changes by the funding
+
+	treasuryOptions := NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(1), "Dev", testPassPhrase, []string{"blockchain", "master"})
+	treasuryOptions.InitialBalance = float64(bc.cfg.TokenCount)
+	treasury, err := NewWallet(treasuryOptions)
+	require.NoError(t, err)
+	require.NoError(t, treasury.Open(testPassPhrase))
+
+	coinbase, err := NewCoinbaseTransaction(treasury, treasury, bc.cfg)
+	require.NoError(t, err)
+	bc.GenerateGenesisBlock([]Transaction{coinbase})
+	supply := bc.CalculateTotalSupply()
+	treasuryBalance := bc.GetBalance(treasury.GetAddress())
+
+	// Without a treasury wallet there is nothing to fund new wallets from
+	_, err = bc.NewWallet(NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(2), "Unfunded", testPassPhrase, nil))
+	assert.Error(t, err)
+
+	bc.SetTreasuryWallet(treasury)
+	wallet, err := bc.NewWallet(NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(3), "Funded", testPassPhrase, nil))
+	require.NoError(t, err)
+
+	// The transfer is only queued, nothing moves until it is mined
+	assert.Zero(t, bc.GetBalance(wallet.GetAddress()))
+	assert.Equal(t, treasuryBalance, bc.GetBalance(treasury.GetAddress()))
+	bc.createNewBlock(1)
+
+	// The funds are moved from the treasury rather than created
+	assert.Equal(t, supply, bc.CalculateTotalSupply())
+	assert.Equal(t, bc.cfg.FundWalletAmount, bc.GetBalance(wallet.GetAddress()))
+	assert.Equal(t, treasuryBalance-bc.cfg.FundWalletAmount-transactionFee, bc.GetBalance(treasury.GetAddress()))
+}
+
+func TestGetTransactionsByTimeRange(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	bc.Blocks[0].Header.Timestamp = base
+	ids := make([]string, 0, 4)
+	for i := 1; i <= 4; i++ {
+		msg := newTestMessage(t, "timed")
+		require.NoError(t, bc.AddTransaction(msg))
+		bc.createNewBlock(1)
+		bc.GetLatestBlock().Header.Timestamp = base.Add(time.Duration(i) * time.Hour)
+		ids = append(ids, msg.GetID())
+	}
+
+	idsOf := func(txs []Transaction) []string {
+		result := make([]string, 0, len(txs))
+		for _, tx := range txs {
+			result = append(result, tx.GetID())
+		}
+		return result
+	}
+
+	// The window is inclusive at both ends
+	txs := bc.GetTransactionsByTimeRange(base.Add(2*time.Hour), base.Add(3*time.Hour))
+	assert.Equal(t, ids[1:3], idsOf(txs))
+
+	txs = bc.GetTransactionsByTimeRange(base.Add(90*time.Minute), base.Add(10*time.Hour))
+	assert.Equal(t, ids[1:], idsOf(txs))
+
+	assert.Empty(t, bc.GetTransactionsByTimeRange(base.Add(5*time.Hour), base.Add(6*time.Hour)))
+
+	// The same window through the API
+	api := NewAPI(bc)
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/transactions?from=2024-01-01T14:00:00Z&to=2024-01-01T15:00:00Z")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var found []TransactionView
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &found))
+	require.Len(t, found, 2)
+	assert.Equal(t, ids[1], found[0].ID)
+
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/transactions?from=yesterday")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestGetBlockAtTime(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	assert.Nil(t, bc.GetBlockAtTime(time.Now()))
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	bc.Blocks[0].Header.Timestamp = base
+	for i := 1; i <= 3; i++ {
+		bc.createNewBlock(1)
+		bc.GetLatestBlock().Header.Timestamp = base.Add(time.Duration(i) * time.Hour)
+	}
+
+	// A block is the tip from its own timestamp until the next block
+	assert.Equal(t, bc.Blocks[0], bc.GetBlockAtTime(base))
+	assert.Equal(t, bc.Blocks[0], bc.GetBlockAtTime(base.Add(59*time.Minute)))
+	assert.Equal(t, bc.Blocks[2], bc.GetBlockAtTime(base.Add(2*time.Hour)))
+	assert.Equal(t, bc.Blocks[3], bc.GetBlockAtTime(base.Add(24*time.Hour)))
+
+	// There was no chain before the genesis block
+	assert.Nil(t, bc.GetBlockAtTime(base.Add(-time.Second)))
+
+	// The same through the API
+	api := NewAPI(bc)
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/blocks/at?timestamp=2024-01-01T13:30:00Z")
+	require.Equal(t, http.StatusOK, rec.Code)
+	block, err := DecodeBlock(rec.Body.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, bc.Blocks[1].Hash, block.Hash)
+
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/blocks/at?timestamp=2024-01-01T11:00:00Z")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = serveTestRequest(api, http.MethodGet, "/blockchain/blocks/at?timestamp=noon")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestValidateRewardAddresses(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.cfg.StrictRewards = true
+
+	// The placeholder defaults are replaced when the genesis block is created
+	assert.NoError(t, bc.ValidateRewardAddresses())
+
+	miner, err := NewWallet(NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(2), "Miner", testPassPhrase, []string{"miner"}))
+	require.NoError(t, err)
+	bc.cfg.MinerAddress = miner.GetAddress()
+	assert.NoError(t, bc.ValidateRewardAddresses())
+
+	bc.cfg.DevAddress = "not-an-address"
+	err = bc.ValidateRewardAddresses()
+	assert.ErrorIs(t, err, ErrInvalidRewardAddress)
+	assert.ErrorContains(t, err, "dev address not-an-address")
+
+	// A well formed address still needs a wallet on this node
+	bc.cfg.DevAddress = EncodeAddress(make([]byte, addressHashLength))
+	assert.ErrorIs(t, bc.ValidateRewardAddresses(), ErrInvalidRewardAddress)
+
+	// Without StrictRewards problems are only logged
+	bc.cfg.StrictRewards = false
+	assert.NoError(t, bc.ValidateRewardAddresses())
+}
+
+// newTestChain builds a chain of length blocks from genesis, each mined at the given difficulty.
+// testSigner signs test transactions from the address of its own key, without the cost of creating a wallet.
+type testSigner struct {
+	keys    *PEM
+	address string
+	nonce   uint64
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+
+	key, err := GenerateKey(KeyTypeP256)
+	require.NoError(t, err)
+	keys := NewPEM(key)
+	hash, err := publicKeyHash(keys.GetPublic())
+	require.NoError(t, err)
+	return &testSigner{keys: keys, address: EncodeAddress(hash)}
+}
+
+// message returns a message transaction signed by the signer, with its next nonce.
+func (s *testSigner) message(t *testing.T, message string) *Message {
+	t.Helper()
+
+	msg := newTestMessage(t, message)
+	msg.From = &Wallet{Address: s.address}
+	s.nonce++
+	msg.Nonce = s.nonce
+	msg.ID = msg.computeID(message)
+
+	var err error
+	msg.Signature, err = msg.Sign([]byte(s.keys.GetPrivate()))
+	require.NoError(t, err)
+	return msg
+}
+
+// bank returns a transfer to the address signed by the signer, with its next nonce.
+func (s *testSigner) bank(t *testing.T, to string, amount float64) *Bank {
+	t.Helper()
+
+	bank := newTestBankTx(t, s.address, to, amount)
+	s.nonce++
+	bank.Nonce = s.nonce
+	bank.ID = bank.computeID(amount)
+
+	var err error
+	bank.Signature, err = bank.Sign([]byte(s.keys.GetPrivate()))
+	require.NoError(t, err)
+	return bank
+}
+
+// newTestGenesis returns a genesis block crediting each address with its allocation.
+func newTestGenesis(t *testing.T, allocations map[string]float64) *Block {
+	t.Helper()
+
+	genesis := NewBlock(genesisAllocations(allocations), "")
+	genesis.Index = *big.NewInt(0)
+	mineTestBlock(t, genesis, 1)
+	return genesis
+}
+
+// newTestChain returns a chain of length blocks after genesis, each holding a message from the sender and mined
+// at the difficulty.
+func newTestChain(t *testing.T, genesis *Block, sender *testSigner, length int, difficulty uint32) []*Block {
+	t.Helper()
+
+	blocks := []*Block{genesis}
+	for i := 1; i < length; i++ {
+		msg := sender.message(t, "child")
+		msg.SetStatus(StatusConfirmed)
+		block := NewBlock([]Transaction{msg}, blocks[i-1].Hash)
+		block.Index = *big.NewInt(int64(i))
+		mineTestBlock(t, block, difficulty)
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+func TestReplaceChainPrefersMostWork(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+
+	sender := newTestSigner(t)
+	genesis := newTestGenesis(t, map[string]float64{sender.address: 1})
+
+	long := newTestChain(t, genesis, sender, 6, 1)
+	require.NoError(t, bc.ReplaceChain(long))
+	assert.Equal(t, "96", bc.TotalWork().String())
+
+	// A shorter chain with more work per block wins
+	short := newTestChain(t, genesis, sender, 3, 3)
+	require.NoError(t, bc.ReplaceChain(short))
+	assert.Len(t, bc.Blocks, 3)
+	assert.Equal(t, "8208", bc.TotalWork().String())
+	assert.Len(t, bc.TransactionQueue, 5, "the orphaned blocks' transactions should be queued again")
+
+	_, err := localStorage.GetBlock(5)
+	assert.True(t, os.IsNotExist(err), "blocks beyond the new chain should be removed")
+
+	// The longer, lower work chain is now refused. Its transactions were queued again when it was orphaned, as a
+	// peer would send them they are confirmed.
+	for _, block := range long[1:] {
+		for _, tx := range block.Transactions {
+			tx.SetStatus(StatusConfirmed)
+		}
+	}
+	assert.ErrorIs(t, bc.ReplaceChain(long), ErrInsufficientWork)
+	assert.Len(t, bc.Blocks, 3)
+
+	other := newTestBlock(t)
+	assert.ErrorIs(t, bc.ReplaceChain(newTestChain(t, other, sender, 10, 4)), ErrGenesisMismatch)
+
+	// The total work is reported by the /blockchain endpoint
+	rr := serveTestRequest(NewAPI(bc), http.MethodGet, "/blockchain")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"total_work":"8208"`)
+}
+
+func TestCreateNewBlockRollsBackOnSaveFailure(t *testing.T) {
+	dataPath := useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.cfg.SaveRetries = 2
+	bc.GenerateGenesisBlock([]Transaction{})
+	bc.RebuildBalances()
+
+	msg := newTestMessage(t, "queued")
+	bc.TransactionQueue = []Transaction{msg}
+
+	// Block files can't be written while the blocks folder is a file
+	blocksPath := filepath.Join(dataPath, "blocks")
+	require.NoError(t, os.RemoveAll(blocksPath))
+	require.NoError(t, os.WriteFile(blocksPath, nil, 0644))
+
+	bc.createNewBlock(0)
+	assert.Len(t, bc.Blocks, 1, "the block must not be added when it can't be saved")
+	require.Len(t, bc.TransactionQueue, 1)
+	assert.Equal(t, StatusPending, msg.GetStatus())
+	assert.Nil(t, msg.GetConfirmedAt())
+
+	// The block is saved but the chain state can't be, so the block is rolled back and removed from disk
+	require.NoError(t, os.Remove(blocksPath))
+	require.NoError(t, os.Mkdir(blocksPath, 0755))
+	statePath := filepath.Join(dataPath, "blockchain.json")
+	require.NoError(t, os.RemoveAll(statePath))
+	require.NoError(t, os.Mkdir(statePath, 0755))
+
+	bc.createNewBlock(0)
+	assert.Len(t, bc.Blocks, 1)
+	require.Len(t, bc.TransactionQueue, 1)
+	assert.Equal(t, StatusPending, msg.GetStatus())
+	_, found := bc.TXLookup.FindBlockNumber(msg.GetID())
+	assert.False(t, found)
+	_, err := localStorage.GetBlock(1)
+	assert.True(t, os.IsNotExist(err))
+
+	// Once the disk recovers the transactions are mined as normal
+	require.NoError(t, os.Remove(statePath))
+	bc.createNewBlock(0)
+	require.Len(t, bc.Blocks, 2)
+	assert.Empty(t, bc.TransactionQueue)
+	assert.Equal(t, StatusConfirmed, msg.GetStatus())
+	_, err = localStorage.GetBlock(1)
+	assert.NoError(t, err)
+}
+
+// newTestBankBlock builds a block after previous holding a confirmed bank transfer between two addresses.
+// newTestBankTx returns a bank transfer between two addresses that need not have wallets.
+func newTestBankTx(t *testing.T, from, to string, amount float64) *Bank {
+	t.Helper()
+
+	bank := &Bank{Tx: newTestMessage(t, "").Tx, Amount: amount}
+	bank.Protocol = BankProtocolID
+	bank.From = &Wallet{Address: from}
+	bank.To = &Wallet{Address: to}
+	return bank
+}
+
+// newTestBankBlock returns a block after previous holding a transfer signed by the sender, mined at the
+// difficulty. Its fees are paid to testMinerAddress.
+func newTestBankBlock(t *testing.T, previous *Block, from *testSigner, to string, amount float64, difficulty uint32) *Block {
+	t.Helper()
+
+	bank := from.bank(t, to, amount)
+	bank.SetStatus(StatusConfirmed)
+
+	block := NewBlock([]Transaction{bank}, previous.Hash)
+	block.Index = *big.NewInt(previous.Index.Int64() + 1)
+	block.FeeRecipient = testMinerAddress
+	mineTestBlock(t, block, difficulty)
+	return block
+}
+
+// testMinerAddress is a valid address that test blocks pay their fees to.
+var testMinerAddress = EncodeAddress(make([]byte, addressHashLength))
+
+func TestReplaceChainUndoesOrphanedBalances(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+
+	alice, bob, carol, dave := newTestSigner(t), newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	genesis := newTestGenesis(t, map[string]float64{alice.address: 20})
+	bc.Blocks = []*Block{genesis}
+	bc.RebuildBalances()
+	before := bc.GetAllBalances()
+
+	// Alice pays Bob on the local chain
+	orphan := newTestBankBlock(t, genesis, alice, bob.address, 10, 1)
+	require.NoError(t, bc.ReplaceChain([]*Block{genesis, orphan}))
+	assert.InDelta(t, 10, bc.GetBalance(bob.address), 1e-9)
+	assert.Contains(t, bc.balanceUndo, orphan.Hash)
+
+	// A chain with more work pays Carol instead, so the payment to Bob is orphaned
+	first := newTestBankBlock(t, genesis, alice, carol.address, 3, 2)
+	second := newTestBankBlock(t, first, carol, dave.address, 1.25, 2)
+	alternate := []*Block{genesis, first, second}
+	require.NoError(t, bc.ReplaceChain(alternate))
+	assert.NotContains(t, bc.balanceUndo, orphan.Hash)
+	assert.NotContains(t, bc.GetAllBalances(), bob.address)
+
+	// The orphaned payment is not lost, it is queued to be mined again
+	require.Len(t, bc.TransactionQueue, 1)
+	assert.Equal(t, orphan.Transactions[0].GetID(), bc.TransactionQueue[0].GetID())
+	assert.Equal(t, StatusPending, bc.TransactionQueue[0].GetStatus())
+
+	// The index matches one built from scratch for the alternate chain
+	fresh := newTestBlockchain(t)
+	fresh.Blocks = alternate
+	fresh.RebuildBalances()
+	want := fresh.GetAllBalances()
+	got := bc.GetAllBalances()
+	require.Len(t, got, len(want))
+	for address, balance := range want {
+		assert.InDelta(t, balance, got[address], 1e-9, address)
+	}
+
+	// Rolling back the alternate blocks returns to the genesis balances
+	bc.mux.Lock()
+	assert.True(t, bc.unindexBalances(second))
+	assert.True(t, bc.unindexBalances(first))
+	bc.mux.Unlock()
+	assert.Equal(t, before, bc.GetAllBalances())
+}
+
+func TestReplaceChainChecksForkBlocks(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+
+	alice, bob, carol := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	genesis := newTestGenesis(t, map[string]float64{alice.address: 20})
+	local := newTestBankBlock(t, genesis, alice, bob.address, 15, 1)
+	bc.Blocks = []*Block{genesis}
+	bc.RebuildBalances()
+	require.NoError(t, bc.ReplaceChain([]*Block{genesis, local}))
+
+	// Each fork has more work than the local chain, but must still pass the checks a block from a peer does
+	forged := newTestBankBlock(t, genesis, alice, carol.address, 1, 2)
+	forged.Transactions[0].(*Bank).Signature = local.Transactions[0].GetSignature()
+	mineTestBlock(t, forged, 2)
+	assert.ErrorIs(t, bc.ReplaceChain([]*Block{genesis, forged}), ErrInvalidTransaction)
+
+	overspent := newTestBankBlock(t, genesis, alice, carol.address, 25, 2)
+	assert.ErrorIs(t, bc.ReplaceChain([]*Block{genesis, overspent}), ErrInsufficientBalance)
+
+	unpaid := newTestBankBlock(t, genesis, alice, carol.address, 1, 2)
+	unpaid.FeeRecipient = "not-an-address"
+	mineTestBlock(t, unpaid, 2)
+	assert.ErrorIs(t, bc.ReplaceChain([]*Block{genesis, unpaid}), ErrInvalidFeeRecipient)
+	assert.Equal(t, local.Hash, bc.GetLatestBlock().Hash)
+
+	// Balances are replayed from the fork point, so Alice can spend again what the orphaned block paid Bob
+	fork := newTestBankBlock(t, genesis, alice, carol.address, 15, 2)
+	require.NoError(t, bc.ReplaceChain([]*Block{genesis, fork}))
+	assert.InDelta(t, 15, bc.GetBalance(carol.address), 1e-9)
+	assert.Zero(t, bc.GetBalance(bob.address))
+}
+
+func TestSubscribeAddress(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	bob := bc.SubscribeAddress("bob")
+	carol := bc.SubscribeAddress("carol")
+
+	// Mining a payment to Bob notifies Bob's subscribers only
+	bank := newTestBankTx(t, "alice", "bob", 10)
+	bc.TransactionQueue = []Transaction{bank}
+	bc.createNewBlock(0)
+	require.Len(t, bc.Blocks, 2)
+
+	select {
+	case line := <-bob:
+		assert.Equal(t, bank.GetID(), line.TxID)
+		assert.Equal(t, int64(1), line.BlockIndex)
+		assert.InDelta(t, 10, line.Delta, 1e-9)
+		assert.InDelta(t, bc.GetBalance("bob"), line.RunningBalance, 1e-9)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event for the confirmed transaction")
+	}
+	assert.Empty(t, carol)
+
+	// The running balance carries on from the balance before the block, Bob pays the amount and the fee
+	bc.TransactionQueue = []Transaction{newTestBankTx(t, "bob", "carol", 4)}
+	bc.createNewBlock(0)
+	line := <-bob
+	assert.Less(t, line.Delta, -4.0)
+	assert.InDelta(t, 10+line.Delta, line.RunningBalance, 1e-9)
+	assert.InDelta(t, bc.GetBalance("bob"), line.RunningBalance, 1e-9)
+	assert.Len(t, carol, 1)
+
+	// Unsubscribing closes the channel
+	bc.UnsubscribeAddress(bob)
+	_, open := <-bob
+	assert.False(t, open)
+	assert.NotContains(t, bc.addressSubscribers, "bob")
+}
+
+func TestEstimateConfirmationTime(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+	bc.cfg.BlockTime = 5
+
+	// An empty mempool means the next block
+	assert.Equal(t, 5*time.Second, bc.EstimateConfirmationTime(0.01))
+
+	// Ten transactions paying 0.01 to 0.10, with room for two in a block
+	for i := 1; i <= 10; i++ {
+		msg := newTestMessage(t, fmt.Sprintf("fee %d", i))
+		msg.Fee = float64(i) / 100
+		bc.TransactionQueue = append(bc.TransactionQueue, msg)
+	}
+	bc.cfg.MaxBlockSize = bc.TransactionQueue[0].Size() * 2
+
+	highest := bc.EstimateConfirmationTime(1)
+	middle := bc.EstimateConfirmationTime(0.05)
+	lowest := bc.EstimateConfirmationTime(0.001)
+	assert.Equal(t, 5*time.Second, highest)
+	assert.Less(t, highest, middle)
+	assert.Less(t, middle, lowest)
+	assert.Equal(t, 30*time.Second, lowest)
+
+	// Recent blocks set the interval once there are some
+	first := bc.Blocks[0]
+	second := newTestChildBlock(t, first)
+	second.Header.Timestamp = first.Header.Timestamp.Add(20 * time.Second)
+	bc.Blocks = append(bc.Blocks, second)
+	assert.Equal(t, 20*time.Second, bc.EstimateConfirmationTime(1))
+}
+
+func TestMineWithMiningThreads(t *testing.T) {
+	for _, threads := range []int{1, runtime.NumCPU()} {
+		t.Run(strconv.Itoa(threads), func(t *testing.T) {
+			useTestStorage(t)
+			bc := newTestBlockchain(t)
+			bc.cfg.MiningThreads = threads
+			assert.Equal(t, threads, bc.miningThreads())
+			bc.GenerateGenesisBlock([]Transaction{})
+
+			require.NoError(t, bc.AddTransaction(newTestMessage(t, "threads")))
+			bc.createNewBlock(2)
+
+			block := bc.GetLatestBlock()
+			require.Equal(t, 2, bc.GetBlockCount())
+			assert.True(t, strings.HasPrefix(block.Hash, "00"), "hash %s should have 2 leading zeros", block.Hash)
+			assert.Equal(t, block.CalculateHash(), block.Hash)
+			assert.NoError(t, bc.ValidateChain())
+		})
+	}
+
+	// Every core is used when the thread count is not set
+	bc := newTestBlockchain(t)
+	assert.Equal(t, runtime.NumCPU(), bc.miningThreads())
+}
+
+func TestDeterministicGenesis(t *testing.T) {
+	const otherAddr = "0000000000000000000000000000000000000000000000000000000000000001"
+	allocations := map[string]float64{testAddr: 1000, otherAddr: 250}
+
+	// Each chain is created in its own data folder, as it would be on separate nodes
+	newChain := func(allocations map[string]float64) *Blockchain {
+		useTestStorage(t)
+		bc := newTestBlockchain(t)
+		bc.cfg.DeterministicGenesis = true
+		bc.cfg.GenesisAllocations = allocations
+		require.NoError(t, bc.createBlockchain())
+		require.Equal(t, 1, bc.GetBlockCount())
+		return bc
+	}
+
+	first := newChain(allocations)
+	second := newChain(allocations)
+	genesis := first.GetLatestBlock()
+	assert.Equal(t, genesis.Hash, second.GetLatestBlock().Hash)
+	assert.Equal(t, genesis.CalculateHash(), genesis.Hash)
+	assert.True(t, genesis.Header.Timestamp.Equal(GenesisTimestamp))
+
+	// The allocations are the only balances
+	assert.Equal(t, 1000.0, second.GetBalance(testAddr))
+	assert.Equal(t, 250.0, second.GetBalance(otherAddr))
+
+	// Loading the saved genesis block keeps it, and the configured addresses
+	loaded := newTestBlockchain(t)
+	loaded.cfg.DeterministicGenesis = true
+	loaded.cfg.MinerAddress = testAddr
+	_, err := loaded.LoadExistingBlocks()
+	require.NoError(t, err)
+	assert.Equal(t, genesis.Hash, loaded.GetLatestBlock().Hash)
+	assert.Equal(t, testAddr, loaded.cfg.MinerAddress)
+
+	// Other allocations give another genesis block
+	other := newChain(map[string]float64{testAddr: 1000})
+	assert.NotEqual(t, genesis.Hash, other.GetLatestBlock().Hash)
+}
+
+func TestMinedTransactionRejectedAfterRestart(t *testing.T) {
+	useTestStorage(t)
+
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+	tx := newTestMessage(t, "mined once")
+	require.NoError(t, bc.AddTransaction(tx))
+	bc.createNewBlock(1)
+	require.Len(t, bc.Blocks, 2)
+	assert.ErrorIs(t, bc.AddTransaction(tx), ErrAlreadyProcessed)
+
+	// A restarted node knows the transaction was mined from its saved state alone, before any blocks are loaded
+	restarted := newTestBlockchain(t)
+	require.NoError(t, restarted.Load())
+	require.Empty(t, restarted.Blocks)
+
+	err := restarted.AddTransaction(tx)
+	assert.ErrorIs(t, err, ErrAlreadyProcessed)
+	assert.ErrorIs(t, err, ErrDuplicateTransaction)
+	assert.Equal(t, 0, restarted.GetMempoolSize())
+
+	// Transactions that have not been mined are still accepted
+	assert.NoError(t, restarted.AddTransaction(newTestMessage(t, "new")))
+}
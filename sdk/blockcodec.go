@@ -0,0 +1,258 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/blockcodec.go - Compact binary encoding of blocks for network transfer
+package sdk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// Block wire formats
+const (
+	BlockWireFormatJSON   = "json"
+	BlockWireFormatBinary = "binary"
+)
+
+// blockCodecMagic prefixes every binary encoded block. It can never be the start of a JSON document, which
+// lets a receiver tell the two wire formats apart.
+var blockCodecMagic = []byte{'G', 'B', 'B', 0x01}
+
+// maxBlockFieldSize is the largest single field accepted when decoding a binary block.
+const maxBlockFieldSize = MaxBlockSize * 2
+
+// EncodeBinary encodes the block in the compact binary format. Every variable length field is written as
+// a uvarint length followed by its bytes, and fixed size fields are written big endian. Transactions are
+// written as their protocol followed by their JSON encoding, so any protocol can be carried.
+func (b *Block) EncodeBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(blockCodecMagic)
+
+	// Header
+	binary.Write(&buf, binary.BigEndian, b.Header.Version)
+	writeBlockField(&buf, []byte(b.Header.PreviousHash))
+	writeBlockField(&buf, b.Header.MerkleRoot)
+	timestamp, err := b.Header.Timestamp.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("error encoding block timestamp: %v", err)
+	}
+	writeBlockField(&buf, timestamp)
+	binary.Write(&buf, binary.BigEndian, b.Header.Difficulty)
+	binary.Write(&buf, binary.BigEndian, b.Header.Nonce)
+
+	// Block identity
+	if b.Index.Sign() < 0 {
+		return nil, errors.New("block index cannot be negative")
+	}
+	writeBlockField(&buf, b.Index.Bytes())
+	writeBlockField(&buf, []byte(b.Hash))
+
+	// Transactions
+	writeUvarint(&buf, uint64(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		persisted, err := NewPersistedTransaction(tx)
+		if err != nil {
+			return nil, err
+		}
+		writeBlockField(&buf, []byte(persisted.Protocol))
+		writeBlockField(&buf, persisted.Data)
+	}
+
+	// Trailing fields, absent from blocks encoded before they were added
+	writeBlockField(&buf, []byte(b.FeeRecipient))
+	writeBlockField(&buf, []byte(b.RewardRecipient))
+	binary.Write(&buf, binary.BigEndian, b.Reward)
+
+	return buf.Bytes(), nil
+}
+
+// DecodeBinaryBlock decodes a block that was encoded with EncodeBinary.
+func DecodeBinaryBlock(data []byte) (*Block, error) {
+	if !bytes.HasPrefix(data, blockCodecMagic) {
+		return nil, errors.New("data is not a binary encoded block")
+	}
+	r := bufio.NewReader(bytes.NewReader(data[len(blockCodecMagic):]))
+
+	block := &Block{}
+	err := binary.Read(r, binary.BigEndian, &block.Header.Version)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding block version: %v", err)
+	}
+
+	previousHash, err := readBlockField(r)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding previous hash: %v", err)
+	}
+	block.Header.PreviousHash = string(previousHash)
+
+	block.Header.MerkleRoot, err = readBlockField(r)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding merkle root: %v", err)
+	}
+
+	timestamp, err := readBlockField(r)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding block timestamp: %v", err)
+	}
+	err = block.Header.Timestamp.UnmarshalBinary(timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding block timestamp: %v", err)
+	}
+
+	err = binary.Read(r, binary.BigEndian, &block.Header.Difficulty)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding block difficulty: %v", err)
+	}
+	err = binary.Read(r, binary.BigEndian, &block.Header.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding block nonce: %v", err)
+	}
+
+	index, err := readBlockField(r)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding block index: %v", err)
+	}
+	block.Index = *new(big.Int).SetBytes(index)
+
+	hash, err := readBlockField(r)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding block hash: %v", err)
+	}
+	block.Hash = string(hash)
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding transaction count: %v", err)
+	}
+
+	block.Transactions = make([]Transaction, 0)
+	for i := uint64(0); i < count; i++ {
+		protocol, err := readBlockField(r)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding transaction %d protocol: %v", i, err)
+		}
+		txData, err := readBlockField(r)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding transaction %d: %v", i, err)
+		}
+
+		persisted := &PersistedTransaction{Protocol: string(protocol), Data: json.RawMessage(txData)}
+		tx, err := persisted.Transaction()
+		if err != nil {
+			return nil, err
+		}
+		block.Transactions = append(block.Transactions, tx)
+	}
+
+	feeRecipient, err := readBlockField(r)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error decoding fee recipient: %v", err)
+	}
+	block.FeeRecipient = string(feeRecipient)
+
+	rewardRecipient, err := readBlockField(r)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error decoding reward recipient: %v", err)
+	}
+	if err == nil {
+		block.RewardRecipient = string(rewardRecipient)
+		err = binary.Read(r, binary.BigEndian, &block.Reward)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding block reward: %v", err)
+		}
+	}
+
+	block.bloomFilter = block.CreateBloomFilter()
+	return block, nil
+}
+
+// EncodeBlock encodes a block in the given wire format.
+func EncodeBlock(b *Block, format string) ([]byte, error) {
+	switch strings.ToLower(format) {
+	case BlockWireFormatBinary:
+		return b.EncodeBinary()
+	case BlockWireFormatJSON, "":
+		return json.Marshal(b)
+	default:
+		return nil, fmt.Errorf("unknown block wire format: %s", format)
+	}
+}
+
+// DecodeBlock decodes a block received in either wire format. The format is detected from the data.
+func DecodeBlock(data []byte) (*Block, error) {
+	if bytes.HasPrefix(data, blockCodecMagic) {
+		return DecodeBinaryBlock(data)
+	}
+
+	// Transactions are decoded separately, into the concrete type for their protocol
+	type blockJSON Block
+	aux := struct {
+		*blockJSON
+		Transactions []json.RawMessage `json:"transactions"`
+	}{
+		blockJSON: &blockJSON{},
+	}
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding block: %v", err)
+	}
+
+	block := (*Block)(aux.blockJSON)
+	block.Transactions = make([]Transaction, 0, len(aux.Transactions))
+	for i, raw := range aux.Transactions {
+		var header struct {
+			Protocol string `json:"protocol"`
+		}
+		err := json.Unmarshal(raw, &header)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding transaction %d: %v", i, err)
+		}
+
+		persisted := &PersistedTransaction{Protocol: header.Protocol, Data: raw}
+		tx, err := persisted.Transaction()
+		if err != nil {
+			return nil, err
+		}
+		block.Transactions = append(block.Transactions, tx)
+	}
+
+	block.bloomFilter = block.CreateBloomFilter()
+	return block, nil
+}
+
+// writeUvarint writes v as a uvarint.
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], v)
+	buf.Write(scratch[:n])
+}
+
+// writeBlockField writes a length prefixed field.
+func writeBlockField(buf *bytes.Buffer, field []byte) {
+	writeUvarint(buf, uint64(len(field)))
+	buf.Write(field)
+}
+
+// readBlockField reads a length prefixed field.
+func readBlockField(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxBlockFieldSize {
+		return nil, fmt.Errorf("field size %d exceeds the maximum of %d bytes", size, maxBlockFieldSize)
+	}
+
+	field := make([]byte, size)
+	_, err = io.ReadFull(r, field)
+	if err != nil {
+		return nil, err
+	}
+	return field, nil
+}
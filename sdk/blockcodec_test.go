@@ -0,0 +1,134 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBlock creates a block holding a few transactions of different protocols.
+func newTestBlock(t *testing.T) *Block {
+	t.Helper()
+
+	msg := newTestMessage(t, "hello over the wire")
+	bank := &Bank{Tx: newTestMessage(t, "").Tx, Amount: 12.5}
+	bank.Protocol = BankProtocolID
+	msg.Nonce, bank.Nonce = 1, 2 // Both are from the same sender, so the nonces decide their order in the block
+
+	block := NewBlock([]Transaction{msg, bank}, "0000abcdef")
+	block.Index = *big.NewInt(42)
+	block.Header.Nonce = 7
+	block.FeeRecipient = "miner-address"
+	block.Reward, block.RewardRecipient = 12.5, "miner-address"
+	block.Hash = block.CalculateHash()
+	return block
+}
+
+func TestBlockBinaryRoundTrip(t *testing.T) {
+	block := newTestBlock(t)
+
+	data, err := block.EncodeBinary()
+	require.NoError(t, err)
+
+	decoded, err := DecodeBinaryBlock(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, block.Header.Version, decoded.Header.Version)
+	assert.Equal(t, block.Header.PreviousHash, decoded.Header.PreviousHash)
+	assert.Equal(t, block.Header.MerkleRoot, decoded.Header.MerkleRoot)
+	assert.True(t, block.Header.Timestamp.Equal(decoded.Header.Timestamp))
+	assert.Equal(t, block.Header.Difficulty, decoded.Header.Difficulty)
+	assert.Equal(t, block.Header.Nonce, decoded.Header.Nonce)
+	assert.Equal(t, block.Index.String(), decoded.Index.String())
+	assert.Equal(t, block.Hash, decoded.Hash)
+	assert.Equal(t, block.FeeRecipient, decoded.FeeRecipient)
+	assert.Equal(t, block.Reward, decoded.Reward)
+	assert.Equal(t, block.RewardRecipient, decoded.RewardRecipient)
+
+	require.Len(t, decoded.Transactions, 2)
+	msg, ok := decoded.Transactions[0].(*Message)
+	require.True(t, ok)
+	assert.Equal(t, "hello over the wire", msg.Message)
+	bank, ok := decoded.Transactions[1].(*Bank)
+	require.True(t, ok)
+	assert.Equal(t, 12.5, bank.Amount)
+	assert.Equal(t, block.Transactions[1].GetID(), bank.GetID())
+
+	// Truncated data must be rejected rather than produce a partial block
+	_, err = DecodeBinaryBlock(data[:len(data)-5])
+	assert.Error(t, err)
+}
+
+func TestBlockBinarySmallerThanJSON(t *testing.T) {
+	block := newTestBlock(t)
+
+	binaryData, err := EncodeBlock(block, BlockWireFormatBinary)
+	require.NoError(t, err)
+	jsonData, err := EncodeBlock(block, BlockWireFormatJSON)
+	require.NoError(t, err)
+
+	assert.Less(t, len(binaryData), len(jsonData))
+	t.Logf("binary: %d bytes, json: %d bytes", len(binaryData), len(jsonData))
+}
+
+func TestDecodeBlockDetectsWireFormat(t *testing.T) {
+	block := newTestBlock(t)
+	p2p := NewP2P()
+
+	for _, format := range []string{BlockWireFormatBinary, BlockWireFormatJSON} {
+		require.NoError(t, p2p.SetBlockWireFormat(format))
+
+		data, err := p2p.EncodeBlock(block)
+		require.NoError(t, err)
+		assert.Equal(t, format == BlockWireFormatJSON, json.Valid(data), format)
+		assert.Equal(t, format == BlockWireFormatBinary, bytes.HasPrefix(data, blockCodecMagic), format)
+
+		decoded, err := p2p.DecodeBlock(data)
+		require.NoError(t, err, format)
+		assert.Equal(t, block.Hash, decoded.Hash, format)
+		assert.Len(t, decoded.Transactions, 2, format)
+	}
+
+	assert.Error(t, p2p.SetBlockWireFormat("xml"))
+}
+
+func TestSendBlocksUsesWireFormat(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+	require.NoError(t, bc.AddTransaction(newTestMessage(t, "sent in binary")))
+	bc.createNewBlock(1)
+
+	server := NewP2P()
+	server.SetBlockchain(bc)
+	require.NoError(t, server.SetBlockWireFormat(BlockWireFormatBinary))
+
+	// Framed connections carry blocks in the configured format, legacy ones always get JSON
+	for _, framed := range []bool{true, false} {
+		serverConn, clientConn := net.Pipe()
+		serverPC, clientPC := newP2PConn(serverConn), newP2PConn(clientConn)
+		serverPC.framed, clientPC.framed = framed, framed
+		go server.sendBlocks("GET_BLOCKS 0 1", serverPC)
+
+		header, err := clientPC.Receive()
+		require.NoError(t, err)
+		assert.Equal(t, "BLOCKS 2", string(header))
+		for i := 0; i < 2; i++ {
+			data, err := clientPC.Receive()
+			require.NoError(t, err)
+			assert.Equal(t, framed, bytes.HasPrefix(data, blockCodecMagic), "framed: %v", framed)
+
+			block, err := DecodeBlock(data)
+			require.NoError(t, err)
+			assert.Equal(t, bc.Blocks[i].Hash, block.Hash)
+		}
+
+		serverConn.Close()
+		clientConn.Close()
+	}
+}
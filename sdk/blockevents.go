@@ -0,0 +1,130 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/blockevents.go - Notifying in-process waiters of new blocks and confirmed address changes
+package sdk
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// newBlockSignal returns a channel that is closed the next time a block is added to the chain. The caller must
+// hold bc.mux.
+func (bc *Blockchain) newBlockSignal() <-chan struct{} {
+	if bc.blockAdded == nil {
+		bc.blockAdded = make(chan struct{})
+	}
+	return bc.blockAdded
+}
+
+// notifyNewBlock wakes everything waiting on newBlockSignal. The caller must hold bc.mux.
+func (bc *Blockchain) notifyNewBlock() {
+	if bc.blockAdded != nil {
+		close(bc.blockAdded)
+		bc.blockAdded = nil
+	}
+}
+
+// WaitForBlock returns the block following the one with index after, waiting for it to be added to the chain if
+// it does not exist yet. It returns ctx.Err() if ctx is done first.
+func (bc *Blockchain) WaitForBlock(ctx context.Context, after int64) (*Block, error) {
+	if after < 0 {
+		return nil, errors.New("block index cannot be negative")
+	}
+
+	for {
+		bc.mux.Lock()
+		if after+1 < int64(len(bc.Blocks)) {
+			block := bc.Blocks[after+1]
+			bc.mux.Unlock()
+			return block, nil
+		}
+		signal := bc.newBlockSignal()
+		bc.mux.Unlock()
+
+		select {
+		case <-signal:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// SubscribeAddress returns a channel that receives a statement line each time a transaction affecting the address
+// is confirmed in a block, including fees credited to it as the fee recipient. Subscribers that fall behind miss
+// events rather than holding up the chain, and should call GetStatement to catch up. Call UnsubscribeAddress when
+// done with the channel.
+func (bc *Blockchain) SubscribeAddress(address string) <-chan StatementLine {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	if bc.addressSubscribers == nil {
+		bc.addressSubscribers = make(map[string][]chan StatementLine)
+	}
+
+	ch := make(chan StatementLine, addressSubscriptionBuffer)
+	bc.addressSubscribers[address] = append(bc.addressSubscribers[address], ch)
+	return ch
+}
+
+// UnsubscribeAddress stops and closes a channel returned by SubscribeAddress.
+func (bc *Blockchain) UnsubscribeAddress(sub <-chan StatementLine) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	for address, subscribers := range bc.addressSubscribers {
+		for i, ch := range subscribers {
+			if (<-chan StatementLine)(ch) != sub {
+				continue
+			}
+
+			close(ch)
+			subscribers = append(subscribers[:i], subscribers[i+1:]...)
+			if len(subscribers) == 0 {
+				delete(bc.addressSubscribers, address)
+			} else {
+				bc.addressSubscribers[address] = subscribers
+			}
+			return
+		}
+	}
+}
+
+// notifyAddresses sends the statement lines of the newly added blocks to the subscribers of each address. The
+// blocks must be the newest on the chain, so that the running balance of the last line is the current balance.
+// The caller must hold bc.mux.
+func (bc *Blockchain) notifyAddresses(blocks []*Block) {
+	for address, subscribers := range bc.addressSubscribers {
+		var lines []StatementLine
+		change := 0.0
+		for _, block := range blocks {
+			var blockLines []StatementLine
+			blockLines, change = blockStatement(block, address, change)
+			lines = append(lines, blockLines...)
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		// The lines were built from a zero balance, offset them by the balance before the blocks
+		var balance float64
+		if bc.balances != nil {
+			balance = bc.balances[address]
+		} else {
+			balance = bc.calculateBalance(address)
+		}
+		opening := balance - change
+
+		for _, line := range lines {
+			line.RunningBalance += opening
+			for _, ch := range subscribers {
+				select {
+				case ch <- line:
+				default:
+					log.Printf("[%s] Address subscriber for %s is full, dropped event for block %d\n", time.Now().Format(logDateTimeFormat), address, line.BlockIndex)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/chainload.go - Loading the blocks saved on disk and checking they form a chain
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrBrokenChain is returned by LoadExistingBlocks when Config.StrictChainLoad is set and the blocks on disk
+// do not form a single chain.
+var ErrBrokenChain = errors.New("blocks on disk do not form a chain")
+
+// ChainLoadReport describes the blocks found on disk by LoadExistingBlocks and any problems with them.
+type ChainLoadReport struct {
+	BlockFiles       int      `json:"block_files"`                 // Number of block files found
+	BlocksLoaded     int      `json:"blocks_loaded"`               // Number of blocks added to the chain
+	MissingIndexes   []int64  `json:"missing_indexes,omitempty"`   // Indexes below the highest block that have no block
+	DuplicateIndexes []int64  `json:"duplicate_indexes,omitempty"` // Indexes claimed by more than one block file
+	BrokenLinks      []int64  `json:"broken_links,omitempty"`      // Indexes of blocks whose previous hash is not the hash of the block before them
+	UnreadableFiles  []string `json:"unreadable_files,omitempty"`  // Block files that could not be decoded
+}
+
+// OK returns true if the blocks on disk form a single chain with no problems.
+func (r *ChainLoadReport) OK() bool {
+	return len(r.MissingIndexes) == 0 && len(r.DuplicateIndexes) == 0 && len(r.BrokenLinks) == 0 && len(r.UnreadableFiles) == 0
+}
+
+// String returns a summary of the problems found, for logging.
+func (r *ChainLoadReport) String() string {
+	if r.OK() {
+		return fmt.Sprintf("%d blocks loaded", r.BlocksLoaded)
+	}
+
+	var problems []string
+	if len(r.MissingIndexes) > 0 {
+		problems = append(problems, fmt.Sprintf("missing indexes %v", r.MissingIndexes))
+	}
+	if len(r.DuplicateIndexes) > 0 {
+		problems = append(problems, fmt.Sprintf("duplicate indexes %v", r.DuplicateIndexes))
+	}
+	if len(r.BrokenLinks) > 0 {
+		problems = append(problems, fmt.Sprintf("broken links at %v", r.BrokenLinks))
+	}
+	if len(r.UnreadableFiles) > 0 {
+		problems = append(problems, fmt.Sprintf("unreadable files %v", r.UnreadableFiles))
+	}
+	return fmt.Sprintf("%d of %d blocks loaded, %s", r.BlocksLoaded, r.BlockFiles, strings.Join(problems, ", "))
+}
+
+// LoadExistingBlocks loads the blocks saved on disk and makes them the chain. Every block file is read and
+// checked for missing indexes, indexes claimed by more than one file, and blocks that do not link to the block
+// before them. The blocks from the genesis block up to the first problem are loaded, unless Config.StrictChainLoad
+// is set, in which case nothing is loaded and ErrBrokenChain is returned.
+//
+// The dev and miner addresses are restored from the genesis transactions, which fund the dev wallet with a
+// coinbase and the miner wallet with a bank transfer. A genesis block that exists but can not be read is always
+// an error, so that it is never recreated over existing chain data.
+func (bc *Blockchain) LoadExistingBlocks() (*ChainLoadReport, error) {
+	start := time.Now()
+	report := &ChainLoadReport{}
+
+	files, err := localStorage.blockFiles()
+	if err != nil {
+		return report, fmt.Errorf("error listing block files: %w", err)
+	}
+	report.BlockFiles = len(files)
+	if len(files) == 0 {
+		return report, nil
+	}
+
+	log.Printf("[%s] Loading Blockchain [%d]...\n", time.Now().Format(logDateTimeFormat), len(files))
+
+	blocks, highest, err := scanBlockFiles(files, report)
+	if err != nil {
+		return report, err
+	}
+
+	// The chain runs from the genesis block up to the first missing block or broken link
+	var chain []*Block
+	for index := int64(0); index <= highest; index++ {
+		block, exists := blocks[index]
+		if !exists || (index > 0 && block.Header.PreviousHash != chain[index-1].Hash) {
+			break
+		}
+		chain = append(chain, block)
+	}
+
+	if !report.OK() {
+		if bc.cfg != nil && bc.cfg.StrictChainLoad {
+			return report, fmt.Errorf("%w: %s", ErrBrokenChain, report)
+		}
+		log.Printf("[%s] Warning: %s\n", time.Now().Format(logDateTimeFormat), report)
+	}
+
+	if len(chain) > 0 {
+		bc.restoreGenesisAddresses(chain[0])
+	}
+
+	bc.mux.Lock()
+	bc.Blocks = chain
+	bc.markProcessed(chain...)
+	if bc.balances != nil {
+		bc.rebuildBalances()
+	}
+	bc.mux.Unlock()
+
+	for _, block := range chain {
+		err = bc.TXLookup.Add(block)
+		if err != nil {
+			log.Printf("Error adding block to TXLookup: %v\n", err)
+		}
+	}
+	report.BlocksLoaded = len(chain)
+
+	log.Printf("[%s] Loaded %d blocks in %v\n", time.Now().Format(logDateTimeFormat), len(chain), time.Since(start))
+	return report, nil
+}
+
+// RepairChain restores the blocks on disk that are missing, unreadable or do not link to the block before them
+// by fetching them from peer with GET_BLOCKS requests, then reloads the chain and validates it again. A peer
+// running in this process is asked directly, other peers over the P2P network of this process's node. It
+// returns nil without contacting the peer if the blocks on disk already form a chain.
+func (bc *Blockchain) RepairChain(peer *Node) error {
+	if peer == nil {
+		return errors.New("no peer to repair the chain from")
+	}
+
+	files, err := localStorage.blockFiles()
+	if err != nil {
+		return fmt.Errorf("error listing block files: %w", err)
+	}
+
+	report := &ChainLoadReport{BlockFiles: len(files)}
+	_, _, err = scanBlockFiles(files, report)
+	if err != nil {
+		return err
+	}
+	if report.OK() {
+		return nil
+	}
+
+	damaged := damagedIndexes(report)
+	log.Printf("[%s] Repairing blocks %v from node %s\n", time.Now().Format(logDateTimeFormat), damaged, peer.ID)
+
+	// Request each run of consecutive damaged blocks at once
+	for start := 0; start < len(damaged); {
+		end := start
+		for end+1 < len(damaged) && damaged[end+1] == damaged[end]+1 && damaged[end+1]-damaged[start] < maxBlockStreamRange {
+			end++
+		}
+
+		blocks, err := requestBlocks(peer, damaged[start], damaged[end])
+		if err != nil {
+			return fmt.Errorf("error requesting blocks %d to %d from node %s: %w", damaged[start], damaged[end], peer.ID, err)
+		}
+		for i, block := range blocks {
+			if block.Index.Int64() != damaged[start]+int64(i) {
+				return fmt.Errorf("node %s sent block %s, expected block %d", peer.ID, block.Index.String(), damaged[start]+int64(i))
+			}
+			err = block.save()
+			if err != nil {
+				return fmt.Errorf("error saving block %s: %w", block.Index.String(), err)
+			}
+		}
+		start = end + 1
+	}
+
+	report, err = bc.LoadExistingBlocks()
+	if err != nil {
+		return err
+	}
+	if len(report.MissingIndexes) > 0 || len(report.BrokenLinks) > 0 {
+		return fmt.Errorf("%w: %s", ErrBrokenChain, report)
+	}
+	return bc.ValidateChain()
+}
+
+// damagedIndexes returns the sorted indexes of the missing blocks, the blocks with broken links and the blocks
+// whose files could not be read.
+func damagedIndexes(report *ChainLoadReport) []int64 {
+	indexes := append([]int64{}, report.MissingIndexes...)
+	indexes = append(indexes, report.BrokenLinks...)
+	for _, file := range report.UnreadableFiles {
+		var index int64
+		if _, err := fmt.Sscanf(file, "%d.json", &index); err == nil {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	// Drop duplicates, a block file can be unreadable and its index missing
+	unique := indexes[:0]
+	for i, index := range indexes {
+		if i == 0 || index != indexes[i-1] {
+			unique = append(unique, index)
+		}
+	}
+	return unique
+}
+
+// requestBlocks sends a GET_BLOCKS request for the blocks from index from to index to, inclusive, to peer.
+func requestBlocks(peer *Node, from, to int64) ([]*Block, error) {
+	if peer.Blockchain != nil {
+		return peer.Blockchain.GetBlocks(from, to)
+	}
+
+	local := GetNode()
+	if local == nil || local.P2P == nil {
+		return nil, errors.New("no P2P network to reach the peer")
+	}
+	if peer.Config == nil || peer.Config.P2PHostName == "" {
+		return nil, errors.New("peer has no P2P address")
+	}
+	return local.P2P.RequestBlocks(peer.Config.P2PHostName, from, to)
+}
+
+// scanBlockFiles reads the block files and records any missing indexes, duplicate indexes, broken links and
+// unreadable files in the report. It returns the blocks by index and the highest index found.
+func scanBlockFiles(files []string, report *ChainLoadReport) (map[int64]*Block, int64, error) {
+	blocks := make(map[int64]*Block, len(files))
+	highest := int64(-1)
+	for _, file := range files {
+		block, err := readBlockFile(file)
+		if err != nil {
+			if filepath.Base(file) == "0.json" {
+				return nil, -1, fmt.Errorf("genesis block exists but could not be read: %w", err)
+			}
+			report.UnreadableFiles = append(report.UnreadableFiles, filepath.Base(file))
+			continue
+		}
+
+		index := block.Index.Int64()
+		if _, exists := blocks[index]; exists {
+			report.DuplicateIndexes = append(report.DuplicateIndexes, index)
+
+			// Prefer the block saved under its own index
+			if filepath.Base(file) != fmt.Sprintf("%d.json", index) {
+				continue
+			}
+		}
+		blocks[index] = block
+		if index > highest {
+			highest = index
+		}
+	}
+	sort.Slice(report.DuplicateIndexes, func(i, j int) bool { return report.DuplicateIndexes[i] < report.DuplicateIndexes[j] })
+
+	for index := int64(0); index <= highest; index++ {
+		block, exists := blocks[index]
+		if !exists {
+			report.MissingIndexes = append(report.MissingIndexes, index)
+			continue
+		}
+
+		previous, exists := blocks[index-1]
+		if index > 0 && exists && block.Header.PreviousHash != previous.Hash {
+			report.BrokenLinks = append(report.BrokenLinks, index)
+		}
+	}
+
+	return blocks, highest, nil
+}
+
+// restoreGenesisAddresses sets the dev and miner addresses from the transactions in the genesis block. A
+// deterministic genesis block only holds allocations, the addresses are configured instead.
+func (bc *Blockchain) restoreGenesisAddresses(genesis *Block) {
+	if bc.cfg.DeterministicGenesis {
+		return
+	}
+
+	for _, tx := range genesis.Transactions {
+		switch tx := tx.(type) {
+		case *Coinbase:
+			if tx.To != nil && tx.To.Address != "" {
+				bc.cfg.DevAddress = tx.To.Address
+			}
+		case *Bank:
+			if tx.To != nil && tx.To.Address != "" {
+				bc.cfg.MinerAddress = tx.To.Address
+			}
+		}
+	}
+}
+
+// readBlockFile reads and decodes a block file.
+func readBlockFile(path string) (*Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeBlock(data)
+}
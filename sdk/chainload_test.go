@@ -0,0 +1,138 @@
+package sdk
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// saveTestChain mines a genesis block and three more, each saved to disk, and returns their hashes.
+func saveTestChain(t *testing.T) []string {
+	t.Helper()
+
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, bc.AddTransaction(newTestMessage(t, "saved")))
+		bc.createNewBlock(1)
+	}
+
+	hashes := make([]string, 0, len(bc.Blocks))
+	for _, block := range bc.Blocks {
+		hashes = append(hashes, block.Hash)
+	}
+	return hashes
+}
+
+func TestLoadExistingBlocks(t *testing.T) {
+	useTestStorage(t)
+	hashes := saveTestChain(t)
+
+	bc := newTestBlockchain(t)
+	report, err := bc.LoadExistingBlocks()
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, 4, report.BlockFiles)
+	assert.Equal(t, 4, report.BlocksLoaded)
+	require.Equal(t, 4, bc.GetBlockCount())
+	assert.Equal(t, hashes[3], bc.GetLatestBlock().Hash)
+}
+
+func TestLoadExistingBlocksReportsProblems(t *testing.T) {
+	tests := []struct {
+		name     string
+		damage   func(t *testing.T, blocksPath string)
+		loaded   int
+		expected ChainLoadReport
+	}{
+		{
+			name: "gap",
+			damage: func(t *testing.T, blocksPath string) {
+				require.NoError(t, os.Remove(filepath.Join(blocksPath, "2.json")))
+			},
+			loaded:   2,
+			expected: ChainLoadReport{BlockFiles: 3, MissingIndexes: []int64{2}},
+		},
+		{
+			name: "duplicate",
+			damage: func(t *testing.T, blocksPath string) {
+				data, err := os.ReadFile(filepath.Join(blocksPath, "1.json"))
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(filepath.Join(blocksPath, "copy.json"), data, 0644))
+			},
+			loaded:   4,
+			expected: ChainLoadReport{BlockFiles: 5, DuplicateIndexes: []int64{1}},
+		},
+		{
+			name: "broken link",
+			damage: func(t *testing.T, blocksPath string) {
+				block, err := localStorage.GetBlock(2)
+				require.NoError(t, err)
+				block.Header.PreviousHash = "not-the-previous-hash"
+				require.NoError(t, block.save())
+			},
+			loaded:   2,
+			expected: ChainLoadReport{BlockFiles: 4, BrokenLinks: []int64{2}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataPath := useTestStorage(t)
+			hashes := saveTestChain(t)
+			tt.damage(t, filepath.Join(dataPath, "blocks"))
+
+			bc := newTestBlockchain(t)
+			report, err := bc.LoadExistingBlocks()
+			require.NoError(t, err)
+			assert.False(t, report.OK())
+
+			tt.expected.BlocksLoaded = tt.loaded
+			assert.Equal(t, tt.expected, *report)
+
+			// The chain is loaded up to the first problem
+			require.Equal(t, tt.loaded, bc.GetBlockCount())
+			assert.Equal(t, hashes[tt.loaded-1], bc.GetLatestBlock().Hash)
+
+			// A strict load refuses the broken chain
+			strict := newTestBlockchain(t)
+			strict.cfg.StrictChainLoad = true
+			_, err = strict.LoadExistingBlocks()
+			assert.True(t, errors.Is(err, ErrBrokenChain))
+			assert.Equal(t, 0, strict.GetBlockCount())
+		})
+	}
+}
+
+func TestRepairChainFromPeer(t *testing.T) {
+	dataPath := useTestStorage(t)
+
+	// The peer mines the chain, saving each block to disk
+	peer := newGossipTestNode(t, "peer")
+	peer.Blockchain.GenerateGenesisBlock([]Transaction{})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, peer.Blockchain.AddTransaction(newTestMessage(t, "repair")))
+		peer.Blockchain.createNewBlock(1)
+	}
+	require.NoError(t, os.Remove(filepath.Join(dataPath, "blocks", "2.json")))
+
+	bc := newTestBlockchain(t)
+	require.NoError(t, bc.RepairChain(peer))
+	require.Equal(t, 4, bc.GetBlockCount())
+	assert.Equal(t, peer.Blockchain.GetLatestBlock().Hash, bc.GetLatestBlock().Hash)
+	assert.NoError(t, bc.ValidateChain())
+	assert.FileExists(t, filepath.Join(dataPath, "blocks", "2.json"))
+
+	// Nothing needs repairing once the chain is whole
+	assert.NoError(t, bc.RepairChain(peer))
+
+	// A peer that doesn't have the blocks can't repair the chain
+	require.NoError(t, os.Remove(filepath.Join(dataPath, "blocks", "2.json")))
+	empty := newGossipTestNode(t, "empty")
+	assert.Error(t, bc.RepairChain(empty))
+	assert.Error(t, bc.RepairChain(nil))
+}
@@ -64,6 +64,11 @@ func (c *Coinbase) Process() string {
 	return fmt.Sprintf("Transferred %f from %s to %s", c.TransactionFee, c.From.Address, c.To.Address)
 }
 
+// Size returns the size of the coinbase transaction in bytes, including its protocol specific fields.
+func (c *Coinbase) Size() int {
+	return serializedSize(c)
+}
+
 // // String returns a string representation of the bank transaction.
 // func (c *Coinbase) String() string {
 // 	return fmt.Sprintf("%s%s%s%v%d%f%f%s%f%s%f%d%f%t",
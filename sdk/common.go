@@ -8,7 +8,6 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -18,6 +17,7 @@ import (
 	"net/http"
 	"net/smtp"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -139,22 +139,12 @@ func ConvertToFloat64(value interface{}) (float64, error) {
 	}
 }
 
-// ValidateAddress validates the provided Ethereum address string. It decodes the address
-// and verifies that the length of the decoded bytes is 32. If the address is invalid,
-// it returns an error.
+// ValidateAddress validates the provided address string. It verifies the address prefix and checksum,
+// returning ErrAddressPrefix or ErrAddressChecksum if they do not match. Legacy hex addresses of 32 bytes
+// are also accepted, see MigrateAddress. If the address is invalid, it returns an error.
 func ValidateAddress(address string) error {
-	// Decode the test address
-	addr, err := hex.DecodeString(address)
-	if err != nil {
-		return fmt.Errorf("failed to decode address: %v", err)
-	}
-
-	// Verify the address length
-	if len(addr) != 32 {
-		return fmt.Errorf("expected address length: %d, got: %d", 32, len(addr))
-	}
-
-	return nil
+	_, err := DecodeAddress(address)
+	return err
 }
 
 // testPasswordStrength tests the password strength. It checks that the password is between 12 and 24 characters
@@ -271,6 +261,44 @@ func createFolder(path string) {
 	}
 }
 
+// ValidateDataPath checks that path can be used to store blockchain data. The folder is created if it does
+// not exist, and must be a directory this process can write to. The resolved location is logged so that a
+// data path pointing somewhere unexpected is easy to spot.
+func ValidateDataPath(path string) error {
+	if path == "" {
+		return errors.New("data path cannot be empty")
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("invalid data path %s: %w", path, err)
+	}
+
+	err = os.MkdirAll(absPath, 0755)
+	if err != nil {
+		return fmt.Errorf("data path %s can not be created: %w", absPath, err)
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return fmt.Errorf("data path %s can not be read: %w", absPath, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("data path %s is not a directory", absPath)
+	}
+
+	// Prove the folder is writable by creating and removing a file
+	probe, err := os.CreateTemp(absPath, ".write-test-*")
+	if err != nil {
+		return fmt.Errorf("data path %s is not writable: %w", absPath, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	log.Printf("Using data path: %s\n", absPath)
+	return nil
+}
+
 // SendGmail sends an email using the provided Gmail account configuration.
 //
 // The function takes the recipient email address, subject, and body of the email,
@@ -314,6 +342,16 @@ func SendGmail(to, subject, body string, cfg *Config) error {
 }
 
 // isValidEmail checks if the provided email string is in a valid format.
+// secureRandomUint64 returns a random 64-bit value read from crypto/rand.
+func secureRandomUint64() uint64 {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err) // In a production environment, handle this error more gracefully
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
 // It uses a basic regular expression to validate the email address.
 func isValidEmail(email string) bool {
 	// Basic regex to check email format
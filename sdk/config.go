@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -18,33 +19,64 @@ import (
 
 // Config is the configuration for the blockchain.
 type Config struct {
-	BlockchainName    string
-	BlockchainSymbol  string
-	BlockTime         int
-	Difficulty        int
-	TransactionFee    float64
-	MinerRewardPCT    float64
-	MinerAddress      string
-	DevRewardPCT      float64
-	DevAddress        string
-	APIHostName       string
-	P2PHostName       string
-	EnableAPI         bool
-	FundWalletAmount  float64
-	TokenCount        int64
-	TokenPrice        float64
-	AllowNewTokens    bool
-	DataPath          string
-	GMailEmail        string
-	GMailPassword     string
-	Domain            string
-	Version           string  // New field: Configuration version
-	MaxBlockSize      int     // New field: Maximum block size in bytes
-	MinTransactionFee float64 // New field: Minimum transaction fee
-	IsSeed            bool    // New field: Is this a seed node
-	SeedAddress       string  // New field: Address of the seed node to connect to
-	promptUpdate      bool
-	testing           bool
+	BlockchainName         string
+	BlockchainSymbol       string
+	BlockTime              int
+	Difficulty             int
+	TransactionFee         float64
+	MinerRewardPCT         float64
+	MinerAddress           string
+	DevRewardPCT           float64
+	DevAddress             string
+	APIHostName            string
+	P2PHostName            string
+	EnableAPI              bool
+	FundWalletAmount       float64
+	TokenCount             int64
+	TokenPrice             float64
+	AllowNewTokens         bool
+	DataPath               string
+	GMailEmail             string
+	GMailPassword          string
+	Domain                 string
+	Version                string             // New field: Configuration version
+	MaxBlockSize           int                // New field: Maximum block size in bytes
+	MinTransactionFee      float64            // New field: Minimum transaction fee
+	IsSeed                 bool               // New field: Is this a seed node
+	SeedAddresses          []string           // New field: Addresses of the seed nodes to connect to, tried in order
+	P2PTimeout             int                // New field: Timeout in seconds for P2P handshakes and requests
+	BlockWireFormat        string             // New field: Block encoding used for P2P transfer ("binary" or "json")
+	MaxMempoolSize         int                // New field: Maximum number of pending transactions in the mempool
+	DisableProgress        bool               // New field: Disable progress animations (always off when not on a terminal)
+	InitialBlockReward     float64            // New field: Reward for mining a block before the first halving
+	HalvingInterval        int64              // New field: Number of blocks between each halving of the block reward
+	LogFile                string             // New field: File to write logs to, empty logs to the console only
+	LogMaxSizeMB           int                // New field: Size in MB at which the log file is rotated
+	LogToStdout            bool               // New field: Echo logs to stdout when writing to a log file
+	RequiredConfirmations  int                // New field: Number of blocks, including its own, before a transaction is confirmed
+	AddressPrefix          string             // New field: Prefix of wallet addresses, identifying the chain they belong to
+	MaxPeers               int                // New field: Most peers this node registers, further peers are refused
+	FeePolicy              string             // New field: Where block fees go ("miner", "burn" or "treasury")
+	MaxClockSkew           int                // New field: Seconds a block timestamp may be ahead of this node's clock
+	FundNewWallets         bool               // New field: Send FundWalletAmount from the treasury wallet to each new wallet
+	StrictChainLoad        bool               // New field: Refuse to start when the blocks on disk do not form a chain
+	StrictRewards          bool               // New field: Refuse to start when a reward address is malformed or has no wallet
+	AllowSelfTransfers     bool               // New field: Allow bank transfers where the sender is also the recipient
+	SaveRetries            int                // New field: Attempts to save a new block and the chain state before the block is rolled back
+	MinDifficulty          int                // New field: Lowest difficulty blocks are mined or retargeted at
+	MaxDifficulty          int                // New field: Highest difficulty blocks are mined or retargeted at
+	APIReadOnly            bool               // New field: Only serve GET endpoints, other methods are refused with 405
+	MiningThreads          int                // New field: Number of goroutines searching for a block's nonce, 0 uses every CPU core
+	MaxPendingPerSender    int                // New field: Most transactions from one sender held in the mempool, 0 for no limit
+	DeterministicGenesis   bool               // New field: Create the same genesis block on every node, from GenesisTimestamp and GenesisAllocations
+	GenesisAllocations     map[string]float64 // New field: Balances credited to addresses by a deterministic genesis block
+	NodeToken              string             // New field: Shared token that authenticates peers on the consensus endpoints, empty to only accept signed requests
+	TrustedPeers           []string           // New field: Node wallet addresses of the peers whose signed consensus requests are accepted
+	APIResponseEnvelope    bool               // New field: Wrap JSON API responses in an envelope with the request ID, the data and the error
+	AcceptLegacySignatures bool               // New field: Accept transactions signed with the legacy signature scheme as well as the current one
+	MiningRewardAddress    string             // New field: Address blocks mined by this run pay their reward, and fees under the miner policy, to, such as a pool's, empty for MinerAddress
+	promptUpdate           bool
+	testing                bool
 }
 
 // NewConfig creates a new configuration object with default values.
@@ -95,6 +127,35 @@ func (c *Config) setDefaultValues() {
 	c.AllowNewTokens = allowNewTokens
 	c.MaxBlockSize = MaxBlockSize
 	c.MinTransactionFee = minTransactionFee
+	c.P2PTimeout = p2pTimeout
+	c.BlockWireFormat = blockWireFormat
+	c.MaxMempoolSize = maxMempoolSize
+	c.InitialBlockReward = InitialBlockReward
+	c.HalvingInterval = BlockRewardHalvingInterval
+	c.LogMaxSizeMB = logMaxSizeMB
+	c.LogToStdout = logToStdout
+	c.RequiredConfirmations = requiredConfirmations
+	c.AddressPrefix = addressPrefix
+	c.MaxPeers = maxPeers
+	c.FeePolicy = feePolicy
+	c.MaxClockSkew = maxClockSkewInSec
+	c.FundNewWallets = fundNewWallets
+	c.StrictChainLoad = strictChainLoad
+	c.StrictRewards = strictRewards
+	c.AllowSelfTransfers = allowSelfTransfers
+	c.SaveRetries = saveRetries
+	c.MinDifficulty = minDifficulty
+	c.MaxDifficulty = maxDifficulty
+	c.APIReadOnly = apiReadOnly
+	c.MiningThreads = miningThreads
+	c.MaxPendingPerSender = maxPendingPerSender
+	c.DeterministicGenesis = deterministicGenesis
+	c.GenesisAllocations = map[string]float64{}
+	c.NodeToken = nodeToken
+	c.TrustedPeers = []string{}
+	c.APIResponseEnvelope = apiResponseEnvelope
+	c.AcceptLegacySignatures = acceptLegacySignatures
+	c.MiningRewardAddress = miningRewardAddress
 }
 
 // loadFromEnv loads configuration values from environment variables.
@@ -138,6 +199,39 @@ func (c *Config) loadFromEnv() {
 		c.Domain = getEnv("DOMAIN", c.Domain)
 		c.MaxBlockSize = getEnvAsInt("MAX_BLOCK_SIZE", c.MaxBlockSize)
 		c.MinTransactionFee = getEnvAsFloat("MIN_TRANSACTION_FEE", c.MinTransactionFee)
+		c.P2PTimeout = getEnvAsInt("P2P_TIMEOUT", c.P2PTimeout)
+		c.BlockWireFormat = getEnv("BLOCK_WIRE_FORMAT", c.BlockWireFormat)
+		c.MaxMempoolSize = getEnvAsInt("MAX_MEMPOOL_SIZE", c.MaxMempoolSize)
+		c.DisableProgress = getEnvAsBool("DISABLE_PROGRESS", c.DisableProgress)
+		c.InitialBlockReward = getEnvAsFloat("INITIAL_BLOCK_REWARD", c.InitialBlockReward)
+		c.HalvingInterval = getEnvAsInt64("HALVING_INTERVAL", c.HalvingInterval)
+		c.LogFile = getEnv("LOG_FILE", c.LogFile)
+		c.LogMaxSizeMB = getEnvAsInt("LOG_MAX_SIZE_MB", c.LogMaxSizeMB)
+		c.LogToStdout = getEnvAsBool("LOG_TO_STDOUT", c.LogToStdout)
+		c.RequiredConfirmations = getEnvAsInt("REQUIRED_CONFIRMATIONS", c.RequiredConfirmations)
+		c.AddressPrefix = getEnv("ADDRESS_PREFIX", c.AddressPrefix)
+		c.MaxPeers = getEnvAsInt("MAX_PEERS", c.MaxPeers)
+		c.FeePolicy = getEnv("FEE_POLICY", c.FeePolicy)
+		c.MaxClockSkew = getEnvAsInt("MAX_CLOCK_SKEW", c.MaxClockSkew)
+		c.FundNewWallets = getEnvAsBool("FUND_NEW_WALLETS", c.FundNewWallets)
+		c.StrictChainLoad = getEnvAsBool("STRICT_CHAIN_LOAD", c.StrictChainLoad)
+		c.StrictRewards = getEnvAsBool("STRICT_REWARDS", c.StrictRewards)
+		c.AllowSelfTransfers = getEnvAsBool("ALLOW_SELF_TRANSFERS", c.AllowSelfTransfers)
+		c.SaveRetries = getEnvAsInt("SAVE_RETRIES", c.SaveRetries)
+		c.MinDifficulty = getEnvAsInt("MIN_DIFFICULTY", c.MinDifficulty)
+		c.MaxDifficulty = getEnvAsInt("MAX_DIFFICULTY", c.MaxDifficulty)
+		c.APIReadOnly = getEnvAsBool("API_READ_ONLY", c.APIReadOnly)
+		c.MiningThreads = getEnvAsInt("MINING_THREADS", c.MiningThreads)
+		c.MaxPendingPerSender = getEnvAsInt("MAX_PENDING_PER_SENDER", c.MaxPendingPerSender)
+		c.DeterministicGenesis = getEnvAsBool("DETERMINISTIC_GENESIS", c.DeterministicGenesis)
+		c.GenesisAllocations = getEnvAsAllocations("GENESIS_ALLOCATIONS", c.GenesisAllocations)
+		c.NodeToken = getEnv("NODE_TOKEN", c.NodeToken)
+		if trustedPeers := getEnv("TRUSTED_PEERS", ""); trustedPeers != "" {
+			c.TrustedPeers = ParseSeedAddresses(trustedPeers)
+		}
+		c.APIResponseEnvelope = getEnvAsBool("API_RESPONSE_ENVELOPE", c.APIResponseEnvelope)
+		c.AcceptLegacySignatures = getEnvAsBool("ACCEPT_LEGACY_SIGNATURES", c.AcceptLegacySignatures)
+		c.MiningRewardAddress = getEnv("MINING_REWARD_ADDRESS", c.MiningRewardAddress)
 	}
 }
 
@@ -165,12 +259,46 @@ func (c *Config) applyCommandLineFlags() {
 		case "seed":
 			c.IsSeed = Args.GetBool("seed")
 		case "seed-address":
-			c.SeedAddress = Args.GetString("seed-address")
+			c.SeedAddresses = ParseSeedAddresses(Args.GetString("seed-address"))
 			// Add more cases for other flags as needed
 		}
 	}
 }
 
+// ParseSeedAddresses splits a comma separated list of seed node addresses, dropping empty entries.
+func ParseSeedAddresses(list string) []string {
+	addresses := []string{}
+	for _, address := range strings.Split(list, ",") {
+		address = strings.TrimSpace(address)
+		if address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// ParseGenesisAllocations parses a comma separated list of address=amount genesis allocations.
+func ParseGenesisAllocations(list string) (map[string]float64, error) {
+	allocations := map[string]float64{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		address, amount, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("genesis allocation %q is not address=amount", entry)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(amount), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid genesis allocation amount %q: %w", amount, err)
+		}
+		allocations[strings.TrimSpace(address)] += value
+	}
+	return allocations, nil
+}
+
 // promptForValues prompts the user for configuration values.
 func (c *Config) promptForValues() {
 	c.BlockchainName = c.promptString("BLOCKCHAIN_NAME", c.BlockchainName)
@@ -231,6 +359,82 @@ func (c *Config) Validate() error {
 	if c.MinTransactionFee < 0 {
 		return errors.New("minimum transaction fee cannot be negative")
 	}
+	if c.P2PTimeout <= 0 {
+		return errors.New("P2P timeout must be positive")
+	}
+	if c.BlockWireFormat != BlockWireFormatBinary && c.BlockWireFormat != BlockWireFormatJSON {
+		return errors.New("block wire format must be binary or json")
+	}
+	if c.MaxMempoolSize <= 0 {
+		return errors.New("max mempool size must be positive")
+	}
+	if c.InitialBlockReward < 0 {
+		return errors.New("initial block reward cannot be negative")
+	}
+	if c.HalvingInterval <= 0 {
+		return errors.New("halving interval must be positive")
+	}
+	if c.LogFile != "" && c.LogMaxSizeMB <= 0 {
+		return errors.New("log max size must be positive")
+	}
+	if c.RequiredConfirmations <= 0 {
+		return errors.New("required confirmations must be positive")
+	}
+	if !validAddressPrefix(c.AddressPrefix) {
+		return errors.New("address prefix must only contain letters and digits")
+	}
+	if c.MaxPeers <= 0 {
+		return errors.New("max peers must be positive")
+	}
+	if c.SaveRetries <= 0 {
+		return errors.New("save retries must be positive")
+	}
+	if c.MinDifficulty < 0 {
+		return errors.New("min difficulty cannot be negative")
+	}
+	if c.MaxDifficulty < c.MinDifficulty || c.MaxDifficulty > difficultyLimit {
+		return fmt.Errorf("max difficulty must be between min difficulty and %d", difficultyLimit)
+	}
+	if c.MiningThreads < 0 {
+		return errors.New("mining threads cannot be negative")
+	}
+	if c.MaxPendingPerSender < 0 {
+		return errors.New("max pending transactions per sender cannot be negative")
+	}
+	if c.NodeToken != "" && len(c.NodeToken) < minNodeTokenLength {
+		return fmt.Errorf("node token must be at least %d characters", minNodeTokenLength)
+	}
+	for _, address := range c.TrustedPeers {
+		if err := ValidateAddress(address); err != nil {
+			return fmt.Errorf("invalid trusted peer address %q: %w", address, err)
+		}
+	}
+	if c.MiningRewardAddress != "" {
+		if err := ValidateAddress(c.MiningRewardAddress); err != nil {
+			return fmt.Errorf("invalid mining reward address %q: %w", c.MiningRewardAddress, err)
+		}
+	}
+	for address, amount := range c.GenesisAllocations {
+		if err := ValidateAddress(address); err != nil {
+			return fmt.Errorf("invalid genesis allocation address %q: %w", address, err)
+		}
+		if amount <= 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+			return fmt.Errorf("genesis allocation to %s must be a positive amount", address)
+		}
+	}
+	switch c.FeePolicy {
+	case FeePolicyMiner, FeePolicyBurn, FeePolicyTreasury:
+	default:
+		return errors.New("fee policy must be miner, burn or treasury")
+	}
+	// The override receives the block reward, and the fees under the miner policy. With neither it receives nothing.
+	if c.MiningRewardAddress != "" && c.FeePolicy != FeePolicyMiner && c.InitialBlockReward == 0 {
+		return fmt.Errorf("mining reward address has no effect: blocks pay no reward and the %s fee policy does not pay fees to the miner",
+			c.FeePolicy)
+	}
+	if c.MaxClockSkew < 0 {
+		return errors.New("max clock skew cannot be negative")
+	}
 	return nil
 }
 
@@ -257,7 +461,36 @@ func (c *Config) Show() {
 	log.Printf("- Max Block Size: %d bytes\n", c.MaxBlockSize)
 	log.Printf("- Min Transaction Fee: %.2f\n", c.MinTransactionFee)
 	log.Printf("- Is Seed Node: %v\n", c.IsSeed)
-	log.Printf("- Seed Address: %s\n", c.SeedAddress)
+	log.Printf("- Seed Addresses: %s\n", strings.Join(c.SeedAddresses, ", "))
+	log.Printf("- P2P Timeout: %d seconds\n", c.P2PTimeout)
+	log.Printf("- Block Wire Format: %s\n", c.BlockWireFormat)
+	log.Printf("- Max Mempool Size: %d transactions\n", c.MaxMempoolSize)
+	log.Printf("- Disable Progress: %v\n", c.DisableProgress)
+	log.Printf("- Initial Block Reward: %.2f\n", c.InitialBlockReward)
+	log.Printf("- Halving Interval: %d blocks\n", c.HalvingInterval)
+	log.Printf("- Log File: %s\n", c.LogFile)
+	log.Printf("- Log Max Size: %d MB\n", c.LogMaxSizeMB)
+	log.Printf("- Log To Stdout: %v\n", c.LogToStdout)
+	log.Printf("- Required Confirmations: %d blocks\n", c.RequiredConfirmations)
+	log.Printf("- Address Prefix: %s\n", c.AddressPrefix)
+	log.Printf("- Max Peers: %d\n", c.MaxPeers)
+	log.Printf("- Fee Policy: %s\n", c.FeePolicy)
+	log.Printf("- Max Clock Skew: %d seconds\n", c.MaxClockSkew)
+	log.Printf("- Fund New Wallets: %v\n", c.FundNewWallets)
+	log.Printf("- Strict Chain Load: %v\n", c.StrictChainLoad)
+	log.Printf("- Strict Rewards: %v\n", c.StrictRewards)
+	log.Printf("- Allow Self Transfers: %v\n", c.AllowSelfTransfers)
+	log.Printf("- Save Retries: %d\n", c.SaveRetries)
+	log.Printf("- Difficulty Range: %d to %d\n", c.MinDifficulty, c.MaxDifficulty)
+	log.Printf("- API Read Only: %v\n", c.APIReadOnly)
+	log.Printf("- Mining Threads: %d (0 = all cores)\n", c.MiningThreads)
+	log.Printf("- Max Pending Per Sender: %d transactions (0 = no limit)\n", c.MaxPendingPerSender)
+	log.Printf("- Deterministic Genesis: %v (%d allocations)\n", c.DeterministicGenesis, len(c.GenesisAllocations))
+	log.Printf("- Node Token Set: %v\n", c.NodeToken != "")
+	log.Printf("- Trusted Peers: %s\n", strings.Join(c.TrustedPeers, ", "))
+	log.Printf("- API Response Envelope: %v\n", c.APIResponseEnvelope)
+	log.Printf("- Accept Legacy Signatures: %v\n", c.AcceptLegacySignatures)
+	log.Printf("- Mining Reward Address: %s\n", c.MiningRewardAddress)
 }
 
 // Path returns the path to the executable file.
@@ -455,6 +688,19 @@ func getEnvAsBool(key string, fallback bool) bool {
 	return fallback
 }
 
+func getEnvAsAllocations(key string, fallback map[string]float64) map[string]float64 {
+	strValue := getEnv(key, "")
+	if strValue == "" {
+		return fallback
+	}
+	value, err := ParseGenesisAllocations(strValue)
+	if err != nil {
+		log.Printf("Ignoring %s: %v", key, err)
+		return fallback
+	}
+	return value
+}
+
 // fileExists checks if a file exists and is not a directory
 func fileExists(filename string) bool {
 	info, err := os.Stat(filename)
@@ -0,0 +1,124 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/configschema.go - Schema of the node configuration, for UIs that edit it
+package sdk
+
+import (
+	"reflect"
+)
+
+// ConfigField describes a configuration field: its name, JSON type, default value and the rules Validate checks.
+// The default of a secret field is never included.
+type ConfigField struct {
+	Name        string            `json:"name"`
+	Type        string            `json:"type"` // JSON type: string, integer, number, boolean, array or object
+	Default     interface{}       `json:"default"`
+	Secret      bool              `json:"secret,omitempty"`
+	Constraints *ConfigConstraint `json:"constraints,omitempty"`
+}
+
+// ConfigConstraint is a rule Config.Validate checks for a field. Rules that depend on other fields are described
+// in Note.
+type ConfigConstraint struct {
+	Minimum          *float64 `json:"minimum,omitempty"`
+	ExclusiveMinimum *float64 `json:"exclusive_minimum,omitempty"`
+	Maximum          *float64 `json:"maximum,omitempty"`
+	Enum             []string `json:"enum,omitempty"`
+	MinLength        int      `json:"min_length,omitempty"`
+	Pattern          string   `json:"pattern,omitempty"`
+	Note             string   `json:"note,omitempty"`
+}
+
+// secretConfigFields are the configuration fields whose values are never shown.
+var secretConfigFields = map[string]bool{
+	"GMailPassword": true,
+	"NodeToken":     true,
+}
+
+// configConstraints are the rules Config.Validate checks, by field. Keep them in step with Validate.
+var configConstraints = map[string]*ConfigConstraint{
+	"BlockTime":             {ExclusiveMinimum: bound(0)},
+	"Difficulty":            {Minimum: bound(0)},
+	"TransactionFee":        {Minimum: bound(0)},
+	"MinerRewardPCT":        {Minimum: bound(0), Maximum: bound(100)},
+	"DevRewardPCT":          {Minimum: bound(0), Maximum: bound(100)},
+	"FundWalletAmount":      {Minimum: bound(0)},
+	"TokenCount":            {Minimum: bound(0)},
+	"TokenPrice":            {Minimum: bound(0)},
+	"MaxBlockSize":          {ExclusiveMinimum: bound(0)},
+	"MinTransactionFee":     {Minimum: bound(0)},
+	"P2PTimeout":            {ExclusiveMinimum: bound(0)},
+	"BlockWireFormat":       {Enum: []string{BlockWireFormatBinary, BlockWireFormatJSON}},
+	"MaxMempoolSize":        {ExclusiveMinimum: bound(0)},
+	"InitialBlockReward":    {Minimum: bound(0)},
+	"HalvingInterval":       {ExclusiveMinimum: bound(0)},
+	"LogMaxSizeMB":          {ExclusiveMinimum: bound(0), Note: "Only checked when LogFile is set"},
+	"RequiredConfirmations": {ExclusiveMinimum: bound(0)},
+	"AddressPrefix":         {Pattern: "^[A-Za-z0-9]*$"},
+	"MaxPeers":              {ExclusiveMinimum: bound(0)},
+	"FeePolicy":             {Enum: []string{FeePolicyMiner, FeePolicyBurn, FeePolicyTreasury}},
+	"MaxClockSkew":          {Minimum: bound(0)},
+	"SaveRetries":           {ExclusiveMinimum: bound(0)},
+	"MinDifficulty":         {Minimum: bound(0)},
+	"MaxDifficulty":         {Maximum: bound(difficultyLimit), Note: "Must be at least MinDifficulty"},
+	"MiningThreads":         {Minimum: bound(0)},
+	"MaxPendingPerSender":   {Minimum: bound(0)},
+	"GenesisAllocations":    {Note: "Keys must be valid addresses and values positive amounts"},
+	"NodeToken":             {MinLength: minNodeTokenLength, Note: "May be empty to only accept signed requests"},
+	"TrustedPeers":          {Note: "Entries must be valid addresses. Signed consensus requests are refused while it is empty"},
+	"MiningRewardAddress":   {Note: "Must be a valid address, or empty to pay MinerAddress. Refused when blocks pay no reward and FeePolicy is not miner"},
+}
+
+// bound returns a pointer to the limit, for the optional bounds of a ConfigConstraint.
+func bound(limit float64) *float64 {
+	return &limit
+}
+
+// ConfigSchema describes every exported configuration field, in declaration order, with the default set by
+// NewConfig's setDefaultValues and the rules checked by Validate.
+func ConfigSchema() []ConfigField {
+	defaults := &Config{}
+	defaults.setDefaultValues()
+
+	value := reflect.ValueOf(defaults).Elem()
+	t := value.Type()
+
+	fields := make([]ConfigField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+
+		schema := ConfigField{
+			Name:        field.Name,
+			Type:        jsonTypeOf(field.Type),
+			Default:     value.Field(i).Interface(),
+			Secret:      secretConfigFields[field.Name],
+			Constraints: configConstraints[field.Name],
+		}
+		if schema.Secret {
+			schema.Default = nil
+		}
+		fields = append(fields, schema)
+	}
+	return fields
+}
+
+// jsonTypeOf returns the JSON type a Go type is encoded as.
+func jsonTypeOf(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
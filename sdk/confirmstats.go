@@ -0,0 +1,99 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/confirmstats.go - Confirmation, mempool wait and block fullness statistics over recent blocks
+package sdk
+
+import (
+	"time"
+)
+
+// blockStat is what createNewBlock records about each block it mines, for GetConfirmationStats.
+type blockStat struct {
+	index       int64
+	minedAt     time.Time
+	txCount     int
+	mempoolWait time.Duration // Total time the block's transactions waited in the mempool
+	fullness    float64       // Share of the maximum block size the block's transactions use
+}
+
+// ConfirmationStats summarises how the blocks most recently mined by this node were confirmed. Blocks received
+// from peers are not counted. Times are in seconds, and block fullness is the share of Config.MaxBlockSize used,
+// from 0 to 1.
+type ConfirmationStats struct {
+	Blocks                int     `json:"blocks"`                    // Blocks in the window
+	Transactions          int     `json:"transactions"`              // Transactions in those blocks
+	RequiredConfirmations int64   `json:"required_confirmations"`    // Confirmations a block needs to be final
+	FinalBlocks           int     `json:"final_blocks"`              // Blocks in the window that are final
+	AvgTimeToFinal        float64 `json:"avg_time_to_final_seconds"` // From mining a block to mining the block that makes it final
+	AvgMempoolWait        float64 `json:"avg_mempool_wait_seconds"`  // From creating a transaction to mining it
+	AvgBlockFullness      float64 `json:"avg_block_fullness"`
+}
+
+// recordBlockStat records the statistics of a block mined by createNewBlock, keeping the most recent
+// confirmationStatsWindow blocks. The caller must hold bc.mux.
+func (bc *Blockchain) recordBlockStat(block *Block, minedAt time.Time) {
+	stat := blockStat{
+		index:   block.Index.Int64(),
+		minedAt: minedAt,
+		txCount: len(block.Transactions),
+	}
+
+	size := 0
+	for _, tx := range block.Transactions {
+		size += tx.Size()
+		if created := tx.GetCreatedAt(); !created.IsZero() && minedAt.After(created) {
+			stat.mempoolWait += minedAt.Sub(created)
+		}
+	}
+	stat.fullness = float64(size) / float64(bc.maxBlockSize())
+	if stat.fullness > 1 {
+		stat.fullness = 1 // The first transaction is always taken, even when it is larger than a block
+	}
+
+	bc.blockStats = append(bc.blockStats, stat)
+	if len(bc.blockStats) > confirmationStatsWindow {
+		bc.blockStats = append([]blockStat{}, bc.blockStats[len(bc.blockStats)-confirmationStatsWindow:]...)
+	}
+}
+
+// GetConfirmationStats returns the confirmation statistics of the blocks most recently mined by this node. A
+// block is final once it has Config.RequiredConfirmations, counting itself, so its time to final is known once the
+// block that gives it its last confirmation has also been mined here.
+func (bc *Blockchain) GetConfirmationStats() ConfirmationStats {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	stats := ConfirmationStats{
+		Blocks:                len(bc.blockStats),
+		RequiredConfirmations: bc.requiredConfirmations(),
+	}
+	if len(bc.blockStats) == 0 {
+		return stats
+	}
+
+	minedAt := make(map[int64]time.Time, len(bc.blockStats))
+	for _, stat := range bc.blockStats {
+		minedAt[stat.index] = stat.minedAt
+	}
+
+	var mempoolWait, timeToFinal time.Duration
+	fullness := 0.0
+	for _, stat := range bc.blockStats {
+		stats.Transactions += stat.txCount
+		mempoolWait += stat.mempoolWait
+		fullness += stat.fullness
+
+		if final, ok := minedAt[stat.index+stats.RequiredConfirmations-1]; ok {
+			stats.FinalBlocks++
+			timeToFinal += final.Sub(stat.minedAt)
+		}
+	}
+
+	if stats.Transactions > 0 {
+		stats.AvgMempoolWait = mempoolWait.Seconds() / float64(stats.Transactions)
+	}
+	if stats.FinalBlocks > 0 {
+		stats.AvgTimeToFinal = timeToFinal.Seconds() / float64(stats.FinalBlocks)
+	}
+	stats.AvgBlockFullness = fullness / float64(stats.Blocks)
+	return stats
+}
@@ -14,24 +14,91 @@ const (
 	BlockchainMinerAssetID  = 2
 
 	// Blockchain Parameters
-	blockTimeInSec        = 5
-	proofOfWorkDifficulty = 4
-	transactionFee        = 0.05    // 5 hundredths of a coin (a nickel-ish)
-	minTransactionFee     = 0.01    // Minimum transaction fee
-	minerRewardPCT        = 50.0    // Miner reward is 50% of the transaction fee
-	devRewardPCT          = 50.0    // Developer reward is 50% of the transaction fee
-	MaxBlockSize          = 1000000 // Maximum block size in bytes (1MB)
-	indexCacheSize        = 65536   // Size of the block/transaction index cache (1,572,864 bytes or 1.5 MB)
+	blockTimeInSec         = 5
+	proofOfWorkDifficulty  = 4
+	transactionFee         = 0.05           // 5 hundredths of a coin (a nickel-ish)
+	minTransactionFee      = 0.01           // Minimum transaction fee
+	minerRewardPCT         = 50.0           // Miner reward is 50% of the transaction fee
+	devRewardPCT           = 50.0           // Developer reward is 50% of the transaction fee
+	MaxBlockSize           = 1000000        // Maximum block size in bytes (1MB)
+	indexCacheSize         = 65536          // Size of the block/transaction index cache (1,572,864 bytes or 1.5 MB)
+	maxMempoolSize         = 10000          // Maximum number of pending transactions held in the mempool
+	requiredConfirmations  = 1              // Number of blocks, including its own, before a transaction is confirmed
+	addressPrefix          = "GBB"          // Prefix of wallet addresses, identifying the chain they belong to
+	feePolicy              = FeePolicyMiner // Where block fees go, see the FeePolicy constants
+	maxClockSkewInSec      = 5              // How far in seconds a block timestamp may be ahead of this node's clock
+	strictChainLoad        = false          // Refuse to start when the blocks on disk do not form a chain
+	strictRewards          = false          // Refuse to start when a reward address is malformed or has no wallet
+	allowSelfTransfers     = false          // Allow bank transfers where the sender is also the recipient
+	saveRetries            = 3              // Attempts to save a new block and the chain state before the block is rolled back
+	saveRetryDelayInMs     = 100            // Delay in milliseconds before the first save retry, doubled after each failure
+	minDifficulty          = 1              // Lowest difficulty blocks are mined or retargeted at
+	maxDifficulty          = 8              // Highest difficulty blocks are mined or retargeted at, more can't be found in the 32 bit nonce range
+	difficultyLimit        = 64             // Number of hex digits in a block hash, the most leading zeros a hash can have
+	apiReadOnly            = false          // Only serve GET endpoints, refusing every request that changes state
+	miningThreads          = 0              // Number of goroutines searching for a block's nonce, 0 uses every CPU core
+	maxPendingPerSender    = 1000           // Most transactions from one sender held in the mempool, so one sender can't fill it
+	deterministicGenesis   = false          // Create the same genesis block on every node instead of one with new wallets
+	nodeToken              = ""             // Shared token peers may present on the consensus endpoints, empty to only accept signed requests
+	nodeAuthMaxSkewInSec   = 300            // How far in seconds a signed consensus request's timestamp may be from this node's clock
+	minNodeTokenLength     = 16             // Shortest node token accepted, so it can't easily be guessed
+	apiResponseEnvelope    = false          // Wrap JSON API responses in an envelope with the request ID
+	acceptLegacySignatures = true           // Accept the legacy transaction signature scheme while a network moves to the current one
+	miningRewardAddress    = ""             // Address the miner's share of a block is paid to instead of the miner address, empty for the miner address
+
+	rebuildBalancesLogInterval = 1000 // Number of blocks between progress messages when rebuilding balances
+	balanceEpsilon             = 1e-9 // Balances closer than this to zero are treated as zero
+	addressSubscriptionBuffer  = 16   // Statement lines held for a slow address subscriber before events are dropped
+	confirmationEstimateWindow = 10   // Number of recent blocks averaged to estimate the block interval
+	confirmationStatsWindow    = 100  // Number of recently mined blocks GetConfirmationStats reports on
 
 	// Token Related
 	tokenCount       = 33554432
 	tokenPrice       = 0.01 // Price of a token in USD
 	allowNewTokens   = false
 	fundWalletAmount = 100.0 // Default amount to fund new wallets
+	fundNewWallets   = false // Fund new wallets from the treasury wallet
+
+	// Logging
+	logMaxSizeMB = 10   // Size in MB at which the log file is rotated
+	logToStdout  = true // Echo logs to stdout when writing to a log file
 
 	// Network Settings
 	apiHostname = ":8100"
 	p2pHostname = ":8101"
+	p2pTimeout  = 10 // Timeout in seconds for P2P handshakes and requests
+
+	// Number of addresses returned by the rich list endpoint when no limit is given
+	richListLimit = 10
+
+	// Most addresses in a single request to the bulk balance endpoint
+	maxBalanceQueryAddresses = 100
+
+	// Most blocks returned by a single request to the block stream endpoint
+	maxBlockStreamRange = 1000
+
+	// Default and longest time in seconds a request to the block wait endpoint waits for a new block
+	blockWaitTimeoutInSec    = 30
+	maxBlockWaitTimeoutInSec = 120
+
+	// Largest P2P message accepted from a peer
+	maxP2PMessageSize = 4 * 1024 * 1024
+
+	// Most peers a node registers, not counting itself
+	maxPeers = 50
+
+	// Block encoding used for P2P transfer, blocks are always stored on disk as JSON
+	blockWireFormat = BlockWireFormatBinary
+
+	// Peer Banning
+	maxPeerStrikes   = 3    // Number of invalid messages a peer may send before it is banned
+	peerBanTimeInSec = 3600 // How long a misbehaving peer is banned for
+
+	// Transaction Gossip
+	gossipSeenTTLInSec = 600 // How long a gossiped transaction ID is remembered to prevent rebroadcasts
+
+	// Transaction Submission
+	idempotencyKeyTTLInSec = 86400 // How long the response to a submission is replayed for retries with the same Idempotency-Key
 
 	// Default Addresses
 	minerAddress = "MINER" // Will be supplied by the environment
@@ -69,13 +136,16 @@ const (
 	MessageProtocolID  = "MESSAGE"
 	CoinbaseProtocolID = "COINBASE"
 	ChainProtocolID    = "CHAIN"
+	TokenProtocolID    = "TOKEN"
 )
 
-// AvailableProtocols is a list of all available protocols
+// AvailableProtocols is a list of the built in protocols. Protocols lists these along with any custom protocols
+// added by RegisterProtocol.
 var AvailableProtocols = []string{
 	CoinbaseProtocolID,
 	BankProtocolID,
 	MessageProtocolID,
 	PersistProtocolID,
 	ChainProtocolID,
+	TokenProtocolID,
 }
@@ -0,0 +1,143 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/cursor.go - Cursor pagination for the browse endpoints, stable while the chain grows
+package sdk
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor can't be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// CursorPage is a page of a browse endpoint requested with ?cursor=. Passing NextCursor as the cursor of the next
+// request continues after the last item of this page, so no item is returned twice or skipped while blocks are
+// added. A page with fewer items than the limit has reached the end of the chain, and the same cursor returns the
+// items added since.
+type CursorPage struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"next_cursor"`
+}
+
+// pageCursor is the position of the last item a page returned: a block, or a transaction in a block.
+type pageCursor struct {
+	Block int64
+	TxID  string
+}
+
+// startCursor is the position before the genesis block, where an empty cursor starts.
+var startCursor = pageCursor{Block: -1}
+
+// encode returns the cursor in the opaque form returned to clients.
+func (c pageCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.Block, 10) + ":" + c.TxID))
+}
+
+// decodeCursor decodes a cursor returned by encode. An empty cursor is the start of the chain.
+func decodeCursor(cursor string) (pageCursor, error) {
+	if cursor == "" {
+		return startCursor, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	block, txID, ok := strings.Cut(string(data), ":")
+	if !ok {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	index, err := strconv.ParseInt(block, 10, 64)
+	if err != nil || index < -1 {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	return pageCursor{Block: index, TxID: txID}, nil
+}
+
+// blocksAfter returns up to limit blocks following the cursor, and the cursor of the last block returned.
+func (bc *Blockchain) blocksAfter(cursor pageCursor, limit int) ([]*Block, pageCursor) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	start := int(cursor.Block + 1)
+	if start > len(bc.Blocks) {
+		start = len(bc.Blocks)
+	}
+	end := start + limit
+	if end > len(bc.Blocks) {
+		end = len(bc.Blocks)
+	}
+
+	blocks := append([]*Block{}, bc.Blocks[start:end]...)
+	if len(blocks) > 0 {
+		cursor = pageCursor{Block: int64(end - 1)}
+	}
+	return blocks, cursor
+}
+
+// transactionsAfter returns up to limit transactions following the cursor that keep accepts, in chain order, and
+// the cursor of the last transaction returned. If the cursor's block no longer holds its transaction, after the
+// chain was replaced, the whole block is returned.
+func (bc *Blockchain) transactionsAfter(cursor pageCursor, limit int, keep func(*Block, Transaction) bool) ([]Transaction, pageCursor) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	first := cursor.Block
+	if first < 0 {
+		first = 0
+	}
+
+	txs := []Transaction{}
+	for i := first; i < int64(len(bc.Blocks)) && len(txs) < limit; i++ {
+		block := bc.Blocks[i]
+
+		// Continue after the last transaction returned from the cursor's block
+		position := 0
+		if i == cursor.Block {
+			for j, tx := range block.Transactions {
+				if tx.GetID() == cursor.TxID {
+					position = j + 1
+					break
+				}
+			}
+		}
+
+		for _, tx := range block.Transactions[position:] {
+			if len(txs) == limit {
+				break
+			}
+			if keep != nil && !keep(block, tx) {
+				continue
+			}
+			txs = append(txs, tx)
+			cursor = pageCursor{Block: i, TxID: tx.GetID()}
+		}
+	}
+	return txs, cursor
+}
+
+// writeCursorPage writes the items and the cursor to continue from as a CursorPage.
+func writeCursorPage(w http.ResponseWriter, items interface{}, next pageCursor) {
+	page := CursorPage{Items: items}
+	if next != startCursor {
+		page.NextCursor = next.encode()
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", "application/json")
+
+	// Marshal the page to JSON
+	data, err := json.Marshal(page)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the JSON response
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,149 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/envelope.go - Request IDs, and the envelope JSON responses are wrapped in when Config.APIResponseEnvelope is set
+package sdk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RequestIDHeader carries the ID of a request, which is logged with it and returned with its response. Clients may
+// send their own, otherwise one is generated.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest request ID accepted from a client, longer ones are replaced.
+const maxRequestIDLength = 128
+
+// requestIDKey is the context key of the request ID.
+type requestIDKey struct{}
+
+// ResponseEnvelope wraps a JSON response with the ID of the request. Data is the response a handler wrote, and is
+// null when the request failed, in which case Error holds the reason.
+type ResponseEnvelope struct {
+	RequestID string          `json:"request_id"`
+	Data      json.RawMessage `json:"data"`
+	Error     *ErrorResponse  `json:"error"`
+}
+
+// RequestID returns the ID the API gave the request, empty if it has not been handled by the API.
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID returns the request with an ID, the one the client sent in X-Request-ID if it is usable or a new
+// random one otherwise.
+func withRequestID(r *http.Request) *http.Request {
+	id := r.Header.Get(RequestIDHeader)
+	if !validRequestID(id) {
+		id = generateRandomToken()
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
+
+// validRequestID returns true if a client supplied request ID can be logged and echoed safely: it is not empty,
+// not too long and only made of printable ASCII characters other than space.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// envelopeMiddleware wraps JSON responses, and every error response, in a ResponseEnvelope. Other responses, such
+// as HTML pages, images, streams and WebSockets, are passed through unchanged.
+func (api *API) envelopeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ew := &envelopeWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(ew, r)
+		ew.finish(RequestID(r))
+	})
+}
+
+// envelopeWriter holds back a response that is to be wrapped in an envelope until the handler has finished.
+type envelopeWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+	wrap        bool
+	body        bytes.Buffer
+}
+
+// WriteHeader decides whether the response is wrapped, from its status code and content type.
+func (ew *envelopeWriter) WriteHeader(code int) {
+	if ew.wroteHeader {
+		return
+	}
+	ew.wroteHeader = true
+	ew.code = code
+
+	contentType := ew.Header().Get("Content-Type")
+	ew.wrap = code >= http.StatusBadRequest || strings.HasPrefix(contentType, "application/json")
+	if !ew.wrap {
+		ew.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (ew *envelopeWriter) Write(data []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.wrap {
+		return ew.body.Write(data)
+	}
+	return ew.ResponseWriter.Write(data)
+}
+
+// Hijack lets WebSocket handlers take over the connection through the wrapper.
+func (ew *envelopeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := ew.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// finish writes the envelope of a wrapped response.
+func (ew *envelopeWriter) finish(requestID string) {
+	if !ew.wrap {
+		return
+	}
+
+	envelope := ResponseEnvelope{RequestID: requestID}
+	body := bytes.TrimSpace(ew.body.Bytes())
+	if ew.code >= http.StatusBadRequest {
+		// Errors are sent by http.Error as plain text, or by RespondError as an ErrorResponse
+		var errorResponse ErrorResponse
+		if json.Unmarshal(body, &errorResponse) != nil || errorResponse.Message == "" {
+			errorResponse.Message = string(body)
+		}
+		envelope.Error = &errorResponse
+	} else if len(body) > 0 {
+		envelope.Data = body
+	}
+
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		http.Error(ew.ResponseWriter, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Set response headers
+	ew.Header().Set("Content-Type", "application/json")
+	ew.Header().Del("Content-Length")
+
+	// Write the JSON response
+	ew.ResponseWriter.WriteHeader(ew.code)
+	ew.ResponseWriter.Write(data)
+}
@@ -35,7 +35,7 @@ func init() {
 
 	// Register new command-line flags for seed node functionality
 	Args.Register("seed", "Run as a seed node", true)
-	Args.Register("seed-address", "Address of the seed node to connect to", "")
+	Args.Register("seed-address", "Comma separated addresses of the seed nodes to connect to", "")
 }
 
 // NewArguments creates a new Arguments instance
@@ -72,6 +72,14 @@ func (a *Arguments) Parse() error {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
 		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "Commands:")
+		fmt.Fprintln(os.Stderr, "  verify-block <file> [previous-hash]")
+		fmt.Fprintln(os.Stderr, "    \tCheck the hash and Merkle root of a stored block, and that it follows previous-hash")
+		fmt.Fprintln(os.Stderr, "  verify-balance <address>")
+		fmt.Fprintln(os.Stderr, "    \tCheck the balance held in a wallet against the chain, reading its passphrase from stdin")
+		fmt.Fprintln(os.Stderr, "Environment:")
+		fmt.Fprintf(os.Stderr, "  %s\n", NodeWalletPassphraseEnv)
+		fmt.Fprintln(os.Stderr, "    \tPassphrase of the node wallet, required to start the node. It is never saved, set it on every start")
 	}
 
 	flag.Parse()
@@ -83,6 +91,11 @@ func (a *Arguments) Parse() error {
 	return nil
 }
 
+// Command returns the arguments left after the flags, such as a command and its parameters.
+func (a *Arguments) Command() []string {
+	return flag.Args()
+}
+
 // PrintUsage prints usage information for all registered arguments
 func (a *Arguments) PrintUsage() {
 	log.Println("Usage:")
@@ -0,0 +1,219 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/gossip.go - Forwarding new transactions to peers
+package sdk
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// seenSet remembers IDs for a limited time. It is used to stop a transaction being gossiped back and forth
+// between peers that have already received it.
+type seenSet struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	items map[string]time.Time // IDs mapped to when they expire
+}
+
+// newSeenSet creates a seenSet that forgets IDs after ttl.
+func newSeenSet(ttl time.Duration) *seenSet {
+	return &seenSet{
+		ttl:   ttl,
+		items: make(map[string]time.Time),
+	}
+}
+
+// add records the ID and returns true if it had not been seen before, or its earlier sighting has expired.
+func (s *seenSet) add(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+
+	if _, exists := s.items[id]; exists {
+		return false
+	}
+
+	s.items[id] = now.Add(s.ttl)
+	return true
+}
+
+// contains returns true if the ID has been seen and has not expired.
+func (s *seenSet) contains(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, exists := s.items[id]
+	return exists && time.Now().Before(until)
+}
+
+// prune forgets expired IDs. The caller must hold s.mu.
+func (s *seenSet) prune(now time.Time) {
+	for id, until := range s.items {
+		if !now.Before(until) {
+			delete(s.items, id)
+		}
+	}
+}
+
+// MarkSeen records that the transaction with the given ID has been gossiped. It returns true if the ID
+// was not already seen, meaning the transaction should be forwarded to peers.
+func (p *P2P) MarkSeen(id string) bool {
+	return p.seen.add(id)
+}
+
+// IsSeen returns true if the transaction with the given ID has already been gossiped.
+func (p *P2P) IsSeen(id string) bool {
+	return p.seen.contains(id)
+}
+
+// peers returns the registered nodes other than the one with the given ID.
+func (p *P2P) peers(exclude string) []*Node {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	peers := make([]*Node, 0, len(p.nodes))
+	for id, node := range p.nodes {
+		if id != exclude {
+			peers = append(peers, node)
+		}
+	}
+	return peers
+}
+
+// gossipTransaction forwards a transaction accepted into this node's mempool to its peers using the
+// "tx" action of the /consensus/tx flow. Peers running in this process are handed the transaction directly, remote
+// peers are sent it over a P2P connection. Transactions that have already been gossiped are not sent again.
+func (n *Node) gossipTransaction(tx Transaction) {
+	if n.P2P == nil || !n.P2P.MarkSeen(tx.GetID()) {
+		return
+	}
+
+	persisted, err := NewPersistedTransaction(tx)
+	if err != nil {
+		log.Printf("Error encoding transaction %s for gossip: %v\n", tx.GetID(), err)
+		return
+	}
+
+	data, err := json.Marshal(persisted)
+	if err != nil {
+		log.Printf("Error encoding transaction %s for gossip: %v\n", tx.GetID(), err)
+		return
+	}
+
+	id, err := NewPUIDFromString(tx.GetID())
+	if err != nil {
+		log.Printf("Error parsing transaction ID %s for gossip: %v\n", tx.GetID(), err)
+		return
+	}
+
+	msg := P2PTransaction{
+		Tx:     Tx{ID: id, Protocol: tx.GetProtocol()},
+		Target: "node",
+		Action: "tx",
+		Data:   data,
+	}
+
+	// Peers are sent to without holding the P2P lock, as they may gossip the transaction onwards
+	for _, peer := range n.P2P.peers(n.ID) {
+		switch {
+		case peer.Blockchain != nil:
+			err = peer.ProcessP2PTransaction(msg)
+		case peer.Config != nil && peer.Config.P2PHostName != "":
+			err = n.P2P.SendTransaction(peer.Config.P2PHostName, msg)
+		default:
+			err = errors.New("peer has no P2P address")
+		}
+		if err != nil {
+			log.Printf("Error gossiping transaction %s to node %s: %v\n", tx.GetID(), peer.ID, err)
+		}
+	}
+}
+
+// SendTransaction connects to the peer at address and sends it the P2P transaction.
+func (p *P2P) SendTransaction(address string, tx P2PTransaction) error {
+	if p.IsBanned(address) {
+		return fmt.Errorf("peer %s is banned", address)
+	}
+
+	message, err := json.Marshal(tx)
+	if err != nil {
+		return fmt.Errorf("failed to marshal P2P transaction: %w", err)
+	}
+
+	conn, err := net.DialTimeout("tcp", address, p.getTimeout())
+	if err != nil {
+		return fmt.Errorf("failed to connect to node: %w", err)
+	}
+	defer conn.Close()
+
+	pc, err := p.performClientHandshake(conn)
+	if err != nil {
+		return fmt.Errorf("handshake failed: %w", err)
+	}
+
+	pc.SetDeadline(time.Now().Add(p.getTimeout()))
+	return pc.Send(message)
+}
+
+// receiveTransaction queues a transaction gossiped by a peer running in this process.
+func (n *Node) receiveTransaction(tx P2PTransaction) error {
+	return receiveGossipedTransaction(n.Blockchain, n.P2P, tx)
+}
+
+// receiveGossipedTransaction queues a transaction gossiped by a peer on bc. Transactions already seen on the P2P
+// network p are dropped, and accepted transactions are gossiped onwards by the blockchain's OnTransactionAdded hook.
+// Transactions that can't be decoded or verified are the peer's fault, and the error wraps ErrInvalidPeerMessage.
+func receiveGossipedTransaction(bc *Blockchain, p *P2P, tx P2PTransaction) error {
+	if bc == nil {
+		return errors.New("no blockchain to queue the gossiped transaction on")
+	}
+	if p != nil && tx.ID != nil && p.IsSeen(tx.ID.String()) {
+		return nil
+	}
+
+	// Received over a P2P connection the data is JSON decoded, which leaves the bytes base64 encoded
+	var data []byte
+	switch raw := tx.Data.(type) {
+	case []byte:
+		data = raw
+	case string:
+		decoded, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			return fmt.Errorf("%w: error decoding gossiped transaction: %v", ErrInvalidPeerMessage, err)
+		}
+		data = decoded
+	default:
+		return fmt.Errorf("%w: error asserting tx.Data to []byte", ErrInvalidPeerMessage)
+	}
+
+	var persisted PersistedTransaction
+	err := json.Unmarshal(data, &persisted)
+	if err != nil {
+		return fmt.Errorf("%w: error decoding gossiped transaction: %v", ErrInvalidPeerMessage, err)
+	}
+
+	transaction, err := persisted.Transaction()
+	if err != nil {
+		return fmt.Errorf("%w: error decoding gossiped transaction: %v", ErrInvalidPeerMessage, err)
+	}
+
+	err = bc.VerifySignature(transaction)
+	if err != nil {
+		return fmt.Errorf("%w: error verifying gossiped transaction: %v", ErrInvalidPeerMessage, err)
+	}
+
+	err = bc.AddTransaction(transaction)
+	if err != nil && !errors.Is(err, ErrDuplicateTransaction) {
+		return fmt.Errorf("error queuing gossiped transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package sdk
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGossipTestNode creates an in-process node with its own blockchain and P2P network, wired to gossip
+// accepted transactions the way NewNode does.
+func newGossipTestNode(t *testing.T, id string) *Node {
+	t.Helper()
+
+	n := &Node{
+		ID:         id,
+		Config:     &Config{},
+		Blockchain: newTestBlockchain(t),
+		P2P:        NewP2P(),
+		Wallet:     &Wallet{Address: testAddr},
+	}
+	n.Config.setDefaultValues()
+	n.Blockchain.OnTransactionAdded(n.gossipTransaction)
+	return n
+}
+
+func TestGossipTransactionReachesPeerMempool(t *testing.T) {
+	useTestStorage(t)
+	a := newGossipTestNode(t, "node-a")
+	b := newGossipTestNode(t, "node-b")
+
+	// Connect the nodes to each other
+	for _, n := range []*Node{a, b} {
+		assert.NoError(t, n.P2P.RegisterNode(a))
+		assert.NoError(t, n.P2P.RegisterNode(b))
+	}
+
+	tx := newSignedTestMessage(t, "gossip")
+	assert.NoError(t, a.Blockchain.AddTransaction(tx))
+
+	assert.True(t, b.Blockchain.HasTransaction(tx.ID), "transaction should be gossiped to the peer")
+	assert.Len(t, b.Blockchain.TransactionQueue, 1)
+	assert.Len(t, a.Blockchain.TransactionQueue, 1)
+	assert.True(t, a.P2P.IsSeen(tx.GetID()))
+	assert.True(t, b.P2P.IsSeen(tx.GetID()))
+}
+
+func TestGossipTransactionReachesRemotePeer(t *testing.T) {
+	useTestStorage(t)
+	a := newGossipTestNode(t, "node-a")
+
+	// The remote peer is only known by its P2P address, its blockchain is behind the connection
+	remote := newTestBlockchain(t)
+	server := NewP2P()
+	server.SetBlockchain(remote)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.handleConnection(conn)
+		}
+	}()
+	a.Config.P2PHostName = p2pHostname // The handshake introduces node-a by its own registration
+	require.NoError(t, a.P2P.RegisterNode(a))
+	require.NoError(t, a.P2P.RegisterNode(&Node{ID: "remote", Config: &Config{P2PHostName: listener.Addr().String()}}))
+
+	tx := newSignedTestMessage(t, "over the wire")
+	require.NoError(t, a.Blockchain.AddTransaction(tx))
+
+	assert.Eventually(t, func() bool { return remote.HasTransaction(tx.ID) }, 5*time.Second, 10*time.Millisecond,
+		"transaction should be sent to the remote peer")
+}
+
+func TestSeenSetForgetsExpiredIDs(t *testing.T) {
+	s := newSeenSet(0)
+
+	assert.True(t, s.add("tx"))
+	assert.False(t, s.contains("tx"))
+	assert.True(t, s.add("tx"), "expired IDs should be accepted again")
+}
+
+func TestBroadcastStatusReachesPeers(t *testing.T) {
+	useTestStorage(t)
+
+	a := newGossipTestNode(t, "node-a")
+	b := newGossipTestNode(t, "node-b")
+	a.Config.P2PHostName = "node-a:8100" // node-b's P2P network tells itself apart from its peers by host name
+
+	// Connect the nodes to each other
+	for _, n := range []*Node{a, b} {
+		assert.NoError(t, n.P2P.RegisterNode(a))
+		assert.NoError(t, n.P2P.RegisterNode(b))
+	}
+
+	// Give node-a a block on top of the genesis block and a pending transaction
+	a.Blockchain.GenerateGenesisBlock([]Transaction{})
+	assert.NoError(t, a.Blockchain.AddTransaction(newTestMessage(t, "mined")))
+	a.Blockchain.createNewBlock(1)
+	assert.NoError(t, a.Blockchain.AddTransaction(newTestMessage(t, "pending")))
+
+	assert.NoError(t, a.P2P.BroadcastStatus(a, "active"))
+
+	peers := b.P2P.GetPeers()
+	if assert.Len(t, peers, 1) && assert.NotNil(t, peers[0].Status) {
+		assert.Equal(t, "node-a", peers[0].ID)
+		assert.Equal(t, "active", peers[0].Status.Status)
+		assert.Equal(t, int64(1), peers[0].Status.BlockHeight)
+		assert.Equal(t, 1, peers[0].Status.MempoolSize)
+		assert.Equal(t, BlockchainVersion, peers[0].Status.Version)
+	}
+}
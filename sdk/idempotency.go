@@ -0,0 +1,158 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/idempotency.go - Replaying the response to a retried request that carries an Idempotency-Key
+package sdk
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// IdempotencyKeyHeader names a request so that retries of it are answered with the first response instead of
+	// being handled again.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotentReplayedHeader is set to "true" on a response replayed for a retried request.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// idempotentResponse is the response to a request with an Idempotency-Key. It is nil while the first request is
+// still being handled.
+type idempotentResponse struct {
+	code   int
+	header http.Header
+	body   []byte
+}
+
+// idempotencyEntry is a key that has been seen, with the response to replay and when it is forgotten.
+type idempotencyEntry struct {
+	response *idempotentResponse
+	expires  time.Time
+}
+
+// idempotencyCache remembers the responses to requests with an Idempotency-Key for a limited time.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*idempotencyEntry
+}
+
+// newIdempotencyCache creates an idempotencyCache that forgets responses after ttl.
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// begin claims the key for a request. It returns false and the response to replay if the key has already been
+// used, the response is nil when the first request with the key has not finished yet.
+func (c *idempotencyCache) begin(key string) (*idempotentResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.prune(now)
+
+	if entry, exists := c.entries[key]; exists {
+		return entry.response, false
+	}
+
+	c.entries[key] = &idempotencyEntry{expires: now.Add(c.ttl)}
+	return nil, true
+}
+
+// finish stores the response to replay for the key claimed by begin.
+func (c *idempotencyCache) finish(key string, response *idempotentResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, exists := c.entries[key]; exists {
+		entry.response = response
+	}
+}
+
+// release forgets the key claimed by begin, so that the request may be retried.
+func (c *idempotencyCache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+// prune forgets expired keys. The caller must hold c.mu.
+func (c *idempotencyCache) prune(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// idempotent handles a request with an Idempotency-Key once. Retries with the same key are answered with the
+// first response, marked with the Idempotent-Replayed header, until the key expires. Server errors are not
+// remembered, so that a request which failed that way may be retried. Requests without the header are handled
+// as usual.
+func (api *API) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		// Keys are scoped to the endpoint, so that a client reusing one elsewhere gets that endpoint's response
+		key = r.Method + " " + r.URL.Path + " " + key
+
+		response, first := api.idempotency.begin(key)
+		if !first {
+			if response == nil {
+				http.Error(w, "A request with this Idempotency-Key is still being handled", http.StatusConflict)
+				return
+			}
+
+			// The replay keeps this request's ID, so the retry can be told apart from the first request in the logs
+			for name, values := range response.header {
+				if name != RequestIDHeader {
+					w.Header()[name] = values
+				}
+			}
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			w.WriteHeader(response.code)
+			w.Write(response.body)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, code: http.StatusOK}
+		next(rec, r)
+
+		if rec.code >= http.StatusInternalServerError {
+			api.idempotency.release(key)
+			return
+		}
+		api.idempotency.finish(key, &idempotentResponse{
+			code:   rec.code,
+			header: w.Header().Clone(),
+			body:   rec.body.Bytes(),
+		})
+	}
+}
+
+// responseRecorder passes a response through while keeping a copy of its status code and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	rr.code = code
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(data []byte) (int, error) {
+	rr.body.Write(data)
+	return rr.ResponseWriter.Write(data)
+}
@@ -0,0 +1,146 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/keystore.go - Exporting and importing a wallet's encrypted keystore for backup
+package sdk
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WalletExportRequest is the body of a request to export a wallet's keystore. The owner of the wallet proves
+// ownership by giving its passphrase.
+type WalletExportRequest struct {
+	Passphrase string `json:"passphrase"`
+}
+
+const (
+	// maxExportFailures is the number of failed attempts to export a wallet's keystore before it is locked out
+	maxExportFailures = 5
+
+	// exportLockout is how long exports of a wallet are refused once it is locked out
+	exportLockout = 15 * time.Minute
+
+	// maxExportRequestSize is the largest WalletExportRequest body read, in bytes
+	maxExportRequestSize = 4096
+)
+
+// exportAttempts counts the failed attempts to export each wallet's keystore, so its passphrase can't be guessed
+// through the API.
+var exportAttempts = &exportLimiter{wallets: make(map[string]*exportFailures)}
+
+// exportFailures is the record of failed export attempts for a wallet.
+type exportFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// exportLimiter locks a wallet out of exports for exportLockout after maxExportFailures failed attempts.
+type exportLimiter struct {
+	mu      sync.Mutex
+	wallets map[string]*exportFailures
+}
+
+// allowed returns false while the wallet is locked out.
+func (l *exportLimiter) allowed(id string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	failures, ok := l.wallets[id]
+	return !ok || !now.Before(failures.lockedUntil)
+}
+
+// fail records a failed attempt to export the wallet, locking it out once it has failed maxExportFailures times.
+// Records not updated for exportLockout, and no longer locked out, are dropped.
+func (l *exportLimiter) fail(id string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, failures := range l.wallets {
+		if now.Sub(failures.last) > exportLockout && !now.Before(failures.lockedUntil) {
+			delete(l.wallets, key)
+		}
+	}
+
+	failures, ok := l.wallets[id]
+	if !ok {
+		failures = &exportFailures{}
+		l.wallets[id] = failures
+	}
+	failures.count++
+	failures.last = now
+	if failures.count >= maxExportFailures {
+		failures.count = 0
+		failures.lockedUntil = now.Add(exportLockout)
+	}
+}
+
+// reset forgets the failed attempts to export the wallet, after a successful export.
+func (l *exportLimiter) reset(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.wallets, id)
+}
+
+// Keystore errors.
+var (
+	ErrWalletNotLocked = errors.New("wallet must be locked to export its keystore")
+	ErrInvalidKeystore = errors.New("invalid keystore")
+)
+
+// Export returns the wallet's encrypted keystore: the same JSON the wallet is saved to disk as, with the private key
+// only in the encrypted vault. The wallet must be locked, so decrypted keys are never exported.
+func (w *Wallet) Export() ([]byte, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.Encrypted || len(w.Ciphertext) == 0 {
+		return nil, ErrWalletNotLocked
+	}
+
+	data, err := json.MarshalIndent(w, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to export wallet %s: %w", w.Address, err)
+	}
+	return data, nil
+}
+
+// ImportWallet restores a wallet from a keystore returned by Export, unlocking it with the passphrase it was locked
+// with. The keystore is refused if it is not encrypted, or if its key does not belong to its address. The wallet is
+// returned unlocked and is not saved, Close it to save it to disk.
+func ImportWallet(data []byte, passphrase string) (*Wallet, error) {
+	wallet := &Wallet{}
+	err := json.Unmarshal(data, wallet)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeystore, err)
+	}
+	if !wallet.Encrypted || len(wallet.Ciphertext) == 0 {
+		return nil, fmt.Errorf("%w: the vault is not encrypted", ErrInvalidKeystore)
+	}
+
+	err = ValidateAddress(wallet.Address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeystore, err)
+	}
+
+	err = wallet.Unlock(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock keystore for %s: %w", wallet.Address, err)
+	}
+
+	pubBytes, err := wallet.PublicBytes()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeystore, err)
+	}
+	hash := sha256.Sum256(pubBytes)
+	if EncodeAddress(hash[:]) != wallet.Address {
+		return nil, fmt.Errorf("%w: the key does not belong to address %s", ErrInvalidKeystore, wallet.Address)
+	}
+
+	return wallet, nil
+}
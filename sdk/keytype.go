@@ -0,0 +1,201 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/keytype.go - Signature algorithms (ECDSA curves) supported by wallets
+package sdk
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	btcutil "github.com/FactomProject/btcutilecc"
+)
+
+// Wallet key types. Every key type is ECDSA over a different curve.
+const (
+	KeyTypeP256      = "P-256"     // NIST P-256, the default
+	KeyTypeSecp256k1 = "secp256k1" // The Koblitz curve used by Bitcoin and Ethereum
+)
+
+// ErrUnsupportedKeyType is returned when a wallet key type or curve is not supported.
+var ErrUnsupportedKeyType = errors.New("unsupported key type")
+
+// keyTypeInfo describes a supported key type.
+type keyTypeInfo struct {
+	curve elliptic.Curve
+	oid   asn1.ObjectIdentifier // Named curve OID used in SEC 1 and PKIX encodings
+}
+
+var (
+	keyTypes = map[string]keyTypeInfo{
+		KeyTypeP256:      {curve: elliptic.P256(), oid: asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}},
+		KeyTypeSecp256k1: {curve: btcutil.Secp256k1(), oid: asn1.ObjectIdentifier{1, 3, 132, 0, 10}},
+	}
+
+	// oidPublicKeyECDSA identifies an elliptic curve public key in PKIX encodings
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+)
+
+// ecPrivateKey is the SEC 1 ASN.1 structure of an elliptic curve private key.
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// pkixPublicKey is the PKIX ASN.1 structure of a public key.
+type pkixPublicKey struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// ValidateKeyType returns ErrUnsupportedKeyType if the key type is not supported. An empty key type is the default,
+// KeyTypeP256.
+func ValidateKeyType(keyType string) error {
+	if keyType == "" {
+		return nil
+	}
+	if _, ok := keyTypes[keyType]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedKeyType, keyType)
+	}
+	return nil
+}
+
+// GenerateKey generates a new private key of the key type. An empty key type generates a KeyTypeP256 key.
+func GenerateKey(keyType string) (*ecdsa.PrivateKey, error) {
+	if keyType == "" {
+		keyType = KeyTypeP256
+	}
+
+	info, ok := keyTypes[keyType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKeyType, keyType)
+	}
+	return ecdsa.GenerateKey(info.curve, rand.Reader)
+}
+
+// keyTypeOfCurve returns the key type using the curve.
+func keyTypeOfCurve(curve elliptic.Curve) (string, error) {
+	for keyType, info := range keyTypes {
+		if info.curve == curve {
+			return keyType, nil
+		}
+	}
+
+	name := "unknown"
+	if curve != nil {
+		name = curve.Params().Name
+	}
+	return "", fmt.Errorf("unsupported curve %s: %w", name, ErrUnsupportedKeyType)
+}
+
+// keyTypeOfOID returns the key type using the named curve OID.
+func keyTypeOfOID(oid asn1.ObjectIdentifier) (string, error) {
+	for keyType, info := range keyTypes {
+		if info.oid.Equal(oid) {
+			return keyType, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported curve %s: %w", oid, ErrUnsupportedKeyType)
+}
+
+// marshalECPrivateKey encodes the private key in SEC 1 form. Curves crypto/x509 doesn't know, such as secp256k1,
+// are encoded in the same form with their own OID.
+func marshalECPrivateKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	keyType, err := keyTypeOfCurve(key.Curve)
+	if err != nil || keyType == KeyTypeP256 {
+		return x509.MarshalECPrivateKey(key)
+	}
+
+	size := (key.Curve.Params().N.BitLen() + 7) / 8
+	return asn1.Marshal(ecPrivateKey{
+		Version:       1,
+		PrivateKey:    key.D.FillBytes(make([]byte, size)),
+		NamedCurveOID: keyTypes[keyType].oid,
+		PublicKey:     asn1.BitString{Bytes: elliptic.Marshal(key.Curve, key.X, key.Y)},
+	})
+}
+
+// parseECPrivateKey decodes a SEC 1 private key of any supported key type.
+func parseECPrivateKey(der []byte) (*ecdsa.PrivateKey, error) {
+	key, err := x509.ParseECPrivateKey(der)
+	if err == nil {
+		return key, nil
+	}
+
+	var sec1 ecPrivateKey
+	if _, asn1Err := asn1.Unmarshal(der, &sec1); asn1Err != nil {
+		return nil, err
+	}
+	keyType, typeErr := keyTypeOfOID(sec1.NamedCurveOID)
+	if typeErr != nil {
+		return nil, typeErr
+	}
+
+	curve := keyTypes[keyType].curve
+	d := new(big.Int).SetBytes(sec1.PrivateKey)
+	if d.Sign() <= 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("invalid private key")
+	}
+
+	key = &ecdsa.PrivateKey{D: d}
+	key.Curve = curve
+	key.X, key.Y = curve.ScalarBaseMult(sec1.PrivateKey)
+	return key, nil
+}
+
+// marshalPKIXPublicKey encodes the public key in PKIX form. Curves crypto/x509 doesn't know, such as secp256k1, are
+// encoded in the same form with their own OID.
+func marshalPKIXPublicKey(key *ecdsa.PublicKey) ([]byte, error) {
+	keyType, err := keyTypeOfCurve(key.Curve)
+	if err != nil || keyType == KeyTypeP256 {
+		return x509.MarshalPKIXPublicKey(key)
+	}
+
+	params, err := asn1.Marshal(keyTypes[keyType].oid)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkixPublicKey{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyECDSA, Parameters: asn1.RawValue{FullBytes: params}},
+		PublicKey: asn1.BitString{Bytes: elliptic.Marshal(key.Curve, key.X, key.Y)},
+	})
+}
+
+// parsePKIXPublicKey decodes a PKIX public key of any supported key type.
+func parsePKIXPublicKey(der []byte) (*ecdsa.PublicKey, error) {
+	generic, err := x509.ParsePKIXPublicKey(der)
+	if err == nil {
+		key, ok := generic.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, errors.New("not an ECDSA public key")
+		}
+		return key, nil
+	}
+
+	var pkixKey pkixPublicKey
+	if _, asn1Err := asn1.Unmarshal(der, &pkixKey); asn1Err != nil || !pkixKey.Algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+		return nil, err
+	}
+	var oid asn1.ObjectIdentifier
+	if _, asn1Err := asn1.Unmarshal(pkixKey.Algorithm.Parameters.FullBytes, &oid); asn1Err != nil {
+		return nil, err
+	}
+	keyType, typeErr := keyTypeOfOID(oid)
+	if typeErr != nil {
+		return nil, typeErr
+	}
+
+	curve := keyTypes[keyType].curve
+	x, y := elliptic.Unmarshal(curve, pkixKey.PublicKey.RightAlign())
+	if x == nil {
+		return nil, errors.New("invalid public key")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
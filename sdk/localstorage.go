@@ -7,6 +7,7 @@ import (
 
 	"fmt"
 	"log"
+	"math/big"
 	"os"
 	"path/filepath"
 
@@ -44,16 +45,20 @@ func NewLocalStorage(dataPath string) error {
 		return fmt.Errorf("local storage already initialized")
 	}
 
-	// Create the LocalStorage instance
-	localStorage = &LocalStorage{}
 	if dataPath == "" {
 		// Use the default data path
-		localStorage.dataPath = "./data" // Modify the data path based on your requirements
-	} else {
-		// Use the given data path
-		localStorage.dataPath = dataPath
+		dataPath = "./data" // Modify the data path based on your requirements
+	}
+
+	// Fail fast if the data can not be stored where it was asked to be
+	err := ValidateDataPath(dataPath)
+	if err != nil {
+		return err
 	}
 
+	// Create the LocalStorage instance
+	localStorage = &LocalStorage{dataPath: dataPath}
+
 	// Perform any initial setup or data loading if needed
 	localStorage.setup()
 
@@ -72,6 +77,13 @@ func GetLocalStorage() (*LocalStorage, error) {
 	return localStorage, nil
 }
 
+// ResetLocalStorage forgets the local storage so that NewLocalStorage can initialize it again, possibly with a
+// different data path. Files already written are left on disk. It is intended for tests and tools that run
+// more than one node in a process, one after the other.
+func ResetLocalStorage() {
+	localStorage = nil
+}
+
 // LocalStorageAvailable returns a boolean indicating whether the LocalStorage instance has been initialized.
 // This function can be used to check if the local storage data persist manager is available for use.
 func LocalStorageAvailable() bool {
@@ -135,6 +147,48 @@ func (ls *LocalStorage) file(t interface{}) (filePath string, err error) {
 	return filePath, err
 }
 
+// walletFiles returns the paths of all wallet files persisted in the LocalStorage.
+func (ls *LocalStorage) walletFiles() ([]string, error) {
+	return filepath.Glob(filepath.Join(ls.dataPath, "wallets", "*.json"))
+}
+
+// blockFiles returns the paths of all block files persisted in the LocalStorage.
+func (ls *LocalStorage) blockFiles() ([]string, error) {
+	return filepath.Glob(filepath.Join(ls.dataPath, "blocks", "*.json"))
+}
+
+// GetBlock reads the block with the given index from disk. Blocks are decoded with DecodeBlock so that
+// each transaction is restored as the concrete type for its protocol. If the block has not been saved
+// the returned error satisfies os.IsNotExist.
+func (ls *LocalStorage) GetBlock(index int64) (*Block, error) {
+	filePath, err := ls.file(&Block{Index: *big.NewInt(index)})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeBlock(data)
+}
+
+// DeleteBlock removes the block with the given index from disk. It is not an error if the block has not
+// been saved.
+func (ls *LocalStorage) DeleteBlock(index int64) error {
+	filePath, err := ls.file(&Block{Index: *big.NewInt(index)})
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 // Get retrieves the value associated with the given key from the LocalStorage.
 // It decodes the JSON data from the file corresponding to the type of the provided value.
 // If the file does not exist or the JSON data cannot be decoded, an error is returned.
@@ -0,0 +1,92 @@
+package sdk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestStorage points the package level localStorage at a temporary folder for the duration of a test.
+func useTestStorage(t *testing.T) string {
+	t.Helper()
+
+	previous := localStorage
+	localStorage = &LocalStorage{dataPath: t.TempDir()}
+	localStorage.setup()
+
+	t.Cleanup(func() {
+		localStorage = previous
+	})
+
+	return localStorage.dataPath
+}
+
+func TestNewLocalStorageRejectsUnusableDataPath(t *testing.T) {
+	previous := localStorage
+	t.Cleanup(func() { localStorage = previous })
+
+	// A data path below a regular file can never be created
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, []byte("not a folder"), 0644))
+
+	localStorage = nil
+	err := NewLocalStorage(filepath.Join(file, "data"))
+	assert.Error(t, err)
+	assert.Nil(t, localStorage)
+
+	localStorage = nil
+	assert.Error(t, NewLocalStorage(file))
+
+	// A missing but creatable data path is created
+	localStorage = nil
+	dataPath := filepath.Join(t.TempDir(), "new", "data")
+	require.NoError(t, NewLocalStorage(dataPath))
+	assert.DirExists(t, dataPath)
+}
+
+func TestValidateDataPathReadOnly(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("file permissions are not enforced for root")
+	}
+
+	readOnly := t.TempDir()
+	require.NoError(t, os.Chmod(readOnly, 0555))
+	t.Cleanup(func() { os.Chmod(readOnly, 0755) })
+
+	err := ValidateDataPath(readOnly)
+	assert.ErrorContains(t, err, "not writable")
+}
+
+func TestUnlockMigratesWalletTags(t *testing.T) {
+	useTestStorage(t)
+
+	wallet, err := NewWallet(NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(4), "Tagged", testPassPhrase, []string{"savings"}))
+	require.NoError(t, err)
+	if !wallet.Encrypted {
+		require.NoError(t, wallet.Close(testPassPhrase))
+	}
+
+	// Wallets saved before tags were kept unencrypted only have their tags in the vault
+	saved, err := GetWalletByAddress(wallet.Address)
+	require.NoError(t, err)
+	saved.Tags = nil
+	require.NoError(t, localStorage.Set("wallet", saved))
+
+	saved, err = GetWalletByAddress(wallet.Address)
+	require.NoError(t, err)
+	assert.False(t, saved.HasTag("savings"))
+
+	require.NoError(t, saved.Unlock(testPassPhrase))
+	assert.Equal(t, []string{"savings"}, saved.Tags)
+
+	// The migrated tags are saved with the still encrypted wallet
+	migrated, err := GetWalletByAddress(wallet.Address)
+	require.NoError(t, err)
+	assert.True(t, migrated.Encrypted)
+	assert.True(t, migrated.HasTag("savings"))
+	require.NoError(t, migrated.Unlock(testPassPhrase))
+	assert.Equal(t, wallet.Address, migrated.GetAddress())
+}
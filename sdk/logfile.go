@@ -0,0 +1,135 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/logfile.go - Log file output with size based rotation
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RotatingFile is an io.Writer that appends to a log file and rotates it once it would grow past its maximum
+// size. The previous file is kept next to it with a ".1" suffix, replacing any older backup.
+type RotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+}
+
+// NewRotatingFile opens (or creates) the log file at path, which is rotated once it reaches maxSize bytes.
+func NewRotatingFile(path string, maxSize int64) (*RotatingFile, error) {
+	if path == "" {
+		return nil, errors.New("log file path cannot be empty")
+	}
+	if maxSize <= 0 {
+		return nil, errors.New("log file max size must be positive")
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating log folder: %w", err)
+	}
+
+	f := &RotatingFile{path: path, maxSize: maxSize}
+	err = f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write writes p to the log file, rotating the file first if p would take it past the maximum size.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		err := f.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the log file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// open opens the log file for appending and records its current size.
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error reading log file: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// rotate moves the current log file to the backup and starts a new one. The caller must hold f.mu.
+func (f *RotatingFile) rotate() error {
+	err := f.file.Close()
+	if err != nil {
+		return fmt.Errorf("error closing log file: %w", err)
+	}
+
+	err = os.Rename(f.path, f.path+".1")
+	if err != nil {
+		return fmt.Errorf("error rotating log file: %w", err)
+	}
+
+	return f.open()
+}
+
+// SetupLogging sends the standard logger to Config.LogFile, rotated at Config.LogMaxSizeMB, and also to stdout
+// when Config.LogToStdout is set. It returns nil if no log file is configured. The caller should Close the
+// returned file when it is done logging.
+func SetupLogging(cfg *Config) (*RotatingFile, error) {
+	if cfg == nil || cfg.LogFile == "" {
+		return nil, nil
+	}
+
+	logFile, err := NewRotatingFile(cfg.LogFile, int64(cfg.LogMaxSizeMB)*1024*1024)
+	if err != nil {
+		return nil, err
+	}
+
+	var w io.Writer = logFile
+	if cfg.LogToStdout {
+		w = io.MultiWriter(os.Stdout, logFile)
+	}
+	log.SetOutput(w)
+
+	log.Printf("Logging to %s (rotated at %d MB)\n", cfg.LogFile, cfg.LogMaxSizeMB)
+	return logFile, nil
+}
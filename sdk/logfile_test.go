@@ -0,0 +1,62 @@
+package sdk
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewNodeClosesLogFileOnError(t *testing.T) {
+	previous := localStorage
+	t.Cleanup(func() { localStorage = previous })
+	localStorage = nil
+
+	// The data path can't be created below a regular file, so NewNode fails once logging is set up
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(file, []byte("not a folder"), 0644))
+
+	cfg := NewConfig()
+	cfg.LogFile = filepath.Join(dir, "chaind.log")
+	cfg.DataPath = filepath.Join(file, "data")
+
+	_, err := NewNode(&NodeOptions{Config: cfg})
+	require.Error(t, err)
+	assert.Nil(t, GetNode())
+	assert.Equal(t, os.Stderr, log.Writer(), "logging should be back on the console")
+
+	logged, err := os.ReadFile(cfg.LogFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(logged), "Logging to")
+}
+
+func TestRotatingFileRotatesPastMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "chaind.log")
+	logFile, err := NewRotatingFile(path, 100)
+	require.NoError(t, err)
+	defer logFile.Close()
+
+	first := strings.Repeat("a", 60) + "\n"
+	second := strings.Repeat("b", 60) + "\n"
+
+	_, err = logFile.Write([]byte(first))
+	require.NoError(t, err)
+	_, err = os.Stat(path + ".1")
+	assert.True(t, os.IsNotExist(err), "the log file should not rotate before it is full")
+
+	_, err = logFile.Write([]byte(second))
+	require.NoError(t, err)
+
+	rotated, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, first, string(rotated))
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, second, string(current))
+}
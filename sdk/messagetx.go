@@ -12,8 +12,14 @@ type Message struct {
 	Message string
 }
 
-// NewMessageTransaction creates a new message transaction.
+// NewMessageTransaction creates a new message transaction. Both wallets must be set and have valid addresses,
+// and the message can't be empty.
 func NewMessageTransaction(from *Wallet, to *Wallet, message string) (*Message, error) {
+	err := validateParties(from, to)
+	if err != nil {
+		return nil, err
+	}
+
 	tx, err := NewTransaction(MessageProtocolID, from, to)
 	if err != nil {
 		return nil, err
@@ -24,13 +30,21 @@ func NewMessageTransaction(from *Wallet, to *Wallet, message string) (*Message,
 		return nil, fmt.Errorf("message can't be empty")
 	}
 
-	return &Message{
+	msg := &Message{
 		Tx:      *tx,
 		Message: message,
-	}, nil
+	}
+	msg.ID = msg.computeID(message)
+
+	return msg, nil
 }
 
 // Process returns a string representation of the message.
 func (m *Message) Process() string {
 	return fmt.Sprintf("Message from %s to %s: %s", m.From.GetWalletName(), m.To.GetWalletName(), m.Message)
 }
+
+// Size returns the size of the message transaction in bytes, including its protocol specific fields.
+func (m *Message) Size() int {
+	return serializedSize(m)
+}
@@ -0,0 +1,154 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/metrics.go - Per endpoint request counts and latency histograms in the Prometheus text format
+package sdk
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request latency histogram buckets.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// routeKey identifies an endpoint by its method and route template, such as /blockchain/blocks/{index}, so that
+// every block shares one set of metrics.
+type routeKey struct {
+	method string
+	route  string
+}
+
+// statusKey identifies the responses of an endpoint with one status code.
+type statusKey struct {
+	routeKey
+	code int
+}
+
+// latencyHistogram counts the requests to an endpoint by how long they took.
+type latencyHistogram struct {
+	buckets []uint64 // Requests that took at most the matching latencyBuckets bound, not cumulative
+	count   uint64
+	sum     float64
+}
+
+// RequestMetrics records the number of requests to each API endpoint by status code, and how long they took.
+type RequestMetrics struct {
+	mu        sync.Mutex
+	requests  map[statusKey]uint64
+	latencies map[routeKey]*latencyHistogram
+}
+
+// NewRequestMetrics creates an empty set of request metrics.
+func NewRequestMetrics() *RequestMetrics {
+	return &RequestMetrics{
+		requests:  make(map[statusKey]uint64),
+		latencies: make(map[routeKey]*latencyHistogram),
+	}
+}
+
+// Observe records a request to the route that was answered with the status code after the duration.
+func (m *RequestMetrics) Observe(method, route string, code int, duration time.Duration) {
+	key := routeKey{method: method, route: route}
+	seconds := duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[statusKey{routeKey: key, code: code}]++
+
+	histogram, ok := m.latencies[key]
+	if !ok {
+		histogram = &latencyHistogram{buckets: make([]uint64, len(latencyBuckets))}
+		m.latencies[key] = histogram
+	}
+	histogram.count++
+	histogram.sum += seconds
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			histogram.buckets[i]++
+			break
+		}
+	}
+}
+
+// RequestCount returns the number of requests to the route that were answered with the status code.
+func (m *RequestMetrics) RequestCount(method, route string, code int) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.requests[statusKey{routeKey: routeKey{method: method, route: route}, code: code}]
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *RequestMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+
+	fmt.Fprintln(cw, "# HELP http_requests_total Number of API requests by route and status code.")
+	fmt.Fprintln(cw, "# TYPE http_requests_total counter")
+	statuses := make([]statusKey, 0, len(m.requests))
+	for key := range m.requests {
+		statuses = append(statuses, key)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].routeKey != statuses[j].routeKey {
+			return statuses[i].routeKey.less(statuses[j].routeKey)
+		}
+		return statuses[i].code < statuses[j].code
+	})
+	for _, key := range statuses {
+		fmt.Fprintf(cw, "http_requests_total{method=%q,route=%q,code=\"%d\"} %d\n", key.method, key.route, key.code, m.requests[key])
+	}
+
+	fmt.Fprintln(cw, "# HELP http_request_duration_seconds Latency of API requests by route.")
+	fmt.Fprintln(cw, "# TYPE http_request_duration_seconds histogram")
+	routes := make([]routeKey, 0, len(m.latencies))
+	for key := range m.latencies {
+		routes = append(routes, key)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].less(routes[j]) })
+	for _, key := range routes {
+		histogram := m.latencies[key]
+		cumulative := uint64(0)
+		for i, bound := range latencyBuckets {
+			cumulative += histogram.buckets[i]
+			fmt.Fprintf(cw, "http_request_duration_seconds_bucket{method=%q,route=%q,le=%q} %d\n",
+				key.method, key.route, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(cw, "http_request_duration_seconds_bucket{method=%q,route=%q,le=\"+Inf\"} %d\n", key.method, key.route, histogram.count)
+		fmt.Fprintf(cw, "http_request_duration_seconds_sum{method=%q,route=%q} %s\n", key.method, key.route, strconv.FormatFloat(histogram.sum, 'g', -1, 64))
+		fmt.Fprintf(cw, "http_request_duration_seconds_count{method=%q,route=%q} %d\n", key.method, key.route, histogram.count)
+	}
+
+	return cw.n, cw.err
+}
+
+// less orders endpoints by route, then method.
+func (k routeKey) less(other routeKey) bool {
+	if k.route != other.route {
+		return k.route < other.route
+	}
+	return k.method < other.method
+}
+
+// countingWriter counts the bytes written and keeps the first error, so a series of writes can be checked once.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
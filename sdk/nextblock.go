@@ -0,0 +1,123 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/nextblock.go - Choosing the pending transactions that go into the next block
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// ErrNotPending is returned when a transaction is not in the mempool.
+var ErrNotPending = errors.New("transaction is not pending")
+
+// PinTransaction makes a pending transaction go into the next block ahead of every transaction that is not
+// pinned, whatever the fees. Pinned transactions are never evicted from a full mempool.
+func (bc *Blockchain) PinTransaction(id string) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	for _, tx := range bc.TransactionQueue {
+		if tx.GetID() == id {
+			if bc.pinned == nil {
+				bc.pinned = make(map[string]bool)
+			}
+			bc.pinned[id] = true
+			log.Printf("[%s] Pinned TX %s for the next block\n", time.Now().Format(logDateTimeFormat), id)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrNotPending, id)
+}
+
+// IsPinned returns true if the pending transaction has been pinned for the next block.
+func (bc *Blockchain) IsPinned(id string) bool {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	return bc.pinned[id]
+}
+
+// nextBlockTransactions splits the mempool into the transactions that go into the next block and those that stay
+// queued. Pinned transactions go first, in the order they were queued, followed by the others from the highest fee
+// down, for as long as they fit in Config.MaxBlockSize. The first transaction is always taken, so one that is too
+// large on its own can't hold up the mempool. The caller must hold bc.mux.
+func (bc *Blockchain) nextBlockTransactions() ([]Transaction, []Transaction) {
+	ordered := append([]Transaction{}, bc.TransactionQueue...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		pinnedI, pinnedJ := bc.pinned[ordered[i].GetID()], bc.pinned[ordered[j].GetID()]
+		if pinnedI != pinnedJ {
+			return pinnedI
+		}
+		if pinnedI {
+			return false
+		}
+		return ordered[i].GetFee() > ordered[j].GetFee()
+	})
+
+	maxSize := bc.maxBlockSize()
+
+	included := make(map[Transaction]bool)
+	size := 0
+	for _, tx := range ordered {
+		txSize := tx.Size()
+		if len(included) > 0 && size+txSize > maxSize {
+			continue
+		}
+		included[tx] = true
+		size += txSize
+	}
+
+	// The chosen transactions are in priority order, the others keep their place in the queue
+	var selected, remaining []Transaction
+	for _, tx := range ordered {
+		if included[tx] {
+			selected = append(selected, tx)
+		}
+	}
+	for _, tx := range bc.TransactionQueue {
+		if !included[tx] {
+			remaining = append(remaining, tx)
+		}
+	}
+	return selected, remaining
+}
+
+// maxBlockSize returns the most bytes of transactions a new block holds.
+func (bc *Blockchain) maxBlockSize() int {
+	if bc.cfg != nil && bc.cfg.MaxBlockSize > 0 {
+		return bc.cfg.MaxBlockSize
+	}
+	return MaxBlockSize
+}
+
+// PreviewNextBlock assembles the block that would be mined next from the current mempool, choosing its
+// transactions the same way mining does. The block is neither mined nor added to the chain, so its nonce and hash
+// are not final, and the mempool is left untouched.
+func (bc *Blockchain) PreviewNextBlock() *Block {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	previousHash := ""
+	if len(bc.Blocks) > 0 {
+		previousHash = bc.Blocks[len(bc.Blocks)-1].Hash
+	}
+
+	selected, _ := bc.nextBlockTransactions()
+	block := NewBlock(selected, previousHash)
+	block.Index = *big.NewInt(int64(len(bc.Blocks)))
+	block.FeeRecipient = bc.feeRecipient()
+	bc.setBlockReward(block)
+	return block
+}
+
+// unpin forgets the pins of transactions that have left the mempool. The caller must hold bc.mux.
+func (bc *Blockchain) unpin(transactions []Transaction) {
+	for _, tx := range transactions {
+		delete(bc.pinned, tx.GetID())
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
 	"sync"
 	"time"
@@ -16,11 +17,11 @@ import (
 
 // NodeOptions is the options for a node.
 type NodeOptions struct {
-	EnvName     string
-	DataPath    string
-	Config      *Config
-	IsSeed      bool
-	SeedAddress string
+	EnvName       string
+	DataPath      string
+	Config        *Config
+	IsSeed        bool
+	SeedAddresses []string // Seed nodes to bootstrap from, tried in order until one connects
 }
 
 // NewNodeOptions creates a new NodeOptions instance.
@@ -35,15 +36,35 @@ func NewNodeOptions(envName string, path string, cfg *Config) *NodeOptions {
 	return nodeOptions
 }
 
+// NodeWalletPassphraseEnv is the environment variable the node wallet's passphrase is read from. The passphrase
+// is never saved with the node state.
+const NodeWalletPassphraseEnv = "NODE_WALLET_PASSPHRASE"
+
 // NodePersistData is the data that is persisted for a node to disk.
 type NodePersistData struct {
-	ID     string
-	Config *Config
+	ID               string
+	Config           *Config
+	WalletAddress    string
+	WalletPassphrase string `json:",omitempty"` // Only read, from node state saved before the passphrase moved to NodeWalletPassphraseEnv
+}
+
+// NodeDetails identifies a node to operators and peers.
+type NodeDetails struct {
+	ID         string `json:"id"`
+	P2PAddress string `json:"p2p_address"`
+	Version    string `json:"version"`
+	IsSeed     bool   `json:"is_seed"`
+	PeerCount  int    `json:"peer_count"`
+	MaxPeers   int    `json:"max_peers"`
 }
 
+// NodeStatus is the state a node broadcasts to its peers, so they can tell whether it is ahead of or behind them.
 type NodeStatus struct {
-	NodeID string `json:"node_id"`
-	Status string `json:"status"`
+	NodeID      string `json:"node_id"`
+	Status      string `json:"status"`
+	BlockHeight int64  `json:"block_height"` // Index of the latest block, -1 when the chain has no blocks
+	MempoolSize int    `json:"mempool_size"`
+	Version     string `json:"version"`
 }
 
 // Node is a node in the blockchain network.
@@ -58,120 +79,170 @@ type Node struct {
 	API         *API
 	P2P         *P2P
 	Wallet      *Wallet
+	PublicKey   string // PEM public key of the node wallet, which peers verify its consensus requests with
+
+	walletPassphrase string        // passphrase found in node state saved by an older version, never saved again
+	logFile          *RotatingFile // log file output, nil when logging to the console only
 }
 
 // node is the node instance
 var node *Node
 
+// ErrNodeExists is returned by NewNode when a node has already been created in this process.
+var ErrNodeExists = errors.New("node already exists")
+
+// GetNode returns the node created by NewNode, or nil if no node has been created.
 func GetNode() *Node {
 	return node
 }
 
-func NewNode(opts *NodeOptions) error {
+// ResetNode shuts down the node created by NewNode, if there is one, and clears it along with the local
+// storage so that NewNode can be called again. It is intended for tests and tools that run more than one
+// node in a process, one after the other. The error is the one returned by the node's Cleanup.
+func ResetNode() error {
+	var err error
+	if node != nil {
+		err = node.Cleanup()
+	}
+
+	node = nil
+	ResetLocalStorage()
+	return err
+}
+
+// NewNode creates and initializes the node for this process. If opts is nil a configuration is loaded
+// from the environment. Only one node may exist per process at a time, subsequent calls return ErrNodeExists
+// until ResetNode is called.
+func NewNode(opts *NodeOptions) (*Node, error) {
 	log.Println("Starting NewNode function")
-	node = &Node{}
-	node.Lock()
-	defer node.Unlock()
+	if node != nil {
+		return nil, ErrNodeExists
+	}
 
-	if opts != nil {
-		node.Config = opts.Config
-	} else {
-		node.Config = NewConfig()
+	if opts == nil {
+		opts = &NodeOptions{Config: NewConfig()}
 	}
+
+	if opts.Config == nil {
+		return nil, errors.New("node options must include a config")
+	}
+
+	err := opts.Config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid node config: %w", err)
+	}
+
+	n := &Node{Config: opts.Config}
+	n.Lock()
+	defer n.Unlock()
 	log.Println("Config initialized")
 
-	err := NewLocalStorage(node.Config.DataPath)
+	n.logFile, err = SetupLogging(n.Config)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing logging: %w", err)
+	}
+
+	// A node that fails to start is never cleaned up, so it must not leave the log file open
+	created := false
+	defer func() {
+		if !created {
+			n.closeLogFile()
+		}
+	}()
+
+	err = NewLocalStorage(n.Config.DataPath)
 	if err != nil {
-		return fmt.Errorf("error initializing local storage: %w", err)
+		return nil, fmt.Errorf("error initializing local storage: %w", err)
 	}
 	log.Println("Local storage initialized")
 
-	nodePath := filepath.Join("./", "node.json")
+	nodePath := filepath.Join(localStorage.dataPath, "node.json")
 	if fileExists(nodePath) {
-		err := node.load()
+		err := n.load()
 		if err != nil {
-			return fmt.Errorf("error loading existing node: %w", err)
+			return nil, fmt.Errorf("error loading existing node: %w", err)
 		}
 		log.Println("Loaded existing node configuration")
-	} else {
-		node.ID = uuid.New()
-		err := node.save()
+	}
+
+	// The node ID is generated once and persisted immediately, so peers always see the same node
+	if n.ID == "" {
+		n.ID = uuid.New()
+		err := n.save()
 		if err != nil {
-			return fmt.Errorf("error saving new node: %w", err)
+			return nil, fmt.Errorf("error saving new node: %w", err)
 		}
 		log.Println("Created and saved new node configuration")
 	}
 
 	// Initialize Blockchain
-	node.Blockchain = NewBlockchain(node.Config)
-	if node.Blockchain == nil {
-		return fmt.Errorf("failed to initialize blockchain")
+	n.Blockchain = NewBlockchain(n.Config)
+	if n.Blockchain == nil {
+		return nil, fmt.Errorf("failed to initialize blockchain")
 	}
 	log.Println("Blockchain initialized")
 
-	node.API = NewAPI(node.Blockchain)
+	n.API = NewAPI(n.Blockchain)
 	log.Println("API initialized")
 
-	node.P2P = NewP2P()
+	n.P2P = NewP2P()
+	n.P2P.SetTimeout(time.Duration(n.Config.P2PTimeout) * time.Second)
+	n.P2P.SetMaxPeers(n.Config.MaxPeers)
+	n.P2P.SetProgressIndicator(n.GetProgressIndicator())
+	n.P2P.SetBlockchain(n.Blockchain)
+	if n.Config.BlockWireFormat != "" {
+		err = n.P2P.SetBlockWireFormat(n.Config.BlockWireFormat)
+		if err != nil {
+			return nil, err
+		}
+	}
 	log.Println("P2P initialized")
 
-	// Initialize wallet
-	// password, err := GenerateRandomPassword()
-	// if err != nil {
-	// 	return fmt.Errorf("error generating random password: %w", err)
-	// }
-	// log.Println("Random password generated")
-
-	// walletOptions := &WalletOptions{
-	// 	OrganizationID: NewBigInt(1),
-	// 	AppID:          NewBigInt(1),
-	// 	UserID:         NewBigInt(1),
-	// 	AssetID:        NewBigInt(1),
-	// 	Name:           "NodeWallet",
-	// 	Passphrase:     password,
-	// 	Tags:           []string{"node", "wallet"},
-	// }
-	// wallet, err := NewWallet(walletOptions)
-	// if err != nil {
-	// 	return fmt.Errorf("error creating node wallet: %w", err)
-	// }
-	// node.Wallet = wallet
-	// log.Println("Node wallet created")
+	// Forward transactions accepted into the mempool to our peers
+	n.Blockchain.OnTransactionAdded(n.gossipTransaction)
+
+	err = n.initWallet()
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Node wallet initialized")
 
 	if opts.IsSeed {
 		log.Println("Initializing as seed node")
-		node.P2P.SetAsSeedNode()
+		n.P2P.SetAsSeedNode()
 		log.Println("Node set as seed node")
-	} else if opts.SeedAddress != "" {
+	} else if len(opts.SeedAddresses) > 0 {
 		log.Println("Attempting to connect to seed node")
-		err := node.P2P.ConnectToSeedNode(opts.SeedAddress)
+		seed, err := n.P2P.ConnectToSeedNodes(opts.SeedAddresses)
 		if err != nil {
-			return fmt.Errorf("failed to connect to seed node: %w", err)
+			return nil, fmt.Errorf("failed to connect to seed node: %w", err)
 		}
-		log.Println("Connected to seed node")
+		log.Printf("Connected to seed node %s\n", seed)
 
 		log.Println("Registering node with P2P network")
-		err = node.Register()
+		err = n.Register()
 		if err != nil {
-			return fmt.Errorf("error registering node: %w", err)
+			return nil, fmt.Errorf("error registering node: %w", err)
 		}
 		log.Println("Node registered with P2P network")
 	} else {
 		log.Println("Warning: Node is neither a seed node nor connected to a seed node")
 	}
 
-	node.Config.Show()
-	node.initialized = true
+	n.Config.Show()
+	n.initialized = true
 
-	err = node.save()
+	err = n.save()
 	if err != nil {
-		return fmt.Errorf("error saving node state: %w", err)
+		return nil, fmt.Errorf("error saving node state: %w", err)
 	}
 	log.Println("Node state saved")
 
+	node = n
+	created = true
 	log.Println("Node initialization complete")
 
-	return nil
+	return n, nil
 }
 
 func DefaultNodeOptions() *NodeOptions {
@@ -189,6 +260,52 @@ func (n *Node) IsReady() bool {
 	return n.initialized
 }
 
+// Details returns the details that identify this node.
+func (n *Node) Details() NodeDetails {
+	details := NodeDetails{
+		ID:      n.ID,
+		Version: BlockchainVersion,
+	}
+
+	if n.Config != nil {
+		details.P2PAddress = n.Config.P2PHostName
+	}
+
+	if n.P2P != nil {
+		details.IsSeed = n.P2P.IsSeedNode()
+		details.PeerCount = n.P2P.PeerCount(n.ID)
+		details.MaxPeers = n.P2P.MaxPeers()
+	}
+
+	return details
+}
+
+// CurrentStatus returns the status the node broadcasts to its peers, with its block height and mempool size.
+func (n *Node) CurrentStatus(status string) NodeStatus {
+	nodeStatus := NodeStatus{
+		NodeID:      n.ID,
+		Status:      status,
+		BlockHeight: -1,
+		Version:     BlockchainVersion,
+	}
+
+	if n.Blockchain != nil {
+		if latest := n.Blockchain.GetLatestBlock(); latest != nil {
+			nodeStatus.BlockHeight = latest.Index.Int64()
+		}
+		nodeStatus.MempoolSize = n.Blockchain.GetMempoolSize()
+	}
+
+	return nodeStatus
+}
+
+// GetProgressIndicator returns a progress indicator for long running node work. It never returns nil, when
+// progress is disabled the indicator does nothing.
+func (n *Node) GetProgressIndicator() ProgressIndicator {
+	disabled := n.Config == nil || n.Config.DisableProgress
+	return NewProgressIndicator(disabled, os.Stdout)
+}
+
 // save saves the node state to disk.
 func (n *Node) save() error {
 	data := &NodePersistData{
@@ -196,6 +313,10 @@ func (n *Node) save() error {
 		Config: n.Config,
 	}
 
+	if n.Wallet != nil {
+		data.WalletAddress = n.Wallet.GetAddress()
+	}
+
 	err := localStorage.Set("state", data)
 	if err != nil {
 		return fmt.Errorf("error saving node state: %w", err)
@@ -214,12 +335,75 @@ func (n *Node) load() error {
 	}
 
 	n.ID = data.ID
-	n.Config = data.Config
+	if data.Config != nil {
+		n.Config = data.Config
+	}
+	n.walletPassphrase = data.WalletPassphrase
+
+	if data.WalletAddress != "" {
+		n.Wallet = &Wallet{Address: data.WalletAddress}
+	}
 
 	log.Printf("Loaded node state: %s\n", n.ID)
 	return nil
 }
 
+// initWallet opens the persisted node wallet, or creates one for a new node. The wallet is stored encrypted with the
+// passphrase in NodeWalletPassphraseEnv, so the node keeps the same address across restarts without the
+// passphrase ever being written to disk.
+func (n *Node) initWallet() error {
+	passphrase := getEnv(NodeWalletPassphraseEnv, "")
+
+	if n.Wallet != nil {
+		if passphrase == "" && n.walletPassphrase != "" {
+			return fmt.Errorf("the node wallet passphrase is no longer saved in node.json, set %s to its WalletPassphrase to migrate it",
+				NodeWalletPassphraseEnv)
+		}
+		if passphrase == "" {
+			return fmt.Errorf("%s must be set to open the node wallet", NodeWalletPassphraseEnv)
+		}
+
+		err := n.Wallet.Open(passphrase)
+		if err != nil {
+			return fmt.Errorf("error opening node wallet: %w", err)
+		}
+		n.PublicKey = n.Wallet.PublicPEM()
+		n.walletPassphrase = ""
+		log.Printf("Opened node wallet: %s\n", n.Wallet.GetAddress())
+		return nil
+	}
+
+	if passphrase == "" {
+		return fmt.Errorf("%s must be set to create the node wallet", NodeWalletPassphraseEnv)
+	}
+
+	walletOptions := &WalletOptions{
+		OrganizationID: NewBigInt(1),
+		AppID:          NewBigInt(1),
+		UserID:         NewBigInt(1),
+		AssetID:        NewBigInt(1),
+		Name:           "NodeWallet",
+		Passphrase:     passphrase,
+		Tags:           []string{"node", "wallet"},
+	}
+
+	// NewWallet saves the wallet to disk encrypted, so it has to be opened before use
+	wallet, err := n.Blockchain.NewWallet(walletOptions)
+	if err != nil {
+		return fmt.Errorf("error creating node wallet: %w", err)
+	}
+
+	err = wallet.Open(passphrase)
+	if err != nil {
+		return fmt.Errorf("error opening node wallet: %w", err)
+	}
+
+	n.Wallet = wallet
+	n.PublicKey = wallet.PublicPEM()
+	log.Printf("Created node wallet: %s\n", wallet.GetAddress())
+	return nil
+}
+
 // Run runs the node.
 func (n *Node) Run() {
 	log.Println("Starting node...")
@@ -242,8 +426,66 @@ func (n *Node) Run() {
 	}
 }
 
+// Cleanup performs a structured shutdown of the node. The API and P2P network are stopped, then the
+// blockchain and node state are flushed to disk. Every step is attempted and all errors are returned together.
+func (n *Node) Cleanup() error {
+	log.Println("Shutting down node...")
+	var errs []error
+
+	if n.API != nil {
+		if err := n.API.Stop(); err != nil {
+			errs = append(errs, fmt.Errorf("error stopping API: %w", err))
+		}
+	}
+
+	if n.P2P != nil && n.P2P.IsRunning() {
+		if err := n.P2P.Stop(); err != nil {
+			errs = append(errs, fmt.Errorf("error stopping P2P network: %w", err))
+		}
+	}
+
+	if n.Blockchain != nil {
+		if err := n.Blockchain.Cleanup(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := n.save(); err != nil {
+		errs = append(errs, err)
+	}
+
+	log.Println("Node shutdown complete")
+
+	if err := n.closeLogFile(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// closeLogFile sends logging back to the console and closes the log file, if the node logs to one.
+func (n *Node) closeLogFile() error {
+	if n.logFile == nil {
+		return nil
+	}
+
+	log.SetOutput(os.Stderr)
+	err := n.logFile.Close()
+	n.logFile = nil
+	if err != nil {
+		return fmt.Errorf("error closing log file: %w", err)
+	}
+	return nil
+}
+
 // ProcessP2PTransaction processes a P2PTransaction received from the P2P network.
 func (n *Node) ProcessP2PTransaction(tx P2PTransaction) error {
+	// Gossiped transactions are handled without the node lock, as accepting one gossips it onwards and
+	// the gossip may reach this node again before the call returns
+	if tx.Action == "tx" {
+		return n.receiveTransaction(tx)
+	}
+
 	n.Lock()
 	defer n.Unlock()
 
@@ -316,16 +558,17 @@ func (n *Node) Register() error {
 }
 
 func (n *Node) validateTransaction(tx P2PTransaction) error {
-	isValid, err := tx.Tx.Verify([]byte(tx.Tx.From.PublicPEM()), tx.Tx.GetSignature())
+	// The key must belong to the sender and the ID match the content, not just the signature check out
+	err := n.Blockchain.VerifySignature(&tx.Tx)
 	if err != nil {
-		return fmt.Errorf("error validating transaction: %w", err)
+		log.Printf("Transaction %s is invalid: %v\n", tx.ID, err)
+		return nil
 	}
 
-	if isValid {
-		log.Printf("Transaction %s is valid\n", tx.ID)
-		n.Blockchain.AddTransaction(&tx.Tx)
-	} else {
-		log.Printf("Transaction %s is invalid\n", tx.ID)
+	log.Printf("Transaction %s is valid\n", tx.ID)
+	err = n.Blockchain.AddTransaction(&tx.Tx)
+	if err != nil {
+		return fmt.Errorf("error queuing transaction: %w", err)
 	}
 
 	return nil
@@ -342,14 +585,7 @@ func (n *Node) updateStatus(tx P2PTransaction) error {
 		return fmt.Errorf("error unmarshaling node status: %w", err)
 	}
 
-	if node, exists := n.P2P.nodes[status.NodeID]; exists {
-		node.LastSeen = time.Now()
-		node.Status = status.Status
-		log.Printf("Updated status of node %s: %s\n", status.NodeID, status.Status)
-		return nil
-	}
-
-	return fmt.Errorf("node %s not found in the network", status.NodeID)
+	return n.P2P.setNodeStatus(status)
 }
 
 func (n *Node) addNode(tx P2PTransaction) error {
@@ -2,6 +2,8 @@ package sdk
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -11,7 +13,7 @@ import (
 
 func TestNewNode(t *testing.T) {
 	t.Run("with default options", func(t *testing.T) {
-		err := NewNode(nil)
+		_, err := NewNode(nil)
 		assert.NoError(t, err)
 		assert.NotNil(t, node)
 		assert.True(t, node.IsReady())
@@ -29,7 +31,7 @@ func TestNewNode(t *testing.T) {
 			DataPath: "./test_data",
 			Config:   NewConfig(),
 		}
-		err := NewNode(opts)
+		_, err := NewNode(opts)
 		assert.NoError(t, err)
 		assert.NotNil(t, node)
 		assert.True(t, node.IsReady())
@@ -37,6 +39,111 @@ func TestNewNode(t *testing.T) {
 	})
 }
 
+// startTestNode creates a node from dataPath as if the process had just started. A node left by an earlier
+// call is shut down first, and the node is reset when the test completes.
+func startTestNode(t *testing.T, dataPath string) *Node {
+	t.Helper()
+
+	require.NoError(t, ResetNode())
+	t.Cleanup(func() { assert.NoError(t, ResetNode()) })
+
+	// Seed an existing chain state so the node does not need to create new blockchain wallets
+	chainPath := filepath.Join(dataPath, "blockchain.json")
+	if !fileExists(chainPath) {
+		require.NoError(t, os.WriteFile(chainPath, []byte("{}"), 0644))
+	}
+
+	// The node wallet is created and reopened with the passphrase from the environment
+	t.Setenv(NodeWalletPassphraseEnv, testPassPhrase)
+
+	cfg := &Config{}
+	cfg.setDefaultValues()
+
+	n, err := NewNode(NewNodeOptions("test", dataPath, cfg))
+	require.NoError(t, err)
+	require.NotNil(t, n)
+	return n
+}
+
+func TestNewNodeThenGetNode(t *testing.T) {
+	created := startTestNode(t, t.TempDir())
+	assert.Same(t, created, GetNode())
+	assert.True(t, created.IsReady())
+	assert.NotEmpty(t, created.ID)
+
+	again, err := NewNode(NewNodeOptions("test", t.TempDir(), created.Config))
+	assert.ErrorIs(t, err, ErrNodeExists)
+	assert.Nil(t, again)
+	assert.Same(t, created, GetNode())
+}
+
+func TestResetNodeAllowsSequentialNodes(t *testing.T) {
+	first := startTestNode(t, t.TempDir())
+	firstPath := localStorage.dataPath
+
+	require.NoError(t, ResetNode())
+	assert.Nil(t, GetNode())
+	assert.False(t, LocalStorageAvailable())
+	assert.NoError(t, ResetNode(), "resetting without a node does nothing")
+
+	second := startTestNode(t, t.TempDir())
+	assert.Same(t, second, GetNode())
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.NotEqual(t, firstPath, localStorage.dataPath)
+
+	require.NoError(t, ResetNode())
+	assert.Nil(t, GetNode())
+}
+
+func TestNodeWalletPersistsAcrossRestarts(t *testing.T) {
+	dataPath := t.TempDir()
+
+	first := startTestNode(t, dataPath)
+	require.NotNil(t, first.Wallet)
+	address := first.Wallet.GetAddress()
+	assert.NotEmpty(t, address)
+	assert.False(t, first.Wallet.Encrypted)
+
+	restarted := startTestNode(t, dataPath)
+	require.NotNil(t, restarted.Wallet)
+	assert.Equal(t, address, restarted.Wallet.GetAddress())
+	assert.False(t, restarted.Wallet.Encrypted)
+	assert.NotEmpty(t, restarted.Wallet.PublicPEM())
+}
+
+func TestNodeIDPersistsAcrossRestarts(t *testing.T) {
+	dataPath := t.TempDir()
+
+	first := startTestNode(t, dataPath)
+	require.NotEmpty(t, first.ID)
+
+	restarted := startTestNode(t, dataPath)
+	assert.Equal(t, first.ID, restarted.ID)
+
+	// Peers track nodes by ID, so the restarted node must map to the existing entry
+	peers := NewP2P()
+	require.NoError(t, peers.RegisterNode(first))
+	assert.Error(t, peers.RegisterNode(restarted))
+	assert.Len(t, peers.nodes, 1)
+	assert.Error(t, peers.RegisterNode(&Node{}))
+}
+
+func TestNewNodeRejectsInvalidOptions(t *testing.T) {
+	previous := node
+	node = nil
+	t.Cleanup(func() { node = previous })
+
+	_, err := NewNode(&NodeOptions{})
+	assert.Error(t, err)
+
+	cfg := &Config{}
+	cfg.setDefaultValues()
+	cfg.BlockchainName = ""
+	_, err = NewNode(&NodeOptions{Config: cfg})
+	assert.Error(t, err)
+	assert.Nil(t, GetNode())
+}
+
 func TestDefaultNodeOptions(t *testing.T) {
 	opts := DefaultNodeOptions()
 	assert.NotNil(t, opts)
@@ -46,7 +153,7 @@ func TestDefaultNodeOptions(t *testing.T) {
 }
 
 func TestNodeIsReady(t *testing.T) {
-	err := NewNode(nil)
+	_, err := NewNode(nil)
 	require.NoError(t, err)
 	assert.True(t, node.IsReady())
 
@@ -55,7 +162,7 @@ func TestNodeIsReady(t *testing.T) {
 }
 
 func TestNodeSaveAndLoad(t *testing.T) {
-	err := NewNode(nil)
+	_, err := NewNode(nil)
 	require.NoError(t, err)
 
 	originalID := node.ID
@@ -74,7 +181,7 @@ func TestNodeSaveAndLoad(t *testing.T) {
 }
 
 func TestNodeRun(t *testing.T) {
-	err := NewNode(nil)
+	_, err := NewNode(nil)
 	require.NoError(t, err)
 
 	// This is a bit tricky to test as it runs indefinitely
@@ -93,7 +200,7 @@ func TestNodeRun(t *testing.T) {
 }
 
 func TestNodeProcessP2PTransaction(t *testing.T) {
-	err := NewNode(nil)
+	_, err := NewNode(nil)
 	require.NoError(t, err)
 
 	testCases := []struct {
@@ -176,7 +283,7 @@ func TestNodeProcessP2PTransaction(t *testing.T) {
 }
 
 func TestNodeRegister(t *testing.T) {
-	err := NewNode(nil)
+	_, err := NewNode(nil)
 	require.NoError(t, err)
 
 	err = node.Register()
@@ -187,7 +294,7 @@ func TestNodeRegister(t *testing.T) {
 }
 
 func TestNodeValidateTransaction(t *testing.T) {
-	err := NewNode(nil)
+	_, err := NewNode(nil)
 	require.NoError(t, err)
 
 	// Create a valid transaction
@@ -211,7 +318,7 @@ func TestNodeValidateTransaction(t *testing.T) {
 }
 
 func TestNodeUpdateStatus(t *testing.T) {
-	err := NewNode(nil)
+	_, err := NewNode(nil)
 	require.NoError(t, err)
 
 	// Add a test node to the P2P network
@@ -237,7 +344,7 @@ func TestNodeUpdateStatus(t *testing.T) {
 }
 
 func TestNodeAddAndRemoveNode(t *testing.T) {
-	err := NewNode(nil)
+	_, err := NewNode(nil)
 	require.NoError(t, err)
 
 	newNode := Node{ID: "test"}
@@ -267,7 +374,7 @@ func TestNodeAddAndRemoveNode(t *testing.T) {
 }
 
 func TestNodeRegisterNode(t *testing.T) {
-	err := NewNode(nil)
+	_, err := NewNode(nil)
 	require.NoError(t, err)
 
 	newNode := Node{ID: "test"}
@@ -294,3 +401,27 @@ func TestGenerateRandomPassphrase(t *testing.T) {
 	passphrase := generateRandomPassphrase()
 	assert.Len(t, passphrase, 64) // 32 bytes in hex format
 }
+
+func TestNodeStateOmitsWalletPassphrase(t *testing.T) {
+	dataPath := useTestStorage(t)
+	t.Setenv(NodeWalletPassphraseEnv, "")
+
+	cfg := NewConfig()
+	n := &Node{ID: "test-node", Config: cfg, Wallet: &Wallet{Address: testAddr}, walletPassphrase: testPassPhrase}
+	require.NoError(t, n.save())
+
+	data, err := os.ReadFile(filepath.Join(dataPath, "node.json"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "WalletPassphrase")
+	assert.NotContains(t, string(data), testPassPhrase)
+
+	// A passphrase saved by an older version is still read, but only to tell the operator how to migrate it
+	legacy := &NodePersistData{ID: n.ID, Config: cfg, WalletAddress: testAddr, WalletPassphrase: testPassPhrase}
+	require.NoError(t, localStorage.Set("state", legacy))
+
+	loaded := &Node{}
+	require.NoError(t, loaded.load())
+	err = loaded.initWallet()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), NodeWalletPassphraseEnv)
+}
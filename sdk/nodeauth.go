@@ -0,0 +1,207 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/nodeauth.go - Authentication of peers on the consensus endpoints
+package sdk
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers a peer authenticates its consensus requests with. A request carries either the shared node token, or
+// the peer's node ID, a timestamp, a nonce and a signature of the request made with the key of its node wallet.
+const (
+	NodeIDHeader        = "X-Node-ID"
+	NodeTimestampHeader = "X-Node-Timestamp"
+	NodeNonceHeader     = "X-Node-Nonce"
+	NodeSignatureHeader = "X-Node-Signature"
+	NodeTokenHeader     = "X-Node-Token"
+)
+
+// ErrNodeNotAuthenticated is returned when a consensus request does not prove it comes from a known peer.
+var ErrNodeNotAuthenticated = errors.New("node not authenticated")
+
+// nodeNonces remembers the nonces of the signed requests accepted recently, so none of them can be replayed.
+var nodeNonces = &nonceCache{seen: make(map[string]time.Time)}
+
+// nonceCache records nonces until the timestamps they were sent with are too old to be accepted anyway.
+type nonceCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// add records the nonce of the node and returns false if it was already recorded. Expired nonces are dropped.
+func (c *nonceCache) add(nodeID, nonce string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, expires := range c.seen {
+		if now.After(expires) {
+			delete(c.seen, key)
+		}
+	}
+
+	key := nodeID + "\n" + nonce
+	if _, ok := c.seen[key]; ok {
+		return false
+	}
+	// A timestamp is accepted up to nodeAuthMaxSkewInSec either side of the clock, so a nonce must be kept as long
+	c.seen[key] = now.Add(2 * nodeAuthMaxSkewInSec * time.Second)
+	return true
+}
+
+// nodeAuthChallenge returns the message a peer signs for a request: the method, path, Unix timestamp, nonce and
+// the SHA-256 hash of the body, one per line. The timestamp limits how long a request is accepted, and the nonce
+// makes sure it is only accepted once.
+func nodeAuthChallenge(method, path, timestamp, nonce string, body []byte) []byte {
+	hash := sha256.Sum256(body)
+	return []byte(method + "\n" + path + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(hash[:]))
+}
+
+// SignNodeRequest signs a consensus request with the private key of the node wallet, setting the headers the
+// receiving node authenticates it with. The body is read and replaced, so the request can still be sent.
+func SignNodeRequest(r *http.Request, nodeID string, key *ecdsa.PrivateKey) error {
+	body, err := readRequestBody(r)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := generateRandomToken()
+	hash := sha256.Sum256(nodeAuthChallenge(r.Method, r.URL.Path, timestamp, nonce, body))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		return fmt.Errorf("error signing request: %w", err)
+	}
+
+	r.Header.Set(NodeIDHeader, nodeID)
+	r.Header.Set(NodeTimestampHeader, timestamp)
+	r.Header.Set(NodeNonceHeader, nonce)
+	r.Header.Set(NodeSignatureHeader, base64.StdEncoding.EncodeToString(signature))
+	return nil
+}
+
+// authenticateNode only lets requests from authenticated peers through to the consensus endpoints.
+func authenticateNode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := verifyNodeRequest(r)
+		if err != nil {
+			log.Printf("Refused consensus request from %s: %v\n", GetUserIP(r), err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// verifyNodeRequest checks that a consensus request comes from a known peer. A request with a node token must
+// match the token configured on this node. Otherwise it must be signed by a registered peer, whose public key
+// was sent when it registered and belongs to one of Config.TrustedPeers, within nodeAuthMaxSkewInSec of this
+// node's clock and with a nonce that has not been used before.
+func verifyNodeRequest(r *http.Request) error {
+	n := GetNode()
+	if n == nil || n.P2P == nil {
+		return fmt.Errorf("%w: node not initialized", ErrNodeNotAuthenticated)
+	}
+
+	if token := r.Header.Get(NodeTokenHeader); token != "" {
+		if n.Config == nil || n.Config.NodeToken == "" ||
+			subtle.ConstantTimeCompare([]byte(token), []byte(n.Config.NodeToken)) != 1 {
+			return fmt.Errorf("%w: invalid node token", ErrNodeNotAuthenticated)
+		}
+		return nil
+	}
+
+	nodeID := r.Header.Get(NodeIDHeader)
+	timestamp := r.Header.Get(NodeTimestampHeader)
+	nonce := r.Header.Get(NodeNonceHeader)
+	signature, err := base64.StdEncoding.DecodeString(r.Header.Get(NodeSignatureHeader))
+	if nodeID == "" || timestamp == "" || nonce == "" || err != nil || len(signature) == 0 {
+		return fmt.Errorf("%w: missing or malformed signature", ErrNodeNotAuthenticated)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp", ErrNodeNotAuthenticated)
+	}
+	skew := time.Since(time.Unix(seconds, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > nodeAuthMaxSkewInSec*time.Second {
+		return fmt.Errorf("%w: timestamp is %v from this node's clock", ErrNodeNotAuthenticated, skew.Round(time.Second))
+	}
+
+	key, err := n.P2P.PeerPublicKey(nodeID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNodeNotAuthenticated, err)
+	}
+
+	// Anyone can register a node with a key of their own, so the key must be one this node was told to trust
+	if n.Config == nil || !trustedPeerKey(n.Config.TrustedPeers, key) {
+		return fmt.Errorf("%w: node %s is not a trusted peer", ErrNodeNotAuthenticated, nodeID)
+	}
+
+	body, err := readRequestBody(r)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(nodeAuthChallenge(r.Method, r.URL.Path, timestamp, nonce, body))
+	if !ecdsa.VerifyASN1(key, hash[:], signature) {
+		return fmt.Errorf("%w: invalid signature from node %s", ErrNodeNotAuthenticated, nodeID)
+	}
+
+	if !nodeNonces.add(nodeID, nonce, time.Now()) {
+		return fmt.Errorf("%w: replayed request from node %s", ErrNodeNotAuthenticated, nodeID)
+	}
+
+	return nil
+}
+
+// trustedPeerKey returns true if the public key belongs to one of the trusted node wallet addresses.
+func trustedPeerKey(trusted []string, key *ecdsa.PublicKey) bool {
+	der, err := marshalPKIXPublicKey(key)
+	if err != nil {
+		return false
+	}
+	hash := sha256.Sum256(der)
+
+	for _, address := range trusted {
+		addressHash, err := DecodeAddress(address)
+		if err == nil && bytes.Equal(addressHash, hash[:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// readRequestBody reads the whole body of the request, up to maxP2PMessageSize bytes, and replaces it with a copy,
+// so it can be read again.
+func readRequestBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxP2PMessageSize))
+	r.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading request body: %w", err)
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
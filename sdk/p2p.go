@@ -1,23 +1,38 @@
 package sdk
 
 import (
-	"bufio"
+	"crypto/ecdsa"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/briandowns/spinner"
 )
 
+// ErrTooManyPeers is returned when a node tries to register once the peer limit has been reached.
+var ErrTooManyPeers = errors.New("maximum number of peers reached")
+
+// ErrNetworkMismatch is returned when a handshake is refused because the peer is on a different chain.
+var ErrNetworkMismatch = errors.New("peer is on a different network")
+
+// ErrInvalidPeerMessage is returned when a peer sends a message that can't be parsed or asks for something it should
+// not. Only these errors count as strikes against the peer, not the errors this node has answering valid messages.
+var ErrInvalidPeerMessage = errors.New("invalid P2P message")
+
 type NodeInfo struct {
-	ID      string `json:"id"`
-	Address string `json:"address"`
+	ID              string      `json:"id"`
+	Address         string      `json:"address"`
+	ProtocolVersion int         `json:"protocol_version,omitempty"` // Sent during the handshake, empty for legacy peers
+	PublicKey       string      `json:"public_key,omitempty"`       // PEM public key the node signs its consensus requests with
+	NetworkID       string      `json:"network_id,omitempty"`       // Chain the node is on, see Blockchain.NetworkID, empty for legacy peers
+	Status          *NodeStatus `json:"status,omitempty"`           // Last status the node broadcast, nil until it has sent one
 }
 
 // P2PTransactionState represents the current state of a P2P transaction
@@ -75,6 +90,26 @@ type P2P struct {
 	running    bool
 	isSeedNode bool
 	listener   net.Listener
+	timeout    time.Duration
+	wireFormat string               // Encoding used when sending blocks to peers
+	progress   ProgressIndicator    // Shown while discovering nodes
+	banned     map[string]time.Time // Banned peer IDs and addresses, mapped to when the ban expires
+	strikes    map[string]int       // Number of invalid messages received per peer
+	seen       *seenSet             // IDs of transactions already gossiped to peers
+	maxPeers   int                  // Most peers that may register, not counting this node
+	blockchain *Blockchain          // Chain that GET_BLOCKS requests are answered from
+
+	nodesVersion      uint64                // Version of the node list, incremented each time a node is registered
+	nodeVersions      map[string]uint64     // Version of the node list each node was registered at
+	discoveryVersions map[string]uint64     // Version of each peer's node list this node has discovered up to
+	statuses          map[string]NodeStatus // Last status broadcast by each peer
+}
+
+// NodeListDelta answers a "GET_NODES_SINCE <version>" request with the nodes registered after that version of
+// the node list, and the current version to ask from next time.
+type NodeListDelta struct {
+	Version uint64     `json:"version"`
+	Nodes   []NodeInfo `json:"nodes"`
 }
 
 // P2PTransaction represents a transaction to be processed.
@@ -89,29 +124,212 @@ type P2PTransaction struct {
 // NewP2P creates a new P2P network.
 func NewP2P() *P2P {
 	return &P2P{
-		nodes: make(map[string]*Node),
-		queue: []P2PTransaction{},
+		nodes:      make(map[string]*Node),
+		queue:      []P2PTransaction{},
+		timeout:    p2pTimeout * time.Second,
+		wireFormat: blockWireFormat,
+		progress:   NewProgressIndicator(false, os.Stdout),
+		banned:     make(map[string]time.Time),
+		strikes:    make(map[string]int),
+		seen:       newSeenSet(gossipSeenTTLInSec * time.Second),
+		maxPeers:   maxPeers,
+
+		nodeVersions:      make(map[string]uint64),
+		discoveryVersions: make(map[string]uint64),
+		statuses:          make(map[string]NodeStatus),
+	}
+}
+
+// SetTimeout sets the deadline used for P2P handshakes and requests. Non positive values are ignored.
+func (p *P2P) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.timeout = timeout
+}
+
+// SetBlockWireFormat sets the encoding used when sending blocks to peers.
+func (p *P2P) SetBlockWireFormat(format string) error {
+	format = strings.ToLower(format)
+	if format != BlockWireFormatBinary && format != BlockWireFormatJSON {
+		return fmt.Errorf("unknown block wire format: %s", format)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.wireFormat = format
+	return nil
+}
+
+// EncodeBlock encodes a block for transfer to peers using the configured wire format.
+func (p *P2P) EncodeBlock(b *Block) ([]byte, error) {
+	p.mutex.RLock()
+	format := p.wireFormat
+	p.mutex.RUnlock()
+
+	return EncodeBlock(b, format)
+}
+
+// DecodeBlock decodes a block received from a peer, in whichever wire format the peer used.
+func (p *P2P) DecodeBlock(data []byte) (*Block, error) {
+	return DecodeBlock(data)
+}
+
+// SetBlockchain sets the chain that GET_BLOCKS requests from peers are answered from.
+func (p *P2P) SetBlockchain(bc *Blockchain) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.blockchain = bc
+}
+
+// networkID returns the network ID of the chain set with SetBlockchain, or an empty string if none is set.
+func (p *P2P) networkID() string {
+	p.mutex.RLock()
+	bc := p.blockchain
+	p.mutex.RUnlock()
+
+	if bc == nil {
+		return ""
 	}
+	return bc.NetworkID()
+}
+
+// SetProgressIndicator sets the indicator shown while discovering nodes.
+func (p *P2P) SetProgressIndicator(progress ProgressIndicator) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.progress = progress
+}
+
+// SetMaxPeers sets the most peers that may register, not counting this node. Non positive values are ignored.
+func (p *P2P) SetMaxPeers(max int) {
+	if max <= 0 {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.maxPeers = max
+}
+
+// MaxPeers returns the most peers that may register, not counting this node.
+func (p *P2P) MaxPeers() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.maxPeers
+}
+
+// getTimeout returns the deadline used for P2P handshakes and requests.
+func (p *P2P) getTimeout() time.Duration {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.timeout
 }
 
 // RegisterNode registers a new node with the P2P network.
 func (p *P2P) RegisterNode(node *Node) error {
-	if node == nil {
+	if node == nil || node.ID == "" {
 		return errors.New("cannot register empty or invalid node")
 	}
 
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
+	if p.isBanned(node.ID) || (node.Config != nil && p.isBanned(node.Config.P2PHostName)) {
+		return fmt.Errorf("node is banned: %s", node.ID)
+	}
+
 	if _, exists := p.nodes[node.ID]; exists {
 		return fmt.Errorf("node already registered: %s", node.ID)
 	}
 
+	// This node always registers itself, only other peers count towards the limit
+	selfID := p.selfNodeID()
+	if node.ID != selfID && p.maxPeers > 0 && p.peerCount(selfID) >= p.maxPeers {
+		return fmt.Errorf("%w: %d", ErrTooManyPeers, p.maxPeers)
+	}
+
 	p.nodes[node.ID] = node
+	p.nodesVersion++
+	p.nodeVersions[node.ID] = p.nodesVersion
 	log.Printf("Registered node: %s\n", node.ID)
 	return nil
 }
 
+// BanPeer bans a peer, identified by node ID or address, for the given duration. A banned peer can not
+// register, connect to this node, or be used as a seed until the ban expires. Matching nodes are removed.
+func (p *P2P) BanPeer(id string, duration time.Duration) {
+	key := peerKey(id)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.banned[key] = time.Now().Add(duration)
+	delete(p.strikes, key)
+
+	for nodeID, node := range p.nodes {
+		if nodeID == key || (node.Config != nil && peerKey(node.Config.P2PHostName) == key) {
+			delete(p.nodes, nodeID)
+			delete(p.nodeVersions, nodeID)
+			delete(p.discoveryVersions, nodeID)
+			delete(p.statuses, nodeID)
+		}
+	}
+
+	log.Printf("Banned peer %s for %v\n", id, duration)
+}
+
+// IsBanned returns true if the peer, identified by node ID or address, is currently banned.
+func (p *P2P) IsBanned(id string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.isBanned(id)
+}
+
+// isBanned checks the ban list and forgets bans that have expired. The caller must hold p.mutex.
+func (p *P2P) isBanned(id string) bool {
+	key := peerKey(id)
+	until, exists := p.banned[key]
+	if !exists {
+		return false
+	}
+
+	if time.Now().After(until) {
+		delete(p.banned, key)
+		return false
+	}
+
+	return true
+}
+
+// strikePeer records that a peer sent invalid data, and bans the peer once it reaches maxPeerStrikes.
+func (p *P2P) strikePeer(id string) {
+	key := peerKey(id)
+
+	p.mutex.Lock()
+	p.strikes[key]++
+	strikes := p.strikes[key]
+	p.mutex.Unlock()
+
+	log.Printf("Peer %s sent invalid data (%d/%d)\n", id, strikes, maxPeerStrikes)
+	if strikes >= maxPeerStrikes {
+		p.BanPeer(id, peerBanTimeInSec*time.Second)
+	}
+}
+
+// peerKey normalizes a peer identifier for the ban list. Addresses are reduced to their host, so a peer
+// can not avoid a ban by connecting from another port.
+func peerKey(id string) string {
+	host, _, err := net.SplitHostPort(id)
+	if err != nil || host == "" {
+		return id
+	}
+	return host
+}
+
 // IsRegistered returns true if the given node is registered with the P2P network.
 func (p *P2P) IsRegistered(nodeID string) bool {
 	p.mutex.RLock()
@@ -271,7 +489,10 @@ func (p *P2P) runProcessQueue() {
 }
 
 func (p *P2P) runNodeDiscovery() {
-	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
+	p.mutex.RLock()
+	s := p.progress
+	p.mutex.RUnlock()
+
 	log.Println("Starting node discovery...")
 	s.Start()
 	defer s.Stop()
@@ -304,114 +525,208 @@ func (p *P2P) listenForConnections() {
 
 func (p *P2P) handleConnection(conn net.Conn) {
 	defer conn.Close()
-	log.Printf("New connection from %s", conn.RemoteAddr())
+
+	remote := conn.RemoteAddr().String()
+	if p.IsBanned(remote) {
+		log.Printf("Refused connection from banned peer %s", remote)
+		return
+	}
+	log.Printf("New connection from %s", remote)
 
 	// Perform handshake
-	err := p.performHandshake(conn)
+	pc, err := p.performHandshake(conn)
 	if err != nil {
 		log.Printf("Handshake failed: %v", err)
 		return
 	}
 
 	// Read and process messages
-	reader := bufio.NewReader(conn)
 	for {
-		message, err := reader.ReadString('\n')
+		message, err := pc.Receive()
 		if err != nil {
 			if err != io.EOF {
 				log.Printf("Error reading message: %v", err)
 			}
+			if errors.Is(err, ErrMessageTooLarge) {
+				p.strikePeer(remote)
+			}
 			break
 		}
 
 		// Process the message
-		err = p.processMessage(strings.TrimSpace(message), conn)
+		err = p.processMessage(string(message), pc)
 		if err != nil {
 			log.Printf("Error processing message: %v", err)
+			if errors.Is(err, ErrInvalidPeerMessage) {
+				p.strikePeer(remote)
+			}
 			break
 		}
 	}
 }
 
-func (p *P2P) performHandshake(conn net.Conn) error {
+// performHandshake runs the server side of the handshake. The peer's NodeInfo carries its protocol version,
+// and the confirmation tells it whether messages after the handshake are framed: "OK" keeps newline
+// delimited messages for legacy peers, "OK 2" switches both sides to length prefixed framing. A peer on a
+// different network is answered "REJECT network" instead.
+func (p *P2P) performHandshake(conn net.Conn) (*p2pConn, error) {
 	// Set a timeout for the handshake
-	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	conn.SetDeadline(time.Now().Add(p.getTimeout()))
 	defer conn.SetDeadline(time.Time{}) // Reset the deadline
 
 	// 1. Receive "HELLO" message
-	reader := bufio.NewReader(conn)
-	message, err := reader.ReadString('\n')
+	pc := newP2PConn(conn)
+	message, err := pc.readLine()
 	if err != nil {
-		return fmt.Errorf("failed to receive HELLO: %w", err)
+		return nil, fmt.Errorf("failed to receive HELLO: %w", err)
 	}
-	if strings.TrimSpace(message) != "HELLO" {
-		return fmt.Errorf("unexpected message: %s", message)
+	if string(message) != "HELLO" {
+		return nil, fmt.Errorf("unexpected message: %s", message)
 	}
 
 	// 2. Send "ACK" message
-	_, err = conn.Write([]byte("ACK\n"))
+	err = pc.Send([]byte("ACK"))
 	if err != nil {
-		return fmt.Errorf("failed to send ACK: %w", err)
+		return nil, fmt.Errorf("failed to send ACK: %w", err)
 	}
 
 	// 3. Receive node information
-	nodeInfoJSON, err := reader.ReadString('\n')
+	nodeInfoJSON, err := pc.readLine()
 	if err != nil {
-		return fmt.Errorf("failed to receive node info: %w", err)
+		return nil, fmt.Errorf("failed to receive node info: %w", err)
 	}
 
 	var nodeInfo NodeInfo
-	err = json.Unmarshal([]byte(nodeInfoJSON), &nodeInfo)
+	err = json.Unmarshal(nodeInfoJSON, &nodeInfo)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal node info: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal node info: %w", err)
 	}
 
-	// 4. Send confirmation
-	_, err = conn.Write([]byte("OK\n"))
-	if err != nil {
-		return fmt.Errorf("failed to send confirmation: %w", err)
+	// Refuse peers on another chain, legacy peers don't send a network ID
+	if networkID := p.networkID(); networkID != "" && nodeInfo.NetworkID != "" && nodeInfo.NetworkID != networkID {
+		pc.Send([]byte("REJECT network"))
+		return nil, fmt.Errorf("%w: node %s is on %s, not %s", ErrNetworkMismatch, nodeInfo.ID, nodeInfo.NetworkID, networkID)
 	}
 
-	// Register the new node
-	newNode := &Node{
-		ID:     nodeInfo.ID,
-		Config: &Config{P2PHostName: nodeInfo.Address},
+	// 4. Send confirmation, agreeing to framing if the peer supports it
+	confirmation := "OK"
+	if nodeInfo.ProtocolVersion >= P2PProtocolVersionFramed {
+		confirmation = fmt.Sprintf("OK %d", P2PProtocolVersionFramed)
 	}
-	err = p.RegisterNode(newNode)
+	err = pc.Send([]byte(confirmation))
 	if err != nil {
-		return fmt.Errorf("failed to register node: %w", err)
+		return nil, fmt.Errorf("failed to send confirmation: %w", err)
 	}
+	pc.framed = nodeInfo.ProtocolVersion >= P2PProtocolVersionFramed
 
-	return nil
+	// Register the new node. Known peers reconnect for every request, so they are not registered again.
+	if !p.IsRegistered(nodeInfo.ID) {
+		err = p.RegisterPeer(nodeInfo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register node: %w", err)
+		}
+	}
+
+	return pc, nil
 }
 
-func (p *P2P) processMessage(message string, conn net.Conn) error {
-	switch message {
-	case "GET_NODES":
-		return p.sendNodeList(conn)
-	default:
-		return p.processP2PTransaction(message)
+// RegisterPeer registers the peer described by info, as the handshake does for peers connecting over TCP.
+func (p *P2P) RegisterPeer(info NodeInfo) error {
+	if info.ID == "" || info.Address == "" {
+		return errors.New("node info must have an ID and address")
+	}
+
+	return p.RegisterNode(&Node{
+		ID:        info.ID,
+		Config:    &Config{P2PHostName: info.Address},
+		PublicKey: info.PublicKey,
+	})
+}
+
+// PeerPublicKey returns the public key a registered node signs its consensus requests with.
+func (p *P2P) PeerPublicKey(id string) (*ecdsa.PublicKey, error) {
+	p.mutex.RLock()
+	node, ok := p.nodes[id]
+	p.mutex.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("node not registered: %s", id)
+	}
+	if node.PublicKey == "" {
+		return nil, fmt.Errorf("node has no public key: %s", id)
 	}
+
+	block, _ := pem.Decode([]byte(node.PublicKey))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode public key of node %s", id)
+	}
+	return parsePKIXPublicKey(block.Bytes)
+}
+
+// NodeList returns the ID and address of every registered node, including this one.
+func (p *P2P) NodeList() []NodeInfo {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.nodeList()
 }
 
-func (p *P2P) sendNodeList(conn net.Conn) error {
+// GetPeers returns the ID, address and last broadcast status of every registered node other than this one.
+func (p *P2P) GetPeers() []NodeInfo {
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
 
+	selfID := p.selfNodeID()
+	var peers []NodeInfo
+	for _, info := range p.nodeList() {
+		if info.ID != selfID {
+			peers = append(peers, info)
+		}
+	}
+	return peers
+}
+
+// nodeList returns the ID and address of every registered node. The caller must hold p.mutex.
+func (p *P2P) nodeList() []NodeInfo {
 	var nodeList []NodeInfo
 	for _, node := range p.nodes {
-		nodeList = append(nodeList, NodeInfo{
-			ID:      node.ID,
-			Address: node.Config.P2PHostName,
-		})
+		address := ""
+		if node.Config != nil {
+			address = node.Config.P2PHostName
+		}
+		info := NodeInfo{
+			ID:        node.ID,
+			Address:   address,
+			PublicKey: node.PublicKey,
+		}
+		if status, ok := p.statuses[node.ID]; ok {
+			info.Status = &status
+		}
+		nodeList = append(nodeList, info)
 	}
+	return nodeList
+}
 
-	nodeListJSON, err := json.Marshal(nodeList)
+func (p *P2P) processMessage(message string, pc *p2pConn) error {
+	switch {
+	case message == "GET_NODES":
+		return p.sendNodeList(pc)
+	case strings.HasPrefix(message, "GET_NODES_SINCE "):
+		return p.sendNodeListDelta(message, pc)
+	case strings.HasPrefix(message, "GET_BLOCKS "):
+		return p.sendBlocks(message, pc)
+	default:
+		return p.processP2PTransaction(message)
+	}
+}
+
+func (p *P2P) sendNodeList(pc *p2pConn) error {
+	nodeListJSON, err := json.Marshal(p.NodeList())
 	if err != nil {
 		return fmt.Errorf("failed to marshal node list: %w", err)
 	}
 
-	_, err = conn.Write(append(nodeListJSON, '\n'))
+	err = pc.Send(nodeListJSON)
 	if err != nil {
 		return fmt.Errorf("failed to send node list: %w", err)
 	}
@@ -419,72 +734,209 @@ func (p *P2P) sendNodeList(conn net.Conn) error {
 	return nil
 }
 
+// sendNodeListDelta answers a "GET_NODES_SINCE <version>" request with the nodes registered after the version.
+// A version newer than this node's, such as one from before a restart, gets the full node list.
+func (p *P2P) sendNodeListDelta(message string, pc *p2pConn) error {
+	since, err := strconv.ParseUint(strings.TrimPrefix(message, "GET_NODES_SINCE "), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: GET_NODES_SINCE request %q", ErrInvalidPeerMessage, message)
+	}
+
+	p.mutex.RLock()
+	delta := NodeListDelta{Version: p.nodesVersion, Nodes: []NodeInfo{}}
+	for _, info := range p.nodeList() {
+		if since > p.nodesVersion || p.nodeVersions[info.ID] > since {
+			delta.Nodes = append(delta.Nodes, info)
+		}
+	}
+	p.mutex.RUnlock()
+
+	deltaJSON, err := json.Marshal(delta)
+	if err != nil {
+		return fmt.Errorf("failed to marshal node list: %w", err)
+	}
+
+	err = pc.Send(deltaJSON)
+	if err != nil {
+		return fmt.Errorf("failed to send node list: %w", err)
+	}
+
+	return nil
+}
+
+// sendBlocks answers a "GET_BLOCKS <from> <to>" request with a "BLOCKS <count>" message followed by a message for
+// each block in the range. Blocks are encoded in the configured wire format on framed connections, and as JSON for
+// legacy peers, whose newline delimited messages can't carry binary data.
+func (p *P2P) sendBlocks(message string, pc *p2pConn) error {
+	var from, to int64
+	_, err := fmt.Sscanf(message, "GET_BLOCKS %d %d", &from, &to)
+	if err != nil {
+		return fmt.Errorf("%w: GET_BLOCKS request: %v", ErrInvalidPeerMessage, err)
+	}
+	if from < 0 || to < from || to-from+1 > maxBlockStreamRange {
+		return fmt.Errorf("%w: GET_BLOCKS range %d to %d", ErrInvalidPeerMessage, from, to)
+	}
+
+	p.mutex.RLock()
+	bc := p.blockchain
+	p.mutex.RUnlock()
+	if bc == nil {
+		return errors.New("no blockchain to send blocks from")
+	}
+
+	blocks, err := bc.GetBlocks(from, to)
+	if err != nil {
+		return err
+	}
+
+	err = pc.Send([]byte(fmt.Sprintf("BLOCKS %d", len(blocks))))
+	if err != nil {
+		return fmt.Errorf("failed to send blocks: %w", err)
+	}
+
+	for _, block := range blocks {
+		var data []byte
+		if pc.framed {
+			data, err = p.EncodeBlock(block)
+		} else {
+			data, err = EncodeBlock(block, BlockWireFormatJSON)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode block %s: %w", block.Index.String(), err)
+		}
+
+		err = pc.Send(data)
+		if err != nil {
+			return fmt.Errorf("failed to send blocks: %w", err)
+		}
+	}
+
+	return nil
+}
+
 func (p *P2P) processP2PTransaction(message string) error {
 	var tx P2PTransaction
 	err := json.Unmarshal([]byte(message), &tx)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal P2P transaction: %w", err)
+		return fmt.Errorf("%w: failed to unmarshal P2P transaction: %v", ErrInvalidPeerMessage, err)
+	}
+
+	// Gossiped transactions go straight to the mempool, the other actions wait for ProcessQueue
+	if tx.Action == "tx" {
+		p.mutex.RLock()
+		bc := p.blockchain
+		p.mutex.RUnlock()
+
+		return receiveGossipedTransaction(bc, p, tx)
 	}
 
 	p.AddTransaction(tx)
 	return nil
 }
 
-func (p *P2P) discoverNodes() {
+// discoverNodes asks each peer for the nodes it has registered since the last discovery, and registers those
+// this node doesn't know yet. It returns the number of nodes it tried to register.
+func (p *P2P) discoverNodes() int {
 	p.mutex.RLock()
-	defer p.mutex.RUnlock()
+	selfID := p.selfNodeID()
+	var peers []*Node
+	for id, node := range p.nodes {
+		if id != selfID && node.Config != nil {
+			peers = append(peers, node)
+		}
+	}
+	p.mutex.RUnlock()
 
-	for _, node := range p.nodes {
-		if node.ID != p.nodes[p.getSelfNodeID()].ID {
-			newNodes, err := p.requestNodeList(node)
-			if err != nil {
-				log.Printf("Error requesting node list from %s: %v\n", node.ID, err)
+	attempts := 0
+	for _, peer := range peers {
+		newNodes, err := p.requestNodeList(peer)
+		if err != nil {
+			log.Printf("Error requesting node list from %s: %v\n", peer.ID, err)
+			continue
+		}
+
+		for _, newNode := range newNodes {
+			if newNode.ID == selfID || p.IsRegistered(newNode.ID) {
 				continue
 			}
 
-			for _, newNode := range newNodes {
-				if !p.IsRegistered(newNode.ID) {
-					err := p.RegisterNode(newNode)
-					if err != nil {
-						log.Printf("Error registering new node: %v\n", err)
-					} else {
-						log.Printf("Discovered new node: %s\n", newNode.ID)
-					}
-				}
+			attempts++
+			err := p.RegisterNode(newNode)
+			if err != nil {
+				log.Printf("Error registering new node: %v\n", err)
+			} else {
+				log.Printf("Discovered new node: %s\n", newNode.ID)
 			}
 		}
 	}
+
+	return attempts
 }
 
+// requestNodeList connects to the node and requests the nodes it registered since the last discovery.
 func (p *P2P) requestNodeList(node *Node) ([]*Node, error) {
-	conn, err := net.Dial("tcp", node.Config.P2PHostName)
+	conn, err := net.DialTimeout("tcp", node.Config.P2PHostName, p.getTimeout())
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to node: %w", err)
 	}
 	defer conn.Close()
 
-	_, err = conn.Write([]byte("GET_NODES\n"))
+	pc, err := p.performClientHandshake(conn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send GET_NODES request: %w", err)
+		return nil, fmt.Errorf("handshake failed: %w", err)
 	}
 
-	reader := bufio.NewReader(conn)
-	response, err := reader.ReadString('\n')
+	return p.requestNodeDelta(pc, node.ID)
+}
+
+// requestNodeDelta requests the nodes the peer registered after the version of its node list last discovered,
+// and remembers the peer's new version. Legacy peers don't know GET_NODES_SINCE, so they are asked for the full
+// node list with GET_NODES.
+func (p *P2P) requestNodeDelta(pc *p2pConn, peerID string) ([]*Node, error) {
+	// Set a timeout for the request
+	pc.SetDeadline(time.Now().Add(p.getTimeout()))
+	defer pc.SetDeadline(time.Time{}) // Reset the deadline
+
+	p.mutex.RLock()
+	since := p.discoveryVersions[peerID]
+	p.mutex.RUnlock()
+
+	request := "GET_NODES"
+	if pc.framed {
+		request = fmt.Sprintf("GET_NODES_SINCE %d", since)
+	}
+	err := pc.Send([]byte(request))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send %s request: %w", request, err)
+	}
+
+	response, err := pc.Receive()
 	if err != nil {
 		return nil, fmt.Errorf("failed to receive node list: %w", err)
 	}
 
-	var nodeInfoList []NodeInfo
-	err = json.Unmarshal([]byte(response), &nodeInfoList)
+	var delta NodeListDelta
+	if pc.framed {
+		err = json.Unmarshal(response, &delta)
+	} else {
+		err = json.Unmarshal(response, &delta.Nodes)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal node list: %w", err)
 	}
 
+	if pc.framed {
+		p.mutex.Lock()
+		p.discoveryVersions[peerID] = delta.Version
+		p.mutex.Unlock()
+	}
+
 	var nodes []*Node
-	for _, nodeInfo := range nodeInfoList {
+	for _, nodeInfo := range delta.Nodes {
 		nodes = append(nodes, &Node{
-			ID:     nodeInfo.ID,
-			Config: &Config{P2PHostName: nodeInfo.Address},
+			ID:        nodeInfo.ID,
+			Config:    &Config{P2PHostName: nodeInfo.Address},
+			PublicKey: nodeInfo.PublicKey,
 		})
 	}
 
@@ -506,16 +958,28 @@ func (p *P2P) updateNodeStatus(tx P2PTransaction) {
 		return
 	}
 
+	if err := p.setNodeStatus(status); err != nil {
+		log.Println(err)
+	}
+}
+
+// setNodeStatus records the status a registered node broadcast, so that GetPeers shows how far along its chain
+// and mempool are.
+func (p *P2P) setNodeStatus(status NodeStatus) error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	if node, exists := p.nodes[status.NodeID]; exists {
-		node.Status = status.Status
-		node.LastSeen = time.Now()
-		log.Printf("Updated status of node %s: %s\n", status.NodeID, status.Status)
-	} else {
-		log.Printf("Node %s not found in the network\n", status.NodeID)
+	node, exists := p.nodes[status.NodeID]
+	if !exists {
+		return fmt.Errorf("node %s not found in the network", status.NodeID)
 	}
+
+	node.Status = status.Status
+	node.LastSeen = time.Now()
+	p.statuses[status.NodeID] = status
+	log.Printf("Updated status of node %s: %s at height %d with %d pending transactions\n", status.NodeID, status.Status,
+		status.BlockHeight, status.MempoolSize)
+	return nil
 }
 
 func (p *P2P) addNode(tx P2PTransaction) {
@@ -547,6 +1011,7 @@ func (p *P2P) removeNode(tx P2PTransaction) {
 
 	if _, exists := p.nodes[nodeID]; exists {
 		delete(p.nodes, nodeID)
+		delete(p.statuses, nodeID)
 		log.Printf("Removed node from the network: %s\n", nodeID)
 	} else {
 		log.Printf("Node %s not found in the network\n", nodeID)
@@ -577,29 +1042,56 @@ func (p *P2P) registerNode(tx P2PTransaction) {
 	})
 }
 
+// BroadcastStatus sends the node's status, block height, mempool size and software version to its peers.
 func (p *P2P) BroadcastStatus(node *Node, status string) error {
-	nodeStatus := NodeStatus{
-		NodeID: node.ID,
-		Status: status,
-	}
-	statusData, err := json.Marshal(nodeStatus)
+	statusData, err := json.Marshal(node.CurrentStatus(status))
 	if err != nil {
 		return fmt.Errorf("error marshaling node status: %w", err)
 	}
 
-	tx, err := NewTransaction("p2p", node.Wallet, nil)
-	if err != nil {
-		return fmt.Errorf("error creating transaction: %w", err)
-	}
-
 	p2pTx := P2PTransaction{
-		Tx:     *tx,
+		Tx:     Tx{ID: NewPUIDEmpty(), Protocol: "p2p"},
 		Target: "all",
 		Action: "status",
 		Data:   statusData,
 	}
 
-	return p.Broadcast(p2pTx)
+	// Peers are sent to without holding the P2P lock, as recording the status takes it
+	for _, peer := range p.peers(node.ID) {
+		if err := peer.ProcessP2PTransaction(p2pTx); err != nil {
+			return fmt.Errorf("error broadcasting status to node %s: %w", peer.ID, err)
+		}
+	}
+	return nil
+}
+
+// IsSeedNode returns true if this node is a seed node.
+func (p *P2P) IsSeedNode() bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.isSeedNode
+}
+
+// PeerCount returns the number of known peers, excluding this node. The node is identified by selfID, or
+// by its P2P address when selfID is empty.
+func (p *P2P) PeerCount(selfID string) int {
+	if selfID == "" {
+		selfID = p.getSelfNodeID()
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.peerCount(selfID)
+}
+
+// peerCount returns the number of registered nodes other than selfID. The caller must hold p.mutex.
+func (p *P2P) peerCount(selfID string) int {
+	count := len(p.nodes)
+	if _, exists := p.nodes[selfID]; exists {
+		count--
+	}
+	return count
 }
 
 func (p *P2P) SetAsSeedNode() {
@@ -611,21 +1103,24 @@ func (p *P2P) SetAsSeedNode() {
 
 func (p *P2P) ConnectToSeedNode(address string) error {
 	log.Printf("Connecting to seed node at %s\n", address)
+	if p.IsBanned(address) {
+		return fmt.Errorf("seed node %s is banned", address)
+	}
 
-	conn, err := net.Dial("tcp", address)
+	conn, err := net.DialTimeout("tcp", address, p.getTimeout())
 	if err != nil {
 		return fmt.Errorf("failed to connect to seed node: %w", err)
 	}
 	defer conn.Close()
 
 	// Perform handshake
-	err = p.performClientHandshake(conn)
+	pc, err := p.performClientHandshake(conn)
 	if err != nil {
 		return fmt.Errorf("handshake failed: %w", err)
 	}
 
 	// Request node list
-	nodeList, err := p.requestNodeListFromSeed(conn)
+	nodeList, err := p.requestNodeListFromSeed(pc)
 	if err != nil {
 		return fmt.Errorf("failed to get node list from seed: %w", err)
 	}
@@ -647,77 +1142,106 @@ func (p *P2P) ConnectToSeedNode(address string) error {
 	return nil
 }
 
-func (p *P2P) performClientHandshake(conn net.Conn) error {
+// ConnectToSeedNodes tries each seed node in order until one connects and returns the address of that seed.
+// If none of the seeds can be reached the errors from every attempt are returned.
+func (p *P2P) ConnectToSeedNodes(addresses []string) (string, error) {
+	if len(addresses) == 0 {
+		return "", errors.New("no seed node addresses given")
+	}
+
+	var errs []error
+	for _, address := range addresses {
+		err := p.ConnectToSeedNode(address)
+		if err == nil {
+			return address, nil
+		}
+
+		log.Printf("Seed node %s unavailable: %v\n", address, err)
+		errs = append(errs, fmt.Errorf("%s: %w", address, err))
+	}
+
+	return "", errors.Join(errs...)
+}
+
+// performClientHandshake runs the client side of the handshake, offering P2PProtocolVersion in the NodeInfo.
+// Messages after the handshake are framed only if the peer confirms with "OK 2", a legacy peer answers "OK".
+func (p *P2P) performClientHandshake(conn net.Conn) (*p2pConn, error) {
 	// Set a timeout for the handshake
-	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	conn.SetDeadline(time.Now().Add(p.getTimeout()))
 	defer conn.SetDeadline(time.Time{}) // Reset the deadline
 
 	// 1. Send a "HELLO" message
-	_, err := conn.Write([]byte("HELLO\n"))
+	pc := newP2PConn(conn)
+	err := pc.Send([]byte("HELLO"))
 	if err != nil {
-		return fmt.Errorf("failed to send HELLO: %w", err)
+		return nil, fmt.Errorf("failed to send HELLO: %w", err)
 	}
 
 	// 2. Receive an "ACK" message
-	reader := bufio.NewReader(conn)
-	response, err := reader.ReadString('\n')
+	response, err := pc.readLine()
 	if err != nil {
-		return fmt.Errorf("failed to receive ACK: %w", err)
+		return nil, fmt.Errorf("failed to receive ACK: %w", err)
 	}
-	response = strings.TrimSpace(response)
-	if response != "ACK" {
-		return fmt.Errorf("unexpected response: %s", response)
+	if string(response) != "ACK" {
+		return nil, fmt.Errorf("unexpected response: %s", response)
 	}
 
 	// 3. Send node information
 	selfNode := p.nodes[p.getSelfNodeID()]
 	nodeInfo := NodeInfo{
-		ID:      selfNode.ID,
-		Address: selfNode.Config.P2PHostName,
+		ID:              selfNode.ID,
+		Address:         selfNode.Config.P2PHostName,
+		ProtocolVersion: P2PProtocolVersion,
+		PublicKey:       selfNode.PublicKey,
+		NetworkID:       p.networkID(),
 	}
 	nodeInfoJSON, err := json.Marshal(nodeInfo)
 	if err != nil {
-		return fmt.Errorf("failed to marshal node info: %w", err)
+		return nil, fmt.Errorf("failed to marshal node info: %w", err)
 	}
-	_, err = conn.Write(append(nodeInfoJSON, '\n'))
+	err = pc.Send(nodeInfoJSON)
 	if err != nil {
-		return fmt.Errorf("failed to send node info: %w", err)
+		return nil, fmt.Errorf("failed to send node info: %w", err)
 	}
 
 	// 4. Receive confirmation
-	response, err = reader.ReadString('\n')
+	response, err = pc.readLine()
 	if err != nil {
-		return fmt.Errorf("failed to receive confirmation: %w", err)
-	}
-	response = strings.TrimSpace(response)
-	if response != "OK" {
-		return fmt.Errorf("unexpected confirmation: %s", response)
+		return nil, fmt.Errorf("failed to receive confirmation: %w", err)
+	}
+	switch string(response) {
+	case "OK":
+	case fmt.Sprintf("OK %d", P2PProtocolVersionFramed):
+		pc.framed = true
+	case "REJECT network":
+		return nil, ErrNetworkMismatch
+	default:
+		return nil, fmt.Errorf("unexpected confirmation: %s", response)
 	}
 
-	return nil
+	return pc, nil
 }
 
-func (p *P2P) requestNodeListFromSeed(conn net.Conn) ([]NodeInfo, error) {
+func (p *P2P) requestNodeListFromSeed(pc *p2pConn) ([]NodeInfo, error) {
 	// Set a timeout for the request
-	conn.SetDeadline(time.Now().Add(10 * time.Second))
-	defer conn.SetDeadline(time.Time{}) // Reset the deadline
+	pc.SetDeadline(time.Now().Add(p.getTimeout()))
+	defer pc.SetDeadline(time.Time{}) // Reset the deadline
 
 	// 1. Send a "GET_NODES" message
-	_, err := conn.Write([]byte("GET_NODES\n"))
+	err := pc.Send([]byte("GET_NODES"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to send GET_NODES: %w", err)
 	}
 
 	// 2. Receive a list of node information
-	reader := bufio.NewReader(conn)
-	response, err := reader.ReadString('\n')
+	response, err := pc.Receive()
 	if err != nil {
 		return nil, fmt.Errorf("failed to receive node list: %w", err)
 	}
 
 	// 3. Parse and return the node list
 	var nodeList []NodeInfo
-	err = json.Unmarshal([]byte(response), &nodeList)
+	err = json.Unmarshal(response, &nodeList)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal node list: %w", err)
 	}
@@ -725,11 +1249,80 @@ func (p *P2P) requestNodeListFromSeed(conn net.Conn) ([]NodeInfo, error) {
 	return nodeList, nil
 }
 
+// RequestBlocks connects to the peer at address and requests the blocks from index from to index to, inclusive.
+func (p *P2P) RequestBlocks(address string, from, to int64) ([]*Block, error) {
+	conn, err := net.DialTimeout("tcp", address, p.getTimeout())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to node: %w", err)
+	}
+	defer conn.Close()
+
+	pc, err := p.performClientHandshake(conn)
+	if err != nil {
+		return nil, fmt.Errorf("handshake failed: %w", err)
+	}
+
+	return p.requestBlocks(pc, from, to)
+}
+
+func (p *P2P) requestBlocks(pc *p2pConn, from, to int64) ([]*Block, error) {
+	// Set a timeout for the request
+	pc.SetDeadline(time.Now().Add(p.getTimeout()))
+	defer pc.SetDeadline(time.Time{}) // Reset the deadline
+
+	// 1. Send a "GET_BLOCKS" message
+	err := pc.Send([]byte(fmt.Sprintf("GET_BLOCKS %d %d", from, to)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send GET_BLOCKS: %w", err)
+	}
+
+	// 2. Receive the number of blocks that follow
+	response, err := pc.Receive()
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive blocks: %w", err)
+	}
+
+	var count int64
+	_, err = fmt.Sscanf(string(response), "BLOCKS %d", &count)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected GET_BLOCKS response: %.40q", response)
+	}
+	if count < 0 || count > to-from+1 {
+		return nil, fmt.Errorf("peer sent %d blocks for a request of %d", count, to-from+1)
+	}
+
+	// 3. Receive each block, decoding it from whichever wire format the peer used as the concrete transaction
+	// types of its protocols
+	blocks := make([]*Block, 0, count)
+	for i := int64(0); i < count; i++ {
+		data, err := pc.Receive()
+		if err != nil {
+			return nil, fmt.Errorf("failed to receive blocks: %w", err)
+		}
+
+		block, err := p.DecodeBlock(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode block: %w", err)
+		}
+		if block.Index.Int64() != from+i {
+			return nil, fmt.Errorf("peer sent block %s for block %d", block.Index.String(), from+i)
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
+
 func (p *P2P) getSelfNodeID() string {
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
+	return p.selfNodeID()
+}
+
+// selfNodeID returns the ID of this node. The caller must hold p.mutex.
+func (p *P2P) selfNodeID() string {
 	for id, node := range p.nodes {
-		if node.Config.P2PHostName == p2pHostname {
+		if node.Config != nil && node.Config.P2PHostName == p2pHostname {
 			return id
 		}
 	}
@@ -1,11 +1,14 @@
 package sdk
 
 import (
+	"bufio"
 	"fmt"
+	"net"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewP2P(t *testing.T) {
@@ -241,3 +244,160 @@ func TestMax(t *testing.T) {
 	assert.Equal(t, 5, max(5, 3))
 	assert.Equal(t, 5, max(5, 5))
 }
+
+func TestHandshakeTimeoutWithSlowPeer(t *testing.T) {
+	p2p := NewP2P()
+	p2p.SetTimeout(200 * time.Millisecond)
+
+	// A peer that accepts the connection but never answers the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		<-release
+		conn.Close()
+	}()
+
+	start := time.Now()
+	err = p2p.ConnectToSeedNode(listener.Addr().String())
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	// The same applies to an inbound peer that never says HELLO
+	server, client := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+	go func() {
+		p2p.handleConnection(server)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("inbound handshake did not time out")
+	}
+
+	// The connection must be closed once the handshake has failed
+	_, err = client.Write([]byte("HELLO\n"))
+	assert.Error(t, err)
+}
+
+func TestBannedPeerIsRefused(t *testing.T) {
+	p2p := NewP2P()
+	p2p.SetTimeout(time.Second)
+
+	// Banning a registered node removes it and prevents it from registering again
+	require.NoError(t, p2p.RegisterNode(&Node{ID: "bad"}))
+	p2p.BanPeer("bad", time.Minute)
+	assert.False(t, p2p.IsRegistered("bad"))
+	assert.Error(t, p2p.RegisterNode(&Node{ID: "bad"}))
+
+	// Inbound connections from a banned address are closed without a handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		p2p.handleConnection(conn)
+	}()
+
+	p2p.BanPeer("127.0.0.1", time.Minute)
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	_, err = conn.Write([]byte("HELLO\n"))
+	require.NoError(t, err)
+	_, err = bufio.NewReader(conn).ReadString('\n')
+	assert.Error(t, err)
+
+	// Banned seed nodes are not contacted
+	assert.Error(t, p2p.ConnectToSeedNode(listener.Addr().String()))
+
+	// Bans expire
+	p2p.BanPeer("temporary", 10*time.Millisecond)
+	assert.True(t, p2p.IsBanned("temporary"))
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, p2p.IsBanned("temporary"))
+}
+
+func TestPeerBannedAfterRepeatedInvalidData(t *testing.T) {
+	p2p := NewP2P()
+
+	for i := 0; i < maxPeerStrikes-1; i++ {
+		p2p.strikePeer("10.0.0.1:5000")
+	}
+	assert.False(t, p2p.IsBanned("10.0.0.1:5000"))
+
+	p2p.strikePeer("10.0.0.1:5001")
+	assert.True(t, p2p.IsBanned("10.0.0.1:6000"))
+}
+
+func TestConnectToSeedNodesFallsBackToNextSeed(t *testing.T) {
+	// A seed that is down
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	downAddress := down.Addr().String()
+	down.Close()
+
+	// A seed that is up and knows about one other peer
+	seed := NewP2P()
+	seed.SetTimeout(time.Second)
+	require.NoError(t, seed.RegisterNode(&Node{ID: "peer", Config: &Config{P2PHostName: "10.0.0.2:8101"}}))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		seed.handleConnection(conn)
+	}()
+
+	p2p := NewP2P()
+	p2p.SetTimeout(time.Second)
+	require.NoError(t, p2p.RegisterNode(&Node{ID: "self", Config: &Config{P2PHostName: p2pHostname}}))
+
+	connected, err := p2p.ConnectToSeedNodes(ParseSeedAddresses(downAddress + ", " + listener.Addr().String()))
+	require.NoError(t, err)
+	assert.Equal(t, listener.Addr().String(), connected)
+	assert.True(t, p2p.IsRegistered("peer"))
+
+	_, err = p2p.ConnectToSeedNodes([]string{downAddress})
+	assert.Error(t, err)
+}
+
+func TestRegisterNodeEnforcesMaxPeers(t *testing.T) {
+	p2p := NewP2P()
+	p2p.SetMaxPeers(2)
+	assert.Equal(t, 2, p2p.MaxPeers())
+
+	// This node does not count towards the limit
+	require.NoError(t, p2p.RegisterNode(&Node{ID: "self", Config: &Config{P2PHostName: p2pHostname}}))
+	require.NoError(t, p2p.RegisterNode(&Node{ID: "peer-1"}))
+	require.NoError(t, p2p.RegisterNode(&Node{ID: "peer-2"}))
+
+	err := p2p.RegisterNode(&Node{ID: "peer-3"})
+	assert.ErrorIs(t, err, ErrTooManyPeers)
+	assert.False(t, p2p.IsRegistered("peer-3"))
+	assert.Equal(t, 2, p2p.PeerCount(""))
+
+	// A slot opens up once a peer is removed
+	p2p.BanPeer("peer-1", time.Minute)
+	assert.NoError(t, p2p.RegisterNode(&Node{ID: "peer-3"}))
+}
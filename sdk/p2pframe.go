@@ -0,0 +1,117 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/p2pframe.go - Length prefixed framing of P2P messages
+package sdk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// P2P protocol versions. Version 1 peers send newline delimited messages. From version 2 every message after
+// the handshake is framed as a 4 byte big-endian length followed by the payload, so payloads may contain
+// newlines. The handshake itself is always newline delimited so that version 1 peers can take part in it.
+const (
+	P2PProtocolVersionLegacy = 1
+	P2PProtocolVersionFramed = 2
+	P2PProtocolVersion       = P2PProtocolVersionFramed
+)
+
+// frameHeaderSize is the size in bytes of the length prefix of a framed message.
+const frameHeaderSize = 4
+
+// ErrMessageTooLarge is returned when a P2P message exceeds maxP2PMessageSize.
+var ErrMessageTooLarge = errors.New("P2P message too large")
+
+// writeFrame writes the payload prefixed with its length.
+func writeFrame(w io.Writer, payload []byte) error {
+	if len(payload) > maxP2PMessageSize {
+		return fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, len(payload))
+	}
+
+	_, err := w.Write(append(IntToBytes(len(payload)), payload...))
+	return err
+}
+
+// readFrame reads a single length prefixed payload. Payloads larger than maxP2PMessageSize are refused
+// before they are read.
+func readFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, frameHeaderSize)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header)
+	if size > maxP2PMessageSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, size)
+	}
+
+	payload := make([]byte, size)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// p2pConn sends and receives messages on a peer connection, using framing once both sides of the handshake
+// have agreed on P2PProtocolVersionFramed. The reader is kept for the life of the connection so no buffered
+// data is lost between the handshake and the messages that follow it.
+type p2pConn struct {
+	net.Conn
+	reader *bufio.Reader
+	framed bool
+}
+
+// newP2PConn wraps a connection that has not completed a handshake yet.
+func newP2PConn(conn net.Conn) *p2pConn {
+	return &p2pConn{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+// Send writes a message to the peer.
+func (c *p2pConn) Send(message []byte) error {
+	if c.framed {
+		return writeFrame(c.Conn, message)
+	}
+
+	if len(message) > maxP2PMessageSize {
+		return fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, len(message))
+	}
+	_, err := c.Conn.Write(append(message, '\n'))
+	return err
+}
+
+// Receive reads the next message from the peer.
+func (c *p2pConn) Receive() ([]byte, error) {
+	if c.framed {
+		return readFrame(c.reader)
+	}
+	return c.readLine()
+}
+
+// readLine reads a newline delimited message, used for the handshake and for legacy peers.
+func (c *p2pConn) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := c.reader.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+
+		line = append(line, chunk...)
+		if len(line) > maxP2PMessageSize {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrMessageTooLarge, maxP2PMessageSize)
+		}
+		if !isPrefix {
+			return []byte(strings.TrimSpace(string(line))), nil
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package sdk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameRoundTripMultiLineJSON(t *testing.T) {
+	payload, err := json.MarshalIndent(newTestBlock(t), "", "  ")
+	require.NoError(t, err)
+	require.Contains(t, string(payload), "\n")
+
+	var buf bytes.Buffer
+	require.NoError(t, writeFrame(&buf, payload))
+	require.NoError(t, writeFrame(&buf, []byte("GET_NODES")))
+
+	got, err := readFrame(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, payload, got)
+
+	got, err = readFrame(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "GET_NODES", string(got))
+}
+
+func TestFrameRejectsOversizedMessages(t *testing.T) {
+	assert.ErrorIs(t, writeFrame(&bytes.Buffer{}, make([]byte, maxP2PMessageSize+1)), ErrMessageTooLarge)
+
+	// The length is checked before the payload is read
+	buf := bytes.NewBuffer(IntToBytes(maxP2PMessageSize + 1))
+	_, err := readFrame(buf)
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+}
+
+func TestHandshakeNegotiatesFraming(t *testing.T) {
+	server := NewP2P()
+	client := NewP2P()
+	require.NoError(t, client.RegisterNode(&Node{ID: "client", Config: &Config{P2PHostName: p2pHostname}}))
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	type result struct {
+		pc  *p2pConn
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		pc, err := server.performHandshake(serverConn)
+		done <- result{pc, err}
+	}()
+
+	clientPC, err := client.performClientHandshake(clientConn)
+	require.NoError(t, err)
+	res := <-done
+	require.NoError(t, res.err)
+	assert.True(t, clientPC.framed)
+	assert.True(t, res.pc.framed)
+
+	payload := []byte("{\n  \"multi\": \"line\"\n}")
+	go clientPC.Send(payload)
+	got, err := res.pc.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, payload, got)
+}
+
+func TestHandshakeKeepsNewlinesForLegacyPeers(t *testing.T) {
+	server := NewP2P()
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	clientConn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	done := make(chan *p2pConn)
+	go func() {
+		pc, _ := server.performHandshake(serverConn)
+		done <- pc
+	}()
+
+	// A legacy peer sends no protocol version and expects a plain "OK"
+	reader := bufio.NewReader(clientConn)
+	_, err := clientConn.Write([]byte("HELLO\n"))
+	require.NoError(t, err)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "ACK\n", line)
+
+	_, err = clientConn.Write([]byte(`{"id":"legacy","address":"127.0.0.1:9999"}` + "\n"))
+	require.NoError(t, err)
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "OK\n", line)
+
+	pc := <-done
+	require.NotNil(t, pc)
+	assert.False(t, pc.framed)
+}
+
+func TestHandshakeRejectsOtherNetworks(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	server := NewP2P()
+	server.SetBlockchain(bc)
+
+	handshake := func(id, chainName string) (error, error) {
+		other := newTestBlockchain(t)
+		other.cfg.BlockchainName = chainName
+		client := NewP2P()
+		client.SetBlockchain(other)
+		require.NoError(t, client.RegisterNode(&Node{ID: id, Config: &Config{P2PHostName: p2pHostname}}))
+
+		serverConn, clientConn := net.Pipe()
+		defer serverConn.Close()
+		defer clientConn.Close()
+
+		done := make(chan error)
+		go func() {
+			_, err := server.performHandshake(serverConn)
+			done <- err
+		}()
+		_, err := client.performClientHandshake(clientConn)
+		return err, <-done
+	}
+
+	clientErr, serverErr := handshake("same-chain", bc.cfg.BlockchainName)
+	assert.NoError(t, clientErr)
+	assert.NoError(t, serverErr)
+	assert.True(t, server.IsRegistered("same-chain"))
+
+	// A node of another chain is refused, and told why
+	clientErr, serverErr = handshake("other-chain", "Testnet")
+	assert.ErrorIs(t, clientErr, ErrNetworkMismatch)
+	assert.ErrorIs(t, serverErr, ErrNetworkMismatch)
+	assert.False(t, server.IsRegistered("other-chain"))
+}
+
+func TestRequestBlocks(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+	require.NoError(t, bc.AddTransaction(newTestMessage(t, "requested")))
+	bc.createNewBlock(1)
+	bc.createNewBlock(1)
+
+	server := NewP2P()
+	server.SetBlockchain(bc)
+	client := NewP2P()
+	require.NoError(t, client.RegisterNode(&Node{ID: "client", Config: &Config{P2PHostName: p2pHostname}}))
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	go server.handleConnection(serverConn)
+
+	pc, err := client.performClientHandshake(clientConn)
+	require.NoError(t, err)
+
+	// The range is cut short at the latest block, and blocks are decoded from either wire format
+	for _, format := range []string{BlockWireFormatBinary, BlockWireFormatJSON} {
+		require.NoError(t, server.SetBlockWireFormat(format))
+
+		blocks, err := client.requestBlocks(pc, 1, 5)
+		require.NoError(t, err, format)
+		require.Len(t, blocks, 2, format)
+		assert.Equal(t, bc.Blocks[1].Hash, blocks[0].Hash, format)
+		assert.Equal(t, bc.Blocks[2].Hash, blocks[1].Hash, format)
+		require.Len(t, blocks[0].Transactions, 1, format)
+		assert.IsType(t, &Message{}, blocks[0].Transactions[0], format)
+	}
+
+	// A request for blocks the server doesn't have ends the connection, but is not held against the client
+	_, err = client.requestBlocks(pc, 9, 9)
+	assert.Error(t, err)
+	server.mutex.RLock()
+	assert.Zero(t, server.strikes[serverConn.RemoteAddr().String()])
+	server.mutex.RUnlock()
+}
+
+func TestOnlyInvalidMessagesStrikePeers(t *testing.T) {
+	server := NewP2P()
+	pc := newP2PConn(nil)
+
+	for _, message := range []string{"GET_NODES_SINCE latest", "GET_BLOCKS one two", "GET_BLOCKS 5 1", "not a transaction"} {
+		assert.ErrorIs(t, server.processMessage(message, pc), ErrInvalidPeerMessage, message)
+	}
+
+	// Having no blockchain to answer from is this node's problem, not the peer's
+	err := server.processMessage("GET_BLOCKS 0 1", pc)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidPeerMessage)
+}
+
+func TestDiscoverNodesOnlyRegistersNewPeers(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	server := NewP2P()
+	server.SetTimeout(2 * time.Second)
+	require.NoError(t, server.RegisterNode(&Node{ID: "server", Config: &Config{P2PHostName: listener.Addr().String()}}))
+	// Port 1 refuses connections, so the peer found through the server fails fast when it is asked in turn
+	require.NoError(t, server.RegisterNode(&Node{ID: "third", Config: &Config{P2PHostName: "127.0.0.1:1"}}))
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.handleConnection(conn)
+		}
+	}()
+
+	client := NewP2P()
+	client.SetTimeout(2 * time.Second)
+	require.NoError(t, client.RegisterNode(&Node{ID: "client", Config: &Config{P2PHostName: p2pHostname}}))
+	require.NoError(t, client.RegisterNode(&Node{ID: "server", Config: &Config{P2PHostName: listener.Addr().String()}}))
+
+	// The first discovery registers the unknown peer, skipping this node and the server
+	assert.Equal(t, 1, client.discoverNodes())
+	assert.True(t, client.IsRegistered("third"))
+
+	// Nothing has changed, so the server sends no nodes and none are registered
+	assert.Equal(t, 0, client.discoverNodes())
+	assert.Equal(t, 0, client.discoverNodes())
+	assert.True(t, server.IsRegistered("client"))
+
+	// Only nodes the server registers later are sent
+	require.NoError(t, server.RegisterNode(&Node{ID: "fourth", Config: &Config{P2PHostName: "127.0.0.1:1"}}))
+	assert.Equal(t, 1, client.discoverNodes())
+	assert.True(t, client.IsRegistered("fourth"))
+}
@@ -15,10 +15,13 @@ func NewPersistTransaction(from *Wallet, to *Wallet, fee float64, data map[strin
 		return nil, err
 	}
 
-	return &Persist{
+	persist := &Persist{
 		Tx:   *tx,
 		Data: data,
-	}, nil
+	}
+	persist.ID = persist.computeID(data)
+
+	return persist, nil
 }
 
 // Process processes the Persist transaction.
@@ -29,3 +32,8 @@ func (p *Persist) Process() string {
 	p.Status = "processed"
 	return "Persist transaction processed successfully"
 }
+
+// Size returns the size of the persist transaction in bytes, including its protocol specific fields.
+func (p *Persist) Size() int {
+	return serializedSize(p)
+}
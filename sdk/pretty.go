@@ -0,0 +1,99 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/pretty.go - Indented JSON responses for requests with ?pretty=true
+package sdk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// prettyIndent is the indentation of JSON responses to requests with ?pretty=true.
+const prettyIndent = "  "
+
+// prettyMiddleware indents the JSON response of any endpoint when the request has ?pretty=true, so that it can be
+// read when debugging with curl. Responses are compact otherwise, and other content types are never changed.
+func prettyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); !pretty {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		pw := &prettyWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(pw, r)
+		pw.finish()
+	})
+}
+
+// prettyWriter holds back a JSON response until the handler has finished, so that it can be indented.
+type prettyWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+	indent      bool
+	body        bytes.Buffer
+}
+
+// WriteHeader decides whether the response is indented, from its content type.
+func (pw *prettyWriter) WriteHeader(code int) {
+	if pw.wroteHeader {
+		return
+	}
+	pw.wroteHeader = true
+	pw.code = code
+
+	pw.indent = strings.HasPrefix(pw.Header().Get("Content-Type"), "application/json")
+	if !pw.indent {
+		pw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (pw *prettyWriter) Write(data []byte) (int, error) {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	if pw.indent {
+		return pw.body.Write(data)
+	}
+	return pw.ResponseWriter.Write(data)
+}
+
+// Flush sends a response that is not indented, such as a stream, to the client as it is written.
+func (pw *prettyWriter) Flush() {
+	if flusher, ok := pw.ResponseWriter.(http.Flusher); ok && !pw.indent {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets WebSocket handlers take over the connection through the wrapper.
+func (pw *prettyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := pw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// finish writes the indented response. A body that is not valid JSON is written unchanged.
+func (pw *prettyWriter) finish() {
+	if !pw.indent {
+		return
+	}
+
+	var indented bytes.Buffer
+	data := pw.body.Bytes()
+	if json.Indent(&indented, data, "", prettyIndent) == nil {
+		indented.WriteByte('\n')
+		data = indented.Bytes()
+	}
+
+	pw.Header().Del("Content-Length")
+	pw.ResponseWriter.WriteHeader(pw.code)
+	pw.ResponseWriter.Write(data)
+}
@@ -0,0 +1,50 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/processed.go - IDs of the transactions mined into the chain, persisted so they can't be replayed
+package sdk
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ErrAlreadyProcessed is returned when a transaction that has already been mined is submitted again. It wraps
+// ErrDuplicateTransaction.
+var ErrAlreadyProcessed = fmt.Errorf("%w: already processed", ErrDuplicateTransaction)
+
+// isProcessed returns true if the transaction has been mined into the chain. The caller must hold bc.mux.
+func (bc *Blockchain) isProcessed(id string) bool {
+	return bc.processed[id]
+}
+
+// markProcessed records the transactions of the blocks as mined. The caller must hold bc.mux.
+func (bc *Blockchain) markProcessed(blocks ...*Block) {
+	if bc.processed == nil {
+		bc.processed = make(map[string]bool)
+	}
+	for _, block := range blocks {
+		for _, tx := range block.Transactions {
+			bc.processed[tx.GetID()] = true
+		}
+	}
+}
+
+// unmarkProcessed forgets the transactions of blocks that have been removed from the chain, so that they may be
+// mined again. The caller must hold bc.mux.
+func (bc *Blockchain) unmarkProcessed(blocks ...*Block) {
+	for _, block := range blocks {
+		for _, tx := range block.Transactions {
+			delete(bc.processed, tx.GetID())
+		}
+	}
+}
+
+// processedIDs returns the IDs of the mined transactions in order, for the persisted chain state. The caller must
+// hold bc.mux.
+func (bc *Blockchain) processedIDs() []string {
+	ids := make([]string, 0, len(bc.processed))
+	for id := range bc.processed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,52 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/progress.go - Progress indicators for long running work
+package sdk
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/briandowns/spinner"
+)
+
+// ProgressIndicator shows that long running work is in progress.
+type ProgressIndicator interface {
+	Start()
+	Stop()
+}
+
+// noopProgress is a ProgressIndicator that does nothing. It is used when progress output is disabled so
+// callers never have to check for nil.
+type noopProgress struct{}
+
+// Start does nothing.
+func (noopProgress) Start() {}
+
+// Stop does nothing.
+func (noopProgress) Stop() {}
+
+// NewProgressIndicator returns a spinner that writes to w. A no-op indicator is returned when progress is
+// disabled or w is not a terminal, since the animation would corrupt redirected logs.
+func NewProgressIndicator(disabled bool, w io.Writer) ProgressIndicator {
+	if disabled || !isTerminal(w) {
+		return noopProgress{}
+	}
+
+	return spinner.New(spinner.CharSets[9], 100*time.Millisecond, spinner.WithWriter(w))
+}
+
+// isTerminal returns true if w is a character device, such as an interactive terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,24 @@
+package sdk
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressIndicatorDisabled(t *testing.T) {
+	for _, disabled := range []bool{true, false} {
+		// A buffer is not a terminal, so progress is never drawn into it
+		var out bytes.Buffer
+		progress := NewProgressIndicator(disabled, &out)
+		assert.IsType(t, noopProgress{}, progress)
+
+		progress.Start()
+		time.Sleep(250 * time.Millisecond)
+		progress.Stop()
+
+		assert.Empty(t, out.String())
+	}
+}
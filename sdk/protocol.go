@@ -0,0 +1,211 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/protocol.go - Registry of transaction protocols, including custom protocols added by SDK users
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ProtocolFactory returns a new, empty transaction of a protocol. Persisted and gossiped transactions are
+// decoded into the value it returns, so it must be a pointer to the protocol's concrete type.
+type ProtocolFactory func() Transaction
+
+// ProtocolRouter is called by AddTransaction with each transaction of its protocol before the transaction is
+// queued. Returning an error refuses the transaction.
+type ProtocolRouter func(bc *Blockchain, tx Transaction) error
+
+// ErrProtocolExists is returned by RegisterProtocol when the protocol ID is already registered.
+var ErrProtocolExists = errors.New("protocol already registered")
+
+// protocolEntry is a registered protocol.
+type protocolEntry struct {
+	factory ProtocolFactory
+	routers []ProtocolRouter
+	name    string // Human readable name, the ID for custom protocols
+	feeRule string // How the protocol's transactions are charged, senderPaysFee if empty
+}
+
+// senderPaysFee is the fee rule of protocols that don't describe their own.
+const senderPaysFee = "The sender pays the transaction fee"
+
+var (
+	protocols = map[string]*protocolEntry{
+		CoinbaseProtocolID: {
+			factory: func() Transaction { return &Coinbase{} },
+			name:    "Coinbase",
+			feeRule: "No fee, created by the miner of each block",
+		},
+		BankProtocolID: {
+			factory: func() Transaction { return &Bank{} },
+			name:    "Bank Transfer",
+			feeRule: "The sender pays the amount plus the transaction fee",
+		},
+		MessageProtocolID: {
+			factory: func() Transaction { return &Message{} },
+			name:    "Message",
+		},
+		PersistProtocolID: {
+			factory: func() Transaction { return &Persist{} },
+			name:    "Persisted Data",
+		},
+		ChainProtocolID: {
+			factory: func() Transaction { return &Tx{} },
+			name:    "Chain",
+		},
+		TokenProtocolID: {
+			factory: func() Transaction { return &Token{} },
+			routers: []ProtocolRouter{routeTokenTransaction},
+			name:    "Token Transfer",
+			feeRule: "The sender pays the transaction fee in coin, the tokens moved or minted are not charged",
+		},
+	}
+	protocolsMutex sync.RWMutex
+)
+
+// ProtocolInfo describes a registered protocol, so API clients can build its transactions.
+type ProtocolInfo struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	RequiredFields []string `json:"required_fields"` // JSON fields a transaction of the protocol must set
+	Fee            float64  `json:"fee"`             // Fee charged by default
+	MinFee         float64  `json:"min_fee"`         // Lowest fee accepted
+	FeeRule        string   `json:"fee_rule"`
+}
+
+// RegisterProtocol adds a custom transaction protocol. The transaction type should embed Tx, may implement
+// IDContent to include its own fields in the transaction ID, and should override Size to count its own fields.
+// Once registered, transactions of the protocol pass validation, are decoded into the factory's type when blocks
+// and the mempool are loaded, are passed to the routers when added to the blockchain, and can be queried by
+// protocol. Protocol IDs are not case sensitive.
+func RegisterProtocol(id string, factory ProtocolFactory, routers ...ProtocolRouter) error {
+	id = strings.ToUpper(strings.TrimSpace(id))
+	if id == "" {
+		return errors.New("protocol ID cannot be empty")
+	}
+	if factory == nil {
+		return fmt.Errorf("protocol %s needs a factory", id)
+	}
+
+	protocolsMutex.Lock()
+	defer protocolsMutex.Unlock()
+
+	if _, exists := protocols[id]; exists {
+		return fmt.Errorf("%w: %s", ErrProtocolExists, id)
+	}
+
+	protocols[id] = &protocolEntry{factory: factory, routers: routers, name: id}
+	return nil
+}
+
+// DescribeProtocols returns a description of every registered protocol, in the order of Protocols. The fees are
+// taken from the configuration, or the defaults if it is nil. The required fields are the sender and recipient,
+// followed by the fields the protocol's transaction type adds to Tx.
+func DescribeProtocols(cfg *Config) []ProtocolInfo {
+	fee, minFee := float64(transactionFee), float64(minTransactionFee)
+	if cfg != nil {
+		fee, minFee = cfg.TransactionFee, cfg.MinTransactionFee
+	}
+
+	ids := Protocols()
+	infos := make([]ProtocolInfo, 0, len(ids))
+	for _, id := range ids {
+		entry := lookupProtocol(id)
+		info := ProtocolInfo{
+			ID:             id,
+			Name:           entry.name,
+			RequiredFields: append([]string{"from", "to"}, protocolFields(entry.factory())...),
+			Fee:            fee,
+			MinFee:         minFee,
+			FeeRule:        entry.feeRule,
+		}
+		if info.FeeRule == "" {
+			info.FeeRule = senderPaysFee
+		}
+		if id == CoinbaseProtocolID {
+			info.Fee, info.MinFee = 0, 0
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// protocolFields returns the JSON names of the exported fields a transaction type adds to the embedded Tx.
+func protocolFields(tx Transaction) []string {
+	t := reflect.TypeOf(tx)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous || !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+// Protocols returns the IDs of every registered protocol, built in and custom, in alphabetical order.
+func Protocols() []string {
+	protocolsMutex.RLock()
+	defer protocolsMutex.RUnlock()
+
+	ids := make([]string, 0, len(protocols))
+	for id := range protocols {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// lookupProtocol returns the registered protocol with the given ID, or nil if there is none.
+func lookupProtocol(id string) *protocolEntry {
+	protocolsMutex.RLock()
+	defer protocolsMutex.RUnlock()
+
+	return protocols[strings.ToUpper(id)]
+}
+
+// newProtocolTransaction returns an empty transaction of the protocol's type, or a Tx if the protocol is not
+// registered.
+func newProtocolTransaction(id string) Transaction {
+	entry := lookupProtocol(id)
+	if entry == nil {
+		return &Tx{}
+	}
+	return entry.factory()
+}
+
+// routeTransaction passes the transaction to the routers registered for its protocol.
+func routeTransaction(bc *Blockchain, tx Transaction) error {
+	entry := lookupProtocol(tx.GetProtocol())
+	if entry == nil {
+		return nil
+	}
+
+	for _, route := range entry.routers {
+		err := route(bc, tx)
+		if err != nil {
+			return fmt.Errorf("%s protocol refused transaction %s: %w", tx.GetProtocol(), tx.GetID(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package sdk
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testVoteProtocolID = "VOTE"
+
+// testVote is a toy custom protocol recording a choice.
+type testVote struct {
+	Tx
+	Choice string `json:"choice"`
+}
+
+func (v *testVote) IDContent() interface{} {
+	return v.Choice
+}
+
+func TestRegisterProtocol(t *testing.T) {
+	useTestStorage(t)
+
+	var routed []string
+	router := func(bc *Blockchain, tx Transaction) error {
+		if tx.(*testVote).Choice == "" {
+			return errors.New("a vote needs a choice")
+		}
+		routed = append(routed, tx.GetID())
+		return nil
+	}
+
+	require.NoError(t, RegisterProtocol("vote", func() Transaction { return &testVote{} }, router))
+	t.Cleanup(func() {
+		protocolsMutex.Lock()
+		delete(protocols, testVoteProtocolID)
+		protocolsMutex.Unlock()
+	})
+	assert.ErrorIs(t, RegisterProtocol(testVoteProtocolID, func() Transaction { return &testVote{} }), ErrProtocolExists)
+	assert.Error(t, RegisterProtocol("", func() Transaction { return &testVote{} }))
+	assert.Contains(t, Protocols(), testVoteProtocolID)
+
+	from := &Wallet{Address: testAddr, ID: NewPUIDEmpty()}
+	to := &Wallet{Address: EncodeAddress(make([]byte, addressHashLength)), ID: NewPUIDEmpty()}
+	tx, err := NewTransaction(testVoteProtocolID, from, to)
+	require.NoError(t, err)
+
+	vote := &testVote{Tx: *tx, Choice: "yes"}
+	vote.ID, err = NewTransactionID(vote)
+	require.NoError(t, err)
+	require.NoError(t, vote.Validate())
+
+	// The choice is part of the ID
+	other := &testVote{Tx: *tx, Choice: "no"}
+	otherID, err := NewTransactionID(other)
+	require.NoError(t, err)
+	assert.NotEqual(t, vote.GetID(), otherID.String())
+
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	// Routers see the transaction before it is queued, and can refuse it
+	blank := &testVote{Tx: *tx}
+	assert.ErrorContains(t, bc.AddTransaction(blank), "a vote needs a choice")
+	require.NoError(t, bc.AddTransaction(vote))
+	assert.Equal(t, []string{vote.GetID()}, routed)
+
+	bc.createNewBlock(0)
+	require.Len(t, bc.Blocks, 2)
+	assert.NoError(t, bc.ValidateChain())
+
+	// The saved block decodes the vote back into its own type
+	saved, err := localStorage.GetBlock(1)
+	require.NoError(t, err)
+	require.Len(t, saved.Transactions, 1)
+	decoded, ok := saved.Transactions[0].(*testVote)
+	require.True(t, ok, "expected a *testVote, got %T", saved.Transactions[0])
+	assert.Equal(t, "yes", decoded.Choice)
+	assert.Equal(t, StatusConfirmed, decoded.GetStatus())
+
+	// The vote can be queried by protocol
+	api := NewAPI(bc)
+	rr := serveTestRequest(api, http.MethodGet, "/blockchain/transactions?protocol=vote")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var votes []map[string]interface{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &votes))
+	require.Len(t, votes, 1)
+	assert.Equal(t, vote.GetID(), votes[0]["id"])
+	assert.Equal(t, testVoteProtocolID, votes[0]["protocol"])
+
+	rr = serveTestRequest(api, http.MethodGet, "/blockchain/transactions?protocol=unknown")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestHandleProtocols(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	api := NewAPI(bc)
+
+	rec := serveTestRequest(api, http.MethodGet, "/blockchain/protocols")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var infos []ProtocolInfo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &infos))
+
+	byID := make(map[string]ProtocolInfo)
+	for _, info := range infos {
+		byID[info.ID] = info
+	}
+	assert.Len(t, infos, len(Protocols()))
+
+	bank, ok := byID[BankProtocolID]
+	require.True(t, ok)
+	assert.Equal(t, "Bank Transfer", bank.Name)
+	assert.Equal(t, []string{"from", "to", "Amount"}, bank.RequiredFields)
+	assert.Equal(t, bc.GetConfig().TransactionFee, bank.Fee)
+	assert.Equal(t, bc.GetConfig().MinTransactionFee, bank.MinFee)
+
+	message, ok := byID[MessageProtocolID]
+	require.True(t, ok)
+	assert.Equal(t, []string{"from", "to", "Message"}, message.RequiredFields)
+	assert.Equal(t, senderPaysFee, message.FeeRule)
+
+	assert.Zero(t, byID[CoinbaseProtocolID].Fee)
+}
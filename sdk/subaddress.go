@@ -0,0 +1,58 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/subaddress.go - Addresses of a wallet's sub-accounts, derived from its key
+package sdk
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"math/big"
+)
+
+// ErrInvalidAssetID is returned when a sub-address is derived for a missing or negative asset ID.
+var ErrInvalidAssetID = errors.New("asset ID must not be negative")
+
+// DeriveSubAddress returns the address of the wallet's sub-account for an asset or purpose. Like the non-hardened
+// children of an HD wallet, the sub-account key is the wallet key offset by a tweak computed from the wallet's
+// public key and the asset ID, so a wallet always derives the same address for an asset ID and a different one for
+// each asset ID. The wallet must be unlocked.
+func (w *Wallet) DeriveSubAddress(assetID *BigInt) (string, error) {
+	if assetID == nil || assetID.IsNegative() {
+		return "", ErrInvalidAssetID
+	}
+	if w.Encrypted {
+		return "", errors.New("cannot derive a sub-address from an encrypted wallet")
+	}
+	if w.vault == nil || w.vault.Key == nil {
+		return "", errors.New("private key is nil")
+	}
+
+	parent := &w.vault.Key.PublicKey
+	parentBytes, err := marshalPKIXPublicKey(parent)
+	if err != nil {
+		return "", err
+	}
+
+	// The tweak is the first half of an HMAC of the asset ID keyed with the parent public key, as a scalar of the curve
+	curve := parent.Curve
+	mac := hmac.New(sha512.New, parentBytes)
+	mac.Write(assetID.Bytes())
+	tweak := new(big.Int).SetBytes(mac.Sum(nil)[:32])
+	tweak.Mod(tweak, curve.Params().N)
+	if tweak.Sign() == 0 {
+		return "", errors.New("sub-address tweak is zero")
+	}
+
+	tweakX, tweakY := curve.ScalarBaseMult(tweak.Bytes())
+	childX, childY := curve.Add(parent.X, parent.Y, tweakX, tweakY)
+	childBytes, err := marshalPKIXPublicKey(&ecdsa.PublicKey{Curve: curve, X: childX, Y: childY})
+	if err != nil {
+		return "", err
+	}
+
+	// Sub-addresses are encoded like wallet addresses
+	hash := sha256.Sum256(childBytes)
+	return EncodeAddress(hash[:]), nil
+}
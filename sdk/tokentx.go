@@ -0,0 +1,289 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/tokentx.go - Token Transaction for issuing and transferring tokens separately from the native coin
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Token transaction errors, returned wrapped by NewTokenTransaction and when a token transaction is added.
+var (
+	ErrInvalidTokenID     = errors.New("token ID can't be empty")
+	ErrNotTokenIssuer     = errors.New("only the issuer of a token can mint it")
+	ErrInsufficientTokens = errors.New("insufficient token balance")
+)
+
+// Token is a transaction that mints or transfers units of a token issued on the chain. Tokens are held apart from
+// the native coin moved by Bank transactions: only the transaction fee is paid in coin. A mint creates Amount new
+// units for the recipient, and the first wallet to mint a token ID becomes its issuer, the only wallet allowed to
+// mint it again. A transfer moves Amount units from the sender to the recipient.
+type Token struct {
+	Tx
+	TokenID string
+	Amount  int64
+	Mint    bool
+}
+
+// tokenKey identifies the balance of a token held by an address.
+type tokenKey struct {
+	Address string
+	TokenID string
+}
+
+// NewTokenTransaction creates a new Token transaction moving, or minting when mint is set, amount units of the token
+// to the recipient. Both wallets must be set and have valid addresses, the token ID can't be empty and the amount
+// must be positive. Token balances are checked when the transaction is added to the blockchain.
+func NewTokenTransaction(from *Wallet, to *Wallet, tokenID string, amount int64, mint bool) (*Token, error) {
+	err := validateParties(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenID = strings.TrimSpace(tokenID)
+	if tokenID == "" {
+		return nil, ErrInvalidTokenID
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidAmount, amount)
+	}
+
+	tx, err := NewTransaction(TokenProtocolID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &Token{
+		Tx:      *tx,
+		TokenID: tokenID,
+		Amount:  amount,
+		Mint:    mint,
+	}
+	token.ID = token.computeID(token.IDContent())
+
+	return token, nil
+}
+
+// IDContent returns the token fields covered by the transaction ID.
+func (t *Token) IDContent() interface{} {
+	return struct {
+		TokenID string `json:"token_id"`
+		Amount  int64  `json:"amount"`
+		Mint    bool   `json:"mint"`
+	}{t.TokenID, t.Amount, t.Mint}
+}
+
+// Process returns a string describing the token transaction.
+func (t *Token) Process() string {
+	if t.Mint {
+		return fmt.Sprintf("Minted %d %s to %s", t.Amount, t.TokenID, t.To.GetAddress())
+	}
+	return fmt.Sprintf("Transferred %d %s from %s to %s", t.Amount, t.TokenID, t.From.GetAddress(), t.To.GetAddress())
+}
+
+// Size returns the size of the token transaction in bytes, including its protocol specific fields.
+func (t *Token) Size() int {
+	return serializedSize(t)
+}
+
+// tokenDeltas returns how much the transaction changes the token balances of each address, or nil if it is not a
+// token transaction.
+func tokenDeltas(tx Transaction) map[tokenKey]int64 {
+	token, ok := tx.(*Token)
+	if !ok || tx.GetProtocol() != TokenProtocolID || token.To == nil {
+		return nil
+	}
+
+	deltas := map[tokenKey]int64{}
+	if !token.Mint && token.From != nil {
+		deltas[tokenKey{token.From.GetAddress(), token.TokenID}] -= token.Amount
+	}
+	deltas[tokenKey{token.To.GetAddress(), token.TokenID}] += token.Amount
+	return deltas
+}
+
+// routeTokenTransaction refuses token transactions that could not be applied to the chain: mints by a wallet other
+// than the token's issuer, or than the sender of its first queued mint if it has not been minted yet, and
+// transfers of more units than the sender holds, counting its queued transfers.
+func routeTokenTransaction(bc *Blockchain, tx Transaction) error {
+	token, ok := tx.(*Token)
+	if !ok {
+		return fmt.Errorf("unexpected %s transaction type %T", TokenProtocolID, tx)
+	}
+	if token.TokenID == "" {
+		return ErrInvalidTokenID
+	}
+	if token.Amount <= 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidAmount, token.Amount)
+	}
+
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	sender := transactionSender(token)
+	if token.Mint {
+		issuer := bc.tokenIssuer(token.TokenID)
+		if issuer == "" {
+			issuer = queuedTokenIssuer(bc.TransactionQueue, token.TokenID)
+		}
+		if issuer != "" && issuer != sender {
+			return fmt.Errorf("%w: %s is issued by %s", ErrNotTokenIssuer, token.TokenID, issuer)
+		}
+		return nil
+	}
+
+	key := tokenKey{sender, token.TokenID}
+	available := bc.tokenBalance(key)
+	for _, queued := range bc.TransactionQueue {
+		available += tokenDeltas(queued)[key]
+	}
+	if available < token.Amount {
+		return fmt.Errorf("%w: %s holds %d %s", ErrInsufficientTokens, sender, available, token.TokenID)
+	}
+	return nil
+}
+
+// GetTokenBalance returns the number of units of the token held by the address. The token balance index is used
+// once the balance index has been built, otherwise the balance is calculated from every block.
+func (bc *Blockchain) GetTokenBalance(address string, tokenID string) int64 {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	return bc.tokenBalance(tokenKey{address, tokenID})
+}
+
+// GetTokenBalances returns every token held by the address, by token ID.
+func (bc *Blockchain) GetTokenBalances(address string) map[string]int64 {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	if bc.tokenBalances == nil {
+		bc.rebuildBalances()
+	}
+
+	balances := make(map[string]int64)
+	for key, balance := range bc.tokenBalances {
+		if key.Address == address && balance != 0 {
+			balances[key.TokenID] = balance
+		}
+	}
+	return balances
+}
+
+// TokenIssuer returns the address of the wallet that first minted the token, or an empty string if it has not been
+// minted.
+func (bc *Blockchain) TokenIssuer(tokenID string) string {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	return bc.tokenIssuer(tokenID)
+}
+
+// tokenIssuer returns the sender of the first mint of the token in the chain. The caller must hold bc.mux.
+func (bc *Blockchain) tokenIssuer(tokenID string) string {
+	return chainTokenIssuer(bc.Blocks, tokenID)
+}
+
+// chainTokenIssuer returns the sender of the first mint of the token in the blocks, or an empty string if there is
+// none.
+func chainTokenIssuer(blocks []*Block, tokenID string) string {
+	for _, block := range blocks {
+		for _, tx := range block.Transactions {
+			if token, ok := tx.(*Token); ok && token.Mint && token.TokenID == tokenID {
+				return transactionSender(token)
+			}
+		}
+	}
+	return ""
+}
+
+// queuedTokenIssuer returns the sender of the first mint of the token in the transactions, or an empty string if
+// there is none.
+func queuedTokenIssuer(txs []Transaction, tokenID string) string {
+	for _, tx := range txs {
+		if token, ok := tx.(*Token); ok && token.Mint && token.TokenID == tokenID {
+			return transactionSender(token)
+		}
+	}
+	return ""
+}
+
+// checkTokenMints returns an error wrapping ErrNotTokenIssuer if the block, following chain, mints a token from a
+// wallet other than its issuer. A token not yet minted in the chain is issued by the sender of its first mint in
+// the block.
+func checkTokenMints(chain []*Block, block *Block) error {
+	issuers := make(map[string]string)
+	for _, tx := range block.Transactions {
+		token, ok := tx.(*Token)
+		if !ok || !token.Mint {
+			continue
+		}
+
+		issuer, ok := issuers[token.TokenID]
+		if !ok {
+			issuer = chainTokenIssuer(chain, token.TokenID)
+			if issuer == "" {
+				issuer = transactionSender(token)
+			}
+			issuers[token.TokenID] = issuer
+		}
+		if sender := transactionSender(token); sender != issuer {
+			return fmt.Errorf("%w: %s minted %s in block %s, issued by %s", ErrNotTokenIssuer, sender, token.TokenID,
+				block.Index.String(), issuer)
+		}
+	}
+	return nil
+}
+
+// tokenBalance returns the token balance from the index, or replays every block if it has not been built. The
+// caller must hold bc.mux.
+func (bc *Blockchain) tokenBalance(key tokenKey) int64 {
+	if bc.tokenBalances != nil {
+		return bc.tokenBalances[key]
+	}
+
+	balance := int64(0)
+	for _, block := range bc.Blocks {
+		for _, tx := range block.Transactions {
+			balance += tokenDeltas(tx)[key]
+		}
+	}
+	return balance
+}
+
+// indexTokens applies the token transactions in the block to the token balance index, recording the changes so
+// that unindexTokens can undo them. The caller must hold bc.mux.
+func (bc *Blockchain) indexTokens(block *Block) {
+	if bc.tokenBalances == nil {
+		return
+	}
+
+	changes := make(map[tokenKey]int64)
+	for _, tx := range block.Transactions {
+		for key, delta := range tokenDeltas(tx) {
+			changes[key] += delta
+		}
+	}
+
+	for key, delta := range changes {
+		bc.tokenBalances[key] += delta
+	}
+	bc.tokenUndo[block.Hash] = changes
+}
+
+// unindexTokens undoes the changes indexTokens made to the token balance index for the block. Balances left at
+// zero are removed. The caller must hold bc.mux.
+func (bc *Blockchain) unindexTokens(block *Block) {
+	if bc.tokenBalances == nil {
+		return
+	}
+
+	for key, delta := range bc.tokenUndo[block.Hash] {
+		bc.tokenBalances[key] -= delta
+		if bc.tokenBalances[key] == 0 {
+			delete(bc.tokenBalances, key)
+		}
+	}
+	delete(bc.tokenUndo, block.Hash)
+}
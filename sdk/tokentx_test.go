@@ -0,0 +1,122 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/tokentx_test.go - Tests for the Token transaction protocol
+package sdk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestToken creates an unsigned token transaction with a unique ID between two address only wallets.
+func newTestToken(t *testing.T, from, to string, tokenID string, amount int64, mint bool, nonce uint64) *Token {
+	t.Helper()
+
+	token := &Token{Tx: newTestMessage(t, "").Tx, TokenID: tokenID, Amount: amount, Mint: mint}
+	token.Protocol = TokenProtocolID
+	token.From, token.To = &Wallet{Address: from}, &Wallet{Address: to}
+	token.Nonce = nonce
+	return token
+}
+
+func TestTokenMintAndTransfer(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	issuer := EncodeAddress([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20})
+	holder := EncodeAddress([]byte{20, 19, 18, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1})
+
+	// Minting credits the recipient, and makes the sender the token's issuer
+	require.NoError(t, bc.AddTransaction(newTestToken(t, issuer, issuer, "GOLD", 1000, true, 1)))
+	bc.createNewBlock(1)
+	assert.Equal(t, int64(1000), bc.GetTokenBalance(issuer, "GOLD"))
+	assert.Equal(t, issuer, bc.TokenIssuer("GOLD"))
+
+	// Only the issuer may mint more
+	err := bc.AddTransaction(newTestToken(t, holder, holder, "GOLD", 5, true, 1))
+	assert.ErrorIs(t, err, ErrNotTokenIssuer)
+
+	// Transfers move tokens, counting the sender's queued transfers against its balance
+	require.NoError(t, bc.AddTransaction(newTestToken(t, issuer, holder, "GOLD", 600, false, 2)))
+	err = bc.AddTransaction(newTestToken(t, issuer, holder, "GOLD", 600, false, 3))
+	assert.ErrorIs(t, err, ErrInsufficientTokens)
+	err = bc.AddTransaction(newTestToken(t, holder, issuer, "SILVER", 1, false, 1))
+	assert.ErrorIs(t, err, ErrInsufficientTokens)
+	bc.createNewBlock(1)
+
+	assert.Equal(t, int64(400), bc.GetTokenBalance(issuer, "GOLD"))
+	assert.Equal(t, int64(600), bc.GetTokenBalance(holder, "GOLD"))
+	assert.Zero(t, bc.GetTokenBalance(holder, "SILVER"))
+
+	// Tokens don't touch coin balances, the issuer only paid the two transaction fees
+	assert.InDelta(t, -2*transactionFee, bc.GetBalance(issuer), 1e-9)
+	assert.Zero(t, bc.GetBalance(holder))
+
+	// The index built from the chain agrees with replaying it
+	bc.RebuildBalances()
+	assert.Equal(t, int64(400), bc.GetTokenBalance(issuer, "GOLD"))
+	assert.Equal(t, map[string]int64{"GOLD": 600}, bc.GetTokenBalances(holder))
+	assert.InDelta(t, -2*transactionFee, bc.GetBalance(issuer), 1e-9)
+
+	// Undoing the transfer block restores the token balances
+	bc.mux.Lock()
+	assert.True(t, bc.unindexBalances(bc.Blocks[len(bc.Blocks)-1]))
+	bc.mux.Unlock()
+	assert.Equal(t, int64(1000), bc.GetTokenBalance(issuer, "GOLD"))
+	assert.Zero(t, bc.GetTokenBalance(holder, "GOLD"))
+}
+
+func TestFirstMintWins(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	first := EncodeAddress([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20})
+	second := EncodeAddress([]byte{20, 19, 18, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1})
+
+	// A queued mint claims the token before it is mined, so another wallet can't mint it too
+	require.NoError(t, bc.AddTransaction(newTestToken(t, first, first, "GOLD", 10, true, 1)))
+	err := bc.AddTransaction(newTestToken(t, second, second, "GOLD", 10, true, 1))
+	assert.ErrorIs(t, err, ErrNotTokenIssuer)
+	require.NoError(t, bc.AddTransaction(newTestToken(t, first, first, "GOLD", 5, true, 2)))
+
+	// A block may only mint a token from the wallet that first minted it, in the chain or earlier in the block
+	block := NewBlock([]Transaction{newTestToken(t, first, first, "SILVER", 1, true, 3),
+		newTestToken(t, second, second, "SILVER", 1, true, 2)}, "")
+	err = checkTokenMints(bc.snapshotBlocks(), block)
+	assert.ErrorIs(t, err, ErrNotTokenIssuer)
+
+	bc.createNewBlock(1)
+	assert.Equal(t, first, bc.TokenIssuer("GOLD"))
+	block = NewBlock([]Transaction{newTestToken(t, second, second, "GOLD", 1, true, 3)}, "")
+	err = checkTokenMints(bc.snapshotBlocks(), block)
+	assert.ErrorIs(t, err, ErrNotTokenIssuer)
+}
+
+func TestNewTokenTransaction(t *testing.T) {
+	useTestStorage(t)
+	from, err := NewWallet(NewWalletOptions(ThisBlockchainOrganizationID, ThisBlockchainAppID, ThisBlockchainAdminUserID, ThisBlockchainDevAssetID, "tokenFrom", testPassPhrase, nil))
+	require.NoError(t, err)
+	to, err := NewWallet(NewWalletOptions(ThisBlockchainOrganizationID, ThisBlockchainAppID, ThisBlockchainAdminUserID, ThisBlockchainDevAssetID, "tokenTo", testPassPhrase, nil))
+	require.NoError(t, err)
+
+	token, err := NewTokenTransaction(from, to, "GOLD", 10, false)
+	require.NoError(t, err)
+	assert.Equal(t, TokenProtocolID, token.Protocol)
+
+	// The token fields are covered by the ID
+	id, err := NewTransactionID(token)
+	require.NoError(t, err)
+	assert.Equal(t, token.ID.String(), id.String())
+	token.Amount = 11
+	id, err = NewTransactionID(token)
+	require.NoError(t, err)
+	assert.NotEqual(t, token.ID.String(), id.String())
+
+	_, err = NewTokenTransaction(from, to, " ", 10, false)
+	assert.ErrorIs(t, err, ErrInvalidTokenID)
+	_, err = NewTokenTransaction(from, to, "GOLD", 0, true)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+}
@@ -7,8 +7,8 @@ import (
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/sha256"
-	"crypto/x509"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
 	"encoding/json"
@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"strings"
 	"time"
 )
@@ -41,9 +42,14 @@ type Transaction interface {
 	GetHash() string
 	GetSignature() string
 	GetSenderWallet() *Wallet
+	GetSenderPublicKey() string
 	GetFee() float64 // New method to get the transaction fee
+	GetNonce() uint64
 	GetStatus() TransactionStatus
 	SetStatus(status TransactionStatus)
+	GetCreatedAt() time.Time
+	GetConfirmedAt() *time.Time
+	SetConfirmedAt(at time.Time)
 	Sign(privPEM []byte) (string, error)
 	Verify(pubKey []byte, sign string) (bool, error)
 	Send(bc *Blockchain) error
@@ -54,27 +60,29 @@ type Transaction interface {
 	JSON() string
 	Validate() error
 	Size() int
-	EstimateFee(feePerByte float64) float64
 	SetPriority(priority int)
 	GetPriority() int
 }
 
 // Tx is a generic transaction that represents a transfer of value between two wallets.
 type Tx struct {
-	ID        *PUID             `json:"id"`
-	Time      time.Time         `json:"time"`
-	Version   int               `json:"version"`
-	Protocol  string            `json:"protocol"`
-	From      *Wallet           `json:"from"`
-	To        *Wallet           `json:"to"`
-	Fee       float64           `json:"fee"`
-	Status    TransactionStatus `json:"status"`
-	BlockNum  int               `json:"block_num"`
-	Signature string            `json:"signature"`
-	hash      string            `json:"-"`
-	priority  int               `json:"-"`
-	Nonce     uint64            `json:"nonce"`
-	Data      []byte            `json:"data"`
+	ID          *PUID             `json:"id"`
+	Time        time.Time         `json:"time"`
+	Version     int               `json:"version"`
+	Protocol    string            `json:"protocol"`
+	From        *Wallet           `json:"from"`
+	To          *Wallet           `json:"to"`
+	Fee         float64           `json:"fee"`
+	Status      TransactionStatus `json:"status"`
+	BlockNum    int               `json:"block_num"`
+	Signature   string            `json:"signature"`
+	PublicKey   string            `json:"public_key"`             // PEM encoded public key of the sender, used to verify the signature
+	CreatedAt   time.Time         `json:"created_at"`             // When the transaction was created
+	ConfirmedAt *time.Time        `json:"confirmed_at,omitempty"` // When the transaction was included in a block
+	hash        string            `json:"-"`
+	priority    int               `json:"-"`
+	Nonce       uint64            `json:"nonce"`
+	Data        []byte            `json:"data"`
 }
 
 // NewTransaction creates a new transaction with the specified protocol, sender wallet, and recipient wallet.
@@ -89,41 +97,126 @@ func NewTransaction(protocol string, from *Wallet, to *Wallet) (*Tx, error) {
 
 	log.Printf("[%s] Creating %s-TX - FROM: %s, TO: %s\n", time.Now().Format(time.RFC3339), protocol, from.GetAddress(), to.GetAddress())
 
-	toWalletPUID := to.ID
-	if toWalletPUID == nil {
+	if to.ID == nil {
 		return nil, fmt.Errorf("to wallet PUID can't be empty")
 	}
-	assetID, err := NewRandomBigInt()
+
+	now := time.Now()
+	tx := &Tx{
+		Time:      now,
+		CreatedAt: now,
+		Version:   TransactionVersion,
+		Protocol:  protocol,
+		From:      from,
+		To:        to,
+		Fee:       transactionFee,
+		Status:    StatusPending,
+		Nonce:     secureRandomUint64(),
+		PublicKey: from.PublicPEM(),
+	}
+	tx.ID = tx.computeID(nil)
+
+	return tx, nil
+}
+
+// validateParties checks that both wallets of a transaction are set and have valid addresses.
+func validateParties(from *Wallet, to *Wallet) error {
+	if from == nil {
+		return errors.New("from wallet can't be nil")
+	}
+	if to == nil {
+		return errors.New("to wallet can't be nil")
+	}
+
+	err := ValidateAddress(from.GetAddress())
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("invalid from address %q: %w", from.GetAddress(), err)
+	}
+	err = ValidateAddress(to.GetAddress())
+	if err != nil {
+		return fmt.Errorf("invalid to address %q: %w", to.GetAddress(), err)
 	}
+	return nil
+}
 
-	toWalletPUID.SetAssetID(assetID)
+// computeID returns the deterministic ID of the transaction. The ID is the recipient wallet's PUID with its asset
+// ID replaced by a hash of the signed content: the protocol, sender and recipient addresses, fee, nonce and the
+// protocol specific content, such as the amount of a bank transfer. Building the same transaction twice yields
+// the same ID, and changing any of those fields changes it. Times are left out, as they are not part of what
+// the sender asked for.
+func (t *Tx) computeID(content interface{}) *PUID {
+	address := func(w *Wallet) string {
+		if w == nil {
+			return ""
+		}
+		return w.GetAddress()
+	}
 
-	tx := &Tx{
-		ID:       toWalletPUID,
-		Time:     time.Now(),
-		Version:  TransactionVersion,
-		Protocol: protocol,
-		From:     from,
-		To:       to,
-		Fee:      transactionFee,
-		Status:   StatusPending,
-		Nonce:    uint64(SecureRandomInt(8)),
+	// Encoding a struct of plain values can't fail, and encodes map content with sorted keys
+	payload, _ := json.Marshal(struct {
+		Protocol string      `json:"protocol"`
+		From     string      `json:"from"`
+		To       string      `json:"to"`
+		Fee      float64     `json:"fee"`
+		Nonce    uint64      `json:"nonce"`
+		Content  interface{} `json:"content,omitempty"`
+	}{
+		Protocol: strings.ToUpper(t.Protocol),
+		From:     address(t.From),
+		To:       address(t.To),
+		Fee:      t.Fee,
+		Nonce:    t.Nonce,
+		Content:  content,
+	})
+	hash := sha256.Sum256(payload)
+
+	// The asset ID is kept positive so the ID reads the same as any other PUID
+	assetID := NewBigInt(int64(binary.BigEndian.Uint64(hash[:8]) & math.MaxInt64))
+
+	id := NewPUIDEmpty()
+	if t.To != nil && t.To.ID != nil {
+		*id = *t.To.ID
 	}
+	id.SetAssetID(assetID)
+	return id
+}
 
-	return tx, nil
+// customIDTransaction is a transaction of a custom protocol, embedding Tx, that covers its own content in its ID.
+type customIDTransaction interface {
+	IDContent() interface{}
+	computeID(content interface{}) *PUID
+}
+
+// NewTransactionID returns the deterministic ID of a transaction, covering the content specific to its protocol.
+// The constructors of each protocol set the ID this way. Custom protocols cover the value returned by their
+// IDContent method, if they have one.
+func NewTransactionID(tx Transaction) (*PUID, error) {
+	switch v := tx.(type) {
+	case *Bank:
+		return v.computeID(v.Amount), nil
+	case *Message:
+		return v.computeID(v.Message), nil
+	case *Coinbase:
+		return v.computeID(nil), nil
+	case *Persist:
+		return v.computeID(v.Data), nil
+	case *Tx:
+		return v.computeID(nil), nil
+	case customIDTransaction:
+		return v.computeID(v.IDContent()), nil
+	case interface{ computeID(interface{}) *PUID }:
+		return v.computeID(nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported transaction type: %T", tx)
+	}
 }
 
-// isValidProtocol validates a provided protocol against the available protocols.
+// isValidProtocol validates a provided protocol against the registered protocols.
 func isValidProtocol(protocol string) error {
-	protocol = strings.ToUpper(protocol)
-	for _, p := range AvailableProtocols {
-		if protocol == p {
-			return nil
-		}
+	if lookupProtocol(protocol) == nil {
+		return fmt.Errorf("invalid protocol: %s", strings.ToUpper(protocol))
 	}
-	return fmt.Errorf("invalid protocol: %s", protocol)
+	return nil
 }
 
 // GetFee returns the fee for the transaction.
@@ -131,6 +224,31 @@ func (t *Tx) GetFee() float64 {
 	return t.Fee
 }
 
+// GetNonce returns the nonce of the transaction.
+func (t *Tx) GetNonce() uint64 {
+	return t.Nonce
+}
+
+// GetCreatedAt returns when the transaction was created.
+func (t *Tx) GetCreatedAt() time.Time {
+	return t.CreatedAt
+}
+
+// GetConfirmedAt returns when the transaction was included in a block, or nil if it is still pending.
+func (t *Tx) GetConfirmedAt() *time.Time {
+	return t.ConfirmedAt
+}
+
+// SetConfirmedAt records when the transaction was included in a block. A zero time clears it, for a
+// transaction returned to the mempool.
+func (t *Tx) SetConfirmedAt(at time.Time) {
+	if at.IsZero() {
+		t.ConfirmedAt = nil
+		return
+	}
+	t.ConfirmedAt = &at
+}
+
 // GetStatus returns the current status of the transaction.
 func (t *Tx) GetStatus() TransactionStatus {
 	return t.Status
@@ -151,6 +269,25 @@ func (t *Tx) GetSenderWallet() *Wallet {
 	return t.From
 }
 
+// GetRecipientWallet returns the recipient's wallet.
+func (t *Tx) GetRecipientWallet() *Wallet {
+	return t.To
+}
+
+// GetSenderPublicKey returns the PEM encoded public key of the sender. The key stored with the transaction
+// is preferred so that transactions can be verified when the sender wallet is not open on this node.
+func (t *Tx) GetSenderPublicKey() string {
+	if t.PublicKey != "" {
+		return t.PublicKey
+	}
+
+	if t.From == nil {
+		return ""
+	}
+
+	return t.From.PublicPEM()
+}
+
 // GetID returns the ID of the transaction.
 func (t *Tx) GetID() string {
 	return t.ID.String()
@@ -177,11 +314,18 @@ func (t *Tx) Hex() string {
 	return hex.EncodeToString(t.Bytes())
 }
 
-// Hash returns the hash of the transaction as a string.
+// Hash returns the hash of the transaction as a string. Times are hashed in UTC, so that a transaction read back
+// from JSON, which restores them in UTC rather than the local time zone, hashes the same as when it was created.
 func (t *Tx) Hash() string {
 	txCopy := *t
 	txCopy.hash = ""
 	txCopy.Signature = ""
+	txCopy.Time = t.Time.UTC()
+	txCopy.CreatedAt = t.CreatedAt.UTC()
+	if t.ConfirmedAt != nil {
+		confirmedAt := t.ConfirmedAt.UTC()
+		txCopy.ConfirmedAt = &confirmedAt
+	}
 	hash := sha256.Sum256(txCopy.Bytes())
 	t.hash = hex.EncodeToString(hash[:])
 	return t.hash
@@ -225,34 +369,91 @@ func (t *Tx) Send(bc *Blockchain) error {
 		return fmt.Errorf("invalid transaction: %v", err)
 	}
 
-	bc.AddTransaction(t)
+	err := bc.AddTransaction(t)
+	if err != nil {
+		return err
+	}
+
 	log.Printf("Transaction %s added to the transaction queue\n", t.ID)
 	return nil
 }
 
-// Sign signs the transaction with the provided private key.
-func (t *Tx) Sign(privPEM []byte) (string, error) {
-	txBytes, err := json.Marshal(t)
+// signingPayload returns the bytes covered by the transaction signature with the scheme. The current scheme covers
+// the sender and recipient addresses and the sender's public key, not the wallets, so the signature still verifies
+// once the transaction is rebuilt with address only wallets or the sender wallet is locked again. The signature
+// itself and the fields set by the chain once the transaction is mined are not covered.
+func (t *Tx) signingPayload(scheme string) ([]byte, error) {
+	if scheme == signatureSchemeLegacy {
+		// Legacy signatures covered the whole transaction, sender and recipient wallets included
+		txCopy := *t
+		txCopy.Signature = ""
+		txCopy.Status = StatusPending
+		txCopy.BlockNum = 0
+		txCopy.ConfirmedAt = nil
+		return json.Marshal(&txCopy)
+	}
+
+	return json.Marshal(struct {
+		ID        *PUID     `json:"id"`
+		Time      time.Time `json:"time"`
+		Version   int       `json:"version"`
+		Protocol  string    `json:"protocol"`
+		From      string    `json:"from"`
+		To        string    `json:"to"`
+		Fee       float64   `json:"fee"`
+		PublicKey string    `json:"public_key"`
+		CreatedAt time.Time `json:"created_at"`
+		Nonce     uint64    `json:"nonce"`
+		Data      []byte    `json:"data"`
+	}{t.ID, t.Time, t.Version, t.Protocol, t.From.GetAddress(), t.To.GetAddress(), t.Fee, t.PublicKey, t.CreatedAt,
+		t.Nonce, t.Data})
+}
+
+// txSignatureDomain is hashed ahead of the signing payload, so that a transaction signature can't be passed off as
+// the signature of another message signed with the same key, such as a consensus request.
+const txSignatureDomain = "go-basic-blockchain/tx/v2\n"
+
+// Transaction signature schemes, see signingDigest
+const (
+	signatureSchemeV2     = "v2"     // SHA-256 of txSignatureDomain and the signing payload, used to sign
+	signatureSchemeLegacy = "legacy" // SHA-256 of the whole transaction without a domain, only verified
+)
+
+// signingDigest returns the hash of the transaction that is signed with the scheme.
+func (t *Tx) signingDigest(scheme string) ([]byte, error) {
+	txBytes, err := t.signingPayload(scheme)
 	if err != nil {
-		return "", fmt.Errorf("error marshaling transaction: %v", err)
+		return nil, fmt.Errorf("error marshaling transaction: %v", err)
+	}
+
+	h := sha256.New()
+	if scheme == signatureSchemeV2 {
+		h.Write([]byte(txSignatureDomain))
+	}
+	if _, err := io.Copy(h, bytes.NewReader(txBytes)); err != nil {
+		return nil, fmt.Errorf("error hashing transaction: %v", err)
 	}
-	reader := bytes.NewReader(txBytes)
+	return h.Sum(nil), nil
+}
 
+// Sign signs the transaction with the provided private key. The matching public key is stored with the
+// transaction, and covered by the signature, so it can be verified without access to the sender wallet.
+func (t *Tx) Sign(privPEM []byte) (string, error) {
 	block, _ := pem.Decode(privPEM)
 	if block == nil {
 		return "", errors.New("failed to decode PEM block containing private key")
 	}
 
-	pk, err := x509.ParseECPrivateKey(block.Bytes)
+	pk, err := parseECPrivateKey(block.Bytes)
 	if err != nil {
 		return "", fmt.Errorf("error parsing private key: %v", err)
 	}
+	t.PublicKey = NewPEM(pk).GetPublic()
 
-	h := sha256.New()
-	if _, err := io.Copy(h, reader); err != nil {
-		return "", fmt.Errorf("error hashing transaction: %v", err)
+	hash, err := t.signingDigest(signatureSchemeV2)
+	if err != nil {
+		return "", err
 	}
-	hash := h.Sum(nil)
 
 	sign, err := ecdsa.SignASN1(rand.Reader, pk, hash)
 	if err != nil {
@@ -261,38 +462,51 @@ func (t *Tx) Sign(privPEM []byte) (string, error) {
 	return base64.StdEncoding.EncodeToString(sign), nil
 }
 
-// Verify verifies the signature of the transaction with the provided public key.
+// Verify verifies the signature of the transaction with the provided public key. Signatures made with the legacy
+// scheme, which signed the payload without a domain, are accepted too. Blockchain.VerifySignature only accepts them
+// while Config.AcceptLegacySignatures is set.
 func (t *Tx) Verify(pubKey []byte, sign string) (bool, error) {
-	txBytes, err := json.Marshal(t)
-	if err != nil {
-		return false, fmt.Errorf("error marshaling transaction: %v", err)
-	}
-	reader := bytes.NewReader(txBytes)
+	return t.verify(pubKey, sign, true)
+}
 
+// schemeVerifier is implemented by transactions built on Tx, whose signature can be verified without accepting the
+// legacy scheme.
+type schemeVerifier interface {
+	verify(pubKey []byte, sign string, acceptLegacy bool) (bool, error)
+}
+
+// verify verifies the signature of the transaction like Verify, accepting the legacy scheme only if acceptLegacy
+// is set. Accepting both lets a network move to the current scheme without a hard fork.
+func (t *Tx) verify(pubKey []byte, sign string, acceptLegacy bool) (bool, error) {
 	block, _ := pem.Decode(pubKey)
 	if block == nil {
 		return false, errors.New("failed to decode PEM block containing public key")
 	}
-	genericPublicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	// The curve of the signing key is part of its encoding, so the signature is checked with the right algorithm
+	pk, err := parsePKIXPublicKey(block.Bytes)
 	if err != nil {
 		return false, fmt.Errorf("error parsing public key: %v", err)
 	}
-	pk, ok := genericPublicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return false, errors.New("not an ECDSA public key")
-	}
-
-	h := sha256.New()
-	if _, err := io.Copy(h, reader); err != nil {
-		return false, fmt.Errorf("error hashing transaction: %v", err)
-	}
-	hash := h.Sum(nil)
 
 	bSign, err := base64.StdEncoding.DecodeString(sign)
 	if err != nil {
 		return false, fmt.Errorf("error decoding signature: %v", err)
 	}
-	return ecdsa.VerifyASN1(pk, hash, bSign), nil
+
+	schemes := []string{signatureSchemeV2}
+	if acceptLegacy {
+		schemes = append(schemes, signatureSchemeLegacy)
+	}
+	for _, scheme := range schemes {
+		hash, err := t.signingDigest(scheme)
+		if err != nil {
+			return false, err
+		}
+		if ecdsa.VerifyASN1(pk, hash, bSign) {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // GetSignature returns the signature of the transaction.
@@ -317,14 +531,15 @@ func (t *Tx) Validate() error {
 	return nil
 }
 
-// Size returns the size of the transaction in bytes.
+// Size returns the size of the transaction in bytes. Protocols that add fields to Tx override it with
+// serializedSize of their own type, so their fields are counted.
 func (t *Tx) Size() int {
-	return len(t.Bytes())
+	return serializedSize(t)
 }
 
-// EstimateFee estimates the fee for the transaction based on its size and the given fee per byte.
-func (t *Tx) EstimateFee(feePerByte float64) float64 {
-	return float64(t.Size()) * feePerByte
+// EstimateFee estimates the fee for a transaction of any protocol based on its size and the given fee per byte.
+func EstimateFee(tx Transaction, feePerByte float64) float64 {
+	return float64(tx.Size()) * feePerByte
 }
 
 // SetPriority sets the priority of the transaction.
@@ -336,3 +551,46 @@ func (t *Tx) SetPriority(priority int) {
 func (t *Tx) GetPriority() int {
 	return t.priority
 }
+
+// serializedSize returns the length in bytes of the JSON encoding of a transaction. Every protocol
+// measures itself this way so that block size accounting is the same regardless of transaction type.
+func serializedSize(tx interface{}) int {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		log.Printf("Error marshaling transaction to JSON: %v", err)
+		return 0
+	}
+	return len(data)
+}
+
+// PersistedTransaction is the on-disk representation of a transaction. Because Transaction is an interface,
+// the protocol is stored alongside the encoded transaction so it can be decoded back into its concrete type.
+type PersistedTransaction struct {
+	Protocol string          `json:"protocol"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// NewPersistedTransaction encodes the given transaction for persistence.
+func NewPersistedTransaction(tx Transaction) (*PersistedTransaction, error) {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling transaction %s: %v", tx.GetID(), err)
+	}
+
+	return &PersistedTransaction{
+		Protocol: tx.GetProtocol(),
+		Data:     data,
+	}, nil
+}
+
+// Transaction decodes the persisted transaction back into the concrete type for its protocol.
+func (p *PersistedTransaction) Transaction() (Transaction, error) {
+	tx := newProtocolTransaction(p.Protocol)
+
+	err := json.Unmarshal(p.Data, tx)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling %s transaction: %v", p.Protocol, err)
+	}
+
+	return tx, nil
+}
@@ -0,0 +1,353 @@
+package sdk
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionSizeMatchesJSON(t *testing.T) {
+	base := Tx{
+		ID:       NewPUIDEmpty(),
+		Version:  TransactionVersion,
+		From:     &Wallet{Address: testAddr},
+		To:       &Wallet{Address: testAddr},
+		Fee:      transactionFee,
+		Status:   StatusPending,
+		Protocol: BankProtocolID,
+	}
+
+	txs := []Transaction{
+		&base,
+		&Bank{Tx: base, Amount: 12.5},
+		&Message{Tx: base, Message: "a message long enough to make a difference in size"},
+		&Coinbase{Tx: base, BlockchainName: BlockchainName, TokenCount: tokenCount},
+		&Persist{Tx: base, Data: map[string]string{"key": "value"}},
+	}
+
+	for _, tx := range txs {
+		data, err := json.Marshal(tx)
+		assert.NoError(t, err)
+		assert.InDelta(t, len(data), tx.Size(), 1, "size mismatch for %T", tx)
+		assert.Equal(t, float64(tx.Size())*2, EstimateFee(tx, 2))
+	}
+
+	// Protocol specific fields must be accounted for
+	assert.Greater(t, txs[2].Size(), txs[0].Size())
+}
+
+func TestVerifyWithAddressOnlySender(t *testing.T) {
+	useTestStorage(t)
+	fromOptions := NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(4), "Sender", testPassPhrase, nil)
+	fromOptions.InitialBalance = 100
+	from, err := NewWallet(fromOptions)
+	require.NoError(t, err)
+	to, err := NewWallet(NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(4), "Recipient", testPassPhrase, nil))
+	require.NoError(t, err)
+
+	require.NoError(t, from.Unlock(testPassPhrase))
+	bank, err := NewBankTransaction(from, to, 12.5)
+	require.NoError(t, err)
+	bank.Signature, err = bank.Sign([]byte(from.PrivatePEM()))
+	require.NoError(t, err)
+	assert.Equal(t, from.PublicPEM(), bank.GetSenderPublicKey())
+
+	bc := newTestBlockchain(t)
+	assert.NoError(t, bc.VerifySignature(bank))
+
+	// Locking the sender wallet again changes its vault ciphertext, but not the signed fields
+	require.NoError(t, from.Lock(testPassPhrase))
+	assert.NoError(t, bc.VerifySignature(bank))
+
+	// Reconstruct the transaction the way a peer would, with a sender wallet that only has an address
+	data, err := json.Marshal(bank)
+	require.NoError(t, err)
+	restored := &Bank{}
+	require.NoError(t, json.Unmarshal(data, restored))
+	restored.From = &Wallet{Address: from.GetAddress()}
+	assert.Empty(t, restored.From.PublicPEM())
+	assert.NoError(t, bc.VerifySignature(restored))
+
+	// Any change to the signed fields must invalidate the signature
+	restored.Fee = restored.Fee + 1
+	assert.Error(t, bc.VerifySignature(restored))
+}
+
+func TestVerifySignatureRejectsForgeries(t *testing.T) {
+	bc := newTestBlockchain(t)
+
+	key, err := GenerateKey(KeyTypeP256)
+	require.NoError(t, err)
+	keys := NewPEM(key)
+	hash, err := publicKeyHash(keys.GetPublic())
+	require.NoError(t, err)
+	own := EncodeAddress(hash)
+
+	signedBank := func(from string, amount float64) *Bank {
+		bank := &Bank{Tx: newTestMessage(t, "").Tx, Amount: amount}
+		bank.Protocol = BankProtocolID
+		bank.From = &Wallet{Address: from}
+		bank.ID = bank.computeID(amount)
+		bank.Signature, err = bank.Sign([]byte(keys.GetPrivate()))
+		require.NoError(t, err)
+		return bank
+	}
+
+	assert.NoError(t, bc.VerifySignature(signedBank(own, 10)))
+
+	// A key can't sign for another wallet's address
+	forged := signedBank(testAddr, 10)
+	assert.ErrorIs(t, bc.VerifySignature(forged), ErrSenderKeyMismatch)
+
+	// Changing the amount after signing no longer matches the signed ID
+	altered := signedBank(own, 10)
+	altered.Amount = 1000
+	assert.ErrorIs(t, bc.VerifySignature(altered), ErrTransactionIDMismatch)
+
+	// and updating the ID to match breaks the signature
+	altered.ID = altered.computeID(altered.Amount)
+	assert.Error(t, bc.VerifySignature(altered))
+}
+
+func TestAcceptLegacySignatures(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	keys := NewPEM(key)
+	hash, err := publicKeyHash(keys.GetPublic())
+	require.NoError(t, err)
+
+	msg := newTestMessage(t, "signed before the signature scheme changed")
+	msg.From = &Wallet{Address: EncodeAddress(hash)}
+	msg.ID = msg.computeID(msg.Message)
+	current, err := msg.Sign([]byte(keys.GetPrivate()))
+	require.NoError(t, err)
+
+	// Sign the payload the way nodes did before the domain was added
+	digest, err := msg.signingDigest(signatureSchemeLegacy)
+	require.NoError(t, err)
+	raw, err := ecdsa.SignASN1(rand.Reader, key, digest)
+	require.NoError(t, err)
+	legacy := base64.StdEncoding.EncodeToString(raw)
+	assert.NotEqual(t, current, legacy)
+
+	// Verify on its own accepts both schemes
+	ok, err := msg.Verify([]byte(keys.GetPublic()), legacy)
+	require.NoError(t, err)
+	assert.True(t, ok, "legacy signature must be accepted during the transition")
+	ok, err = msg.Verify([]byte(keys.GetPublic()), current)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Each blockchain follows its own configuration
+	accepting, rejecting := newTestBlockchain(t), newTestBlockchain(t)
+	accepting.cfg.AcceptLegacySignatures = true
+	rejecting.cfg.AcceptLegacySignatures = false
+
+	msg.Signature = legacy
+	assert.NoError(t, accepting.VerifySignature(msg))
+	assert.Error(t, rejecting.VerifySignature(msg), "legacy signature must be rejected once the transition is over")
+
+	msg.Signature = current
+	assert.NoError(t, accepting.VerifySignature(msg))
+	assert.NoError(t, rejecting.VerifySignature(msg))
+}
+
+func TestTransactionIDIsDeterministic(t *testing.T) {
+	from := &Wallet{Address: testAddr, ID: NewPUIDEmpty()}
+	to := &Wallet{Address: EncodeAddress(make([]byte, addressHashLength)), ID: NewPUID(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(0))}
+
+	first, err := NewMessageTransaction(from, to, "hello")
+	require.NoError(t, err)
+	second, err := NewMessageTransaction(from, to, "hello")
+	require.NoError(t, err)
+
+	// The recipient's PUID is copied rather than changed
+	assert.Equal(t, "3:1:2:0", to.ID.String())
+	assert.Equal(t, to.ID.UserID, first.ID.UserID)
+
+	// Identical transactions get different IDs through their random nonces
+	assert.NotEqual(t, first.GetID(), second.GetID())
+
+	// The time is not part of the ID, so only the nonce tells the two apart
+	second.Nonce = first.Nonce
+	second.Time = first.Time.Add(time.Minute)
+	id, err := NewTransactionID(second)
+	require.NoError(t, err)
+	assert.Equal(t, first.GetID(), id.String())
+
+	base := Tx{
+		Version:  TransactionVersion,
+		From:     &Wallet{Address: testAddr},
+		To:       to,
+		Fee:      transactionFee,
+		Protocol: BankProtocolID,
+		Nonce:    42,
+	}
+	original := &Bank{Tx: base, Amount: 10}
+	originalID, err := NewTransactionID(original)
+	require.NoError(t, err)
+
+	changes := map[string]func(b *Bank){
+		"protocol": func(b *Bank) { b.Protocol = MessageProtocolID },
+		"from":     func(b *Bank) { b.From = to },
+		"to":       func(b *Bank) { b.To = &Wallet{Address: testAddr, ID: to.ID} },
+		"amount":   func(b *Bank) { b.Amount = 11 },
+		"nonce":    func(b *Bank) { b.Nonce = 43 },
+		"fee":      func(b *Bank) { b.Fee = transactionFee * 2 },
+	}
+	for field, change := range changes {
+		changed := &Bank{Tx: base, Amount: original.Amount}
+		change(changed)
+
+		id, err := NewTransactionID(changed)
+		require.NoError(t, err)
+		assert.NotEqual(t, originalID.String(), id.String(), "changing the %s did not change the ID", field)
+	}
+
+	// Fields set once the transaction is mined are not part of the ID
+	mined := &Bank{Tx: base, Amount: original.Amount}
+	mined.Status = StatusConfirmed
+	mined.BlockNum = 7
+	id, err = NewTransactionID(mined)
+	require.NoError(t, err)
+	assert.Equal(t, originalID.String(), id.String())
+}
+
+func TestNewTransactionInputValidation(t *testing.T) {
+	from := &Wallet{Address: testAddr, ID: NewPUIDEmpty()}
+	to := &Wallet{Address: EncodeAddress(make([]byte, addressHashLength)), ID: NewPUIDEmpty()}
+	badChecksum := &Wallet{Address: to.Address[:len(to.Address)-1] + "1", ID: NewPUIDEmpty()}
+	otherChain := &Wallet{Address: "XYZ" + to.Address[len(AddressPrefix()):], ID: NewPUIDEmpty()}
+
+	bankTests := []struct {
+		name     string
+		from, to *Wallet
+		amount   float64
+		want     error
+		contains string
+	}{
+		{"nil from wallet", nil, to, 1, nil, "from wallet can't be nil"},
+		{"nil to wallet", from, nil, 1, nil, "to wallet can't be nil"},
+		{"invalid from address", badChecksum, to, 1, ErrAddressChecksum, "invalid from address"},
+		{"invalid to address", from, otherChain, 1, ErrAddressPrefix, "invalid to address"},
+		{"malformed to address", from, &Wallet{Address: "not-an-address", ID: NewPUIDEmpty()}, 1, nil, "invalid to address"},
+		{"zero amount", from, to, 0, ErrInvalidAmount, ""},
+		{"negative amount", from, to, -5, ErrInvalidAmount, ""},
+		{"NaN amount", from, to, math.NaN(), ErrInvalidAmount, ""},
+		{"infinite amount", from, to, math.Inf(1), ErrInvalidAmount, ""},
+		{"self transfer", from, from, 1, ErrSelfTransfer, ""},
+	}
+
+	for _, tt := range bankTests {
+		t.Run("bank "+tt.name, func(t *testing.T) {
+			bank, err := NewBankTransaction(tt.from, tt.to, tt.amount)
+			assert.Nil(t, bank)
+			require.Error(t, err)
+			if tt.want != nil {
+				assert.ErrorIs(t, err, tt.want)
+			}
+			assert.ErrorContains(t, err, tt.contains)
+		})
+	}
+
+	messageTests := []struct {
+		name     string
+		from, to *Wallet
+		message  string
+		contains string
+	}{
+		{"nil from wallet", nil, to, "hello", "from wallet can't be nil"},
+		{"nil to wallet", from, nil, "hello", "to wallet can't be nil"},
+		{"invalid from address", badChecksum, to, "hello", "invalid from address"},
+		{"invalid to address", from, otherChain, "hello", "invalid to address"},
+		{"empty message", from, to, "", "message can't be empty"},
+	}
+
+	for _, tt := range messageTests {
+		t.Run("message "+tt.name, func(t *testing.T) {
+			msg, err := NewMessageTransaction(tt.from, tt.to, tt.message)
+			assert.Nil(t, msg)
+			assert.ErrorContains(t, err, tt.contains)
+		})
+	}
+
+	// Once self transfers are allowed the transfer only fails for lack of funds
+	SetAllowSelfTransfers(true)
+	defer SetAllowSelfTransfers(allowSelfTransfers)
+	self := &Wallet{Address: testAddr, ID: NewPUIDEmpty(), vault: NewVaultWithData("Self", nil, 0)}
+	_, err := NewBankTransaction(self, self, 1)
+	assert.NotErrorIs(t, err, ErrSelfTransfer)
+	assert.ErrorContains(t, err, "insufficient balance")
+}
+
+func TestTransactionViewSchema(t *testing.T) {
+	const otherAddr = "0000000000000000000000000000000000000000000000000000000000000001"
+	base := newTestMessage(t, "").Tx
+	base.To = &Wallet{Address: otherAddr}
+
+	bank := &Bank{Tx: base, Amount: 12.5}
+	bank.Protocol = BankProtocolID
+	message := &Message{Tx: base, Message: "hello"}
+	message.Protocol = MessageProtocolID
+	coinbase := &Coinbase{Tx: base, BlockchainName: "test"}
+	coinbase.Protocol = CoinbaseProtocolID
+	persist := &Persist{Tx: base, Data: map[string]string{"key": "value"}}
+	persist.Protocol = PersistProtocolID
+	vote := &testVote{Tx: base, Choice: "yes"}
+	vote.Protocol = testVoteProtocolID
+	token := &Token{Tx: base, TokenID: "GOLD", Amount: 7}
+	token.Protocol = TokenProtocolID
+
+	fields := []string{"id", "protocol", "from", "to", "amount", "token_id", "message", "fee", "status", "timestamp", "created_at"}
+	tests := []struct {
+		tx      Transaction
+		amount  float64
+		tokenID string
+		message string
+	}{
+		{tx: bank, amount: 12.5},
+		{tx: token, amount: 7, tokenID: "GOLD"},
+		{tx: message, message: "hello"},
+		{tx: coinbase},
+		{tx: persist},
+		{tx: vote},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tx.GetProtocol(), func(t *testing.T) {
+			data, err := json.Marshal(NewTransactionView(tt.tx))
+			require.NoError(t, err)
+
+			var view map[string]interface{}
+			require.NoError(t, json.Unmarshal(data, &view))
+			keys := make([]string, 0, len(view))
+			for key := range view {
+				keys = append(keys, key)
+			}
+			assert.ElementsMatch(t, fields, keys)
+
+			assert.Equal(t, tt.tx.GetID(), view["id"])
+			assert.Equal(t, tt.tx.GetProtocol(), view["protocol"])
+			assert.Equal(t, testAddr, view["from"])
+			assert.Equal(t, otherAddr, view["to"])
+			assert.Equal(t, tt.amount, view["amount"])
+			assert.Equal(t, tt.tokenID, view["token_id"])
+			assert.Equal(t, tt.message, view["message"])
+			assert.Equal(t, tt.tx.GetFee(), view["fee"])
+			assert.Equal(t, string(tt.tx.GetStatus()), view["status"])
+		})
+	}
+
+	// Confirmed transactions also have the time they were confirmed
+	bank.SetConfirmedAt(time.Now())
+	view := NewTransactionView(bank)
+	require.NotNil(t, view.ConfirmedAt)
+	assert.True(t, view.ConfirmedAt.Equal(*bank.GetConfirmedAt()))
+}
@@ -131,7 +131,14 @@ func (txlm *TXLookupManager) merge(blockNumber big.Int, txID string, txHash stri
 // split splits a merged string into Indexentry object contining the blockNumber, txID and txHash
 func (txlm *TXLookupManager) split(merged string) (entry *IndexEntry) {
 	entry = &IndexEntry{}
-	fmt.Sscanf(merged, "%s:%s:%s", &entry.BlockNumber, &entry.TxID, &entry.TxHash)
+	parts := strings.SplitN(merged, ":", 3)
+	if len(parts) != 3 {
+		return
+	}
+
+	entry.BlockNumber.SetString(parts[0], 10)
+	entry.TxID = parts[1]
+	entry.TxHash = parts[2]
 
 	return
 }
@@ -180,6 +187,18 @@ func (txlm *TXLookupManager) Find(indexEntry *IndexEntry) (entry *IndexEntry, er
 	return entry, fmt.Errorf("Find() failed to find entry")
 }
 
+// FindBlockNumber returns the number of the block that contains the transaction with the given ID.
+// The second return value is false if the transaction is not in the index.
+func (txlm *TXLookupManager) FindBlockNumber(txID string) (*big.Int, bool) {
+	found := txlm.index.Find(fmt.Sprintf(":%s:", txID))
+	if len(found) == 0 {
+		return nil, false
+	}
+
+	entry := txlm.split(found)
+	return &entry.BlockNumber, true
+}
+
 // Set sets the index from BlockchainPersistData loaded from LocalStorage
 func (txlm *TXLookupManager) Set(idx *Index) error {
 	if idx == nil {
@@ -0,0 +1,67 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/txview.go - A stable JSON shape for transactions of every protocol
+package sdk
+
+import (
+	"time"
+)
+
+// TransactionView is the JSON form of a transaction returned by the API. Every transaction has the same fields
+// whatever its protocol, so that clients can rely on a single schema. Fields that don't apply to the protocol
+// are empty: only bank transfers and token transactions have an amount, only token transactions have a token ID
+// and only messages have a message.
+type TransactionView struct {
+	ID          string            `json:"id"`
+	Protocol    string            `json:"protocol"`
+	From        string            `json:"from"`
+	To          string            `json:"to"`
+	Amount      float64           `json:"amount"`
+	TokenID     string            `json:"token_id"`
+	Message     string            `json:"message"`
+	Fee         float64           `json:"fee"`
+	Status      TransactionStatus `json:"status"`
+	Timestamp   time.Time         `json:"timestamp"`
+	CreatedAt   time.Time         `json:"created_at"`
+	ConfirmedAt *time.Time        `json:"confirmed_at,omitempty"`
+}
+
+// NewTransactionView returns the view of the transaction.
+func NewTransactionView(tx Transaction) *TransactionView {
+	view := &TransactionView{
+		ID:          tx.GetID(),
+		Protocol:    tx.GetProtocol(),
+		Fee:         tx.GetFee(),
+		Status:      tx.GetStatus(),
+		Timestamp:   tx.GetCreatedAt(),
+		CreatedAt:   tx.GetCreatedAt(),
+		ConfirmedAt: tx.GetConfirmedAt(),
+	}
+
+	if from := tx.GetSenderWallet(); from != nil {
+		view.From = from.GetAddress()
+	}
+	if recipient, ok := tx.(interface{ GetRecipientWallet() *Wallet }); ok && recipient.GetRecipientWallet() != nil {
+		view.To = recipient.GetRecipientWallet().GetAddress()
+	}
+
+	switch v := tx.(type) {
+	case *Bank:
+		view.Amount = v.Amount
+	case *Token:
+		view.Amount = float64(v.Amount)
+		view.TokenID = v.TokenID
+	case *Message:
+		view.Message = v.Message
+	}
+
+	return view
+}
+
+// NewTransactionViews returns the views of the transactions, in the same order.
+func NewTransactionViews(txs []Transaction) []*TransactionView {
+	views := make([]*TransactionView, 0, len(txs))
+	for _, tx := range txs {
+		views = append(views, NewTransactionView(tx))
+	}
+	return views
+}
@@ -4,9 +4,6 @@ package sdk
 
 import (
 	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/x509"
 	"encoding/pem"
 	"log"
 )
@@ -32,10 +29,10 @@ func NewPEM(key *ecdsa.PrivateKey) *PEM {
 // The private key is encoded using the "PRIVATE KEY" PEM block type, and the
 // public key is encoded using the "PUBLIC KEY" PEM block type.
 func (p *PEM) Encode(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey) (string, string) {
-	x509Encoded, _ := x509.MarshalECPrivateKey(privateKey)
+	x509Encoded, _ := marshalECPrivateKey(privateKey)
 	pemEncoded := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: x509Encoded})
 
-	x509EncodedPub, _ := x509.MarshalPKIXPublicKey(publicKey)
+	x509EncodedPub, _ := marshalPKIXPublicKey(publicKey)
 	pemEncodedPub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: x509EncodedPub})
 
 	return string(pemEncoded), string(pemEncodedPub)
@@ -48,12 +45,11 @@ func (p *PEM) Encode(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey) (
 func (p *PEM) Decode(pemEncoded string, pemEncodedPub string) (*ecdsa.PrivateKey, *ecdsa.PublicKey) {
 	block, _ := pem.Decode([]byte(pemEncoded))
 	x509Encoded := block.Bytes
-	privateKey, _ := x509.ParseECPrivateKey(x509Encoded)
+	privateKey, _ := parseECPrivateKey(x509Encoded)
 
 	blockPub, _ := pem.Decode([]byte(pemEncodedPub))
 	x509EncodedPub := blockPub.Bytes
-	genericPublicKey, _ := x509.ParsePKIXPublicKey(x509EncodedPub)
-	publicKey := genericPublicKey.(*ecdsa.PublicKey)
+	publicKey, _ := parsePKIXPublicKey(x509EncodedPub)
 
 	return privateKey, publicKey
 }
@@ -99,6 +95,15 @@ func NewVault() *Vault {
 	return newVault
 }
 
+// NewVaultWithKey creates a new Vault around an existing private key.
+func NewVaultWithKey(key *ecdsa.PrivateKey) *Vault {
+	return &Vault{
+		Data: make(map[string]interface{}),
+		Key:  key,
+		Pem:  NewPEM(key),
+	}
+}
+
 func NewVaultWithData(name string, tags []string, balance float64) *Vault {
 	newVault := NewVault()
 	newVault.SetData("name", name)
@@ -140,7 +145,12 @@ func (v *Vault) GetData(key string) (interface{}, error) {
 
 // NewKeyPair creates a new keypair for the wallet
 func (v *Vault) NewKeyPair() (err error) {
-	v.Key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return v.NewKeyPairWithType(KeyTypeP256)
+}
+
+// NewKeyPairWithType creates a new keypair of the key type for the wallet
+func (v *Vault) NewKeyPairWithType(keyType string) (err error) {
+	v.Key, err = GenerateKey(keyType)
 	if err != nil {
 		return err
 	}
@@ -9,13 +9,17 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
-	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"log"
+	"math"
+	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/crypto/scrypt"
 )
@@ -40,6 +44,9 @@ var RequiredWalletProperties = []string{
 // Name is the string name for the wallet.
 // Passphrase is the passphrase for the wallet.
 // Tags are the tags associated with the wallet.
+// KeyType is the signature algorithm of the wallet key, one of the KeyType constants. It defaults to KeyTypeP256.
+// InitialBalance is the balance recorded in the new wallet's vault, 0 by default. It is not credited on the chain,
+// see Blockchain.NewWallet and Config.FundNewWallets for that.
 type WalletOptions struct {
 	OrganizationID *BigInt
 	AppID          *BigInt
@@ -48,6 +55,8 @@ type WalletOptions struct {
 	Name           string
 	Passphrase     string
 	Tags           []string
+	KeyType        string
+	InitialBalance float64
 }
 
 // NewWalletOptions creates a new WalletOptions struct with the provided parameters.
@@ -77,6 +86,8 @@ func NewWalletOptions(organizationID, appID, userID, assetID *BigInt, name, pass
 // Encrypted: A flag indicating whether the private key is encrypted.
 // EncryptionParams: The encryption parameters used to encrypt the private key.
 // Ciphertext: The encrypted private key data.
+// Tags: The wallet's tags, kept unencrypted so wallets can be found by tag without their passphrase.
+// KeyType: The signature algorithm of the wallet key, empty for wallets created before key types were added (P-256).
 // vault: A reference to the wallet's associated vault.
 type Wallet struct {
 	ID               *PUID
@@ -84,8 +95,11 @@ type Wallet struct {
 	Encrypted        bool
 	EncryptionParams *EncryptionParams
 	Ciphertext       []byte
+	Tags             []string
+	KeyType          string
 	vault            *Vault
 	mutex            sync.Mutex
+	relockTimer      *time.Timer // re-locks the wallet after UnlockFor, nil when no relock is pending
 }
 
 // EncryptionParams holds the encryption parameters for the private key.
@@ -110,20 +124,98 @@ func NewDefaultEncryptionParams() *EncryptionParams {
 }
 
 // NewWallet creates a new wallet with a unique ID, name, and set of tags.
-// The wallet is initialized with a new private key and default encryption parameters.
-// The wallet must be closed to save it to disk.
+// The wallet is initialized with a new private key of options.KeyType and default encryption parameters.
+// The wallet must be closed to save it to disk. New wallets hold no funds, see Blockchain.NewWallet to fund them.
 func NewWallet(options *WalletOptions) (*Wallet, error) {
-	var err error
+	err := checkWalletOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := GenerateKey(options.KeyType)
+	if err != nil {
+		return nil, err
+	}
+
+	return newWallet(options, newWalletVault(key, options))
+}
+
+// ImportPrivateKey creates a wallet around an existing ECDSA private key, such as one exported from another tool.
+// The key must be PEM encoded, in either SEC 1 or PKCS #8 form, and use the curve of a supported key type. The
+// key type in the options is ignored, the key's own curve is used. The address is derived from the key, so
+// importing the same key always gives the same address. The wallet is saved encrypted with the passphrase in
+// the options.
+func ImportPrivateKey(pemBytes []byte, options *WalletOptions) (*Wallet, error) {
+	err := checkWalletOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parsePrivateKeyPEM(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return newWallet(options, newWalletVault(key, options))
+}
+
+// newWalletVault creates the vault of a new wallet around its key.
+func newWalletVault(key *ecdsa.PrivateKey, options *WalletOptions) *Vault {
+	vault := NewVaultWithKey(key)
+	vault.SetData("name", options.Name)
+	vault.SetData("tags", options.Tags)
+	vault.SetData("balance", options.InitialBalance)
+	return vault
+}
+
+// parsePrivateKeyPEM decodes a PEM encoded private key of a supported key type.
+func parsePrivateKeyPEM(pemBytes []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block containing private key")
+	}
+
+	key, err := parseECPrivateKey(block.Bytes)
+	if err != nil {
+		parsed, pkcs8Err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if pkcs8Err != nil {
+			return nil, fmt.Errorf("error parsing private key: %v", err)
+		}
+
+		var ok bool
+		key, ok = parsed.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("not an ECDSA private key")
+		}
+	}
+
+	if _, err := keyTypeOfCurve(key.Curve); err != nil {
+		return nil, err
+	}
 
+	return key, nil
+}
+
+// checkWalletOptions checks the options for a new wallet.
+func checkWalletOptions(options *WalletOptions) error {
 	if options == nil {
-		return nil, errors.New("options cannot be nil")
+		return errors.New("options cannot be nil")
 	}
 
 	// Check if the passphrase is strong enough.
 	if testPasswordStrength(options.Passphrase) != nil {
-		return nil, errors.New("password is too weak")
+		return errors.New("password is too weak")
 	}
 
+	if options.InitialBalance < 0 || math.IsNaN(options.InitialBalance) || math.IsInf(options.InitialBalance, 0) {
+		return errors.New("initial balance must be zero or a positive amount")
+	}
+
+	return ValidateKeyType(options.KeyType)
+}
+
+// newWallet creates a wallet around the vault and saves it.
+func newWallet(options *WalletOptions, vault *Vault) (*Wallet, error) {
 	// Create a new wallet with a unique ID, name, and set of tags.
 	log.Printf("Creating new Wallet: %s", options.Name)
 	wallet := &Wallet{
@@ -131,10 +223,17 @@ func NewWallet(options *WalletOptions) (*Wallet, error) {
 		Address:          "",
 		Encrypted:        false,
 		EncryptionParams: NewDefaultEncryptionParams(),
-		vault:            NewVaultWithData(options.Name, options.Tags, float64(fundWalletAmount)),
+		vault:            vault,
 		Ciphertext:       []byte{},
+		Tags:             options.Tags,
 	}
 
+	keyType, err := keyTypeOfCurve(vault.Key.Curve)
+	if err != nil {
+		return nil, err
+	}
+	wallet.KeyType = keyType
+
 	// Generate a new private key.
 	// err := wallet.vault.NewKeyPair()
 	// if err != nil {
@@ -240,33 +339,32 @@ func (w *Wallet) GetBalance() float64 {
 }
 
 // GetTags returns the wallet tags from the data (keypairs) associated with the wallet.
-// If the wallet is encrypted, this function will return nil.
+// If the wallet is encrypted, this function will return the unencrypted copy of the tags.
 // Otherwise, it will return the tags stored in the wallet data, or nil if there is an error retrieving the tags.
 func (w *Wallet) GetTags() []string {
 	if w.Encrypted {
-		return nil
-	}
-
-	tags, err := w.GetData("tags")
-	if err != nil {
-		log.Println(err)
-		return nil
+		return w.Tags
 	}
 
-	return tags.([]string)
+	return w.vaultTags()
 }
 
 // GetAddress generates and returns the wallet address.
 //
 // If the address is already generated, it returns the cached address.
-// Otherwise, it generates a new address by hashing the public key and encoding it in hexadecimal.
+// Otherwise, it generates a new address by hashing the public key and encoding it with EncodeAddress.
+// A nil wallet, such as the missing sender of a genesis allocation, has no address.
 func (w *Wallet) GetAddress() string {
+	if w == nil {
+		return ""
+	}
+
 	// If the address is already generated, return it.
 	if w.Address != "" {
 		return w.Address
 	}
 
-	// Generate an address by hashing the public key and encoding it in hexadecimal.
+	// Generate an address by hashing the public key and encoding it with the prefix and checksum.
 	pubBytes, err := w.PublicBytes()
 	if err != nil {
 		log.Printf("Error getting public key bytes: %s", err)
@@ -274,7 +372,7 @@ func (w *Wallet) GetAddress() string {
 	}
 
 	hash := sha256.Sum256(pubBytes)
-	w.Address = hex.EncodeToString(hash[:])
+	w.Address = EncodeAddress(hash[:])
 
 	return w.Address
 }
@@ -289,7 +387,26 @@ func (w *Wallet) vaultToBytes() ([]byte, error) {
 // this is used by the wallet to decrypt the data (keypairs) associated with the wallet.
 
 func (w *Wallet) bytesToVault(bytes []byte) error {
-	return json.Unmarshal(bytes, &w.vault)
+	err := json.Unmarshal(bytes, &w.vault)
+
+	// The curve of the key can't be restored from JSON, so the key is restored from its PEM encoding
+	if w.vault != nil && w.vault.Pem != nil && w.vault.Pem.PrivateKey != "" {
+		key, pemErr := parsePrivateKeyPEM([]byte(w.vault.Pem.PrivateKey))
+		if pemErr != nil {
+			return pemErr
+		}
+		w.vault.Key = key
+		return nil
+	}
+	return err
+}
+
+// GetKeyType returns the signature algorithm of the wallet key, one of the KeyType constants.
+func (w *Wallet) GetKeyType() string {
+	if w.KeyType == "" {
+		return KeyTypeP256
+	}
+	return w.KeyType
 }
 
 // / PrivateKey returns the private key from the vault associated with the wallet.
@@ -314,7 +431,7 @@ func (w *Wallet) PrivateBytes() ([]byte, error) {
 		return nil, errors.New("private key is nil")
 	}
 
-	bytes, err := x509.MarshalECPrivateKey(w.vault.Key)
+	bytes, err := marshalECPrivateKey(w.vault.Key)
 	if err != nil {
 		return nil, err
 	}
@@ -330,7 +447,7 @@ func (w *Wallet) PrivatePEM() string {
 		return ""
 	}
 
-	if w.vault.Key == nil {
+	if w.vault == nil || w.vault.Key == nil {
 		return ""
 	}
 
@@ -365,7 +482,7 @@ func (w *Wallet) PublicBytes() ([]byte, error) {
 		return nil, errors.New("public key is nil")
 	}
 
-	bytes, err := x509.MarshalPKIXPublicKey(w.vault.Key.Public())
+	bytes, err := marshalPKIXPublicKey(&w.vault.Key.PublicKey)
 	if err != nil {
 		return nil, err
 	}
@@ -382,7 +499,7 @@ func (w *Wallet) PublicPEM() string {
 		return ""
 	}
 
-	if w.vault.Key.Public() == nil {
+	if w.vault == nil || w.vault.Key == nil || w.vault.Key.Public() == nil {
 		return ""
 	}
 
@@ -574,7 +691,8 @@ func (w *Wallet) Unlock(passphrase string) error {
 		pwAsBytes := []byte(passphrase)
 
 		// Decrypt the wallet's data.
-		dataAsBytes, err := w.decrypt(pwAsBytes, w.Ciphertext)
+		ciphertext := w.Ciphertext
+		dataAsBytes, err := w.decrypt(pwAsBytes, ciphertext)
 		if err != nil {
 			return err
 		}
@@ -584,11 +702,112 @@ func (w *Wallet) Unlock(passphrase string) error {
 		// Set the wallet's data.
 		w.Ciphertext = []byte{}
 		w.Encrypted = false
+
+		err = w.migrateTags(ciphertext)
+		if err != nil {
+			log.Printf("Error migrating tags of wallet [%s]: %v", w.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// migrateTags copies the tags of a wallet saved before tags were kept unencrypted from its vault into Tags, and
+// re-saves the still encrypted wallet file with them so the wallet can be found by tag from then on.
+func (w *Wallet) migrateTags(ciphertext []byte) error {
+	if len(w.Tags) > 0 {
+		return nil
+	}
+
+	w.Tags = w.vaultTags()
+	if len(w.Tags) == 0 || !LocalStorageAvailable() {
+		return nil
+	}
+
+	file, err := localStorage.file(w)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(file); err != nil {
+		// The wallet was never saved, so there is no file to migrate.
+		return nil
 	}
 
+	saved := &Wallet{
+		ID:               w.ID,
+		Address:          w.Address,
+		Encrypted:        true,
+		EncryptionParams: w.EncryptionParams,
+		Ciphertext:       ciphertext,
+		Tags:             w.Tags,
+		KeyType:          w.KeyType,
+	}
+	return localStorage.Set("wallet", saved)
+}
+
+// vaultTags returns the tags stored in the vault, which are a []interface{} once the vault has been restored from JSON.
+func (w *Wallet) vaultTags() []string {
+	if w.vault == nil {
+		return nil
+	}
+
+	switch tags := w.vault.Data["tags"].(type) {
+	case []string:
+		return tags
+	case []interface{}:
+		result := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			if s, ok := tag.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// UnlockFor unlocks the wallet like Unlock, then locks it again with the same passphrase once the duration has
+// passed, so the private key does not stay decrypted in memory indefinitely. Calling UnlockFor again replaces the
+// pending relock with one for the new duration.
+func (w *Wallet) UnlockFor(passphrase string, d time.Duration) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	err := w.Unlock(passphrase)
+	if err != nil {
+		return err
+	}
+
+	if w.relockTimer != nil {
+		w.relockTimer.Stop()
+	}
+	w.relockTimer = time.AfterFunc(d, func() {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+
+		w.relockTimer = nil
+		if w.Encrypted {
+			return
+		}
+
+		err := w.Lock(passphrase)
+		if err != nil {
+			log.Printf("Error re-locking wallet [%s]: %v", w.ID, err)
+		}
+	})
+
 	return nil
 }
 
+// IsLocked returns true if the wallet's data is encrypted. Unlike reading Encrypted directly it is safe to call while
+// a relock scheduled by UnlockFor may be running.
+func (w *Wallet) IsLocked() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.Encrypted
+}
+
 // Close encrypts and saves the wallet to disk as a JSON file. If the wallet is already encrypted, this method will return an error.
 // This method first locks the wallet using the provided passphrase, then saves the encrypted wallet to disk using the localStorage.Set method.
 // If any errors occur during the locking or saving process, this method will return an error.
@@ -616,7 +835,7 @@ func (w *Wallet) Close(passphrase string) error {
 // Open loads the wallet from disk that was saved as a JSON file.
 // It also unlocks the value and restores the wallet.vault object.
 func (w *Wallet) Open(passphrase string) error {
-	err := localStorage.Set("wallet", w)
+	err := localStorage.Get("wallet", w)
 	if err != nil {
 		return err
 	}
@@ -677,3 +896,100 @@ func LocalWalletCount() (count int, err error) {
 
 	return len(files), nil
 }
+
+// GetWallet loads a persisted wallet using either its address or its PUID string.
+// The wallet is returned locked; use Unlock to access its vault.
+func GetWallet(id string) (*Wallet, error) {
+	if ValidateAddress(id) == nil {
+		return GetWalletByAddress(id)
+	}
+
+	return GetWalletByID(id)
+}
+
+// GetWalletByAddress loads the wallet that was persisted under the given address.
+func GetWalletByAddress(address string) (*Wallet, error) {
+	if err := ValidateAddress(address); err != nil {
+		return nil, err
+	}
+
+	if !LocalStorageAvailable() {
+		return nil, errors.New("local storage not initialized")
+	}
+
+	wallet := &Wallet{Address: address}
+	err := localStorage.Get("wallet", wallet)
+	if err != nil {
+		return nil, fmt.Errorf("wallet %s not found: %v", address, err)
+	}
+
+	return wallet, nil
+}
+
+// HasTag returns true if the wallet has the given tag.
+func (w *Wallet) HasTag(tag string) bool {
+	for _, t := range w.GetTags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// LocalWallets loads every persisted wallet. The wallets are returned locked; use Unlock to access their vaults.
+func LocalWallets() ([]*Wallet, error) {
+	if !LocalStorageAvailable() {
+		return nil, errors.New("local storage not initialized")
+	}
+
+	files, err := localStorage.walletFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wallets: %v", err)
+	}
+
+	wallets := make([]*Wallet, 0, len(files))
+	for _, file := range files {
+		address := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+
+		wallet, err := GetWalletByAddress(address)
+		if err != nil {
+			log.Printf("Error loading wallet %s: %v\n", address, err)
+			continue
+		}
+		wallets = append(wallets, wallet)
+	}
+
+	return wallets, nil
+}
+
+// GetWalletByID searches the persisted wallets for the one whose PUID matches the given ID.
+// Wallets are stored by address, so this requires scanning the wallet folder.
+func GetWalletByID(id string) (*Wallet, error) {
+	if _, err := NewPUIDFromString(id); err != nil {
+		return nil, err
+	}
+
+	if !LocalStorageAvailable() {
+		return nil, errors.New("local storage not initialized")
+	}
+
+	files, err := localStorage.walletFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wallets: %v", err)
+	}
+
+	for _, file := range files {
+		address := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+
+		wallet, err := GetWalletByAddress(address)
+		if err != nil {
+			continue
+		}
+
+		if wallet.ID != nil && wallet.ID.String() == id {
+			return wallet, nil
+		}
+	}
+
+	return nil, fmt.Errorf("wallet with ID %s not found", id)
+}
@@ -2,11 +2,18 @@ package sdk
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/hex"
+	"encoding/pem"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -58,7 +65,7 @@ func TestCreateWallet(t *testing.T) {
 	// Test wallet data and properties
 	assert.Equal(t, "TestWallet", wallet.GetWalletName())
 	assert.Equal(t, []string{"tag1", "tag2"}, wallet.GetTags())
-	assert.Equal(t, fundWalletAmount, wallet.GetBalance())
+	assert.Equal(t, 0.0, wallet.GetBalance())
 }
 
 // TestOpneCloseWallet test the open and close wallet functions including the locking and unlocking of the wallet
@@ -71,7 +78,7 @@ func TestOpenCloseWallet(t *testing.T) {
 	// Test wallet data and properties
 	assert.Equal(t, "TestWallet", wallet.GetWalletName())
 	assert.Equal(t, []string{"tag1", "tag2"}, wallet.GetTags())
-	assert.Equal(t, fundWalletAmount, wallet.GetBalance())
+	assert.Equal(t, 0.0, wallet.GetBalance())
 
 	// Test wallet address generation
 	address := wallet.GetAddress()
@@ -112,11 +119,11 @@ func TestWallet(t *testing.T) {
 	// Test wallet data and properties
 	assert.Equal(t, "Wallet1", wallet1.GetWalletName())
 	assert.Equal(t, []string{"tag1", "tag2"}, wallet1.GetTags())
-	assert.Equal(t, fundWalletAmount, wallet1.GetBalance())
+	assert.Equal(t, 0.0, wallet1.GetBalance())
 
 	assert.Equal(t, "Wallet2", wallet2.GetWalletName())
 	assert.Equal(t, []string{"tag3", "tag4"}, wallet2.GetTags())
-	assert.Equal(t, fundWalletAmount, wallet2.GetBalance())
+	assert.Equal(t, 0.0, wallet2.GetBalance())
 
 	// Test wallet address generation
 	address1 := wallet1.GetAddress()
@@ -144,6 +151,7 @@ func TestWallet(t *testing.T) {
 
 	// Test sending a transaction
 	bc := NewBlockchain(NewConfig())
+	assert.NoError(t, wallet1.SetData("balance", 10.0))
 	tx, err := NewBankTransaction(wallet1, wallet2, 1.0)
 	assert.NoError(t, err)
 
@@ -199,6 +207,55 @@ func TestWallet_LockAndUnlock(t *testing.T) {
 	}
 }
 
+func TestNewWalletInitialBalance(t *testing.T) {
+	useTestStorage(t)
+
+	// Wallets hold nothing unless an initial balance is given
+	options := NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(4), "Empty", testPassPhrase, nil)
+	empty, err := NewWallet(options)
+	require.NoError(t, err)
+	require.NoError(t, empty.Unlock(testPassPhrase))
+	assert.Zero(t, empty.GetBalance())
+
+	options = NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(5), "Funded", testPassPhrase, nil)
+	options.InitialBalance = 25
+	funded, err := NewWallet(options)
+	require.NoError(t, err)
+	require.NoError(t, funded.Unlock(testPassPhrase))
+	assert.Equal(t, 25.0, funded.GetBalance())
+
+	options.InitialBalance = -1
+	_, err = NewWallet(options)
+	assert.Error(t, err)
+}
+
+func TestWalletUnlockFor(t *testing.T) {
+	useTestStorage(t)
+
+	// New wallets are saved, and so locked
+	wallet, err := NewWallet(NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(4), "Relock", testPassPhrase, nil))
+	require.NoError(t, err)
+	require.True(t, wallet.IsLocked())
+
+	// A wrong passphrase leaves the wallet locked
+	assert.Error(t, wallet.UnlockFor("Wr0ng!Pass#word", time.Minute))
+	assert.True(t, wallet.IsLocked())
+
+	require.NoError(t, wallet.UnlockFor(testPassPhrase, 100*time.Millisecond))
+	assert.False(t, wallet.IsLocked())
+
+	// The wallet is encrypted again once the timeout has passed
+	assert.Eventually(t, wallet.IsLocked, 30*time.Second, 50*time.Millisecond)
+	wallet.mutex.Lock()
+	assert.Nil(t, wallet.vault)
+	assert.NotEmpty(t, wallet.Ciphertext)
+	wallet.mutex.Unlock()
+
+	// The re-locked wallet still opens with the same passphrase
+	require.NoError(t, wallet.Unlock(testPassPhrase))
+	assert.NotNil(t, wallet.vault)
+}
+
 func TestWallet_EncryptDecrypt(t *testing.T) {
 	passphrase := "securepassphrase"
 	data := []byte("test data to encrypt and decrypt")
@@ -265,9 +322,179 @@ func TestWallet_PublicBytesAndAddress(t *testing.T) {
 	}
 
 	hash := sha256.Sum256(pubBytes)
-	expectedAddress := hex.EncodeToString(hash[:])
+	expectedAddress := EncodeAddress(hash[:])
 
 	if address != expectedAddress {
 		t.Errorf("Generated address does not match expected address. Got %s, want %s", address, expectedAddress)
 	}
 }
+
+func TestImportPrivateKey(t *testing.T) {
+	useTestStorage(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	keyPEM := []byte(NewPEM(key).GetPrivate())
+
+	options := NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(0), "Imported", testPassPhrase, []string{"imported"})
+	wallet, err := ImportPrivateKey(keyPEM, options)
+	require.NoError(t, err)
+	assert.True(t, wallet.Encrypted)
+
+	pubBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	hash := sha256.Sum256(pubBytes)
+	assert.Equal(t, EncodeAddress(hash[:]), wallet.GetAddress())
+
+	// Importing the same key again, in PKCS #8 form, derives the same address
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	again, err := ImportPrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), options)
+	require.NoError(t, err)
+	assert.Equal(t, wallet.GetAddress(), again.GetAddress())
+
+	// The saved wallet holds the imported key
+	require.NoError(t, again.Unlock(testPassPhrase))
+	assert.Equal(t, string(keyPEM), again.vault.PrivatePEM())
+
+	// Keys on other curves, and data that is not a key, are refused
+	other, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, err = ImportPrivateKey([]byte(NewPEM(other).GetPrivate()), options)
+	assert.ErrorContains(t, err, "unsupported curve")
+
+	_, err = ImportPrivateKey([]byte("not a key"), options)
+	assert.Error(t, err)
+}
+
+func TestWalletKeyTypes(t *testing.T) {
+	useTestStorage(t)
+
+	for _, keyType := range []string{KeyTypeP256, KeyTypeSecp256k1} {
+		t.Run(keyType, func(t *testing.T) {
+			options := NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(0), "Typed", testPassPhrase, nil)
+			options.KeyType = keyType
+			wallet, err := NewWallet(options)
+			require.NoError(t, err)
+
+			assert.Equal(t, keyType, wallet.GetKeyType())
+
+			// The key type is saved with the wallet, and the unlocked key uses its curve
+			saved, err := GetWalletByAddress(wallet.GetAddress())
+			require.NoError(t, err)
+			assert.Equal(t, keyType, saved.GetKeyType())
+			require.NoError(t, saved.Unlock(testPassPhrase))
+			assert.Equal(t, keyTypes[keyType].curve, saved.vault.Key.Curve)
+
+			pubBytes, err := saved.PublicBytes()
+			require.NoError(t, err)
+			hash := sha256.Sum256(pubBytes)
+			assert.Equal(t, EncodeAddress(hash[:]), saved.GetAddress())
+
+			// Signatures round trip, and fail for a tampered transaction
+			to := &Wallet{Address: testAddr, ID: NewPUIDEmpty()}
+			tx, err := NewMessageTransaction(saved, to, "signed with "+keyType)
+			require.NoError(t, err)
+			tx.Signature, err = tx.Sign([]byte(saved.PrivatePEM()))
+			require.NoError(t, err)
+
+			valid, err := tx.Verify([]byte(tx.GetSenderPublicKey()), tx.GetSignature())
+			require.NoError(t, err)
+			assert.True(t, valid)
+
+			tx.Fee++
+			valid, err = tx.Verify([]byte(tx.GetSenderPublicKey()), tx.GetSignature())
+			require.NoError(t, err)
+			assert.False(t, valid)
+		})
+	}
+
+	// P-256 is the default, for new keys and for wallets saved before key types
+	p256, err := GenerateKey("")
+	require.NoError(t, err)
+	assert.Equal(t, elliptic.P256(), p256.Curve)
+	assert.Equal(t, KeyTypeP256, (&Wallet{}).GetKeyType())
+
+	// Keys of one type don't verify signatures made with another
+	k1, err := GenerateKey(KeyTypeSecp256k1)
+	require.NoError(t, err)
+	tx := newTestMessage(t, "mismatch")
+	tx.Signature, err = tx.Sign([]byte(NewPEM(k1).GetPrivate()))
+	require.NoError(t, err)
+	valid, err := tx.Verify([]byte(NewPEM(p256).GetPublic()), tx.Signature)
+	require.NoError(t, err)
+	assert.False(t, valid)
+
+	options := NewWalletOptions(NewBigInt(1), NewBigInt(2), NewBigInt(3), NewBigInt(0), "Typed", testPassPhrase, nil)
+	options.KeyType = "ed448"
+	_, err = NewWallet(options)
+	assert.ErrorIs(t, err, ErrUnsupportedKeyType)
+}
+
+func TestWalletDeriveSubAddress(t *testing.T) {
+	for _, keyType := range []string{KeyTypeP256, KeyTypeSecp256k1} {
+		t.Run(keyType, func(t *testing.T) {
+			key, err := GenerateKey(keyType)
+			require.NoError(t, err)
+			wallet := &Wallet{vault: NewVaultWithKey(key)}
+
+			// Every asset ID gives its own address, which is never the wallet's own
+			seen := map[string]bool{wallet.GetAddress(): true}
+			for id := int64(0); id < 5; id++ {
+				address, err := wallet.DeriveSubAddress(NewBigInt(id))
+				require.NoError(t, err)
+				assert.False(t, seen[address], "sub-address %d is not unique", id)
+				seen[address] = true
+
+				_, err = DecodeAddress(address)
+				assert.NoError(t, err)
+
+				// Deriving again, even from a copy of the wallet, gives the same address
+				again, err := (&Wallet{vault: NewVaultWithKey(key)}).DeriveSubAddress(NewBigInt(id))
+				require.NoError(t, err)
+				assert.Equal(t, address, again)
+			}
+
+			_, err = wallet.DeriveSubAddress(NewBigInt(-1))
+			assert.ErrorIs(t, err, ErrInvalidAssetID)
+		})
+	}
+}
+
+func TestWalletVerifyBalanceProof(t *testing.T) {
+	useTestStorage(t)
+	bc := newTestBlockchain(t)
+	bc.GenerateGenesisBlock([]Transaction{})
+
+	key, err := GenerateKey(KeyTypeP256)
+	require.NoError(t, err)
+	wallet := &Wallet{vault: NewVaultWithKey(key)}
+	require.NoError(t, wallet.SetData("balance", 0))
+
+	ok, err := wallet.VerifyBalanceProof(bc)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// The wallet is paid on chain and its vault kept in step
+	payment := &Bank{Tx: newTestMessage(t, "").Tx, Amount: 25}
+	payment.Protocol = BankProtocolID
+	payment.From = &Wallet{Address: "other-address"}
+	payment.To = &Wallet{Address: wallet.GetAddress()}
+	require.NoError(t, bc.AddTransaction(payment))
+	bc.createNewBlock(1)
+	require.NoError(t, wallet.SetData("balance", 25))
+
+	ok, err = wallet.VerifyBalanceProof(bc)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// A vault balance that has drifted from the chain is flagged
+	require.NoError(t, wallet.SetData("balance", 40))
+	ok, err = wallet.VerifyBalanceProof(bc)
+	assert.False(t, ok)
+	assert.ErrorIs(t, err, ErrBalanceMismatch)
+
+	wallet.Encrypted = true
+	_, err = wallet.VerifyBalanceProof(bc)
+	assert.Error(t, err)
+}
@@ -0,0 +1,55 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/walletqr.go - QR codes for receiving funds to a wallet address
+package sdk
+
+import (
+	"bytes"
+	"fmt"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Wallet QR code formats
+const (
+	QRFormatPNG = "png"
+	QRFormatSVG = "svg"
+)
+
+// qrCodeSize is the width and height in pixels of PNG QR codes, and the SVG viewport.
+const qrCodeSize = 256
+
+// AddressQRCodePNG returns a PNG image of a QR code encoding the wallet address.
+func AddressQRCodePNG(address string) ([]byte, error) {
+	png, err := qrcode.Encode(address, qrcode.Medium, qrCodeSize)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding QR code: %w", err)
+	}
+	return png, nil
+}
+
+// AddressQRCodeSVG returns an SVG image of a QR code encoding the wallet address. Each dark module is drawn
+// as a unit square so the image scales without blurring.
+func AddressQRCodeSVG(address string) ([]byte, error) {
+	qr, err := qrcode.New(address, qrcode.Medium)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding QR code: %w", err)
+	}
+
+	bitmap := qr.Bitmap()
+	size := len(bitmap)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		qrCodeSize, qrCodeSize, size, size)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#ffffff"/>`, size, size)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="1" height="1" fill="#000000"/>`, x, y)
+			}
+		}
+	}
+	buf.WriteString(`</svg>`)
+
+	return buf.Bytes(), nil
+}
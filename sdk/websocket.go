@@ -0,0 +1,237 @@
+// Package sdk is a software development kit for building blockchain applications.
+// File sdk/websocket.go - Minimal server side WebSocket connections (RFC 6455) for pushing events to clients
+//
+// The connections are implemented here rather than with gorilla/websocket or nhooyr.io/websocket because neither
+// is a dependency of the module. They only cover what the event endpoints need: the handshake, unfragmented text
+// frames to the client and control frames from it. Extensions, subprotocols, fragmented messages and data frames
+// from clients are not supported. Switching to one of those libraries once it is added to go.mod is preferred to
+// extending this file.
+package sdk
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// websocketGUID is appended to the client's key to calculate the handshake accept value.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket frame opcodes
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+// maxWebSocketFrameSize is the largest frame accepted from a client. Clients only send control frames.
+const maxWebSocketFrameSize = 64 * 1024
+
+// maxControlFramePayload is the largest payload of a control frame, see RFC 6455 section 5.5.
+const maxControlFramePayload = 125
+
+// wsCloseProtocolError is the close status code sent when the client breaks the protocol.
+const wsCloseProtocolError = 1002
+
+// ErrNotWebSocket is returned by upgradeWebSocket when the request is not a WebSocket handshake.
+var ErrNotWebSocket = errors.New("not a WebSocket handshake")
+
+// ErrInvalidWebSocketFrame is returned when a frame from the client breaks RFC 6455.
+var ErrInvalidWebSocketFrame = errors.New("invalid WebSocket frame")
+
+// wsConn is a server side WebSocket connection. Writes are serialized so that replies to control frames
+// can be sent while events are being pushed.
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex
+}
+
+// upgradeWebSocket completes the WebSocket handshake and takes over the connection. If the request is not a
+// WebSocket handshake a 400 response is written and ErrNotWebSocket returned.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		!headerContainsToken(r.Header.Get("Connection"), "upgrade") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		http.Error(w, "Expected a WebSocket handshake", http.StatusBadRequest)
+		return nil, ErrNotWebSocket
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, errors.New("response writer does not support hijacking")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("error taking over connection: %w", err)
+	}
+
+	accept := sha1.Sum([]byte(key + websocketGUID))
+	_, err = fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(accept[:]))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error completing WebSocket handshake: %w", err)
+	}
+
+	return &wsConn{conn: conn, reader: rw.Reader}, nil
+}
+
+// headerContainsToken returns true if the comma separated header value contains the token.
+func headerContainsToken(value, token string) bool {
+	for _, part := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(part), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteText sends a text message.
+func (c *wsConn) WriteText(data []byte) error {
+	return c.writeFrame(wsOpText, data)
+}
+
+// writeFrame sends a single unfragmented frame. Frames from the server are not masked.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.conn.Write(encodeWebSocketFrame(opcode, payload))
+	return err
+}
+
+// ReadControl reads frames from the client until it closes the connection, answering pings. Data frames from
+// the client are ignored. It returns nil once the client has closed the connection cleanly. A frame that breaks the
+// protocol, such as one the client did not mask, is answered with a protocol error close frame.
+func (c *wsConn) ReadControl() error {
+	for {
+		opcode, payload, err := readClientWebSocketFrame(c.reader)
+		if errors.Is(err, ErrInvalidWebSocketFrame) {
+			c.writeFrame(wsOpClose, binary.BigEndian.AppendUint16(nil, wsCloseProtocolError))
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		switch opcode {
+		case wsOpClose:
+			c.writeFrame(wsOpClose, payload)
+			return nil
+		case wsOpPing:
+			err = c.writeFrame(wsOpPong, payload)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Close closes the connection.
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
+
+// encodeWebSocketFrame returns a final, unmasked frame holding the payload.
+func encodeWebSocketFrame(opcode byte, payload []byte) []byte {
+	frame := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	return append(frame, payload...)
+}
+
+// readWebSocketFrame reads a single frame, unmasking the payload if it is masked.
+func readWebSocketFrame(r io.Reader) (byte, []byte, error) {
+	return readCheckedWebSocketFrame(r, false)
+}
+
+// readClientWebSocketFrame reads a single frame sent by a client, which must be masked.
+func readClientWebSocketFrame(r io.Reader) (byte, []byte, error) {
+	return readCheckedWebSocketFrame(r, true)
+}
+
+// readCheckedWebSocketFrame reads a single frame, unmasking the payload if it is masked. Reserved bits must be
+// clear, as no extensions are negotiated, and control frames must be final and short.
+func readCheckedWebSocketFrame(r io.Reader, requireMask bool) (byte, []byte, error) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	final := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	size := uint64(header[1] & 0x7F)
+
+	if header[0]&0x70 != 0 {
+		return 0, nil, fmt.Errorf("%w: reserved bits set", ErrInvalidWebSocketFrame)
+	}
+	if requireMask && !masked {
+		return 0, nil, fmt.Errorf("%w: client frames must be masked", ErrInvalidWebSocketFrame)
+	}
+	if opcode >= wsOpClose && (!final || size > maxControlFramePayload) {
+		return 0, nil, fmt.Errorf("%w: control frames must be final and at most %d bytes", ErrInvalidWebSocketFrame,
+			maxControlFramePayload)
+	}
+
+	switch size {
+	case 126:
+		extended := make([]byte, 2)
+		_, err = io.ReadFull(r, extended)
+		size = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		_, err = io.ReadFull(r, extended)
+		size = binary.BigEndian.Uint64(extended)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if size > maxWebSocketFrameSize {
+		return 0, nil, fmt.Errorf("WebSocket frame too large: %d bytes", size)
+	}
+
+	var mask []byte
+	if masked {
+		mask = make([]byte, 4)
+		_, err = io.ReadFull(r, mask)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	payload := make([]byte, size)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return opcode, payload, nil
+}